@@ -76,7 +76,7 @@ func (s *Server) initKubeRegistry(args *PilotArgs) (err error) {
 	args.RegistryOptions.KubeOptions.SystemNamespace = args.Namespace
 	args.RegistryOptions.KubeOptions.MeshServiceController = s.ServiceController()
 
-	s.multiclusterController.AddHandler(kubecontroller.NewMulticluster(args.PodName,
+	mc := kubecontroller.NewMulticluster(args.PodName,
 		s.kubeClient,
 		args.RegistryOptions.ClusterRegistriesNamespace,
 		args.RegistryOptions.KubeOptions,
@@ -85,7 +85,9 @@ func (s *Server) initKubeRegistry(args *PilotArgs) (err error) {
 		args.Revision,
 		s.shouldStartNsController(),
 		s.environment.ClusterLocal(),
-		s.server))
+		s.server)
+	s.XDSServer.ResyncCABundle = mc.TriggerCABundleResync
+	s.multiclusterController.AddHandler(mc)
 
 	return
 }
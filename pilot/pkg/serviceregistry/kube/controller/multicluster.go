@@ -68,9 +68,17 @@ type Multicluster struct {
 	serviceEntryStore *serviceentry.ServiceEntryStore
 	XDSUpdater        model.XDSUpdater
 
-	m                     sync.Mutex // protects remoteKubeControllers
+	m                     sync.Mutex // protects remoteKubeControllers, namespaceControllers and remoteNamespaceClusters
 	remoteKubeControllers map[cluster.ID]*kubeController
-	clusterLocal          model.ClusterLocalProvider
+	// namespaceControllers are the namespace controllers this istiod is the leader for, by cluster.
+	namespaceControllers map[cluster.ID]*NamespaceController
+	// remoteNamespaceClusters are the remote clusters an external istiod distributes the CA bundle to, through the
+	// namespace controller of its local cluster. remoteNamespaceClustersChanged is closed, and replaced, when they
+	// change, so that the namespace controller is restarted with them.
+	remoteNamespaceClusters        map[cluster.ID]NamespaceControllerCluster
+	remoteNamespaceClustersChanged chan struct{}
+
+	clusterLocal model.ClusterLocalProvider
 
 	startNsController bool
 	caBundleWatcher   *keycertbundle.Watcher
@@ -103,16 +111,30 @@ func NewMulticluster(
 		revision:              revision,
 		XDSUpdater:            opts.XDSUpdater,
 		remoteKubeControllers: remoteKubeController,
+		namespaceControllers:  make(map[cluster.ID]*NamespaceController),
 		clusterLocal:          clusterLocal,
 		secretNamespace:       secretNamespace,
 		syncInterval:          opts.GetSyncInterval(),
 		client:                kc,
 		s:                     s,
+
+		remoteNamespaceClusters:        make(map[cluster.ID]NamespaceControllerCluster),
+		remoteNamespaceClustersChanged: make(chan struct{}),
 	}
 
 	return mc
 }
 
+// TriggerCABundleResync redistributes the CA bundle to every namespace of the clusters this istiod runs the namespace
+// controller for, such as after a root change the CA bundle watcher does not see.
+func (m *Multicluster) TriggerCABundleResync() {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, nc := range m.namespaceControllers {
+		nc.TriggerResync()
+	}
+}
+
 func (m *Multicluster) Run(stopCh <-chan struct{}) error {
 	// Wait for server shutdown.
 	<-stopCh
@@ -203,7 +225,11 @@ func (m *Multicluster) ClusterAdded(cluster *multicluster.Cluster, clusterStopCh
 	m.opts.MeshServiceController.AddRegistryAndRun(kubeRegistry, clusterStopCh)
 
 	// TODO only create namespace controller and cert patch for remote clusters (no way to tell currently)
-	if m.startNsController && (features.ExternalIstiod || localCluster) {
+	if m.startNsController && features.ExternalIstiod && !localCluster {
+		// The namespace controller of the local cluster distributes the CA bundle to the remote clusters too.
+		m.addRemoteNamespaceCluster(NewNamespaceControllerCluster(cluster.ID, client, options), clusterStopCh)
+	}
+	if m.startNsController && localCluster {
 		// Block server exit on graceful termination of the leader controller.
 		m.s.RunComponentAsyncAndWait(func(_ <-chan struct{}) error {
 			log.Infof("joining leader-election for %s in %s on cluster %s",
@@ -212,14 +238,14 @@ func (m *Multicluster) ClusterAdded(cluster *multicluster.Cluster, clusterStopCh
 				NewLeaderElection(options.SystemNamespace, m.serverID, leaderelection.NamespaceController, m.revision, client).
 				AddRunFunction(func(leaderStop <-chan struct{}) {
 					log.Infof("starting namespace controller for cluster %s", cluster.ID)
-					nc := NewNamespaceController(client, m.caBundleWatcher, options)
+					local := NewNamespaceControllerCluster(cluster.ID, client, options)
 					// Start informers again. This fixes the case where informers for namespace do not start,
 					// as we create them only after acquiring the leader lock
 					// Note: stop here should be the overall pilot stop, NOT the leader election stop. We are
 					// basically lazy loading the informer, if we stop it when we lose the lock we will never
 					// recreate it again.
 					client.RunAndWait(clusterStopCh)
-					nc.Run(leaderStop)
+					m.runNamespaceController(local, options, leaderStop)
 				}).Run(clusterStopCh)
 			return nil
 		})
@@ -305,6 +331,10 @@ func (m *Multicluster) ClusterDeleted(clusterID cluster.ID) error {
 		log.Warnf("failed cleaning up services in %s: %v", clusterID, err)
 	}
 	delete(m.remoteKubeControllers, clusterID)
+	if _, ok := m.remoteNamespaceClusters[clusterID]; ok {
+		delete(m.remoteNamespaceClusters, clusterID)
+		m.notifyRemoteNamespaceClustersChanged()
+	}
 	if m.XDSUpdater != nil {
 		m.XDSUpdater.ConfigUpdate(&model.PushRequest{Full: true, Reason: []model.TriggerReason{model.ClusterUpdate}})
 	}
@@ -312,6 +342,74 @@ func (m *Multicluster) ClusterDeleted(clusterID cluster.ID) error {
 	return nil
 }
 
+// addRemoteNamespaceCluster adds a remote cluster to the namespace controller of the local cluster.
+func (m *Multicluster) addRemoteNamespaceCluster(cl NamespaceControllerCluster, clusterStopCh <-chan struct{}) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.closing {
+		return
+	}
+	select {
+	case <-clusterStopCh:
+		// The cluster was removed before it could be added.
+		return
+	default:
+	}
+	m.remoteNamespaceClusters[cl.ID] = cl
+	m.notifyRemoteNamespaceClustersChanged()
+}
+
+// notifyRemoteNamespaceClustersChanged wakes up the namespace controller of the local cluster, so that it restarts
+// with the current remote clusters. m.m must be held.
+func (m *Multicluster) notifyRemoteNamespaceClustersChanged() {
+	close(m.remoteNamespaceClustersChanged)
+	m.remoteNamespaceClustersChanged = make(chan struct{})
+}
+
+// runNamespaceController runs the namespace controller of the local cluster, and of the remote clusters of an external
+// istiod, until leaderStop is closed. It is restarted whenever the remote clusters change.
+func (m *Multicluster) runNamespaceController(local NamespaceControllerCluster, options Options, leaderStop <-chan struct{}) {
+	for {
+		m.m.Lock()
+		clusters := []NamespaceControllerCluster{local}
+		for _, cl := range m.remoteNamespaceClusters {
+			clusters = append(clusters, cl)
+		}
+		changed := m.remoteNamespaceClustersChanged
+		m.m.Unlock()
+
+		nc, err := NewMultiClusterNamespaceController(clusters, m.caBundleWatcher, options, NamespaceControllerOptions{})
+		if err != nil {
+			log.Errorf("failed creating namespace controller for cluster %s: %v", local.ID, err)
+			return
+		}
+		stop := make(chan struct{})
+		go func() {
+			select {
+			case <-leaderStop:
+			case <-changed:
+			}
+			close(stop)
+		}()
+		m.m.Lock()
+		m.namespaceControllers[local.ID] = nc
+		m.m.Unlock()
+		nc.Run(stop)
+		m.m.Lock()
+		delete(m.namespaceControllers, local.ID)
+		m.m.Unlock()
+
+		// stop is closed on losing the lead or on a change of the remote clusters.
+		<-stop
+		select {
+		case <-leaderStop:
+			return
+		default:
+		}
+		log.Infof("remote clusters changed, restarting namespace controller for cluster %s", local.ID)
+	}
+}
+
 func createConfigStore(client kubelib.Client, revision string, opts Options) (model.ConfigStoreCache, error) {
 	log.Infof("Creating WorkloadEntry only config store for %s", opts.ClusterID)
 	workloadEntriesSchemas := collection.NewSchemasBuilder().
@@ -28,6 +28,7 @@ import (
 	"istio.io/istio/pilot/pkg/keycertbundle"
 	"istio.io/istio/pilot/pkg/server"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/kube/multicluster"
@@ -217,3 +218,79 @@ func Test_KubeSecretController_ExternalIstiod_MultipleClusters(t *testing.T) {
 	// Test - Verify that the remote controller has been removed.
 	verifyControllers(t, mc, 1, "delete remote controller 2")
 }
+
+func Test_KubeSecretController_ExternalIstiod_NamespaceController(t *testing.T) {
+	externalIstiod := features.ExternalIstiod
+	webhookName := features.InjectionWebhookConfigName
+	prioritizedLeaderElection := features.PrioritizedLeaderElection
+	features.ExternalIstiod = true
+	features.InjectionWebhookConfigName = ""
+	// The default revision watcher of a prioritized leader election outlives the test.
+	features.PrioritizedLeaderElection = false
+	defer func() {
+		features.ExternalIstiod = externalIstiod
+		features.InjectionWebhookConfigName = webhookName
+		features.PrioritizedLeaderElection = prioritizedLeaderElection
+	}()
+	clientset := kube.NewFakeClient()
+	remote := kube.NewFakeClient()
+	multicluster.BuildClientsFromConfig = func(kubeConfig []byte) (kube.Client, error) {
+		return remote, nil
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	s := server.New()
+	caBundle := []byte("caBundle")
+	certWatcher := keycertbundle.NewWatcher()
+	certWatcher.SetAndNotify(nil, nil, caBundle)
+	mc := NewMulticluster(
+		"pilot-abc-123",
+		clientset,
+		testSecretNameSpace,
+		Options{
+			ClusterID:             "cluster-1",
+			DomainSuffix:          DomainSuffix,
+			ResyncPeriod:          ResyncPeriod,
+			SyncInterval:          time.Microsecond,
+			MeshWatcher:           mesh.NewFixedWatcher(&meshconfig.MeshConfig{}),
+			MeshServiceController: mockserviceController,
+		}, nil, certWatcher, "default", true, nil, s)
+	initController(clientset, testSecretNameSpace, stop, mc)
+	clientset.RunAndWait(stop)
+	_ = s.Start(stop)
+	go func() {
+		_ = mc.Run(stop)
+	}()
+	go mockserviceController.Run(stop)
+	verifyControllers(t, mc, 1, "registered local cluster controller")
+
+	if err := createMultiClusterSecret(clientset, "test-secret-1", "test-remote-cluster-1"); err != nil {
+		t.Fatalf("Unexpected error on secret create: %v", err)
+	}
+	verifyControllers(t, mc, 2, "create remote controller")
+
+	// The namespace controller of the local cluster distributes the CA bundle to the remote cluster.
+	remote.RunAndWait(stop)
+	createNamespace(t, remote, "foo", nil)
+	expectConfigMap(t, remote.KubeInformer().Core().V1().ConfigMaps().Lister(), CACertNamespaceConfigMap, "foo",
+		map[string]string{constants.CACertNamespaceConfigMapDataName: string(caBundle)})
+	retry.UntilOrFail(t, func() bool {
+		mc.m.Lock()
+		defer mc.m.Unlock()
+		nc := mc.namespaceControllers["cluster-1"]
+		return len(mc.namespaceControllers) == 1 && nc != nil && len(nc.remotes) == 1
+	}, retry.Message("expected a single namespace controller for both clusters"))
+
+	if err := deleteMultiClusterSecret(clientset, "test-secret-1"); err != nil {
+		t.Fatalf("Unexpected error on secret delete: %v", err)
+	}
+	verifyControllers(t, mc, 1, "delete remote controller")
+	retry.UntilOrFail(t, func() bool {
+		mc.m.Lock()
+		defer mc.m.Unlock()
+		nc := mc.namespaceControllers["cluster-1"]
+		return nc != nil && len(nc.remotes) == 0
+	}, retry.Message("expected the namespace controller to be restarted without the remote cluster"))
+}
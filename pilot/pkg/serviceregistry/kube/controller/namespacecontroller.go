@@ -15,7 +15,24 @@
 package controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	ocprom "contrib.go.opencensus.io/exporter/prometheus"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -24,25 +41,74 @@ import (
 
 	"istio.io/istio/pilot/pkg/keycertbundle"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller/filter"
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/cluster"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/kube/controllers"
 	"istio.io/istio/pkg/kube/inject"
 	"istio.io/istio/security/pkg/k8s"
+	"istio.io/pkg/monitoring"
 )
 
 const (
 	// CACertNamespaceConfigMap is the name of the ConfigMap in each namespace storing the root cert of non-Kube CA.
 	CACertNamespaceConfigMap = "istio-ca-root-cert"
+
+	// defaultMaxCABundleSize is the maximum size of a ConfigMap accepted by the apiserver.
+	defaultMaxCABundleSize = 1024 * 1024
+
+	// maxRetries is the number of times a namespace will be retried before it is dropped out of the queue.
+	maxRetries = 5
+
+	// auditSampleSize is the number of namespaces checked on each audit.
+	auditSampleSize = 20
+
+	// defaultReconcileBatchPause is the pause between batches of a CA bundle sweep, if batching is enabled.
+	defaultReconcileBatchPause = 100 * time.Millisecond
+
+	// caBundlePollInterval is how often WaitForCABundle checks the configmap.
+	caBundlePollInterval = 100 * time.Millisecond
+)
+
+var (
+	driftReasonTag = monitoring.MustCreateLabel("reason")
+
+	caDistributionDrift = monitoring.NewSum(
+		"ca_distribution_drift_total",
+		"Number of CA root configmaps found by the audit to differ from the current CA bundle.",
+		monitoring.WithLabels(driftReasonTag),
+	)
+
+	caBundleWatcherSignals = monitoring.NewSum(
+		"ca_bundle_watcher_signals_total",
+		"Number of CA bundle change signals received by the namespace controller.",
+	)
+
+	caBundleSweepDuration = monitoring.NewDistribution(
+		"ca_bundle_sweep_duration_seconds",
+		"Time in seconds the namespace controller takes to enqueue every member namespace on a CA bundle change.",
+		[]float64{.001, .01, .1, .5, 1, 5, 10},
+	)
 )
 
+func init() {
+	monitoring.MustRegister(caDistributionDrift, caBundleWatcherSignals, caBundleSweepDuration)
+}
+
 var configMapLabel = map[string]string{"istio.io/config": "true"}
 
 // NamespaceController manages reconciles a configmap in each namespace with a desired set of data.
 type NamespaceController struct {
+	clusterID       cluster.ID
 	client          corev1.CoreV1Interface
 	caBundleWatcher *keycertbundle.Watcher
 
+	// remotes are the controllers of the other clusters of a multi-cluster controller. They are run, swept and
+	// suppressed along with this one, which alone watches the CA bundle.
+	remotes []*NamespaceController
+
 	queue              controllers.Queue
 	namespacesInformer cache.SharedInformer
 	configMapInformer  cache.SharedInformer
@@ -50,6 +116,132 @@ type NamespaceController struct {
 	configmapLister    listerv1.ConfigMapLister
 
 	namespaceFilter filter.DiscoveryNamespacesFilter
+
+	// setOwnerReference makes the namespace the owner of the configmaps we write.
+	setOwnerReference bool
+
+	// manageOnlyOwned leaves configmaps without the reserved label untouched.
+	manageOnlyOwned bool
+
+	// httpAddr is the address of the optional health and metrics server.
+	httpAddr string
+
+	maxCABundleSize int
+	caRootDataKey   string
+
+	// options are passed to DesiredCARootConfigMap on every reconcile.
+	options NamespaceControllerOptions
+
+	// excludeNamespace returns true for namespaces that are never written to.
+	excludeNamespace func(ns string) bool
+
+	// suppressed are namespaces removed from distribution at runtime by Suppress, or by labeling them with
+	// constants.CARootSuppressedLabel. Reconciles hold a read lock while they write.
+	suppressedMu sync.RWMutex
+	suppressed   sets.Set
+
+	// liveClient reads configmaps from the apiserver, bypassing the informer cache, for the audit.
+	liveClient    corev1.CoreV1Interface
+	auditInterval time.Duration
+
+	// onReconcile is called after each reconcile.
+	onReconcile func(ns string, err error)
+
+	// reconcileBatchSize and reconcileBatchPause batch the namespaces a CA bundle sweep enqueues. after is replaced
+	// in tests.
+	reconcileBatchSize  int
+	reconcileBatchPause time.Duration
+	after               func(time.Duration) <-chan time.Time
+
+	// written holds the hash of the CA bundle last written to, or found in, the configmap of each namespace, so that
+	// sweeps skip namespaces whose bundle has not changed without reading the configmap. Entries are dropped when the
+	// configmap informer observes the configmap deleted or holding another bundle, and on changes to the namespace.
+	// Without a configmap informer, nothing would drop them, so they are not used.
+	writtenMu sync.Mutex
+	written   map[string][sha256.Size]byte
+
+	// resyncCh holds a pending TriggerResync. It is buffered, so that triggers received while a sweep is in
+	// progress are coalesced into the next one.
+	resyncCh chan struct{}
+}
+
+// NamespaceControllerOptions configure how the NamespaceController distributes the CA bundle. The zero value
+// distributes the mesh CA bundle, as is, to every member namespace.
+type NamespaceControllerOptions struct {
+	// SetOwnerReference, if true, makes the NamespaceController set an owner reference to the Namespace
+	// on the root cert ConfigMaps it manages, so they are garbage collected with the namespace.
+	SetOwnerReference bool
+
+	// HTTPAddr, if set, makes the NamespaceController serve /healthz, /readyz and /metrics on this address. This is
+	// meant for running the controller standalone, outside of istiod.
+	HTTPAddr string
+
+	// MaxCABundleSize is the largest CA bundle, in bytes, that the NamespaceController will write to a ConfigMap.
+	// Larger bundles are not written. Defaults to the 1MiB ConfigMap size limit.
+	MaxCABundleSize int
+
+	// DeduplicateCABundle makes the NamespaceController drop repeated certificates from the CA bundle before writing it.
+	DeduplicateCABundle bool
+
+	// CARootDataKey is the ConfigMap data key the NamespaceController stores the CA bundle under.
+	// Defaults to root-cert.pem.
+	CARootDataKey string
+
+	// NamespaceExclusionPredicate returns true for namespaces the NamespaceController must not write the CA bundle to.
+	// Defaults to the special Kubernetes system namespaces that are never injected.
+	NamespaceExclusionPredicate func(ns string) bool
+
+	// AuditInterval, if set, makes the NamespaceController periodically read a random sample of the CA root ConfigMaps
+	// directly from the apiserver and report any that differ from the current CA bundle. Drift is only reported;
+	// it is left to the reconcile path to fix.
+	AuditInterval time.Duration
+
+	// OnReconcile, if set, is called after the NamespaceController reconciles the CA root ConfigMap of a namespace,
+	// with the namespace and the result of the reconcile. It is called in its own goroutine so that it never blocks
+	// the queue; calls may run concurrently and arrive out of order.
+	OnReconcile func(ns string, err error)
+
+	// PerNamespaceExtraRoots, if set, returns additional trust anchors for the CA root ConfigMap of a namespace,
+	// such as a regional CA in a federated mesh. They are appended to the mesh CA bundle, which is always included.
+	// It is called on every reconcile, so changes are picked up the next time the namespace is reconciled.
+	PerNamespaceExtraRoots func(ns string) []byte
+
+	// ReconcileBatchSize, if positive, makes the NamespaceController enqueue the namespaces of a CA bundle change in
+	// batches of this many namespaces, pausing for ReconcileBatchPause between batches, so that a rotation across
+	// thousands of namespaces does not get rate limited by the apiserver. Zero disables batching.
+	ReconcileBatchSize int
+
+	// ReconcileBatchPause is the pause between batches of ReconcileBatchSize. Defaults to 100ms.
+	ReconcileBatchPause time.Duration
+
+	// BundleTransform, if set, rewrites the CA bundle of each namespace before the NamespaceController writes it,
+	// such as to reorder or normalize the PEM blocks for trust stores that require it. If it fails, the write is
+	// skipped until the namespace is next reconciled.
+	BundleTransform func([]byte) ([]byte, error)
+
+	// ManageOnlyOwned makes the NamespaceController only write the CA root ConfigMaps that carry its reserved
+	// istio.io/config label, such as those it created, and leave pre-existing foreign ConfigMaps untouched.
+	ManageOnlyOwned bool
+}
+
+// NamespaceControllerListers are the caches the NamespaceController reads from. NewNamespaceController builds
+// them from the informer factory of a kube.Client.
+type NamespaceControllerListers struct {
+	NamespaceLister listerv1.NamespaceLister
+	ConfigMapLister listerv1.ConfigMapLister
+
+	// NamespaceInformer and ConfigMapInformer, if set, trigger reconciles on changes, and are waited on to sync by
+	// Run. Without them, namespaces are only reconciled on CA bundle and mesh config changes.
+	NamespaceInformer cache.SharedInformer
+	ConfigMapInformer cache.SharedInformer
+}
+
+// NamespaceControllerCluster is a cluster a multi-cluster NamespaceController distributes the CA bundle to.
+type NamespaceControllerCluster struct {
+	ID              cluster.ID
+	Client          corev1.CoreV1Interface
+	Listers         NamespaceControllerListers
+	NamespaceFilter filter.DiscoveryNamespacesFilter
 }
 
 // NewNamespaceController returns a pointer to a newly constructed NamespaceController instance.
@@ -57,45 +249,189 @@ func NewNamespaceController(
 	kubeClient kube.Client,
 	caBundleWatcher *keycertbundle.Watcher,
 	options Options,
+	ncOptions NamespaceControllerOptions,
 ) *NamespaceController {
-	c := &NamespaceController{
-		client:          kubeClient.CoreV1(),
-		caBundleWatcher: caBundleWatcher,
+	cl := NewNamespaceControllerCluster(options.ClusterID, kubeClient, options)
+	return NewNamespaceControllerWithListers(cl.Client, caBundleWatcher, cl.Listers, cl.NamespaceFilter, options, ncOptions)
+}
+
+// NewNamespaceControllerCluster returns the NamespaceControllerCluster of a kube.Client, which reads from the
+// informers of its informer factory.
+func NewNamespaceControllerCluster(id cluster.ID, kubeClient kube.Client, options Options) NamespaceControllerCluster {
+	listers := NamespaceControllerListers{
+		NamespaceLister:   kubeClient.KubeInformer().Core().V1().Namespaces().Lister(),
+		ConfigMapLister:   kubeClient.KubeInformer().Core().V1().ConfigMaps().Lister(),
+		NamespaceInformer: kubeClient.KubeInformer().Core().V1().Namespaces().Informer(),
+		ConfigMapInformer: kubeClient.KubeInformer().Core().V1().ConfigMaps().Informer(),
+	}
+	return NamespaceControllerCluster{
+		ID:              id,
+		Client:          kubeClient.CoreV1(),
+		Listers:         listers,
+		NamespaceFilter: filter.NewDiscoveryNamespacesFilter(listers.NamespaceLister, options.MeshWatcher.Mesh().NamespaceSelectors),
+	}
+}
+
+// NewMultiClusterNamespaceController returns a NamespaceController that distributes the CA bundle to each of the
+// clusters, such as the primary and remote clusters of a primary-remote mesh. Each cluster is reconciled through its
+// own client, listers and namespace filter, and every change to the CA bundle is swept across all of them. The
+// health endpoints and WaitForCABundle are served for the first cluster; ncOptions.HTTPAddr only applies to it. It returns an error if no clusters are given.
+func NewMultiClusterNamespaceController(
+	clusters []NamespaceControllerCluster,
+	caBundleWatcher *keycertbundle.Watcher,
+	options Options,
+	ncOptions NamespaceControllerOptions,
+) (*NamespaceController, error) {
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters to distribute the CA bundle to")
 	}
-	c.queue = controllers.NewQueue("namespace controller", controllers.WithReconciler(c.insertDataForNamespace))
+	var nc *NamespaceController
+	for i, cl := range clusters {
+		opts, ncOpts := options, ncOptions
+		opts.ClusterID = cl.ID
+		if i > 0 {
+			ncOpts.HTTPAddr = ""
+		}
+		c := NewNamespaceControllerWithListers(cl.Client, caBundleWatcher, cl.Listers, cl.NamespaceFilter, opts, ncOpts)
+		if nc == nil {
+			nc = c
+			continue
+		}
+		nc.remotes = append(nc.remotes, c)
+	}
+	return nc, nil
+}
 
-	c.configMapInformer = kubeClient.KubeInformer().Core().V1().ConfigMaps().Informer()
-	c.configmapLister = kubeClient.KubeInformer().Core().V1().ConfigMaps().Lister()
-	c.namespacesInformer = kubeClient.KubeInformer().Core().V1().Namespaces().Informer()
-	c.namespaceLister = kubeClient.KubeInformer().Core().V1().Namespaces().Lister()
+// NewNamespaceControllerWithListers returns a NamespaceController that writes through the client and reads from
+// the given listers, rather than from the informers of a kube.Client. This allows tests to inject hand-built
+// listers. options.MeshWatcher may be nil, in which case namespace selector changes are not watched.
+func NewNamespaceControllerWithListers(
+	client corev1.CoreV1Interface,
+	caBundleWatcher *keycertbundle.Watcher,
+	listers NamespaceControllerListers,
+	namespaceFilter filter.DiscoveryNamespacesFilter,
+	options Options,
+	ncOptions NamespaceControllerOptions,
+) *NamespaceController {
+	c := &NamespaceController{
+		clusterID:           options.ClusterID,
+		client:              client,
+		caBundleWatcher:     caBundleWatcher,
+		namespacesInformer:  listers.NamespaceInformer,
+		configMapInformer:   listers.ConfigMapInformer,
+		namespaceLister:     listers.NamespaceLister,
+		configmapLister:     listers.ConfigMapLister,
+		namespaceFilter:     namespaceFilter,
+		setOwnerReference:   ncOptions.SetOwnerReference,
+		manageOnlyOwned:     ncOptions.ManageOnlyOwned,
+		httpAddr:            ncOptions.HTTPAddr,
+		maxCABundleSize:     ncOptions.MaxCABundleSize,
+		caRootDataKey:       caRootDataKey(ncOptions),
+		options:             ncOptions,
+		excludeNamespace:    ncOptions.NamespaceExclusionPredicate,
+		suppressed:          sets.NewSet(),
+		written:             map[string][sha256.Size]byte{},
+		liveClient:          client,
+		auditInterval:       ncOptions.AuditInterval,
+		onReconcile:         ncOptions.OnReconcile,
+		reconcileBatchSize:  ncOptions.ReconcileBatchSize,
+		reconcileBatchPause: ncOptions.ReconcileBatchPause,
+		after:               time.After,
+		resyncCh:            make(chan struct{}, 1),
+	}
+	if c.reconcileBatchPause <= 0 {
+		c.reconcileBatchPause = defaultReconcileBatchPause
+	}
+	if c.excludeNamespace == nil {
+		c.excludeNamespace = inject.IgnoredNamespaces.Contains
+	}
+	if c.maxCABundleSize <= 0 {
+		c.maxCABundleSize = defaultMaxCABundleSize
+	}
+	c.queue = controllers.NewQueue("namespace controller",
+		controllers.WithReconciler(c.reconcile),
+		controllers.WithMaxAttempts(maxRetries))
 
-	c.namespaceFilter = filter.NewDiscoveryNamespacesFilter(c.namespaceLister, options.MeshWatcher.Mesh().NamespaceSelectors)
+	if c.configMapInformer != nil {
+		c.registerConfigMapHandler()
+	}
+	if c.namespacesInformer != nil {
+		c.registerNamespaceHandler()
+	}
+	if options.MeshWatcher != nil {
+		c.initMeshWatcherHandler(options.MeshWatcher, c.namespaceFilter)
+	}
+	return c
+}
 
-	c.configMapInformer.AddEventHandler(controllers.FilteredObjectSpecHandler(c.queue.AddObject, func(o controllers.Object) bool {
+// registerConfigMapHandler reconciles the namespace of the CA root configmap on changes to it, and drops the hash of
+// the last write to the namespace when the configmap no longer holds it.
+func (nc *NamespaceController) registerConfigMapHandler() {
+	nc.configMapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			nc.observeConfigMap(obj, false)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			nc.observeConfigMap(obj, false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			nc.observeConfigMap(obj, true)
+		},
+	})
+	nc.configMapInformer.AddEventHandler(controllers.FilteredObjectSpecHandler(nc.queue.AddObject, func(o controllers.Object) bool {
 		if o.GetName() != CACertNamespaceConfigMap {
 			// This is a change to a configmap we don't watch, ignore it
 			return false
 		}
-		if inject.IgnoredNamespaces.Contains(o.GetNamespace()) {
-			// skip special kubernetes system namespaces
+		if nc.skipNamespace(o.GetNamespace()) {
+			// skip excluded namespaces, by default the special kubernetes system namespaces, and suppressed namespaces
 			return false
 		}
-		return c.namespaceFilter.Filter(o)
+		return nc.namespaceFilter.Filter(o)
 	}))
+}
+
+// observeConfigMap forgets the last write to the namespace of a CA root configmap that was deleted, or edited by
+// someone else to hold another bundle. Our own writes hold the bundle whose hash was recorded.
+func (nc *NamespaceController) observeConfigMap(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok || cm.Name != CACertNamespaceConfigMap {
+		return
+	}
+	if deleted || sha256.Sum256([]byte(cm.Data[nc.caRootDataKey])) != nc.writtenHash(cm.Namespace) {
+		nc.forgetWritten(cm.Namespace)
+	}
+}
 
-	c.namespacesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+// registerNamespaceHandler keeps the namespace filter in sync, and reconciles namespaces as they are selected.
+func (nc *NamespaceController) registerNamespaceHandler() {
+	nc.namespacesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			ns := obj.(*v1.Namespace)
-			if c.namespaceFilter.NamespaceCreated(ns.ObjectMeta) {
-				c.namespaceChange(ns)
+			// A namespace may be recreated under the name of one we wrote to.
+			nc.forgetWritten(ns.Name)
+			if nc.namespaceFilter.NamespaceCreated(ns.ObjectMeta) {
+				nc.namespaceChange(ns)
 			}
 		},
 		UpdateFunc: func(old, new interface{}) {
 			oldNs := old.(*v1.Namespace)
 			newNs := new.(*v1.Namespace)
-			membershipChanged, namespaceAdded := c.namespaceFilter.NamespaceUpdated(oldNs.ObjectMeta, newNs.ObjectMeta)
+			membershipChanged, namespaceAdded := nc.namespaceFilter.NamespaceUpdated(oldNs.ObjectMeta, newNs.ObjectMeta)
 			if membershipChanged && namespaceAdded {
-				c.namespaceChange(newNs)
+				nc.namespaceChange(newNs)
+			}
+			switch oldSuppressed, newSuppressed := suppressionRequested(oldNs), suppressionRequested(newNs); {
+			case newSuppressed && !oldSuppressed:
+				// The reconcile deletes the configmap, once writes in flight are done.
+				if !nc.excludeNamespace(newNs.Name) {
+					nc.queue.Add(types.NamespacedName{Name: newNs.Name})
+				}
+			case oldSuppressed && !newSuppressed:
+				nc.unsuppress(newNs.Name)
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -113,61 +449,695 @@ func NewNamespaceController(
 					return
 				}
 			}
-			c.namespaceFilter.NamespaceDeleted(ns.ObjectMeta)
+			nc.forgetWritten(ns.Name)
+			nc.namespaceFilter.NamespaceDeleted(ns.ObjectMeta)
 		},
 	})
-
-	c.initMeshWatcherHandler(options.MeshWatcher, c.namespaceFilter)
-	return c
 }
 
 // Run starts the NamespaceController until a value is sent to stopCh.
 func (nc *NamespaceController) Run(stopCh <-chan struct{}) {
-	if !cache.WaitForCacheSync(stopCh, nc.namespacesInformer.HasSynced, nc.configMapInformer.HasSynced) {
-		log.Error("Failed to sync namespace controller cache")
-		return
+	if nc.httpAddr != "" {
+		go nc.serveHTTP(stopCh)
+	}
+	for _, c := range nc.clusters() {
+		var synced []cache.InformerSynced
+		for _, informer := range []cache.SharedInformer{c.namespacesInformer, c.configMapInformer} {
+			if informer != nil {
+				synced = append(synced, informer.HasSynced)
+			}
+		}
+		if !cache.WaitForCacheSync(stopCh, synced...) {
+			log.Errorf("Failed to sync namespace controller cache for cluster %s", c.clusterID)
+			return
+		}
 	}
 	go nc.startCaBundleWatcher(stopCh)
+	for _, c := range nc.clusters() {
+		if c.auditInterval > 0 {
+			go c.startAudit(stopCh)
+		}
+	}
+	for _, r := range nc.remotes {
+		go r.queue.Run(stopCh)
+	}
 	nc.queue.Run(stopCh)
 }
 
+// clusters returns the controllers of every cluster the CA bundle is distributed to, starting with this one.
+func (nc *NamespaceController) clusters() []*NamespaceController {
+	return append([]*NamespaceController{nc}, nc.remotes...)
+}
+
+// Resync rebuilds the set of member namespaces from the namespace lister, in case it has diverged from the
+// namespaces that exist, such as after an apiserver reconnect. Namespaces that were missing from the set are
+// reconciled; those that no longer exist are pruned from it. Every cluster of a multi-cluster controller is resynced.
+func (nc *NamespaceController) Resync() error {
+	var errs *multierror.Error
+	for _, c := range nc.clusters() {
+		if err := c.resync(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (nc *NamespaceController) resync() error {
+	before := nc.namespaceFilter.GetMembers()
+	if err := nc.namespaceFilter.SyncNamespaces(); err != nil {
+		if nc.clusterID != "" {
+			return fmt.Errorf("failed to resync namespaces of cluster %s: %v", nc.clusterID, err)
+		}
+		return fmt.Errorf("failed to resync namespaces: %v", err)
+	}
+	after := nc.namespaceFilter.GetMembers()
+	added, pruned := after.Difference(before).List(), before.Difference(after).List()
+	if len(added) > 0 || len(pruned) > 0 {
+		log.Infof("namespace controller resync added namespaces %v and pruned namespaces %v", added, pruned)
+	}
+	for _, ns := range added {
+		nc.syncNamespace(ns)
+	}
+	return nil
+}
+
+// HasSynced returns true once the informers have synced and the initial set of namespaces has been processed, in
+// every cluster.
+func (nc *NamespaceController) HasSynced() bool {
+	for _, c := range nc.clusters() {
+		if !c.queue.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// httpHandler returns the handler for the health and metrics endpoints.
+func (nc *NamespaceController) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if !nc.HasSynced() {
+			http.Error(w, "not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !nc.HasSynced() {
+			http.Error(w, "not synced", http.StatusServiceUnavailable)
+			return
+		}
+		if len(nc.caBundleWatcher.GetCABundle()) == 0 {
+			http.Error(w, "no CA bundle", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	if h := metricsHandler(); h != nil {
+		mux.Handle("/metrics", h)
+	}
+	return mux
+}
+
+var (
+	metricsHandlerOnce sync.Once
+	metricsHandlerImpl http.Handler
+)
+
+// metricsHandler returns the handler serving the metrics of the namespace controller, or nil if it could not be
+// set up. The exporter reads every view in the process, so it is created once and its output is limited to the
+// namespace controller's own metrics.
+func metricsHandler() http.Handler {
+	metricsHandlerOnce.Do(func() {
+		// Use a dedicated registry, so we don't conflict with the exporter istiod registers on the default one.
+		registry := prometheus.NewRegistry()
+		if _, err := ocprom.NewExporter(ocprom.Options{Registry: registry}); err != nil {
+			log.Errorf("could not set up prometheus exporter for namespace controller: %v", err)
+			return
+		}
+		names := sets.NewSet(caDistributionDrift.Name(), caBundleWatcherSignals.Name(), caBundleSweepDuration.Name())
+		gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			families, err := registry.Gather()
+			out := make([]*dto.MetricFamily, 0, len(families))
+			for _, f := range families {
+				if names.Contains(f.GetName()) {
+					out = append(out, f)
+				}
+			}
+			return out, err
+		})
+		metricsHandlerImpl = promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	})
+	return metricsHandlerImpl
+}
+
+// serveHTTP serves the health and metrics endpoints until stop is closed.
+func (nc *NamespaceController) serveHTTP(stop <-chan struct{}) {
+	server := &http.Server{
+		Addr:        nc.httpAddr,
+		Handler:     nc.httpHandler(),
+		IdleTimeout: 90 * time.Second,
+		ReadTimeout: 30 * time.Second,
+	}
+	go func() {
+		<-stop
+		if err := server.Close(); err != nil {
+			log.Warnf("failed to close namespace controller http server: %v", err)
+		}
+	}()
+	log.Infof("starting namespace controller http server on %s", nc.httpAddr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("namespace controller http server failed: %v", err)
+	}
+}
+
+// TriggerResync redistributes the CA bundle to every member namespace, through the same sweep as a change signaled
+// by the CA bundle watcher. It is for changes the watcher does not see, and is called by istiod's
+// /debug/ca_bundle_resync endpoint. It does not block; triggers received while a sweep is pending are coalesced into
+// it.
+func (nc *NamespaceController) TriggerResync() {
+	select {
+	case nc.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
+// WaitForCABundle waits until the CA root configmap of the namespace holds the expected bundle, or the context
+// expires. The configmap is read from the lister, falling back to the apiserver when the lister has not caught up.
+func (nc *NamespaceController) WaitForCABundle(ctx context.Context, ns string, expected []byte) error {
+	ticker := time.NewTicker(caBundlePollInterval)
+	defer ticker.Stop()
+	for {
+		found, err := nc.hasCABundle(ctx, ns, expected)
+		if found {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("configmap %s in namespace %s does not hold the expected CA bundle: %v (last error: %v)",
+					CACertNamespaceConfigMap, ns, ctx.Err(), err)
+			}
+			return fmt.Errorf("configmap %s in namespace %s does not hold the expected CA bundle: %v",
+				CACertNamespaceConfigMap, ns, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// hasCABundle reports whether the CA root configmap of the namespace holds the bundle, in the lister or else in the
+// apiserver.
+func (nc *NamespaceController) hasCABundle(ctx context.Context, ns string, bundle []byte) (bool, error) {
+	cm, err := nc.configmapLister.ConfigMaps(ns).Get(CACertNamespaceConfigMap)
+	if err == nil && cm.Data[nc.caRootDataKey] == string(bundle) {
+		return true, nil
+	}
+	cm, err = nc.liveClient.ConfigMaps(ns).Get(ctx, CACertNamespaceConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return cm.Data[nc.caRootDataKey] == string(bundle), nil
+}
+
 // startCaBundleWatcher listens for updates to the CA bundle and update cm in each namespace
 func (nc *NamespaceController) startCaBundleWatcher(stop <-chan struct{}) {
 	id, watchCh := nc.caBundleWatcher.AddWatcher()
 	defer nc.caBundleWatcher.RemoveWatcher(id)
+	nc.watchCABundle(watchCh, stop)
+}
+
+// watchCABundle updates the cm in each namespace on every signal of watchCh, until watchCh or stop is closed.
+func (nc *NamespaceController) watchCABundle(watchCh <-chan struct{}, stop <-chan struct{}) {
 	for {
 		select {
-		case <-watchCh:
-			namespaceList := nc.namespaceFilter.GetMembers().List()
-			for _, nsName := range namespaceList {
-				ns, err := nc.namespaceLister.Get(nsName)
-				if err != nil {
-					log.Errorf("Failed to get namespace %s", nsName)
-					continue
-				}
-				nc.namespaceChange(ns)
+		case _, ok := <-watchCh:
+			if !ok {
+				// The watcher has been shut down; reading from the closed channel would spin forever.
+				log.Warnf("CA bundle watcher channel closed, stopping CA bundle watch for namespace controller")
+				return
 			}
+			caBundleWatcherSignals.Increment()
+			nc.timedSweep(stop)
+		case <-nc.resyncCh:
+			nc.timedSweep(stop)
 		case <-stop:
 			return
 		}
 	}
 }
 
+// timedSweep sweeps the member namespaces of every cluster, recording how long the sweep took.
+func (nc *NamespaceController) timedSweep(stop <-chan struct{}) {
+	start := time.Now()
+	for _, c := range nc.clusters() {
+		c.sweepNamespaces(stop)
+	}
+	caBundleSweepDuration.Record(time.Since(start).Seconds())
+}
+
+// sweepNamespaces enqueues every member namespace after a CA bundle change. Namespaces the lister fails to return
+// are retried once after the others, so that a transient error does not leave them with the old bundle; those that
+// still fail are handed to the queue by name, which looks them up again and retries with backoff. The namespaces are
+// synced in name order, including those found on the retry, so that sweeps and their batches are reproducible. It
+// returns the number of namespaces that were looked up and enqueued, and the number that failed after the retry. A
+// batched sweep stops enqueuing once stop is closed.
+func (nc *NamespaceController) sweepNamespaces(stop <-chan struct{}) (succeeded, failed int) {
+	var found []*v1.Namespace
+	var retries []string
+	// List returns the members sorted.
+	for _, nsName := range nc.namespaceFilter.GetMembers().List() {
+		ns, err := nc.namespaceLister.Get(nsName)
+		if err != nil {
+			retries = append(retries, nsName)
+			continue
+		}
+		found = append(found, ns)
+		succeeded++
+	}
+	if len(retries) == 0 {
+		nc.syncSwept(found, stop)
+		return succeeded, 0
+	}
+	var lastErr error
+	for _, nsName := range retries {
+		ns, err := nc.namespaceLister.Get(nsName)
+		if err != nil {
+			lastErr = err
+			failed++
+			nc.syncNamespace(nsName)
+			continue
+		}
+		found = append(found, ns)
+		succeeded++
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Name < found[j].Name
+	})
+	nc.syncSwept(found, stop)
+	if failed > 0 {
+		log.Warnf("CA bundle sweep: %d namespaces succeeded, %d failed after retry and were left to the queue: %v",
+			succeeded, failed, lastErr)
+	} else {
+		log.Infof("CA bundle sweep: %d namespaces succeeded, %d of them after retry", succeeded, len(retries))
+	}
+	return succeeded, failed
+}
+
+// syncSwept hands the namespaces found by a sweep to the queue. With a reconcile batch size, they are enqueued a
+// batch at a time with a pause in between, so that the writes of a CA rotation are spread out rather than sent as
+// fast as the queue can push them. The rest of the namespaces are not enqueued if stop is closed during a pause.
+func (nc *NamespaceController) syncSwept(namespaces []*v1.Namespace, stop <-chan struct{}) {
+	if nc.reconcileBatchSize <= 0 {
+		for _, ns := range namespaces {
+			nc.namespaceChange(ns)
+		}
+		return
+	}
+	inBatch := 0
+	for _, ns := range namespaces {
+		if ns.Status.Phase == v1.NamespaceTerminating || nc.skipNamespace(ns.Name) {
+			continue
+		}
+		if inBatch == nc.reconcileBatchSize {
+			select {
+			case <-nc.after(nc.reconcileBatchPause):
+			case <-stop:
+				return
+			}
+			inBatch = 0
+		}
+		inBatch++
+		nc.queue.Add(types.NamespacedName{Name: ns.Name})
+	}
+}
+
+// reconcile inserts the CA bundle into the configmap of the namespace, and reports the result to onReconcile.
+func (nc *NamespaceController) reconcile(o types.NamespacedName) error {
+	err := nc.insertDataForNamespace(o)
+	if nc.onReconcile != nil {
+		ns := o.Namespace
+		if ns == "" {
+			ns = o.Name
+		}
+		go nc.onReconcile(ns, err)
+	}
+	return err
+}
+
 // insertDataForNamespace will add data into the configmap for the specified namespace
 // If the configmap is not found, it will be created.
 // If you know the current contents of the configmap, using UpdateDataInConfigMap is more efficient.
+// The configmap is always written whole, so concurrent reconciles never leave it with a partial bundle.
 func (nc *NamespaceController) insertDataForNamespace(o types.NamespacedName) error {
 	ns := o.Namespace
 	if ns == "" {
 		// For Namespace object, it will not have o.Namespace field set
 		ns = o.Name
 	}
-	meta := metav1.ObjectMeta{
-		Name:      CACertNamespaceConfigMap,
-		Namespace: ns,
-		Labels:    configMapLabel,
+	namespace, err := nc.namespaceLister.Get(ns)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// The namespace is gone; there is nothing to write into.
+			return nil
+		}
+		// Returning the error makes the queue retry with backoff.
+		return fmt.Errorf("failed to get namespace %s: %v", ns, err)
+	}
+	if suppressionRequested(namespace) {
+		nc.suppress(ns)
+		return nil
+	}
+	if namespace.Status.Phase == v1.NamespaceTerminating {
+		return nil
+	}
+	if namespace.DeletionTimestamp != nil {
+		// The namespace is being deleted, but the lister may not have observed it entering Terminating yet.
+		// Check the live namespace, so we don't race its termination.
+		live, err := nc.liveClient.Namespaces().Get(context.TODO(), ns, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && live.Status.Phase == v1.NamespaceTerminating) {
+			return nil
+		}
+	}
+	// Hold the suppression lock until the configmap is written, so that suppress, which deletes it, waits for the
+	// write rather than having it undone.
+	nc.suppressedMu.RLock()
+	defer nc.suppressedMu.RUnlock()
+	if nc.suppressed.Contains(ns) {
+		// The namespace may have been suppressed while queued.
+		return nil
+	}
+	desired := DesiredCARootConfigMap(ns, nc.caBundleWatcher.GetCABundle(), nc.options)
+	if desired == nil {
+		// The CA has not loaded its bundle yet. Retry with backoff rather than writing an empty configmap;
+		// the namespace is enqueued again once the bundle is available anyways.
+		return fmt.Errorf("CA bundle is not yet available for namespace %s", ns)
+	}
+	caBundle, err := transformCABundle([]byte(desired.Data[nc.caRootDataKey]), nc.options)
+	if err != nil {
+		// Retrying would fail the same way; the next change to the bundle or namespace tries again.
+		log.Errorf("failed to transform CA bundle; not writing configmap %s to namespace %s: %v",
+			CACertNamespaceConfigMap, ns, err)
+		return nil
+	}
+	if len(caBundle) > nc.maxCABundleSize {
+		// The apiserver would reject the write anyways; don't bother sending it, and don't retry.
+		log.Errorf("CA bundle is %d bytes, which exceeds the limit of %d bytes; not writing configmap %s to namespace %s",
+			len(caBundle), nc.maxCABundleSize, CACertNamespaceConfigMap, ns)
+		return nil
+	}
+	hash := sha256.Sum256(caBundle)
+	if nc.configMapInformer != nil && nc.writtenHash(ns) == hash {
+		// Nothing has changed since the last write.
+		return nil
 	}
-	return k8s.InsertDataToConfigMap(nc.client, nc.configmapLister, meta, nc.caBundleWatcher.GetCABundle())
+	if nc.manageOnlyOwned {
+		existing, err := nc.configmapLister.ConfigMaps(ns).Get(CACertNamespaceConfigMap)
+		if err == nil && !ownedConfigMap(existing) {
+			log.Infof("leaving foreign configmap %s in namespace %s alone, it does not carry the reserved label",
+				CACertNamespaceConfigMap, ns)
+			return nil
+		}
+	}
+	meta := desired.ObjectMeta
+	if nc.setOwnerReference {
+		// Owner references cannot cross namespaces, so the only valid owner is the namespace itself.
+		meta.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       namespace.Name,
+			UID:        namespace.UID,
+		}}
+	}
+	err = k8s.InsertDataToConfigMapWithKey(nc.client, nc.configmapLister, meta, nc.caRootDataKey, caBundle)
+	if err != nil {
+		// The configmap is in an unknown state after a failed write; compare against it next time.
+		nc.forgetWritten(ns)
+	}
+	if isNamespaceTerminatingError(err) {
+		// The namespace started terminating after we checked it. Retrying cannot succeed.
+		log.Debugf("not writing configmap %s to terminating namespace %s: %v", CACertNamespaceConfigMap, ns, err)
+		return nil
+	}
+	if k8s.IsImmutableConfigMapError(err) {
+		// Retrying cannot succeed until the immutable flag is cleared, which reconciles the namespace again.
+		log.Errorf("not writing CA bundle to namespace %s: %v", ns, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	nc.setWritten(ns, hash)
+	return nil
+}
+
+// ownedConfigMap returns true if the configmap carries the reserved label of the configmaps we write.
+func ownedConfigMap(cm *v1.ConfigMap) bool {
+	for k, v := range configMapLabel {
+		if cm.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// writtenHash returns the hash of the CA bundle last written to the namespace, or the zero hash if unknown.
+func (nc *NamespaceController) writtenHash(ns string) [sha256.Size]byte {
+	nc.writtenMu.Lock()
+	defer nc.writtenMu.Unlock()
+	return nc.written[ns]
+}
+
+func (nc *NamespaceController) setWritten(ns string, hash [sha256.Size]byte) {
+	nc.writtenMu.Lock()
+	defer nc.writtenMu.Unlock()
+	nc.written[ns] = hash
+}
+
+// forgetWritten makes the next reconcile of the namespace compare against its configmap.
+func (nc *NamespaceController) forgetWritten(ns string) {
+	nc.writtenMu.Lock()
+	defer nc.writtenMu.Unlock()
+	delete(nc.written, ns)
+}
+
+// isNamespaceTerminatingError returns true if the error, or any error it wraps, is the apiserver rejecting a write
+// because the namespace is terminating.
+func isNamespaceTerminatingError(err error) bool {
+	var statusErr *apierrors.StatusError
+	return errors.As(err, &statusErr) && apierrors.HasStatusCause(statusErr, v1.NamespaceTerminatingCause)
+}
+
+// DesiredCARootConfigMap returns the CA root configmap the NamespaceController writes to the namespace for the given
+// mesh CA bundle: its name and labels, and the bundle, with the extra roots of the namespace appended, under the data
+// key set by opts. It returns nil if the bundle is empty. Owner references, which need the UID of the namespace, and
+// opts.BundleTransform, which may fail, are left to the caller.
+func DesiredCARootConfigMap(ns string, bundle []byte, opts NamespaceControllerOptions) *v1.ConfigMap {
+	caBundle := desiredCABundle(ns, bundle, opts)
+	if len(caBundle) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(configMapLabel)+1)
+	for k, v := range configMapLabel {
+		labels[k] = v
+	}
+	// Tells the test framework that the configmap is deleted when the namespace is labeled for suppression.
+	labels[constants.CARootSuppressibleLabel] = "true"
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CACertNamespaceConfigMap,
+			Namespace: ns,
+			Labels:    labels,
+		},
+		Data: map[string]string{
+			caRootDataKey(opts): string(caBundle),
+		},
+	}
+}
+
+// caRootDataKey returns the configmap data key the CA bundle is stored under.
+func caRootDataKey(opts NamespaceControllerOptions) string {
+	if opts.CARootDataKey == "" {
+		return constants.CACertNamespaceConfigMapDataName
+	}
+	return opts.CARootDataKey
+}
+
+// desiredCABundle returns the CA bundle to be written to the namespace: the mesh CA bundle, followed by the extra
+// roots of the namespace, if any.
+func desiredCABundle(ns string, bundle []byte, opts NamespaceControllerOptions) []byte {
+	if len(bundle) == 0 {
+		// Extra roots are only ever added to the mesh bundle, never distributed in place of it.
+		return nil
+	}
+	if opts.PerNamespaceExtraRoots != nil {
+		if extra := opts.PerNamespaceExtraRoots(ns); len(extra) > 0 {
+			bundle = appendPEM(bundle, extra)
+		}
+	}
+	if opts.DeduplicateCABundle {
+		bundle = dedupPEMBundle(bundle)
+	}
+	return bundle
+}
+
+// transformCABundle applies NamespaceControllerOptions.BundleTransform, if set, to the CA bundle of a namespace.
+func transformCABundle(bundle []byte, opts NamespaceControllerOptions) ([]byte, error) {
+	if opts.BundleTransform == nil || len(bundle) == 0 {
+		return bundle, nil
+	}
+	return opts.BundleTransform(bundle)
+}
+
+// appendPEM returns a new bundle of the PEM data of b following that of a, separated by a newline if a does not end
+// with one.
+func appendPEM(a, b []byte) []byte {
+	out := make([]byte, 0, len(a)+len(b)+1)
+	out = append(out, a...)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return append(out, b...)
+}
+
+// startAudit audits a sample of the configmaps on every tick until stop is closed.
+func (nc *NamespaceController) startAudit(stop <-chan struct{}) {
+	ticker := time.NewTicker(nc.auditInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			nc.audit()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// audit reads the configmaps of a random sample of member namespaces from the apiserver, and reports those whose
+// CA bundle differs from the desired one. It returns the number of drifted configmaps found.
+func (nc *NamespaceController) audit() int {
+	if len(nc.caBundleWatcher.GetCABundle()) == 0 {
+		// Nothing has been written yet, so every configmap would be reported as drifted.
+		log.Debugf("skipping CA root audit: no CA bundle loaded yet")
+		return 0
+	}
+	var namespaces []string
+	for _, ns := range nc.namespaceFilter.GetMembers().UnsortedList() {
+		if !nc.skipNamespace(ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	rand.Shuffle(len(namespaces), func(i, j int) {
+		namespaces[i], namespaces[j] = namespaces[j], namespaces[i]
+	})
+	if len(namespaces) > auditSampleSize {
+		namespaces = namespaces[:auditSampleSize]
+	}
+
+	drifted := 0
+	for _, ns := range namespaces {
+		reason := ""
+		bundle, err := transformCABundle(desiredCABundle(ns, nc.caBundleWatcher.GetCABundle(), nc.options), nc.options)
+		if err != nil {
+			log.Warnf("failed to transform CA bundle for the audit of namespace %s: %v", ns, err)
+			continue
+		}
+		caBundle := string(bundle)
+		cm, err := nc.liveClient.ConfigMaps(ns).Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			reason = "missing"
+		case err != nil:
+			log.Warnf("failed to audit configmap %s in namespace %s: %v", CACertNamespaceConfigMap, ns, err)
+			continue
+		case cm.Data[nc.caRootDataKey] != caBundle:
+			reason = "mismatch"
+		}
+		if reason == "" {
+			continue
+		}
+		drifted++
+		caDistributionDrift.With(driftReasonTag.Value(reason)).Increment()
+		log.WithLabels("namespace", ns, "configmap", CACertNamespaceConfigMap, "reason", reason).
+			Warnf("CA bundle drift detected")
+	}
+	return drifted
+}
+
+// dedupPEMBundle removes repeated PEM blocks from the bundle, preserving the order of first occurrence.
+// Data outside of PEM blocks is dropped. If the bundle contains no PEM blocks, it is returned unchanged.
+func dedupPEMBundle(bundle []byte) []byte {
+	var out []byte
+	seen := sets.NewSet()
+	rest := bundle
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		encoded := pem.EncodeToMemory(block)
+		if seen.Contains(string(encoded)) {
+			continue
+		}
+		seen.Insert(string(encoded))
+		out = append(out, encoded...)
+	}
+	if out == nil {
+		return bundle
+	}
+	return out
+}
+
+// Suppress stops distributing the CA bundle to the namespace, and deletes its configmap, until Unsuppress is called.
+// The namespace is suppressed in every cluster.
+func (nc *NamespaceController) Suppress(ns string) {
+	for _, c := range nc.clusters() {
+		c.suppress(ns)
+	}
+}
+
+// suppress waits for writes to the namespace in flight before deleting its configmap, so they cannot recreate it.
+func (nc *NamespaceController) suppress(ns string) {
+	nc.suppressedMu.Lock()
+	nc.suppressed.Insert(ns)
+	nc.suppressedMu.Unlock()
+	nc.forgetWritten(ns)
+	err := nc.client.ConfigMaps(ns).Delete(context.TODO(), CACertNamespaceConfigMap, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("failed to delete configmap %s in suppressed namespace %s: %v", CACertNamespaceConfigMap, ns, err)
+	}
+}
+
+// Unsuppress resumes distributing the CA bundle to a namespace previously passed to Suppress.
+func (nc *NamespaceController) Unsuppress(ns string) {
+	for _, c := range nc.clusters() {
+		c.unsuppress(ns)
+	}
+}
+
+func (nc *NamespaceController) unsuppress(ns string) {
+	nc.suppressedMu.Lock()
+	nc.suppressed.Delete(ns)
+	nc.suppressedMu.Unlock()
+	nc.syncNamespace(ns)
+}
+
+// suppressionRequested returns true if the namespace is labeled for its CA root configmap to be deleted, as the test
+// framework does before deleting a namespace.
+func suppressionRequested(ns *v1.Namespace) bool {
+	return ns.Labels[constants.CARootSuppressedLabel] == "true"
+}
+
+func (nc *NamespaceController) isSuppressed(ns string) bool {
+	nc.suppressedMu.RLock()
+	defer nc.suppressedMu.RUnlock()
+	return nc.suppressed.Contains(ns)
+}
+
+// skipNamespace returns true if the CA bundle is not distributed to the namespace.
+func (nc *NamespaceController) skipNamespace(ns string) bool {
+	return nc.excludeNamespace(ns) || nc.isSuppressed(ns)
 }
 
 // On namespace change, update the config map.
@@ -179,8 +1149,8 @@ func (nc *NamespaceController) namespaceChange(ns *v1.Namespace) {
 }
 
 func (nc *NamespaceController) syncNamespace(ns string) {
-	// skip special kubernetes system namespaces
-	if inject.IgnoredNamespaces.Contains(ns) {
+	// skip excluded namespaces, by default the special kubernetes system namespaces, and suppressed namespaces
+	if nc.skipNamespace(ns) {
 		return
 	}
 	nc.queue.Add(types.NamespacedName{Name: ns})
@@ -188,7 +1158,8 @@ func (nc *NamespaceController) syncNamespace(ns string) {
 
 // handle namespace membership changes triggered by changes to meshConfig's namespace selectors
 // which requires updating the NamespaceFilter and triggering create/update event handlers for configmap
-// for membership changes
+// for membership changes.
+// Newly selected namespaces are handed to the queue, which looks them up and retries with backoff on failure.
 func (nc *NamespaceController) initMeshWatcherHandler(
 	meshWatcher mesh.Watcher,
 	namespacesFilter filter.DiscoveryNamespacesFilter,
@@ -196,12 +1167,7 @@ func (nc *NamespaceController) initMeshWatcherHandler(
 	meshWatcher.AddMeshHandler(func() {
 		newSelectedNamespaces, _ := namespacesFilter.SelectorsChanged(meshWatcher.Mesh().GetNamespaceSelectors())
 		for _, nsName := range newSelectedNamespaces {
-			ns, err := nc.namespaceLister.Get(nsName)
-			if err != nil {
-				log.Errorf("Failed to get namespace %s", nsName)
-				continue
-			}
-			nc.namespaceChange(ns)
+			nc.syncNamespace(nsName)
 		}
 	})
 }
@@ -16,23 +16,44 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"go.opencensus.io/stats/view"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	listerv1 "k8s.io/client-go/listers/core/v1"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/keycertbundle"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller/filter"
+	"istio.io/istio/pkg/cluster"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/kube/inject"
 	"istio.io/istio/pkg/test/util/retry"
+	istiolog "istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
 )
 
 func TestNamespaceController(t *testing.T) {
@@ -43,7 +64,7 @@ func TestNamespaceController(t *testing.T) {
 	options := Options{
 		MeshWatcher: mesh.NewFixedWatcher(&meshconfig.MeshConfig{}),
 	}
-	nc := NewNamespaceController(client, watcher, options)
+	nc := NewNamespaceController(client, watcher, options, NamespaceControllerOptions{})
 	nc.configmapLister = client.KubeInformer().Core().V1().ConfigMaps().Lister()
 	stop := make(chan struct{})
 	t.Cleanup(func() {
@@ -83,6 +104,68 @@ func TestNamespaceController(t *testing.T) {
 	}
 }
 
+func TestNamespaceController_MultiCluster(t *testing.T) {
+	watcher := keycertbundle.NewWatcher()
+	caBundle := []byte("caBundle")
+	watcher.SetAndNotify(nil, nil, caBundle)
+	var clients []kube.Client
+	var clusters []NamespaceControllerCluster
+	for _, id := range []cluster.ID{"primary", "remote"} {
+		client := kube.NewFakeClient()
+		listers := NamespaceControllerListers{
+			NamespaceLister:   client.KubeInformer().Core().V1().Namespaces().Lister(),
+			ConfigMapLister:   client.KubeInformer().Core().V1().ConfigMaps().Lister(),
+			NamespaceInformer: client.KubeInformer().Core().V1().Namespaces().Informer(),
+			ConfigMapInformer: client.KubeInformer().Core().V1().ConfigMaps().Informer(),
+		}
+		clients = append(clients, client)
+		clusters = append(clusters, NamespaceControllerCluster{
+			ID:              id,
+			Client:          client.CoreV1(),
+			Listers:         listers,
+			NamespaceFilter: filter.NewDiscoveryNamespacesFilter(listers.NamespaceLister, nil),
+		})
+	}
+	nc, err := NewMultiClusterNamespaceController(clusters, watcher, Options{}, NamespaceControllerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutDownQueueOnCleanup(t, nc)
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	for _, client := range clients {
+		client.RunAndWait(stop)
+	}
+	go nc.Run(stop)
+	retry.UntilOrFail(t, nc.HasSynced)
+
+	for _, client := range clients {
+		createNamespace(t, client, "foo", nil)
+	}
+	for _, cl := range clusters {
+		expectConfigMap(t, cl.Listers.ConfigMapLister, CACertNamespaceConfigMap, "foo", map[string]string{
+			constants.CACertNamespaceConfigMapDataName: string(caBundle),
+		})
+	}
+
+	// A single rotation reaches both clusters.
+	newCaBundle := []byte("caBundle-new")
+	watcher.SetAndNotify(nil, nil, newCaBundle)
+	for _, cl := range clusters {
+		expectConfigMap(t, cl.Listers.ConfigMapLister, CACertNamespaceConfigMap, "foo", map[string]string{
+			constants.CACertNamespaceConfigMapDataName: string(newCaBundle),
+		})
+	}
+}
+
+func TestNamespaceController_MultiClusterWithoutClusters(t *testing.T) {
+	if _, err := NewMultiClusterNamespaceController(nil, keycertbundle.NewWatcher(), Options{}, NamespaceControllerOptions{}); err == nil {
+		t.Fatal("expected an error without clusters")
+	}
+}
+
 func TestNamespaceController_WithNamespaceSelectors(t *testing.T) {
 	client := kube.NewFakeClient()
 	watcher := keycertbundle.NewWatcher()
@@ -108,7 +191,7 @@ func TestNamespaceController_WithNamespaceSelectors(t *testing.T) {
 			},
 		}),
 	}
-	nc := NewNamespaceController(client, watcher, options)
+	nc := NewNamespaceController(client, watcher, options, NamespaceControllerOptions{})
 	nc.configmapLister = client.KubeInformer().Core().V1().ConfigMaps().Lister()
 	stop := make(chan struct{})
 	t.Cleanup(func() {
@@ -153,7 +236,7 @@ func TestNamespaceController_WithChangingNamespaceSelectors(t *testing.T) {
 	options := Options{
 		MeshWatcher: meshWatcher,
 	}
-	nc := NewNamespaceController(client, watcher, options)
+	nc := NewNamespaceController(client, watcher, options, NamespaceControllerOptions{})
 	nc.configmapLister = client.KubeInformer().Core().V1().ConfigMaps().Lister()
 	stop := make(chan struct{})
 	t.Cleanup(func() {
@@ -191,6 +274,1480 @@ func TestNamespaceController_WithChangingNamespaceSelectors(t *testing.T) {
 	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, nsB, expectedData)
 }
 
+func TestNamespaceController_SelectorChangeRetriesFailedGet(t *testing.T) {
+	meshWatcher := mesh.NewTestWatcher(&meshconfig.MeshConfig{
+		NamespaceSelectors: []*metav1.LabelSelector{
+			{
+				MatchLabels: map[string]string{
+					"app": "foo",
+				},
+			},
+		},
+	})
+	caBundle := []byte("caBundle")
+	nc, client, _ := newTestNamespaceControllerWithMesh(t, caBundle, meshWatcher, NamespaceControllerOptions{})
+	lister := &flakyNamespaceLister{NamespaceLister: nc.namespaceLister, failures: map[string]int{}}
+	nc.namespaceLister = lister
+	runTestNamespaceController(t, client, nc)
+
+	createNamespace(t, client, "nsB", map[string]string{"app": "bar"})
+	expectConfigMapNotExist(t, nc.configmapLister, "nsB")
+
+	// The first lookup of nsB after it becomes selected fails; the queue should retry it.
+	lister.setFailures("nsB", 1)
+	if err := meshWatcher.Update(&meshconfig.MeshConfig{
+		NamespaceSelectors: []*metav1.LabelSelector{
+			{
+				MatchLabels: map[string]string{
+					"app": "bar",
+				},
+			},
+		},
+	}, 5); err != nil {
+		t.Fatalf("%v", err)
+	}
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "nsB", map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+	})
+	if remaining := lister.remainingFailures("nsB"); remaining != 0 {
+		t.Fatalf("expected the failing Get to be exercised, %d failures remaining", remaining)
+	}
+}
+
+// flakyNamespaceLister fails Get for a namespace a configured number of times before delegating.
+type flakyNamespaceLister struct {
+	listerv1.NamespaceLister
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (l *flakyNamespaceLister) Get(name string) (*v1.Namespace, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failures[name] > 0 {
+		l.failures[name]--
+		return nil, fmt.Errorf("injected failure getting namespace %s", name)
+	}
+	return l.NamespaceLister.Get(name)
+}
+
+func (l *flakyNamespaceLister) setFailures(name string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures[name] = n
+}
+
+func (l *flakyNamespaceLister) remainingFailures(name string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failures[name]
+}
+
+func TestNamespaceController_SweepRetriesFailedGet(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespaces := []string{"healthy", "transient", "persistent"}
+	caBundle := []byte("caBundle")
+	nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, namespaces), caBundle, NamespaceControllerOptions{})
+	lister := &flakyNamespaceLister{NamespaceLister: nc.namespaceLister, failures: map[string]int{}}
+	nc.namespaceLister = lister
+	// transient recovers on the sweep's retry. persistent also fails the retry, and the first lookup by the queue.
+	lister.setFailures("transient", 1)
+	lister.setFailures("persistent", 3)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	succeeded, failed := nc.sweepNamespaces(stop)
+	if succeeded != 2 || failed != 1 {
+		t.Fatalf("expected 2 namespaces to succeed and 1 to fail, got %d and %d", succeeded, failed)
+	}
+
+	go nc.queue.Run(stop)
+	retry.UntilSuccessOrFail(t, func() error {
+		for _, ns := range namespaces {
+			cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("%s: %v", ns, err)
+			}
+			if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != string(caBundle) {
+				return fmt.Errorf("%s: expected CA bundle %q, got %q", ns, caBundle, got)
+			}
+		}
+		return nil
+	}, retry.Timeout(10*time.Second))
+	if remaining := lister.remainingFailures("persistent"); remaining != 0 {
+		t.Fatalf("expected every injected failure to be exercised, %d remaining", remaining)
+	}
+}
+
+// sweepEvents records the configmaps the queue of a controller writes, and the pauses of its sweeps. Each pause waits
+// for the batches enqueued before it to be written, so that the events are in a reproducible order.
+type sweepEvents struct {
+	t      *testing.T
+	mu     sync.Mutex
+	events []string
+	writes int
+}
+
+func newSweepEvents(t *testing.T, client *fake.Clientset, nc *NamespaceController, batchSize int) *sweepEvents {
+	e := &sweepEvents{t: t}
+	client.PrependReactor("create", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.events = append(e.events, action.GetNamespace())
+		e.writes++
+		return false, nil, nil
+	})
+	pauses := 0
+	nc.after = func(d time.Duration) <-chan time.Time {
+		if d != time.Minute {
+			t.Errorf("expected a pause of %v, got %v", time.Minute, d)
+		}
+		pauses++
+		e.waitForWrites(pauses * batchSize)
+		e.mu.Lock()
+		e.events = append(e.events, "pause")
+		e.mu.Unlock()
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	go nc.queue.Run(stop)
+	return e
+}
+
+func (e *sweepEvents) waitForWrites(n int) {
+	e.t.Helper()
+	retry.UntilOrFail(e.t, func() bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return e.writes == n
+	}, retry.Timeout(5*time.Second))
+}
+
+func (e *sweepEvents) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string{}, e.events...)
+}
+
+func TestNamespaceController_SweepInBatches(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var namespaces []string
+	for i := 0; i < 10; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("ns-%02d", i))
+	}
+	nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, namespaces), []byte("caBundle"),
+		NamespaceControllerOptions{ReconcileBatchSize: 3, ReconcileBatchPause: time.Minute})
+	events := newSweepEvents(t, client, nc, 3)
+
+	if succeeded, failed := nc.sweepNamespaces(make(chan struct{})); succeeded != 10 || failed != 0 {
+		t.Fatalf("expected 10 namespaces to succeed, got %d succeeded and %d failed", succeeded, failed)
+	}
+	events.waitForWrites(10)
+	want := []string{
+		"ns-00", "ns-01", "ns-02", "pause",
+		"ns-03", "ns-04", "ns-05", "pause",
+		"ns-06", "ns-07", "ns-08", "pause",
+		"ns-09",
+	}
+	if got := events.get(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected writes in batches of 3 with pauses in between, got %v", got)
+	}
+}
+
+func TestNamespaceController_SweepOrder(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	listers := newTestListers(t, []string{"ns-c", "ns-a", "ns-e", "ns-b", "ns-d"})
+	nc, _ := newTestNamespaceControllerWithListers(t, client, listers, []byte("caBundle"),
+		NamespaceControllerOptions{ReconcileBatchSize: 2, ReconcileBatchPause: time.Minute})
+	lister := &flakyNamespaceLister{NamespaceLister: listers.NamespaceLister, failures: map[string]int{}}
+	nc.namespaceLister = lister
+	// ns-a is only found on the sweep's retry, but is still enqueued first.
+	lister.setFailures("ns-a", 1)
+	events := newSweepEvents(t, client, nc, 2)
+
+	if succeeded, failed := nc.sweepNamespaces(make(chan struct{})); succeeded != 5 || failed != 0 {
+		t.Fatalf("expected 5 namespaces to succeed, got %d succeeded and %d failed", succeeded, failed)
+	}
+	events.waitForWrites(5)
+	want := []string{"ns-a", "ns-b", "pause", "ns-c", "ns-d", "pause", "ns-e"}
+	if got := events.get(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected namespaces to be swept in name order, got %v", got)
+	}
+}
+
+func TestNamespaceController_SweepStopsBetweenBatches(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var namespaces []string
+	for i := 0; i < 5; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("ns-%02d", i))
+	}
+	nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, namespaces), []byte("caBundle"),
+		NamespaceControllerOptions{ReconcileBatchSize: 2, ReconcileBatchPause: time.Hour})
+
+	stop := make(chan struct{})
+	close(stop)
+	done := make(chan struct{})
+	go func() {
+		nc.sweepNamespaces(stop)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the sweep to stop during the pause")
+	}
+	// Only the first batch was enqueued. The queue syncs once it has processed the items enqueued before it ran.
+	queueStop := make(chan struct{})
+	t.Cleanup(func() {
+		close(queueStop)
+	})
+	go nc.queue.Run(queueStop)
+	retry.UntilOrFail(t, nc.queue.HasSynced)
+	if writes := configMapWrites(client); writes != 2 {
+		t.Fatalf("expected only the first batch to be written, got %d writes", writes)
+	}
+}
+
+func TestNamespaceController_SweepWithoutBatches(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var namespaces []string
+	for i := 0; i < 5; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("ns-%02d", i))
+	}
+	nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, namespaces), []byte("caBundle"), NamespaceControllerOptions{})
+	nc.after = func(time.Duration) <-chan time.Time {
+		t.Error("expected no pauses without batching")
+		return nil
+	}
+
+	nc.sweepNamespaces(make(chan struct{}))
+	// Every namespace is left to the queue, which is not running.
+	if writes := configMapWrites(client); writes != 0 {
+		t.Fatalf("expected the sweep to only enqueue namespaces, got %d writes", writes)
+	}
+}
+
+func TestNamespaceController_CABundleWatcherClosed(t *testing.T) {
+	nc, client, watcher := newTestNamespaceController(t, []byte("caBundle"), NamespaceControllerOptions{})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	client.RunAndWait(stop)
+
+	id, watchCh := watcher.AddWatcher()
+	done := make(chan struct{})
+	go func() {
+		nc.watchCABundle(watchCh, stop)
+		close(done)
+	}()
+
+	// Removing the watcher closes the channel, which should cause the loop to exit rather than spin on zero value
+	// reads.
+	watcher.RemoveWatcher(id)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the CA bundle watch loop to stop when the watcher channel is closed")
+	}
+}
+
+// newTestNamespaceController returns a controller for a fake kube client, with a CA bundle watcher holding caBundle,
+// or no bundle if it is nil, and an empty mesh config. The controller's queues are shut down when the test ends,
+// whether or not the test runs it.
+func newTestNamespaceController(t *testing.T, caBundle []byte, ncOptions NamespaceControllerOptions,
+) (*NamespaceController, kube.Client, *keycertbundle.Watcher) {
+	return newTestNamespaceControllerWithMesh(t, caBundle, mesh.NewFixedWatcher(&meshconfig.MeshConfig{}), ncOptions)
+}
+
+// newTestNamespaceControllerWithMesh is like newTestNamespaceController, for the given mesh config watcher.
+func newTestNamespaceControllerWithMesh(t *testing.T, caBundle []byte, meshWatcher mesh.Watcher,
+	ncOptions NamespaceControllerOptions,
+) (*NamespaceController, kube.Client, *keycertbundle.Watcher) {
+	client := kube.NewFakeClient()
+	watcher := newTestCABundleWatcher(caBundle)
+	nc := NewNamespaceController(client, watcher, Options{MeshWatcher: meshWatcher}, ncOptions)
+	shutDownQueueOnCleanup(t, nc)
+	return nc, client, watcher
+}
+
+// newTestNamespaceControllerWithListers is like newTestNamespaceController, for a fake clientset and the given listers.
+// The member namespaces are the ones in the namespace lister.
+func newTestNamespaceControllerWithListers(t *testing.T, client *fake.Clientset, listers NamespaceControllerListers,
+	caBundle []byte, ncOptions NamespaceControllerOptions,
+) (*NamespaceController, *keycertbundle.Watcher) {
+	watcher := newTestCABundleWatcher(caBundle)
+	nc := NewNamespaceControllerWithListers(client.CoreV1(), watcher, listers,
+		filter.NewDiscoveryNamespacesFilter(listers.NamespaceLister, nil), Options{}, ncOptions)
+	shutDownQueueOnCleanup(t, nc)
+	return nc, watcher
+}
+
+// newTestListers returns listers without informers, holding the given namespaces and configmaps.
+func newTestListers(t *testing.T, namespaces []string, configMaps ...*v1.ConfigMap) NamespaceControllerListers {
+	t.Helper()
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range namespaces {
+		if err := nsIndexer.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, cm := range configMaps {
+		if err := cmIndexer.Add(cm.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NamespaceControllerListers{
+		NamespaceLister: listerv1.NewNamespaceLister(nsIndexer),
+		ConfigMapLister: listerv1.NewConfigMapLister(cmIndexer),
+	}
+}
+
+func newTestCABundleWatcher(caBundle []byte) *keycertbundle.Watcher {
+	watcher := keycertbundle.NewWatcher()
+	if caBundle != nil {
+		watcher.SetAndNotify(nil, nil, caBundle)
+	}
+	return watcher
+}
+
+// runTestNamespaceController runs the informers of client and the controller until the test ends, and waits for the
+// controller to sync.
+func runTestNamespaceController(t *testing.T, client kube.Client, nc *NamespaceController) {
+	t.Helper()
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	client.RunAndWait(stop)
+	go nc.Run(stop)
+	retry.UntilOrFail(t, nc.HasSynced)
+}
+
+// shutDownQueueOnCleanup shuts down the queues of a controller when the test ends, so that the workqueue's
+// goroutines do not outlive the test. This is a no-op for queues the test already stopped by running them.
+func shutDownQueueOnCleanup(t *testing.T, nc *NamespaceController) {
+	t.Cleanup(func() {
+		stopped := make(chan struct{})
+		close(stopped)
+		for _, c := range nc.clusters() {
+			c.queue.Run(stopped)
+		}
+	})
+}
+
+func TestNamespaceController_SetOwnerReference(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, _ := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{SetOwnerReference: true})
+	runTestNamespaceController(t, client, nc)
+
+	// ConfigMap created by the controller gets an owner reference on create.
+	createNamespaceWithUID(t, client, "foo", "foo-uid")
+	expectOwnerReference(t, nc.configmapLister, "foo", "foo-uid")
+
+	// A pre-existing ConfigMap without an owner gets the owner backfilled.
+	if _, err := client.CoreV1().ConfigMaps("bar").Create(context.TODO(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: CACertNamespaceConfigMap, Namespace: "bar"},
+		Data:       map[string]string{constants.CACertNamespaceConfigMapDataName: string(caBundle)},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	createNamespaceWithUID(t, client, "bar", "bar-uid")
+	expectOwnerReference(t, nc.configmapLister, "bar", "bar-uid")
+}
+
+func TestNamespaceController_NamespaceExclusionPredicate(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, _ := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{
+		NamespaceExclusionPredicate: func(ns string) bool {
+			return ns == "mesh-control-plane"
+		},
+	})
+	runTestNamespaceController(t, client, nc)
+
+	expectedData := map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+	}
+	// Namespaces ignored by default are written to, as the predicate replaces the default.
+	createNamespace(t, client, "kube-system", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "kube-system", expectedData)
+	createNamespace(t, client, "foo", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", expectedData)
+
+	// Namespaces matched by the predicate are not.
+	createNamespace(t, client, "mesh-control-plane", nil)
+	createConfigMap(t, client, "not-root", "mesh-control-plane", "k")
+	expectConfigMapNotExist(t, nc.configmapLister, "mesh-control-plane")
+}
+
+func TestNamespaceController_EmptyCABundle(t *testing.T) {
+	nc, client, watcher := newTestNamespaceController(t, nil, NamespaceControllerOptions{})
+	runTestNamespaceController(t, client, nc)
+
+	// The namespace is created before the CA has loaded its bundle; nothing is written.
+	createNamespace(t, client, "foo", nil)
+	expectConfigMapNotExist(t, nc.configmapLister, "foo")
+
+	caBundle := []byte("caBundle")
+	watcher.SetAndNotify(nil, nil, caBundle)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+	})
+}
+
+func TestNamespaceController_Suppress(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, watcher := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{})
+	runTestNamespaceController(t, client, nc)
+
+	expectedData := map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+	}
+	createNamespace(t, client, "foo", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", expectedData)
+
+	// Suppressing deletes the configmap, and it is not recreated.
+	nc.Suppress("foo")
+	retry.UntilOrFail(t, func() bool {
+		_, err := nc.configmapLister.ConfigMaps("foo").Get(CACertNamespaceConfigMap)
+		return errors.IsNotFound(err)
+	}, retry.Timeout(time.Second*10))
+	expectConfigMapNotExist(t, nc.configmapLister, "foo")
+
+	// Nor is it written on bundle rotation.
+	newCaBundle := []byte("caBundle-new")
+	watcher.SetAndNotify(nil, nil, newCaBundle)
+	expectConfigMapNotExist(t, nc.configmapLister, "foo")
+
+	// Suppressing a namespace before it exists prevents the configmap from being created.
+	nc.Suppress("bar")
+	createNamespace(t, client, "bar", nil)
+	expectConfigMapNotExist(t, nc.configmapLister, "bar")
+
+	// Unsuppressing recreates the configmap with the current bundle.
+	nc.Unsuppress("foo")
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(newCaBundle),
+	})
+}
+
+func TestNamespaceController_SuppressionLabel(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, _ := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{})
+	runTestNamespaceController(t, client, nc)
+
+	expectedData := map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+	}
+	createNamespace(t, client, "foo", map[string]string{"app": "foo"})
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", expectedData)
+
+	// Labeling the namespace deletes the configmap, as Suppress does.
+	updateNamespace(t, client, "foo", map[string]string{"app": "foo", constants.CARootSuppressedLabel: "true"})
+	retry.UntilOrFail(t, func() bool {
+		_, err := nc.configmapLister.ConfigMaps("foo").Get(CACertNamespaceConfigMap)
+		return errors.IsNotFound(err)
+	}, retry.Timeout(time.Second*10))
+	expectConfigMapNotExist(t, nc.configmapLister, "foo")
+
+	// Removing the label recreates it.
+	updateNamespace(t, client, "foo", map[string]string{"app": "foo"})
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", expectedData)
+}
+
+func TestNamespaceController_SuppressWaitsForWrite(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, []string{"foo"}), []byte("caBundle"), NamespaceControllerOptions{})
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	client.PrependReactor("create", "configmaps", func(ktesting.Action) (bool, runtime.Object, error) {
+		close(writing)
+		<-release
+		return false, nil, nil
+	})
+
+	reconciled := make(chan error)
+	go func() {
+		reconciled <- nc.insertDataForNamespace(types.NamespacedName{Name: "foo"})
+	}()
+	<-writing
+	suppressed := make(chan struct{})
+	go func() {
+		nc.Suppress("foo")
+		close(suppressed)
+	}()
+	select {
+	case <-suppressed:
+		t.Fatal("expected Suppress to wait for the write in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-reconciled; err != nil {
+		t.Fatal(err)
+	}
+	<-suppressed
+	// The configmap written by the reconcile is deleted by Suppress, not the other way around.
+	if _, err := client.CoreV1().ConfigMaps("foo").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the configmap to be deleted, got %v", err)
+	}
+}
+
+func TestNamespaceController_TerminatingNamespace(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "log")
+	o := istiolog.DefaultOptions()
+	o.OutputPaths = []string{logFile}
+	o.JSONEncoding = true
+	if err := istiolog.Configure(o); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = istiolog.Configure(istiolog.DefaultOptions())
+	})
+
+	nc, client, _ := newTestNamespaceController(t, []byte("caBundle"), NamespaceControllerOptions{})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	client.RunAndWait(stop)
+
+	// The namespace starts terminating while its configmap is being updated, so the apiserver rejects the write.
+	createNamespace(t, client, "foo", nil)
+	createConfigMap(t, client, CACertNamespaceConfigMap, "foo", constants.CACertNamespaceConfigMapDataName)
+	retry.UntilOrFail(t, func() bool {
+		_, nsErr := nc.namespaceLister.Get("foo")
+		_, cmErr := nc.configmapLister.ConfigMaps("foo").Get(CACertNamespaceConfigMap)
+		return nsErr == nil && cmErr == nil
+	}, retry.Timeout(time.Second*10))
+	client.Kube().(*fake.Clientset).PrependReactor("update", "configmaps",
+		func(action ktesting.Action) (bool, runtime.Object, error) {
+			err := errors.NewForbidden(v1.Resource("configmaps"), CACertNamespaceConfigMap,
+				fmt.Errorf("namespace foo is being terminated"))
+			err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: v1.NamespaceTerminatingCause}}
+			return true, nil, err
+		})
+	// A nil error means the key is not requeued.
+	if err := nc.insertDataForNamespace(types.NamespacedName{Name: "foo"}); err != nil {
+		t.Fatalf("expected the terminating namespace to be skipped, got %v", err)
+	}
+
+	// The lister has seen the deletion, but not the phase change; the live namespace is checked before writing.
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bar", DeletionTimestamp: &metav1.Time{Time: time.Now()}}}
+	if err := nc.namespacesInformer.GetStore().Add(ns); err != nil {
+		t.Fatal(err)
+	}
+	client.Kube().(*fake.Clientset).PrependReactor("get", "namespaces",
+		func(action ktesting.Action) (bool, runtime.Object, error) {
+			if action.(ktesting.GetAction).GetName() != "bar" {
+				return false, nil, nil
+			}
+			live := ns.DeepCopy()
+			live.Status.Phase = v1.NamespaceTerminating
+			return true, live, nil
+		})
+	if err := nc.insertDataForNamespace(types.NamespacedName{Name: "bar"}); err != nil {
+		t.Fatalf("expected the deleted namespace to be skipped, got %v", err)
+	}
+	if _, err := client.CoreV1().ConfigMaps("bar").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no configmap to be written to the deleted namespace, got %v", err)
+	}
+
+	_ = istiolog.Sync()
+	b, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), `"level":"error"`) {
+		t.Errorf("expected no error logs, got:\n%s", b)
+	}
+}
+
+func TestNamespaceController_Audit(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, _ := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{AuditInterval: time.Hour})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	// Only the informers are run, so the reconcile path does not fix the seeded drift.
+	client.RunAndWait(stop)
+
+	for ns, data := range map[string]string{"in-sync": string(caBundle), "stale": "old-bundle"} {
+		if _, err := client.CoreV1().ConfigMaps(ns).Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: CACertNamespaceConfigMap, Namespace: ns},
+			Data:       map[string]string{constants.CACertNamespaceConfigMapDataName: data},
+		}, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ns := range []string{"in-sync", "stale", "missing", "kube-system"} {
+		createNamespace(t, client, ns, nil)
+	}
+	retry.UntilOrFail(t, func() bool {
+		return nc.namespaceFilter.GetMembers().Len() == 4
+	}, retry.Timeout(time.Second*10))
+
+	before := driftCount(t)
+	if got := nc.audit(); got != 2 {
+		t.Fatalf("expected drift in 2 namespaces, got %d", got)
+	}
+	if got := driftCount(t) - before; got != 2 {
+		t.Errorf("expected the drift counter to increase by 2, got %v", got)
+	}
+}
+
+func TestNamespaceController_AuditWithoutCABundle(t *testing.T) {
+	nc, client, _ := newTestNamespaceController(t, nil, NamespaceControllerOptions{AuditInterval: time.Hour})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	client.RunAndWait(stop)
+
+	createNamespace(t, client, "missing", nil)
+	retry.UntilOrFail(t, func() bool {
+		return nc.namespaceFilter.GetMembers().Len() == 1
+	}, retry.Timeout(time.Second*10))
+
+	before := driftCount(t)
+	if got := nc.audit(); got != 0 {
+		t.Fatalf("expected no drift before a CA bundle is loaded, got %d", got)
+	}
+	if got := driftCount(t) - before; got != 0 {
+		t.Errorf("expected the drift counter to stay unchanged, got %v", got)
+	}
+}
+
+// driftCount returns the total of ca_distribution_drift_total across all reasons.
+func driftCount(t *testing.T) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData("ca_distribution_drift_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, row := range rows {
+		total += row.Data.(*view.SumData).Value
+	}
+	return total
+}
+
+func TestNamespaceController_Resync(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	listers := newTestListers(t, []string{"foo", "bar"})
+	nc, _ := newTestNamespaceControllerWithListers(t, client, listers, []byte("caBundle"), NamespaceControllerOptions{})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	go nc.Run(stop)
+
+	// Diverge the member set from the lister: drop a namespace that exists, and add one that doesn't.
+	nc.namespaceFilter.NamespaceDeleted(metav1.ObjectMeta{Name: "foo"})
+	nc.namespaceFilter.NamespaceCreated(metav1.ObjectMeta{Name: "ghost"})
+	if got := nc.namespaceFilter.GetMembers().List(); !reflect.DeepEqual(got, []string{"bar", "ghost"}) {
+		t.Fatalf("expected the member set to be corrupted, got %v", got)
+	}
+
+	if err := nc.Resync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nc.namespaceFilter.GetMembers().List(); !reflect.DeepEqual(got, []string{"bar", "foo"}) {
+		t.Fatalf("expected the members to match the lister, got %v", got)
+	}
+	// Only the rediscovered namespace is reconciled.
+	retry.UntilSuccessOrFail(t, func() error {
+		_, err := client.CoreV1().ConfigMaps("foo").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+		return err
+	}, retry.Timeout(5*time.Second))
+	if _, err := client.CoreV1().ConfigMaps("bar").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no configmap to be written to a namespace that was already a member, got %v", err)
+	}
+}
+
+func TestNamespaceController_TriggerResync(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	listers := newTestListers(t, []string{"foo", "bar", "baz"})
+	nc, _ := newTestNamespaceControllerWithListers(t, client, listers, []byte("caBundle"), NamespaceControllerOptions{})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	go nc.Run(stop)
+	retry.UntilOrFail(t, nc.queue.HasSynced)
+
+	// Without informers or a watcher signal, nothing has been written yet.
+	if _, err := client.CoreV1().ConfigMaps("foo").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no configmap before the resync, got %v", err)
+	}
+
+	// Triggers that arrive together are coalesced into a sweep of every member.
+	nc.TriggerResync()
+	nc.TriggerResync()
+	for _, ns := range []string{"foo", "bar", "baz"} {
+		retry.UntilSuccessOrFail(t, func() error {
+			_, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+			return err
+		}, retry.Timeout(5*time.Second))
+	}
+}
+
+func TestNamespaceController_WaitForCABundle(t *testing.T) {
+	nc, client, watcher := newTestNamespaceController(t, []byte("caBundle"), NamespaceControllerOptions{})
+	runTestNamespaceController(t, client, nc)
+
+	createNamespace(t, client, "foo", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := nc.WaitForCABundle(ctx, "foo", []byte("caBundle")); err != nil {
+		t.Fatalf("expected the initial bundle to be distributed: %v", err)
+	}
+
+	// The rotated bundle has not been distributed yet.
+	newCaBundle := []byte("caBundle-new")
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer shortCancel()
+	if err := nc.WaitForCABundle(shortCtx, "foo", newCaBundle); err == nil {
+		t.Fatal("expected the wait for a bundle that was never distributed to time out")
+	}
+
+	watcher.SetAndNotify(nil, nil, newCaBundle)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := nc.WaitForCABundle(ctx, "foo", newCaBundle); err != nil {
+		t.Fatalf("expected the rotated bundle to be distributed: %v", err)
+	}
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(newCaBundle),
+	})
+}
+
+func TestNamespaceController_CABundleWatcherMetrics(t *testing.T) {
+	nc, watcher := newTestNamespaceControllerWithListers(t, fake.NewSimpleClientset(), newTestListers(t, []string{"foo", "bar"}),
+		nil, NamespaceControllerOptions{})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+
+	signalsBefore := caBundleSignalCount(t)
+	sweepsBefore := caBundleSweepCount(t)
+	go nc.startCaBundleWatcher(stop)
+	// Signals sent before the previous one is received are coalesced, so wait for each in turn.
+	for i := 1; i <= 3; i++ {
+		retry.UntilSuccessOrFail(t, func() error {
+			if caBundleSignalCount(t)-signalsBefore >= float64(i) {
+				return nil
+			}
+			watcher.SetAndNotify(nil, nil, []byte(fmt.Sprintf("caBundle-%d", i)))
+			return fmt.Errorf("signal %d not yet received", i)
+		}, retry.Timeout(5*time.Second))
+	}
+
+	signals := caBundleSignalCount(t) - signalsBefore
+	if signals < 3 {
+		t.Fatalf("expected at least 3 signals, got %v", signals)
+	}
+	// Every signal is followed by a sweep; the last may still be in progress.
+	retry.UntilSuccessOrFail(t, func() error {
+		if sweeps := caBundleSweepCount(t) - sweepsBefore; float64(sweeps) != signals {
+			return fmt.Errorf("expected %v sweeps to be recorded, got %v", signals, sweeps)
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+}
+
+// caBundleSignalCount returns the value of ca_bundle_watcher_signals_total.
+func caBundleSignalCount(t *testing.T) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData("ca_bundle_watcher_signals_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, row := range rows {
+		total += row.Data.(*view.SumData).Value
+	}
+	return total
+}
+
+// caBundleSweepCount returns the number of observations recorded by ca_bundle_sweep_duration_seconds.
+func caBundleSweepCount(t *testing.T) int64 {
+	t.Helper()
+	rows, err := view.RetrieveData("ca_bundle_sweep_duration_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, row := range rows {
+		total += row.Data.(*view.DistributionData).Count
+	}
+	return total
+}
+
+func TestNamespaceController_MergeConfigMapLabels(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, _ := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{})
+	runTestNamespaceController(t, client, nc)
+
+	// A pre-existing ConfigMap labeled by a third party, with a stale bundle and no reserved label.
+	if _, err := client.CoreV1().ConfigMaps("foo").Create(context.TODO(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CACertNamespaceConfigMap,
+			Namespace: "foo",
+			Labels:    map[string]string{"cost-center": "1234", "team": "mesh"},
+		},
+		Data: map[string]string{constants.CACertNamespaceConfigMapDataName: "stale"},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	createNamespace(t, client, "foo", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", map[string]string{
+		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+	})
+
+	expectedLabels := map[string]string{
+		"cost-center": "1234", "team": "mesh", "istio.io/config": "true", constants.CARootSuppressibleLabel: "true",
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		cm, err := nc.configmapLister.ConfigMaps("foo").Get(CACertNamespaceConfigMap)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(cm.Labels, expectedLabels) {
+			return fmt.Errorf("labels mismatch, expected %+v got %+v", expectedLabels, cm.Labels)
+		}
+		return nil
+	}, retry.Timeout(time.Second*10))
+}
+
+func TestNamespaceController_CARootDataKey(t *testing.T) {
+	caBundle := []byte("caBundle")
+	nc, client, watcher := newTestNamespaceController(t, caBundle, NamespaceControllerOptions{CARootDataKey: "ca.crt"})
+	runTestNamespaceController(t, client, nc)
+
+	// Only the custom key is written; nothing is stored under the default key.
+	createNamespace(t, client, "foo", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", map[string]string{"ca.crt": string(caBundle)})
+
+	// Rotation compares and updates the custom key.
+	newCaBundle := []byte("caBundle-new")
+	watcher.SetAndNotify(nil, nil, newCaBundle)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo", map[string]string{"ca.crt": string(newCaBundle)})
+}
+
+func TestNamespaceController_PerNamespaceExtraRoots(t *testing.T) {
+	var mu sync.Mutex
+	extraRoots := map[string][]byte{"regional": []byte("regional-root\n")}
+	nc, client, watcher := newTestNamespaceController(t, []byte("mesh-root\n"), NamespaceControllerOptions{
+		PerNamespaceExtraRoots: func(ns string) []byte {
+			mu.Lock()
+			defer mu.Unlock()
+			return extraRoots[ns]
+		},
+	})
+	runTestNamespaceController(t, client, nc)
+
+	data := func(bundle string) map[string]string {
+		return map[string]string{constants.CACertNamespaceConfigMapDataName: bundle}
+	}
+	createNamespace(t, client, "regional", nil)
+	createNamespace(t, client, "plain", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "regional", data("mesh-root\nregional-root\n"))
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "plain", data("mesh-root\n"))
+
+	// Rotating the mesh root reaches every namespace, and the extras are kept.
+	watcher.SetAndNotify(nil, nil, []byte("mesh-root-2\n"))
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "regional", data("mesh-root-2\nregional-root\n"))
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "plain", data("mesh-root-2\n"))
+
+	// Extras are read again on the next reconcile.
+	mu.Lock()
+	extraRoots["plain"] = []byte("regional-root\n")
+	mu.Unlock()
+	nc.syncNamespace("plain")
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "plain", data("mesh-root-2\nregional-root\n"))
+}
+
+func TestNamespaceController_BundleTransform(t *testing.T) {
+	certA := "-----BEGIN CERTIFICATE-----\nYQ==\n-----END CERTIFICATE-----\n"
+	certB := "-----BEGIN CERTIFICATE-----\nYg==\n-----END CERTIFICATE-----\n"
+	var mu sync.Mutex
+	fail := false
+	reconciled := make(chan string, 10)
+	options := NamespaceControllerOptions{
+		BundleTransform: func(bundle []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return nil, fmt.Errorf("transform failed")
+			}
+			return reversePEMBundle(bundle), nil
+		},
+		OnReconcile: func(ns string, _ error) {
+			select {
+			case reconciled <- ns:
+			default:
+			}
+		},
+	}
+	nc, client, _ := newTestNamespaceController(t, []byte(certA+certB), options)
+	runTestNamespaceController(t, client, nc)
+
+	createNamespace(t, client, "foo", nil)
+	expectConfigMap(t, nc.configmapLister, CACertNamespaceConfigMap, "foo",
+		map[string]string{constants.CACertNamespaceConfigMapDataName: certB + certA})
+
+	// A failed transform skips the write.
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	createNamespace(t, client, "bar", nil)
+	for ns := ""; ns != "bar"; {
+		select {
+		case ns = <-reconciled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("namespace bar was not reconciled")
+		}
+	}
+	if _, err := client.Kube().CoreV1().ConfigMaps("bar").Get(context.TODO(), CACertNamespaceConfigMap,
+		metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no configmap to be written after a failed transform, got %v", err)
+	}
+}
+
+// reversePEMBundle reverses the order of the PEM blocks of the bundle, putting the leaf last.
+func reversePEMBundle(bundle []byte) []byte {
+	var out []byte
+	for rest := bundle; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return out
+		}
+		out = append(pem.EncodeToMemory(block), out...)
+	}
+}
+
+func TestAppendPEM(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, want string
+	}{
+		{a: "a\n", b: "b\n", want: "a\nb\n"},
+		{a: "a", b: "b\n", want: "a\nb\n"},
+	} {
+		if got := string(appendPEM([]byte(tc.a), []byte(tc.b))); got != tc.want {
+			t.Errorf("appendPEM(%q, %q) = %q, want %q", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDesiredCARootConfigMap(t *testing.T) {
+	extraRoots := func(ns string) []byte {
+		if ns == "regional" {
+			return []byte("regional-root\n")
+		}
+		return nil
+	}
+	for _, tc := range []struct {
+		name   string
+		ns     string
+		bundle string
+		opts   NamespaceControllerOptions
+		want   *v1.ConfigMap
+	}{
+		{
+			name:   "defaults",
+			ns:     "foo",
+			bundle: "mesh-root\n",
+			want: &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CACertNamespaceConfigMap,
+					Namespace: "foo",
+					Labels:    map[string]string{"istio.io/config": "true", constants.CARootSuppressibleLabel: "true"},
+				},
+				Data: map[string]string{constants.CACertNamespaceConfigMapDataName: "mesh-root\n"},
+			},
+		},
+		{
+			name:   "custom data key",
+			ns:     "foo",
+			bundle: "mesh-root\n",
+			opts:   NamespaceControllerOptions{CARootDataKey: "ca.crt"},
+			want: &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CACertNamespaceConfigMap,
+					Namespace: "foo",
+					Labels:    map[string]string{"istio.io/config": "true", constants.CARootSuppressibleLabel: "true"},
+				},
+				Data: map[string]string{"ca.crt": "mesh-root\n"},
+			},
+		},
+		{
+			name:   "extra roots",
+			ns:     "regional",
+			bundle: "mesh-root",
+			opts:   NamespaceControllerOptions{PerNamespaceExtraRoots: extraRoots},
+			want: &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CACertNamespaceConfigMap,
+					Namespace: "regional",
+					Labels:    map[string]string{"istio.io/config": "true", constants.CARootSuppressibleLabel: "true"},
+				},
+				Data: map[string]string{constants.CACertNamespaceConfigMapDataName: "mesh-root\nregional-root\n"},
+			},
+		},
+		{
+			name:   "no extra roots for namespace",
+			ns:     "plain",
+			bundle: "mesh-root\n",
+			opts:   NamespaceControllerOptions{PerNamespaceExtraRoots: extraRoots},
+			want: &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CACertNamespaceConfigMap,
+					Namespace: "plain",
+					Labels:    map[string]string{"istio.io/config": "true", constants.CARootSuppressibleLabel: "true"},
+				},
+				Data: map[string]string{constants.CACertNamespaceConfigMapDataName: "mesh-root\n"},
+			},
+		},
+		{
+			name:   "empty bundle",
+			ns:     "regional",
+			bundle: "",
+			opts:   NamespaceControllerOptions{PerNamespaceExtraRoots: extraRoots},
+			want:   nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DesiredCARootConfigMap(tc.ns, []byte(tc.bundle), tc.opts)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("DesiredCARootConfigMap() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDesiredCARootConfigMapLabelsNotShared(t *testing.T) {
+	cm := DesiredCARootConfigMap("foo", []byte("mesh-root\n"), NamespaceControllerOptions{})
+	cm.Labels["extra"] = "true"
+	if _, ok := configMapLabel["extra"]; ok {
+		t.Fatal("labels of the returned configmap are shared with the controller")
+	}
+}
+
+func TestNamespaceController_HTTPEndpoints(t *testing.T) {
+	nc, client, _ := newTestNamespaceController(t, []byte("caBundle"), NamespaceControllerOptions{})
+	handler := nc.httpHandler()
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// Nothing has synced yet
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code := get(path); code != http.StatusServiceUnavailable {
+			t.Fatalf("%s: expected %d before sync, got %d", path, http.StatusServiceUnavailable, code)
+		}
+	}
+
+	runTestNamespaceController(t, client, nc)
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		if code := get(path); code != http.StatusOK {
+			t.Fatalf("%s: expected %d after sync, got %d", path, http.StatusOK, code)
+		}
+	}
+
+	// The exporter sees every view in the process, but only the namespace controller's metrics are served.
+	other := monitoring.NewSum("namespace_controller_test_other_total", "A metric not owned by the namespace controller.")
+	monitoring.MustRegister(other)
+	other.Increment()
+	caBundleWatcherSignals.Increment()
+	handler = nc.httpHandler()
+	retry.UntilSuccessOrFail(t, func() error {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := rec.Body.String()
+		if !strings.Contains(body, caBundleWatcherSignals.Name()) {
+			return fmt.Errorf("expected %s to be served, got:\n%s", caBundleWatcherSignals.Name(), body)
+		}
+		if strings.Contains(body, other.Name()) {
+			return fmt.Errorf("expected %s not to be served, got:\n%s", other.Name(), body)
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+}
+
+func TestNamespaceController_OversizedCABundle(t *testing.T) {
+	nc, client, _ := newTestNamespaceController(t, []byte("caBundle"), NamespaceControllerOptions{MaxCABundleSize: 4})
+	runTestNamespaceController(t, client, nc)
+
+	createNamespace(t, client, "foo", nil)
+	expectConfigMapNotExist(t, nc.configmapLister, "foo")
+}
+
+func TestDedupPEMBundle(t *testing.T) {
+	certA := "-----BEGIN CERTIFICATE-----\nYQ==\n-----END CERTIFICATE-----\n"
+	certB := "-----BEGIN CERTIFICATE-----\nYg==\n-----END CERTIFICATE-----\n"
+	tcs := []struct {
+		name     string
+		in       string
+		expected string
+	}{
+		{
+			name:     "no duplicates",
+			in:       certA + certB,
+			expected: certA + certB,
+		},
+		{
+			name:     "duplicates removed in order",
+			in:       certB + certA + certB + certA,
+			expected: certB + certA,
+		},
+		{
+			name:     "not pem",
+			in:       "caBundle",
+			expected: "caBundle",
+		},
+		{
+			name:     "empty",
+			in:       "",
+			expected: "",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(dedupPEMBundle([]byte(tc.in))); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNamespaceController_WithListers(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	caBundle := []byte("caBundle")
+	nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, []string{"foo", "bar"}), caBundle, NamespaceControllerOptions{})
+
+	if got := nc.audit(); got != 2 {
+		t.Fatalf("expected both configmaps to be reported missing, got %d drifted", got)
+	}
+	for _, ns := range []string{"foo", "bar", "missing"} {
+		if err := nc.insertDataForNamespace(types.NamespacedName{Name: ns}); err != nil {
+			t.Fatalf("%s: %v", ns, err)
+		}
+	}
+	for _, ns := range []string{"foo", "bar"} {
+		cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != string(caBundle) {
+			t.Fatalf("%s: expected CA bundle %q, got %q", ns, caBundle, got)
+		}
+	}
+	if _, err := client.CoreV1().ConfigMaps("missing").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no configmap for a namespace missing from the lister, got %v", err)
+	}
+	if got := nc.audit(); got != 0 {
+		t.Fatalf("expected no drift after reconciling, got %d drifted", got)
+	}
+}
+
+func TestNamespaceController_SkipsUnchangedBundle(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespaces := []string{"foo", "bar", "baz"}
+	// The configmap informer invalidates the written hashes; the queue is not run, so only the sweeps write.
+	factory := informers.NewSharedInformerFactory(client, 0)
+	listers := newTestListers(t, namespaces)
+	listers.ConfigMapLister = factory.Core().V1().ConfigMaps().Lister()
+	listers.ConfigMapInformer = factory.Core().V1().ConfigMaps().Informer()
+	nc, watcher := newTestNamespaceControllerWithListers(t, client, listers, []byte("caBundle"), NamespaceControllerOptions{})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+
+	sweep := func() int {
+		client.ClearActions()
+		for _, ns := range namespaces {
+			if err := nc.insertDataForNamespace(types.NamespacedName{Name: ns}); err != nil {
+				t.Fatalf("%s: %v", ns, err)
+			}
+		}
+		return configMapWrites(client)
+	}
+	expectBundle := func(ns, want string) {
+		t.Helper()
+		cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != want {
+			t.Fatalf("expected the configmap in %s to hold %q, got %q", ns, want, got)
+		}
+	}
+	expectForgotten := func(ns string) {
+		t.Helper()
+		retry.UntilOrFail(t, func() bool {
+			return nc.writtenHash(ns) == [sha256.Size]byte{}
+		}, retry.Timeout(5*time.Second))
+	}
+
+	if got := sweep(); got != len(namespaces) {
+		t.Fatalf("expected the first sweep to write every namespace, got %d writes", got)
+	}
+	// The informer observing our own writes does not invalidate them.
+	retry.UntilOrFail(t, func() bool {
+		cms, err := listers.ConfigMapLister.List(labels.Everything())
+		return err == nil && len(cms) == len(namespaces)
+	}, retry.Timeout(5*time.Second))
+	for i := 0; i < 3; i++ {
+		if got := sweep(); got != 0 {
+			t.Fatalf("expected a redundant sweep to write nothing, got %d writes", got)
+		}
+	}
+
+	watcher.SetAndNotify(nil, nil, []byte("newCABundle"))
+	if got := sweep(); got != len(namespaces) {
+		t.Fatalf("expected a bundle change to write each namespace once, got %d writes", got)
+	}
+	if got := sweep(); got != 0 {
+		t.Fatalf("expected no writes after the new bundle was written, got %d writes", got)
+	}
+
+	// An external edit is repaired once the informer observes it.
+	cm, err := client.CoreV1().ConfigMaps("foo").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.Data[constants.CACertNamespaceConfigMapDataName] = "tampered"
+	if _, err := client.CoreV1().ConfigMaps("foo").Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectForgotten("foo")
+	if got := sweep(); got != 1 {
+		t.Fatalf("expected the edited configmap to be written once, got %d writes", got)
+	}
+	expectBundle("foo", "newCABundle")
+
+	// So is a deletion.
+	if err := client.CoreV1().ConfigMaps("bar").Delete(context.TODO(), CACertNamespaceConfigMap, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectForgotten("bar")
+	if got := sweep(); got != 1 {
+		t.Fatalf("expected the deleted configmap to be written once, got %d writes", got)
+	}
+	expectBundle("bar", "newCABundle")
+}
+
+func TestNamespaceController_ImmutableConfigMap(t *testing.T) {
+	immutable := true
+	existing := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: CACertNamespaceConfigMap, Namespace: "foo", Labels: configMapLabel},
+		Data:       map[string]string{constants.CACertNamespaceConfigMapDataName: "oldCABundle"},
+		Immutable:  &immutable,
+	}
+	newController := func(t *testing.T, client *fake.Clientset) *NamespaceController {
+		nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, []string{"foo"}, existing),
+			[]byte("newCABundle"), NamespaceControllerOptions{})
+		return nc
+	}
+	liveBundle := func(t *testing.T, client *fake.Clientset) *v1.ConfigMap {
+		cm, err := client.CoreV1().ConfigMaps("foo").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cm
+	}
+
+	t.Run("recreated", func(t *testing.T) {
+		client := fake.NewSimpleClientset(existing.DeepCopy())
+		nc := newController(t, client)
+		if err := nc.insertDataForNamespace(types.NamespacedName{Name: "foo"}); err != nil {
+			t.Fatal(err)
+		}
+		deletes, creates := configMapActions(client, "delete"), configMapActions(client, "create")
+		if deletes != 1 || creates != 1 {
+			t.Fatalf("expected the configmap to be deleted and recreated, got %d deletes and %d creates", deletes, creates)
+		}
+		cm := liveBundle(t, client)
+		if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != "newCABundle" {
+			t.Fatalf("expected the recreated configmap to hold the new bundle, got %q", got)
+		}
+		if cm.Immutable == nil || !*cm.Immutable {
+			t.Fatal("expected the recreated configmap to stay immutable")
+		}
+	})
+
+	t.Run("delete forbidden", func(t *testing.T) {
+		client := fake.NewSimpleClientset(existing.DeepCopy())
+		client.PrependReactor("delete", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(v1.Resource("configmaps"), CACertNamespaceConfigMap, fmt.Errorf("denied"))
+		})
+		nc := newController(t, client)
+		// Retrying cannot succeed, so the namespace is not handed back to the queue.
+		if err := nc.insertDataForNamespace(types.NamespacedName{Name: "foo"}); err != nil {
+			t.Fatalf("expected the immutable configmap not to be retried, got %v", err)
+		}
+		if got := liveBundle(t, client).Data[constants.CACertNamespaceConfigMapDataName]; got != "oldCABundle" {
+			t.Fatalf("expected the configmap to be left alone, got %q", got)
+		}
+	})
+}
+
+func TestNamespaceController_ManageOnlyOwned(t *testing.T) {
+	owned := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: CACertNamespaceConfigMap, Namespace: "foo", Labels: configMapLabel},
+		Data:       map[string]string{constants.CACertNamespaceConfigMapDataName: "oldCABundle"},
+	}
+	foreign := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CACertNamespaceConfigMap,
+			Namespace: "foo",
+			Labels:    map[string]string{"team": "mesh"},
+		},
+		Data: map[string]string{constants.CACertNamespaceConfigMapDataName: "oldCABundle"},
+	}
+	cases := []struct {
+		name            string
+		existing        *v1.ConfigMap
+		manageOnlyOwned bool
+		want            string
+	}{
+		{name: "owned", existing: owned, want: "newCABundle"},
+		{name: "foreign", existing: foreign, want: "newCABundle"},
+		{name: "owned, only owned", existing: owned, manageOnlyOwned: true, want: "newCABundle"},
+		{name: "foreign, only owned", existing: foreign, manageOnlyOwned: true, want: "oldCABundle"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tc.existing.DeepCopy())
+			nc, _ := newTestNamespaceControllerWithListers(t, client, newTestListers(t, []string{"foo"}, tc.existing),
+				[]byte("newCABundle"), NamespaceControllerOptions{ManageOnlyOwned: tc.manageOnlyOwned})
+
+			if err := nc.insertDataForNamespace(types.NamespacedName{Name: "foo"}); err != nil {
+				t.Fatal(err)
+			}
+			cm, err := client.CoreV1().ConfigMaps("foo").Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != tc.want {
+				t.Fatalf("expected the configmap to hold %q, got %q", tc.want, got)
+			}
+			if tc.want == "oldCABundle" && configMapActions(client, "update") != 0 {
+				t.Fatal("expected the foreign configmap not to be written")
+			}
+		})
+	}
+}
+
+func TestNamespaceController_OnReconcile(t *testing.T) {
+	type result struct {
+		ns  string
+		err error
+	}
+	results := make(chan result, 100)
+	// No CA bundle yet, so reconciles fail until one is set.
+	nc, watcher := newTestNamespaceControllerWithListers(t, fake.NewSimpleClientset(), newTestListers(t, []string{"foo"}), nil,
+		NamespaceControllerOptions{
+			OnReconcile: func(ns string, err error) {
+				results <- result{ns, err}
+			},
+		})
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	go nc.Run(stop)
+
+	nc.syncNamespace("foo")
+	select {
+	case r := <-results:
+		if r.ns != "foo" || r.err == nil {
+			t.Fatalf("expected a failed reconcile of foo, got %q: %v", r.ns, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the failed reconcile")
+	}
+
+	watcher.SetAndNotify(nil, nil, []byte("caBundle"))
+	nc.syncNamespace("foo")
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r := <-results:
+			if r.ns != "foo" {
+				t.Fatalf("expected a reconcile of foo, got %q", r.ns)
+			}
+			if r.err == nil {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a successful reconcile")
+		}
+	}
+}
+
+// configMapWrites returns the number of configmap creates and updates the client has received.
+func configMapWrites(client *fake.Clientset) int {
+	writes := 0
+	for _, a := range client.Actions() {
+		if a.GetResource().Resource == "configmaps" && (a.GetVerb() == "create" || a.GetVerb() == "update") {
+			writes++
+		}
+	}
+	return writes
+}
+
+// configMapActions returns the number of configmap actions with the given verb the client has received.
+func configMapActions(client *fake.Clientset, verb string) int {
+	actions := 0
+	for _, a := range client.Actions() {
+		if a.GetResource().Resource == "configmaps" && a.GetVerb() == verb {
+			actions++
+		}
+	}
+	return actions
+}
+
+func createNamespaceWithUID(t *testing.T, client kubernetes.Interface, ns string, uid types.UID) {
+	t.Helper()
+	if _, err := client.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: ns, UID: uid},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectOwnerReference(t *testing.T, client listerv1.ConfigMapLister, ns string, uid types.UID) {
+	t.Helper()
+	retry.UntilSuccessOrFail(t, func() error {
+		cm, err := client.ConfigMaps(ns).Get(CACertNamespaceConfigMap)
+		if err != nil {
+			return err
+		}
+		expected := []metav1.OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: ns, UID: uid}}
+		if !reflect.DeepEqual(cm.OwnerReferences, expected) {
+			return fmt.Errorf("owner references mismatch, expected %+v got %+v", expected, cm.OwnerReferences)
+		}
+		return nil
+	}, retry.Timeout(time.Second*10))
+}
+
 func deleteConfigMap(t *testing.T, client kubernetes.Interface, ns string) {
 	t.Helper()
 	_, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), CACertNamespaceConfigMap, metav1.GetOptions{})
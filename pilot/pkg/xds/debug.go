@@ -203,6 +203,7 @@ func (s *DiscoveryServer) AddDebugHandlers(mux, internalMux *http.ServeMux, enab
 	s.addDebugHandler(mux, internalMux, "/debug/inject", "Active inject template", s.injectTemplateHandler(webhook))
 	s.addDebugHandler(mux, internalMux, "/debug/mesh", "Active mesh config", s.meshHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/clusterz", "List remote clusters where istiod reads endpoints", s.clusterz)
+	s.addDebugHandler(mux, internalMux, "/debug/ca_bundle_resync", "Redistributes the CA bundle to every namespace (POST)", s.caBundleResync)
 	s.addDebugHandler(mux, internalMux, "/debug/networkz", "List cross-network gateways", s.networkz)
 	s.addDebugHandler(mux, internalMux, "/debug/mcsz", "List information about Kubernetes MCS services", s.mcsz)
 
@@ -960,6 +961,20 @@ func (s *DiscoveryServer) clusterz(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, s.ListRemoteClusters())
 }
 
+// caBundleResync redistributes the CA bundle to every namespace, for root changes the CA bundle watcher does not see.
+func (s *DiscoveryServer) caBundleResync(w http.ResponseWriter, req *http.Request) {
+	if s.ResyncCABundle == nil {
+		w.WriteHeader(400)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.ResyncCABundle()
+	_, _ = w.Write([]byte("Triggered CA bundle resync\n"))
+}
+
 // handlePushRequest handles a ?push=true query param and triggers a push.
 // A boolean response is returned to indicate if the caller should continue
 func (s *DiscoveryServer) handlePushRequest(w http.ResponseWriter, req *http.Request) bool {
@@ -213,3 +213,33 @@ func TestDebugHandlers(t *testing.T) {
 		t.Errorf("Error in generatating debug endpoint list")
 	}
 }
+
+func TestCABundleResync(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	resyncs := 0
+	s.Discovery.ResyncCABundle = func() { resyncs++ }
+	mux, internalMux := http.NewServeMux(), http.NewServeMux()
+	s.Discovery.AddDebugHandlers(mux, internalMux, false, nil)
+
+	for _, tt := range []struct {
+		method   string
+		wantCode int
+		want     int
+	}{
+		{method: "GET", wantCode: http.StatusMethodNotAllowed, want: 0},
+		{method: "POST", wantCode: http.StatusOK, want: 1},
+	} {
+		req, err := http.NewRequest(tt.method, "/debug/ca_bundle_resync", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		internalMux.ServeHTTP(rr, req)
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: wanted response code %v, got %v", tt.method, tt.wantCode, rr.Code)
+		}
+		if resyncs != tt.want {
+			t.Errorf("%s: wanted %d resyncs, got %d", tt.method, tt.want, resyncs)
+		}
+	}
+}
@@ -122,6 +122,13 @@ const (
 	// Label to skip config comparison.
 	AlwaysPushLabel = "internal.istio.io/always-push"
 
+	// CARootSuppressedLabel on a namespace, set to "true", makes istiod delete the CA root configmap of the namespace
+	// and stop writing it. The test framework sets it before deleting a namespace.
+	CARootSuppressedLabel = "internal.istio.io/ca-root-suppressed"
+
+	// CARootSuppressibleLabel marks a CA root configmap written by an istiod that honors CARootSuppressedLabel.
+	CARootSuppressibleLabel = "internal.istio.io/ca-root-suppressible"
+
 	// InternalParentName declares the original resource of an internally-generate config. This is used by the gateway-api.
 	InternalParentName = "internal.istio.io/parent"
 
@@ -0,0 +1,66 @@
+//  Copyright Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package echo
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// CallEdge is a single call from one echo instance to a destination, as observed by the caller.
+type CallEdge struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Host        string    `json:"host,omitempty"`
+	Protocol    string    `json:"protocol"`
+	Status      string    `json:"status,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+var callGraph struct {
+	mu   sync.Mutex
+	path string
+}
+
+// EnableCallGraph makes RecordCall append every call to the file at path, one JSON object per line.
+func EnableCallGraph(path string) {
+	callGraph.mu.Lock()
+	defer callGraph.mu.Unlock()
+	callGraph.path = path
+}
+
+// RecordCall appends the call to the call graph file, if enabled. Failures to record are returned, but are not
+// expected to fail the call.
+func RecordCall(edge CallEdge) error {
+	callGraph.mu.Lock()
+	defer callGraph.mu.Unlock()
+	if callGraph.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(edge)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(callGraph.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
@@ -48,6 +48,7 @@ var (
 	crt              string
 	key              string
 	istioVersion     string
+	istioRevision    string
 	disableALPN      bool
 
 	loggingOptions = log.DefaultOptions()
@@ -123,6 +124,7 @@ var (
 				Version:               version,
 				Cluster:               cluster,
 				IstioVersion:          istioVersion,
+				IstioRevision:         istioRevision,
 				UDSServer:             uds,
 				DisableALPN:           disableALPN,
 			})
@@ -166,6 +168,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&crt, "crt", "", "gRPC TLS server-side certificate")
 	rootCmd.PersistentFlags().StringVar(&key, "key", "", "gRPC TLS server-side key")
 	rootCmd.PersistentFlags().StringVar(&istioVersion, "istio-version", "", "Istio sidecar version")
+	rootCmd.PersistentFlags().StringVar(&istioRevision, "istio-revision", "", "Istio control plane revision")
 	rootCmd.PersistentFlags().BoolVar(&disableALPN, "disable-alpn", disableALPN, "disable ALPN negotiation")
 
 	loggingOptions.AttachCobraFlags(rootCmd)
@@ -32,9 +32,11 @@ const (
 	MethodField         Field = "Method"
 	ProtocolField       Field = "Proto"
 	AlpnField           Field = "Alpn"
+	SNIField            Field = "SNI"
 	RequestHeaderField  Field = "RequestHeader"
 	ResponseHeaderField Field = "ResponseHeader"
 	ClusterField        Field = "Cluster"
 	IstioVersionField   Field = "IstioVersion"
+	IstioRevisionField  Field = "IstioRevision"
 	IPField             Field = "IP" // The Requester’s IP Address.
 )
@@ -34,10 +34,12 @@ var (
 	URLFieldRegex            = regexp.MustCompile(string(URLField) + "=(.*)")
 	ClusterFieldRegex        = regexp.MustCompile(string(ClusterField) + "=(.*)")
 	IstioVersionFieldRegex   = regexp.MustCompile(string(IstioVersionField) + "=(.*)")
+	IstioRevisionFieldRegex  = regexp.MustCompile(string(IstioRevisionField) + "=(.*)")
 	IPFieldRegex             = regexp.MustCompile(string(IPField) + "=(.*)")
 	methodFieldRegex         = regexp.MustCompile(string(MethodField) + "=(.*)")
 	protocolFieldRegex       = regexp.MustCompile(string(ProtocolField) + "=(.*)")
 	alpnFieldRegex           = regexp.MustCompile(string(AlpnField) + "=(.*)")
+	sniFieldRegex            = regexp.MustCompile(string(SNIField) + "=(.*)")
 )
 
 func ParseResponses(req *proto.ForwardEchoRequest, resp *proto.ForwardEchoResponse) Responses {
@@ -76,6 +78,11 @@ func parseResponse(output string) Response {
 		out.Alpn = match[1]
 	}
 
+	match = sniFieldRegex.FindStringSubmatch(output)
+	if match != nil {
+		out.SNI = match[1]
+	}
+
 	match = serviceVersionFieldRegex.FindStringSubmatch(output)
 	if match != nil {
 		out.Version = match[1]
@@ -116,6 +123,11 @@ func parseResponse(output string) Response {
 		out.IstioVersion = match[1]
 	}
 
+	match = IstioRevisionFieldRegex.FindStringSubmatch(output)
+	if match != nil {
+		out.IstioRevision = match[1]
+	}
+
 	match = IPFieldRegex.FindStringSubmatch(output)
 	if match != nil {
 		out.IP = match[1]
@@ -32,6 +32,8 @@ type Response struct {
 	Protocol string
 	// Alpn value (for HTTP).
 	Alpn string
+	// SNI received by the server (for HTTPS).
+	SNI string
 	// RawContent is the original unparsed content for this response
 	RawContent string
 	// ID is a unique identifier of the resource in the response
@@ -52,6 +54,8 @@ type Response struct {
 	Cluster string
 	// IstioVersion for the Istio sidecar.
 	IstioVersion string
+	// IstioRevision of the control plane the server is attached to.
+	IstioRevision string
 	// IP is the requester's ip address
 	IP string
 	// rawBody gives a map of all key/values in the body of the response.
@@ -92,6 +96,7 @@ func (r Response) String() string {
 	out += fmt.Sprintf("Method:           %s\n", r.Method)
 	out += fmt.Sprintf("Protocol:         %s\n", r.Protocol)
 	out += fmt.Sprintf("Alpn:             %s\n", r.Alpn)
+	out += fmt.Sprintf("SNI:              %s\n", r.SNI)
 	out += fmt.Sprintf("URL:              %s\n", r.URL)
 	out += fmt.Sprintf("Version:          %s\n", r.Version)
 	out += fmt.Sprintf("Port:             %s\n", r.Port)
@@ -100,6 +105,7 @@ func (r Response) String() string {
 	out += fmt.Sprintf("Hostname:         %s\n", r.Hostname)
 	out += fmt.Sprintf("Cluster:          %s\n", r.Cluster)
 	out += fmt.Sprintf("IstioVersion:     %s\n", r.IstioVersion)
+	out += fmt.Sprintf("IstioRevision:    %s\n", r.IstioRevision)
 	out += fmt.Sprintf("IP:               %s\n", r.IP)
 	out += fmt.Sprintf("Request Headers:  %v\n", r.RequestHeaders)
 	out += fmt.Sprintf("Response Headers: %v\n", r.ResponseHeaders)
@@ -277,6 +277,7 @@ func (h *grpcHandler) Echo(ctx context.Context, req *proto.EchoRequest) (*proto.
 	writeField(&body, echo.ClusterField, h.Cluster)
 	writeField(&body, echo.IPField, ip)
 	writeField(&body, echo.IstioVersionField, h.IstioVersion)
+	writeField(&body, echo.IstioRevisionField, h.IstioRevision)
 	writeField(&body, echo.ProtocolField, "GRPC")
 	writeField(&body, "Echo", req.GetMessage())
 
@@ -314,6 +314,7 @@ func (h *httpHandler) addResponsePayload(r *http.Request, body *bytes.Buffer) {
 	writeField(body, echo.URLField, r.RequestURI)
 	writeField(body, echo.ClusterField, h.Cluster)
 	writeField(body, echo.IstioVersionField, h.IstioVersion)
+	writeField(body, echo.IstioRevisionField, h.IstioRevision)
 
 	writeField(body, echo.MethodField, r.Method)
 	writeField(body, echo.ProtocolField, r.Proto)
@@ -322,11 +323,13 @@ func (h *httpHandler) addResponsePayload(r *http.Request, body *bytes.Buffer) {
 
 	// Note: since this is the NegotiatedProtocol, it will be set to empty if the client sends an ALPN
 	// not supported by the server (ie one of h2,http/1.1,http/1.0)
-	var alpn string
+	var alpn, sni string
 	if r.TLS != nil {
 		alpn = r.TLS.NegotiatedProtocol
+		sni = r.TLS.ServerName
 	}
 	writeField(body, echo.AlpnField, alpn)
+	writeField(body, echo.SNIField, sni)
 
 	var keys []string
 	for k := range r.Header {
@@ -152,6 +152,7 @@ func (s *tcpInstance) writeResponse(conn net.Conn) {
 		echo.StatusCodeField:     strconv.Itoa(http.StatusOK),
 		echo.ClusterField:        s.Cluster,
 		echo.IstioVersionField:   s.IstioVersion,
+		echo.IstioRevisionField:  s.IstioRevision,
 		echo.ServiceVersionField: s.Version,
 		echo.ServicePortField:    strconv.Itoa(s.Port.Port),
 		echo.IPField:             ip,
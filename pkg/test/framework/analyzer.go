@@ -226,6 +226,10 @@ func (t *testAnalyzer) RequiresSingleNetwork() Test {
 	return t
 }
 
+func (t *testAnalyzer) RequiresAlphaFeatures(...resource.AlphaFeature) Test {
+	return t
+}
+
 func (t *testAnalyzer) Run(_ func(ctx TestContext)) {
 	defer t.track()
 	if t.hasRun {
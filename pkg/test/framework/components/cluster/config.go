@@ -36,4 +36,8 @@ type Config struct {
 	PrimaryClusterName string     `yaml:"primaryClusterName,omitempty"`
 	ConfigClusterName  string     `yaml:"configClusterName,omitempty"`
 	Meta               config.Map `yaml:"meta,omitempty"`
+
+	// KubeQPS and KubeBurst, if set, override the rate limits of the Kubernetes client.
+	KubeQPS   float32 `yaml:"-"`
+	KubeBurst int     `yaml:"-"`
 }
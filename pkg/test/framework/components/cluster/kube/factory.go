@@ -29,6 +29,9 @@ import (
 const (
 	kubeconfigMetaKey = "kubeconfig"
 	vmSupportMetaKey  = "fakeVM"
+
+	defaultKubeQPS   = 200
+	defaultKubeBurst = 400
 )
 
 func init() {
@@ -53,12 +56,12 @@ func buildKube(origCfg cluster.Config, topology cluster.Topology) (cluster.Clust
 		if err != nil {
 			return nil, err
 		}
-		client, err = buildClientWithProxy(kubeconfigPath, proxyURL)
+		client, err = buildClientWithProxy(kubeconfigPath, proxyURL, rateLimits(cfg))
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		client, err = buildClient(kubeconfigPath)
+		client, err = buildClient(kubeconfigPath, rateLimits(cfg))
 		if err != nil {
 			return nil, err
 		}
@@ -86,22 +89,30 @@ func validConfig(cfg cluster.Config) (cluster.Config, error) {
 	return cfg, nil
 }
 
-func buildClient(kubeconfig string) (istioKube.ExtendedClient, error) {
-	rc, err := istioKube.DefaultRestConfig(kubeconfig, "", func(config *rest.Config) {
-		config.QPS = 200
-		config.Burst = 400
-	})
+// rateLimits returns a function setting the client rate limits configured for the cluster, or the defaults.
+func rateLimits(cfg cluster.Config) func(*rest.Config) {
+	return func(config *rest.Config) {
+		config.QPS = defaultKubeQPS
+		config.Burst = defaultKubeBurst
+		if cfg.KubeQPS > 0 {
+			config.QPS = cfg.KubeQPS
+		}
+		if cfg.KubeBurst > 0 {
+			config.Burst = cfg.KubeBurst
+		}
+	}
+}
+
+func buildClient(kubeconfig string, rateLimits func(*rest.Config)) (istioKube.ExtendedClient, error) {
+	rc, err := istioKube.DefaultRestConfig(kubeconfig, "", rateLimits)
 	if err != nil {
 		return nil, err
 	}
 	return istioKube.NewExtendedClient(istioKube.NewClientConfigForRestConfig(rc), "")
 }
 
-func buildClientWithProxy(kubeconfig string, proxyURL *url.URL) (istioKube.ExtendedClient, error) {
-	rc, err := istioKube.DefaultRestConfig(kubeconfig, "", func(config *rest.Config) {
-		config.QPS = 200
-		config.Burst = 400
-	})
+func buildClientWithProxy(kubeconfig string, proxyURL *url.URL, rateLimits func(*rest.Config)) (istioKube.ExtendedClient, error) {
+	rc, err := istioKube.DefaultRestConfig(kubeconfig, "", rateLimits)
 	if err != nil {
 		return nil, err
 	}
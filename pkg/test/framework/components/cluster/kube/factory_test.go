@@ -0,0 +1,53 @@
+//  Copyright Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	"k8s.io/client-go/rest"
+
+	"istio.io/istio/pkg/test/framework/components/cluster"
+)
+
+func TestRateLimits(t *testing.T) {
+	cases := []struct {
+		name      string
+		cfg       cluster.Config
+		wantQPS   float32
+		wantBurst int
+	}{
+		{
+			name:      "defaults",
+			wantQPS:   defaultKubeQPS,
+			wantBurst: defaultKubeBurst,
+		},
+		{
+			name:      "overridden",
+			cfg:       cluster.Config{KubeQPS: 1000, KubeBurst: 2000},
+			wantQPS:   1000,
+			wantBurst: 2000,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &rest.Config{}
+			rateLimits(tc.cfg)(rc)
+			if rc.QPS != tc.wantQPS || rc.Burst != tc.wantBurst {
+				t.Errorf("expected QPS/burst %v/%v, got %v/%v", tc.wantQPS, tc.wantBurst, rc.QPS, rc.Burst)
+			}
+		})
+	}
+}
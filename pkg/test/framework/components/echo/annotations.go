@@ -46,6 +46,7 @@ var (
 	SidecarIncludeOutboundIPRanges = workloadAnnotation(annotation.SidecarTrafficIncludeOutboundIPRanges.Name, "")
 	SidecarProxyConfig             = workloadAnnotation(annotation.ProxyConfig.Name, "")
 	SidecarInjectTemplates         = workloadAnnotation(annotation.InjectTemplates.Name, "")
+	SidecarProxyCPU                = workloadAnnotation(annotation.SidecarProxyCPU.Name, "")
 )
 
 type AnnotationValue struct {
@@ -121,6 +121,7 @@ func callInternal(srcName string, opts *echo.CallOptions, send sendFunc,
 		// Add defaults retry options to the beginning, since last option encountered wins.
 		retryOptions = append(append([]retry.Option{}, echo.DefaultCallRetryOptions()...), retryOptions...)
 		err := retry.UntilSuccess(sendAndValidate, retryOptions...)
+		recordCall(srcName, opts, responses, err)
 		return responses, formatError(err)
 	}
 
@@ -128,9 +129,36 @@ func callInternal(srcName string, opts *echo.CallOptions, send sendFunc,
 	// Retry not enabled for this call.
 	err := sendAndValidate()
 	scopes.Framework.Debugf("echo call complete with duration %v", time.Since(t0))
+	recordCall(srcName, opts, responses, err)
 	return responses, formatError(err)
 }
 
+// recordCall adds the outcome of a call to the call graph, if --istio.test.callGraphDump is enabled.
+func recordCall(srcName string, opts *echo.CallOptions, responses echoclient.Responses, err error) {
+	edge := echoclient.CallEdge{
+		Source:      srcName,
+		Destination: opts.Address,
+		Host:        opts.GetHost(),
+		Protocol:    string(opts.Port.Protocol),
+		Timestamp:   time.Now(),
+	}
+	if opts.Target != nil {
+		edge.Destination = opts.Target.Config().ClusterLocalFQDN()
+	}
+	if opts.Scheme == scheme.DNS || opts.Scheme == scheme.XDS {
+		edge.Protocol = string(opts.Scheme)
+	}
+	if len(responses) > 0 {
+		edge.Status = responses[len(responses)-1].Code
+	}
+	if err != nil {
+		edge.Error = err.Error()
+	}
+	if err := echoclient.RecordCall(edge); err != nil {
+		scopes.Framework.Warnf("failed recording echo call from %s to %s: %v", srcName, edge.Destination, err)
+	}
+}
+
 func CallEcho(opts *echo.CallOptions, retry bool, retryOptions ...retry.Option) (echoclient.Responses, error) {
 	send := func(req *proto.ForwardEchoRequest) (echoclient.Responses, error) {
 		instance, err := forwarder.New(forwarder.Config{
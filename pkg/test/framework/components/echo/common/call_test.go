@@ -0,0 +1,83 @@
+//  Copyright Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"istio.io/istio/pkg/config/protocol"
+	echoclient "istio.io/istio/pkg/test/echo"
+	"istio.io/istio/pkg/test/echo/proto"
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+func TestCallGraph(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "echo-call-graph.jsonl")
+	echoclient.EnableCallGraph(path)
+	t.Cleanup(func() {
+		echoclient.EnableCallGraph("")
+	})
+
+	ok := func(req *proto.ForwardEchoRequest) (echoclient.Responses, error) {
+		return echoclient.Responses{{Code: "200"}}, nil
+	}
+	blackholed := func(req *proto.ForwardEchoRequest) (echoclient.Responses, error) {
+		return nil, errors.New("connection reset")
+	}
+	if _, err := callInternal("client", &echo.CallOptions{
+		Address: "10.0.0.1",
+		Port:    &echo.Port{Name: "http", Protocol: protocol.HTTP, ServicePort: 80},
+		Headers: http.Header{"Host": {"some-external-site.com"}},
+	}, ok, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callInternal("client", &echo.CallOptions{
+		Address: "10.0.0.1",
+		Port:    &echo.Port{Name: "tcp", Protocol: protocol.TCP, ServicePort: 9090},
+	}, blackholed, false); err == nil {
+		t.Fatal("expected the call to fail")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var edges []echoclient.CallEdge
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var edge echoclient.CallEdge
+		if err := json.Unmarshal(scanner.Bytes(), &edge); err != nil {
+			t.Fatal(err)
+		}
+		edges = append(edges, edge)
+	}
+	if len(edges) != 2 {
+		t.Fatalf("expected 2 edges, got %+v", edges)
+	}
+	if e := edges[0]; e.Source != "client" || e.Destination != "10.0.0.1" || e.Host != "some-external-site.com" ||
+		e.Protocol != "HTTP" || e.Status != "200" || e.Error != "" || e.Timestamp.IsZero() {
+		t.Errorf("unexpected edge for the HTTP call: %+v", e)
+	}
+	if e := edges[1]; e.Protocol != "TCP" || e.Status != "" || e.Error == "" {
+		t.Errorf("unexpected edge for the failed TCP call: %+v", e)
+	}
+}
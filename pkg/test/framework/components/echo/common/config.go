@@ -17,6 +17,7 @@ package common
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/protocol"
@@ -67,6 +68,7 @@ func FillInDefaults(ctx resource.Context, c *echo.Config) (err error) {
 			c.Subsets[i].Version = c.Version
 		}
 	}
+	filterEchoProtocols(ctx, c)
 	AddPortIfMissing(c, protocol.GRPC)
 	// If no namespace was provided, use the default.
 	if c.Namespace == nil && ctx != nil {
@@ -133,12 +135,47 @@ func FillInDefaults(ctx resource.Context, c *echo.Config) (err error) {
 	// If readiness probe is not specified by a test, wait a long time
 	// Waiting forever would cause the test to timeout and lose logs
 	if c.ReadinessTimeout == 0 {
-		c.ReadinessTimeout = echo.DefaultReadinessTimeout()
+		c.ReadinessTimeout = readinessTimeout(ctx)
 	}
 
 	return nil
 }
 
+// readinessTimeout returns how long to wait for echo workloads to become ready, preferring
+// --istio.test.echoReadyTimeout over --istio.test.echo.readinessTimeout.
+func readinessTimeout(ctx resource.Context) time.Duration {
+	if ctx != nil && ctx.Settings() != nil && ctx.Settings().EchoReadyTimeout > 0 {
+		return ctx.Settings().EchoReadyTimeout
+	}
+	return echo.DefaultReadinessTimeout()
+}
+
+// filterEchoProtocols drops the ports whose protocols are not in --istio.test.echoProtocols, if set. A gRPC port is
+// added back afterwards if none is left, since the framework drives the echo workloads through it.
+func filterEchoProtocols(ctx resource.Context, c *echo.Config) {
+	if ctx == nil || ctx.Settings() == nil || len(ctx.Settings().EchoProtocols) == 0 {
+		return
+	}
+	allowed := map[protocol.Instance]bool{}
+	for _, p := range ctx.Settings().EchoProtocols {
+		allowed[p] = true
+	}
+	var ports []echo.Port
+	for _, p := range c.Ports {
+		if allowed[p.Protocol] {
+			ports = append(ports, p)
+		}
+	}
+	c.Ports = ports
+	var workloadPorts []echo.WorkloadPort
+	for _, p := range c.WorkloadOnlyPorts {
+		if allowed[p.Protocol] {
+			workloadPorts = append(workloadPorts, p)
+		}
+	}
+	c.WorkloadOnlyPorts = workloadPorts
+}
+
 // GetPortForProtocol returns the first port found with the given protocol, or nil if none was found.
 func GetPortForProtocol(c *echo.Config, protocol protocol.Instance) *echo.Port {
 	for _, p := range c.Ports {
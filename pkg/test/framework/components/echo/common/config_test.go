@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+// settingsContext is a resource.Context that only provides settings.
+type settingsContext struct {
+	resource.Context
+	settings *resource.Settings
+}
+
+func (c settingsContext) Settings() *resource.Settings {
+	return c.settings
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	cases := []struct {
+		name     string
+		ctx      resource.Context
+		expected time.Duration
+	}{
+		{
+			name:     "no context",
+			expected: echo.DefaultReadinessTimeout(),
+		},
+		{
+			name:     "unset",
+			ctx:      settingsContext{settings: &resource.Settings{}},
+			expected: echo.DefaultReadinessTimeout(),
+		},
+		{
+			name:     "echoReadyTimeout",
+			ctx:      settingsContext{settings: &resource.Settings{EchoReadyTimeout: 25 * time.Minute}},
+			expected: 25 * time.Minute,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := echo.Config{Namespace: namespace.Static("echo")}
+			if err := FillInDefaults(tc.ctx, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			// The workload manager waits for readiness for the config's timeout.
+			if cfg.ReadinessTimeout != tc.expected {
+				t.Errorf("expected readiness timeout %v, got %v", tc.expected, cfg.ReadinessTimeout)
+			}
+		})
+	}
+}
+
+func TestFillInDefaultsEchoProtocols(t *testing.T) {
+	cases := []struct {
+		name             string
+		protocols        []protocol.Instance
+		expected         []string
+		expectedWorkload []protocol.Instance
+	}{
+		{
+			name: "unset",
+			expected: []string{
+				"http", "grpc", "http2", "tcp", "https", "tcp-server", "auto-tcp", "auto-tcp-server", "auto-http",
+				"auto-grpc", "auto-https", "http-instance", "http-localhost",
+			},
+			expectedWorkload: []protocol.Instance{protocol.TCP, protocol.HTTP},
+		},
+		{
+			name:             "http",
+			protocols:        []protocol.Instance{protocol.HTTP},
+			expected:         []string{"grpc", "http", "http2", "auto-http", "http-instance", "http-localhost"},
+			expectedWorkload: []protocol.Instance{protocol.HTTP},
+		},
+		{
+			name:      "grpc and tls",
+			protocols: []protocol.Instance{protocol.GRPC, protocol.HTTPS},
+			expected:  []string{"grpc", "https", "auto-grpc", "auto-https"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := echo.Config{
+				Namespace:         namespace.Static("echo"),
+				Ports:             EchoPorts,
+				WorkloadOnlyPorts: WorkloadPorts,
+			}
+			ctx := settingsContext{settings: &resource.Settings{EchoProtocols: tc.protocols}}
+			if err := FillInDefaults(ctx, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, p := range cfg.Ports {
+				names = append(names, p.Name)
+			}
+			if diff := cmp.Diff(tc.expected, names); diff != "" {
+				t.Errorf("unexpected ports (-want +got):\n%s", diff)
+			}
+			var workloadProtocols []protocol.Instance
+			for _, p := range cfg.WorkloadOnlyPorts {
+				workloadProtocols = append(workloadProtocols, p.Protocol)
+			}
+			if diff := cmp.Diff(tc.expectedWorkload, workloadProtocols); diff != "" {
+				t.Errorf("unexpected workload only ports (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if len(EchoPorts) != 13 {
+		t.Fatalf("expected the default echo ports not to be modified, got %d", len(EchoPorts))
+	}
+}
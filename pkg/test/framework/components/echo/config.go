@@ -76,6 +76,10 @@ type Config struct {
 	// Headless (k8s only) indicates that no ClusterIP should be specified.
 	Headless bool
 
+	// IPFamilyPolicy (k8s only) sets the ipFamilyPolicy of the Service (e.g. PreferDualStack). If not provided,
+	// the cluster default is used.
+	IPFamilyPolicy string
+
 	// StatefulSet indicates that the pod should be backed by a StatefulSet. This implies Headless=true
 	// as well.
 	StatefulSet bool
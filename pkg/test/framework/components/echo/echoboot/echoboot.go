@@ -39,6 +39,7 @@ import (
 	"istio.io/istio/pkg/test/framework/components/istio"
 	"istio.io/istio/pkg/test/framework/components/namespace"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/framework/tracing"
 	"istio.io/istio/pkg/test/scopes"
 )
 
@@ -166,15 +167,20 @@ func (b builder) WithClusters(clusters ...cluster.Cluster) echo.Builder {
 }
 
 func (b builder) Build() (out echo.Instances, err error) {
+	span := tracing.Start("echo.deploy")
+	defer span.End()
 	return build(b)
 }
 
 // injectionTemplates lists the set of templates for each Kube cluster
 func (b builder) injectionTemplates() (map[string]sets.Set, error) {
-	ns := "istio-system"
+	ns := istio.DefaultSystemNamespace
+	if b.ctx.Settings().SystemNamespace != "" {
+		ns = b.ctx.Settings().SystemNamespace
+	}
 	i, err := istio.Get(b.ctx)
 	if err != nil {
-		scopes.Framework.Infof("defaulting to istio-system namespace for injection template discovery: %v", err)
+		scopes.Framework.Infof("defaulting to %s namespace for injection template discovery: %v", ns, err)
 	} else {
 		ns = i.Settings().SystemNamespace
 	}
@@ -32,6 +32,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
+	"istio.io/api/annotation"
 	"istio.io/api/label"
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pkg/config/constants"
@@ -78,6 +79,9 @@ metadata:
 spec:
 {{- if .Headless }}
   clusterIP: None
+{{- end }}
+{{- if .IPFamilyPolicy }}
+  ipFamilyPolicy: {{ .IPFamilyPolicy }}
 {{- end }}
   ports:
 {{- range $i, $p := .Ports }}
@@ -111,7 +115,7 @@ spec:
   {{- if $.StatefulSet }}
   serviceName: {{ $.Service }}
   {{- end }}
-  replicas: 1
+  replicas: {{ $.Replicas }}
   selector:
     matchLabels:
       app: {{ $.Service }}
@@ -136,6 +140,11 @@ spec:
         prometheus.io/port: "15014"
 {{- range $name, $value := $subset.Annotations }}
         {{ $name.Name }}: {{ printf "%q" $value.Value }}
+{{- end }}
+{{- range $name, $value := $.SidecarResources }}
+{{- if eq ($subset.Annotations.GetByName $name) "" }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
 {{- end }}
     spec:
 {{- if $.ServiceAccount }}
@@ -218,6 +227,10 @@ spec:
           - "{{ $subset.Version }}"
           - --istio-version
           - "{{ $version }}"
+{{- if $revision }}
+          - --istio-revision
+          - "{{ $revision }}"
+{{- end }}
 {{- if $.TLSSettings }}
           - --crt=/etc/certs/custom/cert-chain.pem
           - --key=/etc/certs/custom/key.pem
@@ -660,6 +673,11 @@ func templateParams(cfg echo.Config, imgSettings *image.Settings, settings *reso
 		}
 	}
 	supportStartupProbe := cfg.Cluster.MinKubeVersion(0)
+	replicas := settings.EchoReplicas
+	if replicas < 1 {
+		// Settings that were not read from the command line leave it unset.
+		replicas = 1
+	}
 
 	vmImage := VMImages[cfg.VMDistro]
 	if vmImage == "" {
@@ -681,6 +699,7 @@ func templateParams(cfg echo.Config, imgSettings *image.Settings, settings *reso
 		"Service":            cfg.Service,
 		"Version":            cfg.Version,
 		"Headless":           cfg.Headless,
+		"IPFamilyPolicy":     cfg.IPFamilyPolicy,
 		"StatefulSet":        cfg.StatefulSet,
 		"ProxylessGRPC":      cfg.IsProxylessGRPC(),
 		"GRPCMagicPort":      grpcMagicPort,
@@ -691,6 +710,7 @@ func templateParams(cfg echo.Config, imgSettings *image.Settings, settings *reso
 		"ContainerPorts":     getContainerPorts(cfg),
 		"ServiceAnnotations": cfg.ServiceAnnotations,
 		"Subsets":            cfg.Subsets,
+		"Replicas":           replicas,
 		"TLSSettings":        cfg.TLSSettings,
 		"Cluster":            cfg.Cluster.Name(),
 		"Namespace":          namespace,
@@ -706,10 +726,28 @@ func templateParams(cfg echo.Config, imgSettings *image.Settings, settings *reso
 		"Compatibility":     settings.Compatibility,
 		"Class":             cfg.Class(),
 		"OverlayIstioProxy": canCreateIstioProxy(settings.Revisions.Minimum()),
+		"SidecarResources":  sidecarResourceAnnotations(settings.SidecarResources),
 	}
 	return params, nil
 }
 
+// sidecarResourceAnnotations returns the injection annotations that apply the resources to the sidecar. Annotations
+// set on a subset take precedence.
+func sidecarResourceAnnotations(r resource.SidecarResources) map[string]string {
+	out := map[string]string{}
+	for name, value := range map[string]string{
+		annotation.SidecarProxyCPU.Name:         r.CPURequest,
+		annotation.SidecarProxyMemory.Name:      r.MemoryRequest,
+		annotation.SidecarProxyCPULimit.Name:    r.CPULimit,
+		annotation.SidecarProxyMemoryLimit.Name: r.MemoryLimit,
+	} {
+		if value != "" {
+			out[name] = value
+		}
+	}
+	return out
+}
+
 func lines(input string) []string {
 	out := make([]string, 0)
 	scanner := bufio.NewScanner(strings.NewReader(input))
@@ -14,6 +14,7 @@
 package kube
 
 import (
+	"strings"
 	"testing"
 
 	testutil "istio.io/istio/pilot/test/util"
@@ -22,6 +23,7 @@ import (
 	"istio.io/istio/pkg/test/framework/components/cluster/clusterboot"
 	"istio.io/istio/pkg/test/framework/components/echo"
 	"istio.io/istio/pkg/test/framework/components/echo/common"
+	"istio.io/istio/pkg/test/framework/components/namespace"
 	"istio.io/istio/pkg/test/framework/config"
 	"istio.io/istio/pkg/test/framework/image"
 	"istio.io/istio/pkg/test/framework/resource"
@@ -219,3 +221,174 @@ func TestDeploymentYAML(t *testing.T) {
 		})
 	}
 }
+
+func TestDeploymentYAMLSidecarResources(t *testing.T) {
+	clusters, err := clusterboot.NewFactory().With(cluster.Config{
+		Kind: cluster.Fake, Name: "cluster-0",
+		Meta: config.Map{"majorVersion": 1, "minorVersion": 16},
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := echo.Config{
+		Service: "foo",
+		Cluster: clusters[0],
+		Ports: []echo.Port{{
+			Name:         "http",
+			Protocol:     protocol.HTTP,
+			InstancePort: 8090,
+			ServicePort:  8090,
+		}},
+		Subsets: []echo.SubsetConfig{
+			{
+				Version: "v1",
+			},
+			{
+				Version:     "v2",
+				Annotations: echo.NewAnnotations().Set(echo.SidecarProxyCPU, "2"),
+			},
+		},
+	}
+	if err := common.FillInDefaults(nil, &cfg); err != nil {
+		t.Fatalf("failed filling in defaults: %v", err)
+	}
+	if !config.Parsed() {
+		config.Parse()
+	}
+	resources, err := resource.ParseSidecarResources("requests.cpu=100m,limits.memory=1Gi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploymentYAML, err := GenerateDeployment(cfg, imgSettings, &resource.Settings{SidecarResources: resources})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, v2 := subsetYAML(deploymentYAML, "foo-v1"), subsetYAML(deploymentYAML, "foo-v2")
+	for _, want := range []string{`sidecar.istio.io/proxyCPU: "100m"`, `sidecar.istio.io/proxyMemoryLimit: "1Gi"`} {
+		if !strings.Contains(v1, want) {
+			t.Errorf("expected the pod template of v1 to contain %s, got:\n%s", want, v1)
+		}
+	}
+	// The annotation set on the subset wins.
+	if !strings.Contains(v2, `sidecar.istio.io/proxyCPU: "2"`) || strings.Contains(v2, `sidecar.istio.io/proxyCPU: "100m"`) {
+		t.Errorf("expected the subset's proxyCPU to take precedence, got:\n%s", v2)
+	}
+	if !strings.Contains(v2, `sidecar.istio.io/proxyMemoryLimit: "1Gi"`) {
+		t.Errorf("expected the pod template of v2 to contain the memory limit, got:\n%s", v2)
+	}
+}
+
+func TestDeploymentYAMLEchoReplicas(t *testing.T) {
+	clusters, err := clusterboot.NewFactory().With(cluster.Config{
+		Kind: cluster.Fake, Name: "cluster-0",
+		Meta: config.Map{"majorVersion": 1, "minorVersion": 16},
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := echo.Config{
+		Service: "foo",
+		Cluster: clusters[0],
+		Ports: []echo.Port{{
+			Name:         "http",
+			Protocol:     protocol.HTTP,
+			InstancePort: 8090,
+			ServicePort:  8090,
+		}},
+		Subsets: []echo.SubsetConfig{{Version: "v1"}, {Version: "v2"}},
+	}
+	if err := common.FillInDefaults(nil, &cfg); err != nil {
+		t.Fatalf("failed filling in defaults: %v", err)
+	}
+	if !config.Parsed() {
+		config.Parse()
+	}
+	for _, tc := range []struct {
+		name     string
+		replicas int
+		want     string
+	}{
+		{name: "unset", want: "replicas: 1\n"},
+		{name: "scaled", replicas: 5, want: "replicas: 5\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			deploymentYAML, err := GenerateDeployment(cfg, imgSettings, &resource.Settings{EchoReplicas: tc.replicas})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"foo-v1", "foo-v2"} {
+				if subset := subsetYAML(deploymentYAML, name); !strings.Contains(subset, tc.want) {
+					t.Errorf("expected the deployment %s to contain %q, got:\n%s", name, tc.want, subset)
+				}
+			}
+		})
+	}
+}
+
+// settingsContext is a resource.Context that only provides settings.
+type settingsContext struct {
+	resource.Context
+	settings *resource.Settings
+}
+
+func (c settingsContext) Settings() *resource.Settings {
+	return c.settings
+}
+
+func TestDeploymentYAMLEchoProtocols(t *testing.T) {
+	clusters, err := clusterboot.NewFactory().With(cluster.Config{
+		Kind: cluster.Fake, Name: "cluster-0",
+		Meta: config.Map{"majorVersion": 1, "minorVersion": 16},
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := &resource.Settings{EchoProtocols: []protocol.Instance{protocol.HTTP}}
+	cfg := echo.Config{
+		Service:           "foo",
+		Namespace:         namespace.Static("echo"),
+		Cluster:           clusters[0],
+		Ports:             common.EchoPorts,
+		WorkloadOnlyPorts: common.WorkloadPorts,
+	}
+	if err := common.FillInDefaults(settingsContext{settings: settings}, &cfg); err != nil {
+		t.Fatalf("failed filling in defaults: %v", err)
+	}
+	if !config.Parsed() {
+		config.Parse()
+	}
+	serviceYAML, err := GenerateService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploymentYAML, err := GenerateDeployment(cfg, imgSettings, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"name: http\n", "name: grpc\n"} {
+		if !strings.Contains(serviceYAML, want) {
+			t.Errorf("expected the service to contain %q, got:\n%s", want, serviceYAML)
+		}
+	}
+	for _, port := range []string{"tcp", "https", "auto-grpc"} {
+		if strings.Contains(serviceYAML, "name: "+port+"\n") {
+			t.Errorf("expected the service not to expose the %s port, got:\n%s", port, serviceYAML)
+		}
+	}
+	// The TCP ports, including the workload only one, are not served.
+	for _, port := range []string{"19090", "16060", "19092"} {
+		if strings.Contains(deploymentYAML, port) {
+			t.Errorf("expected the deployment not to serve port %s, got:\n%s", port, deploymentYAML)
+		}
+	}
+}
+
+// subsetYAML returns the document of the named deployment.
+func subsetYAML(deploymentYAML, name string) string {
+	for _, doc := range strings.Split(deploymentYAML, "---") {
+		if strings.Contains(doc, "name: "+name+"\n") {
+			return doc
+		}
+	}
+	return ""
+}
@@ -54,6 +54,10 @@ Check the test framework wiki for details on running the tests locally:
 	if err != nil {
 		return nil, err
 	}
+	for i := range configs {
+		configs[i].KubeQPS = ctx.Settings().KubeQPS
+		configs[i].KubeBurst = ctx.Settings().KubeBurst
+	}
 	clusters, err := clusterboot.NewFactory().With(configs...).Build()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestsWithChart returns a manifests directory under workDir that mirrors the one at manifestsDir, except that
+// the chart with the same name as the one at chartPath is replaced by it. Everything else is linked, not copied.
+func manifestsWithChart(workDir, manifestsDir, chartPath string) (string, error) {
+	name, err := chartName(chartPath)
+	if err != nil {
+		return "", err
+	}
+	replaced := ""
+	err = filepath.Walk(filepath.Join(manifestsDir, "charts"), func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != "Chart.yaml" || replaced != "" {
+			return err
+		}
+		if n, err := chartName(filepath.Dir(p)); err == nil && n == name {
+			replaced = filepath.Dir(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if replaced == "" {
+		return "", fmt.Errorf("no chart named %q in %s", name, manifestsDir)
+	}
+	chartPath, err = filepath.Abs(chartPath)
+	if err != nil {
+		return "", err
+	}
+	out := filepath.Join(workDir, "manifests")
+	if err := linkTree(manifestsDir, out, replaced, chartPath); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// linkTree recreates the directories along the path to replaced from src under dst, linking every other entry to
+// its original, and replaced itself to with.
+func linkTree(src, dst, replaced, with string) error {
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := filepath.Join(src, e.Name())
+		target := filepath.Join(dst, e.Name())
+		switch {
+		case p == replaced:
+			err = os.Symlink(with, target)
+		case strings.HasPrefix(replaced, p+string(filepath.Separator)):
+			err = linkTree(p, target, replaced, with)
+		default:
+			err = os.Symlink(p, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chartName returns the name of the Helm chart in the directory.
+func chartName(dir string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return "", err
+	}
+	chart := struct {
+		Name string `yaml:"name"`
+	}{}
+	if err := yaml.Unmarshal(b, &chart); err != nil {
+		return "", fmt.Errorf("invalid Chart.yaml in %s: %v", dir, err)
+	}
+	if chart.Name == "" {
+		return "", fmt.Errorf("chart in %s has no name", dir)
+	}
+	return chart.Name, nil
+}
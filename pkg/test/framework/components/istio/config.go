@@ -143,8 +143,17 @@ type Config struct {
 	// OperatorOptions overrides default operator configuration.
 	OperatorOptions map[string]string
 
-	// EnableCNI indicates the test should have CNI enabled.
+	// EnableCNI indicates the test should have CNI enabled. --istio.test.cni, unless set to auto, takes precedence
+	// over --istio.test.istio.enableCNI.
 	EnableCNI bool
+
+	// Profile, if set, is the IstioOperator profile installed on control plane clusters, overriding the profile of
+	// their IstioOperator files. It is read from --istio.test.profile.
+	Profile string
+
+	// MeshConfigOverlay is mesh config YAML merged over the meshConfig of every IstioOperator spec that is installed.
+	// It is read from --istio.test.meshConfigOverlay.
+	MeshConfigOverlay string
 }
 
 func (c *Config) OverridesYAML() string {
@@ -202,6 +211,18 @@ func DefaultConfig(ctx resource.Context) (Config, error) {
 	// Make a local copy.
 	s := *settingsFromCommandline
 
+	if ns := ctx.Settings().SystemNamespace; ns != "" {
+		// --istio.test.systemNamespace takes precedence over the deprecated --istio.test.kube.systemNamespace.
+		if s.TelemetryNamespace == s.SystemNamespace {
+			s.TelemetryNamespace = ns
+		}
+		s.SystemNamespace = ns
+	}
+
+	s.EnableCNI = cniEnabled(ctx.Settings().CNIMode, s.EnableCNI)
+	s.DeployIstio = deployIstio(ctx.Settings(), s.DeployIstio)
+	s.Profile = string(ctx.Settings().InstallProfile)
+
 	iopFile := s.PrimaryClusterIOPFile
 	if iopFile != "" && !path.IsAbs(s.PrimaryClusterIOPFile) {
 		iopFile = filepath.Join(env.IstioSrc, s.PrimaryClusterIOPFile)
@@ -219,11 +240,22 @@ func DefaultConfig(ctx resource.Context) (Config, error) {
 	if s.Values, err = newHelmValues(ctx, deps); err != nil {
 		return Config{}, err
 	}
+	if _, ok := s.Values["global.istioNamespace"]; !ok && s.SystemNamespace != DefaultSystemNamespace {
+		s.Values["global.istioNamespace"] = s.SystemNamespace
+	}
 
 	if s.OperatorOptions, err = parseConfigOptions(operatorOptions); err != nil {
 		return Config{}, err
 	}
 
+	if overlay := ctx.Settings().MeshConfigOverlay; overlay != "" {
+		b, err := os.ReadFile(overlay)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read mesh config overlay: %v", err)
+		}
+		s.MeshConfigOverlay = string(b)
+	}
+
 	return s, nil
 }
 
@@ -236,6 +268,23 @@ func DefaultConfigOrFail(t test.Failer, ctx resource.Context) Config {
 	return cfg
 }
 
+// cniEnabled returns whether Istio is installed with CNI in the given mode, falling back to enableCNI in auto mode.
+func cniEnabled(mode resource.CNIMode, enableCNI bool) bool {
+	switch mode {
+	case resource.CNIModeEnabled:
+		return true
+	case resource.CNIModeDisabled:
+		return false
+	default:
+		return enableCNI
+	}
+}
+
+// deployIstio returns whether the framework installs Istio, which it never does with --istio.test.useExistingInstall.
+func deployIstio(s *resource.Settings, deploy bool) bool {
+	return deploy && !s.UseExistingInstall
+}
+
 func checkFileExists(path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return err
@@ -273,6 +322,18 @@ func newHelmValues(ctx resource.Context, s *image.Settings) (map[string]string,
 		values["global.proxy.componentLogLevel"] = "misc:debug"
 	}
 
+	// Config warnings are only written to resource status when Istiod runs its analysis.
+	if ctx.Settings().FailOnConfigWarning {
+		values["global.istiod.enableAnalysis"] = "true"
+	}
+
+	// Propagate the log levels requested for the test run to the control plane.
+	if ctx.Settings().LogLevelString != "" {
+		if _, ok := values["global.logging.level"]; !ok {
+			values["global.logging.level"] = ctx.Settings().LogLevelString
+		}
+	}
+
 	return values, nil
 }
 
@@ -311,6 +372,8 @@ func (c *Config) String() string {
 	result += fmt.Sprintf("IstiodlessRemotes:              %v\n", c.IstiodlessRemotes)
 	result += fmt.Sprintf("OperatorOptions:                %v\n", c.OperatorOptions)
 	result += fmt.Sprintf("EnableCNI:                      %v\n", c.EnableCNI)
+	result += fmt.Sprintf("Profile:                        %v\n", c.Profile)
+	result += fmt.Sprintf("MeshConfigOverlay:              %v\n", c.MeshConfigOverlay != "")
 
 	return result
 }
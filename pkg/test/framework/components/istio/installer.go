@@ -0,0 +1,227 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	yaml2 "sigs.k8s.io/yaml"
+
+	opAPI "istio.io/api/operator/v1alpha1"
+	"istio.io/istio/operator/cmd/mesh"
+	pkgAPI "istio.io/istio/operator/pkg/apis/istio/v1alpha1"
+	"istio.io/istio/operator/pkg/manifest"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/istioctl"
+	"istio.io/istio/pkg/test/framework/image"
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/helm"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+const (
+	helmInstallTimeout = 5 * time.Minute
+	// operatorCRName is the name of the IstioOperator resource applied by --istio.test.installMethod=operator.
+	operatorCRName = "test-istiocontrolplane"
+)
+
+// helmRelease is a chart installed by --istio.test.installMethod=helm.
+type helmRelease struct {
+	name string
+	// chart is relative to the charts directory of the manifests.
+	chart string
+}
+
+// installControlPlane installs the control plane of a cluster with the installer selected by
+// --istio.test.installMethod.
+func installControlPlane(i *operatorComponent, installArgs *mesh.InstallArgs, c cluster.Cluster) error {
+	switch i.ctx.Settings().InstallMethod {
+	case resource.InstallMethodHelm:
+		return installWithHelm(i, installArgs, c)
+	case resource.InstallMethodOperator:
+		return installWithOperator(i, installArgs, c)
+	default:
+		return install(i, installArgs, c.Name())
+	}
+}
+
+// generateIstioOperator merges the IstioOperator files and --set options of the install args into the resource
+// istioctl would install, returning both its YAML and parsed forms.
+func generateIstioOperator(installArgs *mesh.InstallArgs) (string, *pkgAPI.IstioOperator, error) {
+	setFlags := append([]string{}, installArgs.Set...)
+	if installArgs.ManifestsPath != "" {
+		setFlags = append(setFlags, "installPackagePath="+installArgs.ManifestsPath)
+	}
+	if installArgs.Revision != "" {
+		setFlags = append(setFlags, "revision="+installArgs.Revision)
+	}
+	var stdOut, stdErr bytes.Buffer
+	iopYAML, iop, err := manifest.GenerateConfig(installArgs.InFilenames, setFlags, installArgs.Force, nil,
+		cmdLogger(&stdOut, &stdErr))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed generating IstioOperator: %v: %s", err, &stdErr)
+	}
+	return iopYAML, iop, nil
+}
+
+// withOperatorMetadata sets the name and namespace of the IstioOperator resource, so that the operator watching the
+// namespace picks it up.
+func withOperatorMetadata(iopYAML, name, ns string) ([]byte, error) {
+	obj := map[string]interface{}{}
+	if err := yaml2.Unmarshal([]byte(iopYAML), &obj); err != nil {
+		return nil, fmt.Errorf("invalid IstioOperator: %v", err)
+	}
+	meta, _ := obj["metadata"].(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	meta["name"] = name
+	meta["namespace"] = ns
+	obj["metadata"] = meta
+	return yaml2.Marshal(obj)
+}
+
+// helmReleases returns the charts that install the components enabled in the spec, in the order they are installed.
+func helmReleases(spec *opAPI.IstioOperatorSpec) []helmRelease {
+	istiod := "istiod"
+	if spec.GetRevision() != "" {
+		istiod += "-" + spec.GetRevision()
+	}
+	out := []helmRelease{
+		{name: "istio-base", chart: "base"},
+		{name: istiod, chart: "istio-control/istio-discovery"},
+	}
+	if gatewayEnabled(spec.GetComponents().GetIngressGateways()) {
+		out = append(out, helmRelease{name: "istio-ingress", chart: "gateways/istio-ingress"})
+	}
+	if gatewayEnabled(spec.GetComponents().GetEgressGateways()) {
+		out = append(out, helmRelease{name: "istio-egress", chart: "gateways/istio-egress"})
+	}
+	return out
+}
+
+func gatewayEnabled(gateways []*opAPI.GatewaySpec) bool {
+	for _, gw := range gateways {
+		if gw.Enabled.GetValue() {
+			return true
+		}
+	}
+	return false
+}
+
+// helmChartValues returns the Helm values equivalent to the spec. Helm takes the mesh config as a top level value.
+func helmChartValues(spec *opAPI.IstioOperatorSpec) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range spec.Values {
+		out[k] = v
+	}
+	if len(spec.MeshConfig) > 0 {
+		out["meshConfig"] = spec.MeshConfig
+	}
+	if spec.GetRevision() != "" {
+		out["revision"] = spec.GetRevision()
+	}
+	return out
+}
+
+// installWithHelm installs the charts for the components istioctl would install, with the same values.
+func installWithHelm(i *operatorComponent, installArgs *mesh.InstallArgs, c cluster.Cluster) error {
+	if err := generateManifestForCleanup(i, installArgs, c.Name()); err != nil {
+		return err
+	}
+	_, iop, err := generateIstioOperator(installArgs)
+	if err != nil {
+		return err
+	}
+	values, err := yaml2.Marshal(helmChartValues(iop.Spec))
+	if err != nil {
+		return err
+	}
+	valuesFile := filepath.Join(i.workDir, fmt.Sprintf("helm-values-%s.yaml", c.Name()))
+	if err := os.WriteFile(valuesFile, values, os.ModePerm); err != nil {
+		return fmt.Errorf("failed writing helm values: %v", err)
+	}
+	if err := createSystemNamespace(c, i.settings.SystemNamespace); err != nil {
+		return err
+	}
+	h := helm.New(installArgs.KubeConfigPath)
+	for _, r := range helmReleases(iop.Spec) {
+		scopes.Framework.Infof("Installing Helm chart %s as release %s on cluster %s", r.chart, r.name, c.Name())
+		if err := h.InstallChart(r.name, filepath.Join(installArgs.ManifestsPath, "charts", r.chart),
+			i.settings.SystemNamespace, valuesFile, helmInstallTimeout); err != nil {
+			return fmt.Errorf("failed installing helm chart %s: %v", r.chart, err)
+		}
+	}
+	return nil
+}
+
+// installWithOperator installs the operator, which then installs Istio from the IstioOperator resource istioctl would
+// install.
+func installWithOperator(i *operatorComponent, installArgs *mesh.InstallArgs, c cluster.Cluster) error {
+	if err := generateManifestForCleanup(i, installArgs, c.Name()); err != nil {
+		return err
+	}
+	iopYAML, _, err := generateIstioOperator(installArgs)
+	if err != nil {
+		return err
+	}
+	b, err := withOperatorMetadata(iopYAML, operatorCRName, i.settings.SystemNamespace)
+	if err != nil {
+		return err
+	}
+	iopFile := filepath.Join(i.workDir, fmt.Sprintf("operator-%s.yaml", c.Name()))
+	if err := os.WriteFile(iopFile, b, os.ModePerm); err != nil {
+		return fmt.Errorf("failed writing IstioOperator: %v", err)
+	}
+	s, err := image.SettingsFromCommandLine()
+	if err != nil {
+		return err
+	}
+	istioCtl, err := istioctl.New(i.ctx, istioctl.Config{Cluster: c})
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"operator", "init",
+		"-f", iopFile,
+		"--hub", s.Hub,
+		"--tag", s.Tag,
+		"--watchedNamespaces", i.settings.SystemNamespace,
+		"--manifests", installArgs.ManifestsPath,
+	}
+	scopes.Framework.Infof("Installing the Istio operator on cluster %s", c.Name())
+	if _, stdErr, err := istioCtl.Invoke(args); err != nil {
+		return fmt.Errorf("operator init failed: %v: %s", err, stdErr)
+	}
+	return nil
+}
+
+func createSystemNamespace(c cluster.Cluster, ns string) error {
+	_, err := c.CoreV1().Namespaces().Create(context.TODO(), &kubeApiCore.Namespace{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: ns},
+	}, kubeApiMeta.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed creating namespace %s: %v", ns, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istio
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+
+	opAPI "istio.io/api/operator/v1alpha1"
+)
+
+func TestHelmReleases(t *testing.T) {
+	enabled := &opAPI.BoolValueForPB{BoolValue: types.BoolValue{Value: true}}
+	for _, tc := range []struct {
+		name string
+		spec *opAPI.IstioOperatorSpec
+		want []helmRelease
+	}{
+		{
+			name: "no gateways",
+			spec: &opAPI.IstioOperatorSpec{},
+			want: []helmRelease{
+				{name: "istio-base", chart: "base"},
+				{name: "istiod", chart: "istio-control/istio-discovery"},
+			},
+		},
+		{
+			name: "revision with ingress",
+			spec: &opAPI.IstioOperatorSpec{
+				Revision: "canary",
+				Components: &opAPI.IstioComponentSetSpec{
+					IngressGateways: []*opAPI.GatewaySpec{{Name: "istio-ingressgateway", Enabled: enabled}},
+					EgressGateways:  []*opAPI.GatewaySpec{{Name: "istio-egressgateway"}},
+				},
+			},
+			want: []helmRelease{
+				{name: "istio-base", chart: "base"},
+				{name: "istiod-canary", chart: "istio-control/istio-discovery"},
+				{name: "istio-ingress", chart: "gateways/istio-ingress"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, helmReleases(tc.spec), cmp.AllowUnexported(helmRelease{})); diff != "" {
+				t.Errorf("unexpected releases (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHelmChartValues(t *testing.T) {
+	spec := &opAPI.IstioOperatorSpec{
+		Revision: "canary",
+		Values: map[string]interface{}{
+			"global": map[string]interface{}{"hub": "docker.io/istio"},
+		},
+		MeshConfig: map[string]interface{}{"accessLogFile": "/dev/stdout"},
+	}
+	want := map[string]interface{}{
+		"global":     map[string]interface{}{"hub": "docker.io/istio"},
+		"meshConfig": map[string]interface{}{"accessLogFile": "/dev/stdout"},
+		"revision":   "canary",
+	}
+	if diff := cmp.Diff(want, helmChartValues(spec)); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+	if got := helmChartValues(&opAPI.IstioOperatorSpec{}); len(got) != 0 {
+		t.Errorf("expected no values for an empty spec, got %v", got)
+	}
+}
+
+func TestWithOperatorMetadata(t *testing.T) {
+	out, err := withOperatorMetadata(`
+apiVersion: install.istio.io/v1alpha1
+kind: IstioOperator
+metadata:
+  labels:
+    foo: bar
+spec:
+  profile: default
+`, "test-istiocontrolplane", "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "install.istio.io/v1alpha1",
+		"kind":       "IstioOperator",
+		"metadata": map[string]interface{}{
+			"name":      "test-istiocontrolplane",
+			"namespace": "istio-system",
+			"labels":    map[string]interface{}{"foo": "bar"},
+		},
+		"spec": map[string]interface{}{"profile": "default"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected IstioOperator (-want +got):\n%s", diff)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"istio.io/istio/pkg/test/framework/components/environment/kube"
 	"istio.io/istio/pkg/test/framework/components/istio/ingress"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/framework/tracing"
 	"istio.io/istio/pkg/test/scopes"
 )
 
@@ -115,12 +116,16 @@ func Deploy(ctx resource.Context, cfg *Config) (Instance, error) {
 
 	t0 := time.Now()
 	scopes.Framework.Infof("=== BEGIN: Deploy Istio [Suite=%s] ===", ctx.Settings().TestID)
+	span := tracing.Start("install")
+	defer span.End()
 
 	i, err := deploy(ctx, ctx.Environment().(*kube.Environment), *cfg)
 	if err != nil {
 		scopes.Framework.Infof("=== FAILED: Deploy Istio in %v [Suite=%s] ===", time.Since(t0), ctx.Settings().TestID)
+		span.SetAttribute("outcome", "failed")
 	} else {
 		scopes.Framework.Infof("=== SUCCEEDED: Deploy Istio in %v [Suite=%s]===", time.Since(t0), ctx.Settings().TestID)
+		span.SetAttribute("outcome", "succeeded")
 	}
 	return i, err
 }
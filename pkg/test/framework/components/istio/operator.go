@@ -34,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	yaml2 "sigs.k8s.io/yaml"
 
 	"istio.io/api/label"
 	opAPI "istio.io/api/operator/v1alpha1"
@@ -84,6 +85,8 @@ type operatorComponent struct {
 	// ingress components, indexed first by cluster name and then by gateway name.
 	ingress map[string]map[string]ingress.Instance
 	workDir string
+	// manifestsPath is the directory of charts and profiles Istio is installed from.
+	manifestsPath string
 }
 
 var (
@@ -101,6 +104,12 @@ func (i *operatorComponent) Settings() Config {
 	return i.settings
 }
 
+// SystemNamespace returns the namespace istiod is installed in. It lets the framework, which cannot import this
+// package, find istiod.
+func (i *operatorComponent) SystemNamespace() string {
+	return i.settings.SystemNamespace
+}
+
 func removeCRDsSlice(raw []string) string {
 	res := make([]string, 0)
 	for _, r := range raw {
@@ -308,6 +317,11 @@ func deploy(ctx resource.Context, env *kube.Environment, cfg Config) (Instance,
 
 	if !cfg.DeployIstio {
 		scopes.Framework.Info("skipping deployment as specified in the config")
+		if ctx.Settings().UseExistingInstall {
+			if err := waitForExistingControlPlane(ctx, cfg); err != nil {
+				return nil, err
+			}
+		}
 		return i, nil
 	}
 
@@ -318,6 +332,19 @@ func deploy(ctx resource.Context, env *kube.Environment, cfg Config) (Instance,
 	}
 	i.workDir = workDir
 
+	if method := ctx.Settings().InstallMethod; method != resource.InstallMethodIstioctl && method != "" &&
+		ctx.Clusters().IsMulticluster() {
+		return nil, fmt.Errorf("--istio.test.installMethod=%s only supports single cluster installs", method)
+	}
+
+	i.manifestsPath = filepath.Join(testenv.IstioSrc, "manifests")
+	if chartPath := ctx.Settings().ChartPath; chartPath != "" {
+		if i.manifestsPath, err = manifestsWithChart(workDir, i.manifestsPath, chartPath); err != nil {
+			return nil, fmt.Errorf("failed to install from chart %s: %v", chartPath, err)
+		}
+		scopes.Framework.Infof("Installing Istio with the chart at %s", chartPath)
+	}
+
 	// generate common IstioOperator yamls for different cluster types (primary, remote, remote-config)
 	istioctlConfigFiles, err := createIstioctlConfigFile(workDir, cfg)
 	if err != nil {
@@ -484,8 +511,11 @@ spec:
 }
 
 func initIOPFile(cfg Config, iopFile string, valuesYaml string) (*opAPI.IstioOperatorSpec, error) {
-	operatorYaml := cfg.IstioOperatorConfigYAML(valuesYaml)
+	return writeIOPFile(cfg, iopFile, cfg.IstioOperatorConfigYAML(valuesYaml))
+}
 
+// writeIOPFile writes the IstioOperator in operatorYaml to iopFile, with the mesh config overlay of cfg applied.
+func writeIOPFile(cfg Config, iopFile string, operatorYaml string) (*opAPI.IstioOperatorSpec, error) {
 	operatorCfg := &pkgAPI.IstioOperator{}
 	if err := gogoprotomarshal.ApplyYAML(operatorYaml, operatorCfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal base iop: %v, %v", err, operatorYaml)
@@ -507,6 +537,12 @@ func initIOPFile(cfg Config, iopFile string, valuesYaml string) (*opAPI.IstioOpe
 	}
 	operatorCfg.Spec.Values = valuesMap
 
+	if cfg.MeshConfigOverlay != "" {
+		if operatorCfg.Spec.MeshConfig, err = overlayMeshConfig(operatorCfg.Spec.MeshConfig, cfg.MeshConfigOverlay); err != nil {
+			return nil, fmt.Errorf("failed to apply mesh config overlay: %v", err)
+		}
+	}
+
 	// marshaling entire operatorCfg causes panic because of *time.Time in ObjectMeta
 	out, err := gogoprotomarshal.ToYAML(operatorCfg.Spec)
 	if err != nil {
@@ -526,6 +562,33 @@ spec:
 	return operatorCfg.Spec, nil
 }
 
+// overlayMeshConfig merges the overlay YAML over the meshConfig of an IstioOperator spec. Nested fields are merged,
+// so an overlay only needs to set the fields it changes.
+func overlayMeshConfig(meshConfig map[string]interface{}, overlay string) (map[string]interface{}, error) {
+	overlayMap := map[string]interface{}{}
+	if err := yaml2.Unmarshal([]byte(overlay), &overlayMap); err != nil {
+		return nil, err
+	}
+	if meshConfig == nil {
+		meshConfig = map[string]interface{}{}
+	}
+	mergeMaps(meshConfig, overlayMap)
+	return meshConfig, nil
+}
+
+// mergeMaps recursively merges src into dst; values in src win, except that nested maps are merged.
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
 // installControlPlaneCluster installs the istiod control plane to the given cluster.
 // The cluster is considered a "primary" cluster if it is also a "config cluster", in which case components
 // like ingress will be installed.
@@ -542,6 +605,7 @@ func installControlPlaneCluster(i *operatorComponent, cfg Config, c cluster.Clus
 	if err != nil {
 		return err
 	}
+	installArgs.Set = append(installArgs.Set, profileInstallOptions(cfg.Profile)...)
 
 	if i.environment.IsMulticluster() {
 		if i.isExternalControlPlane() || cfg.IstiodlessRemotes {
@@ -558,7 +622,7 @@ func installControlPlaneCluster(i *operatorComponent, cfg Config, c cluster.Clus
 		installArgs.Set = append(installArgs.Set, "values.global.multiCluster.clusterName="+clusterName)
 	}
 
-	err = install(i, installArgs, c.Name())
+	err = installControlPlane(i, installArgs, c)
 	if err != nil {
 		return err
 	}
@@ -673,7 +737,7 @@ func installRemoteClusterGateways(i *operatorComponent, c cluster.Cluster) error
 
 	installArgs := &mesh.InstallArgs{
 		KubeConfigPath: kubeConfigFile,
-		ManifestsPath:  filepath.Join(testenv.IstioSrc, "manifests"),
+		ManifestsPath:  i.manifestsPath,
 		InFilenames: []string{
 			filepath.Join(testenv.IstioSrc, IntegrationTestRemoteGatewaysIOP),
 		},
@@ -701,6 +765,27 @@ func kubeConfigFileForCluster(c cluster.Cluster) (string, error) {
 	return fn.Filename(), nil
 }
 
+// cniInstallOptions returns the operator options that install the CNI plugin. The injector leaves the istio-init
+// container out of pods once it is enabled.
+func cniInstallOptions(enabled bool) []string {
+	if !enabled {
+		return nil
+	}
+	return []string{
+		"components.cni.namespace=kube-system",
+		"components.cni.enabled=true",
+	}
+}
+
+// profileInstallOptions returns the --set options that install the profile, overriding the profile of the
+// IstioOperator files. Nothing is overridden if the profile is unset.
+func profileInstallOptions(profile string) []string {
+	if profile == "" {
+		return nil
+	}
+	return []string{"profile=" + profile}
+}
+
 func (i *operatorComponent) generateCommonInstallArgs(cfg Config, c cluster.Cluster, defaultsIOPFile, iopFile string) (*mesh.InstallArgs, error) {
 	s, err := image.SettingsFromCommandLine()
 	if err != nil {
@@ -722,7 +807,7 @@ func (i *operatorComponent) generateCommonInstallArgs(cfg Config, c cluster.Clus
 
 	installArgs := &mesh.InstallArgs{
 		KubeConfigPath: kubeConfigFile,
-		ManifestsPath:  filepath.Join(testenv.IstioSrc, "manifests"),
+		ManifestsPath:  i.manifestsPath,
 		InFilenames: []string{
 			baseIOP,
 			defaultsIOPFile,
@@ -740,11 +825,7 @@ func (i *operatorComponent) generateCommonInstallArgs(cfg Config, c cluster.Clus
 	}
 
 	// Include all user-specified values and configuration options.
-	if cfg.EnableCNI {
-		installArgs.Set = append(installArgs.Set,
-			"components.cni.namespace=kube-system",
-			"components.cni.enabled=true")
-	}
+	installArgs.Set = append(installArgs.Set, cniInstallOptions(cfg.EnableCNI)...)
 
 	// Include all user-specified values.
 	for k, v := range cfg.Values {
@@ -759,24 +840,15 @@ func (i *operatorComponent) generateCommonInstallArgs(cfg Config, c cluster.Clus
 
 // install will replace and reconcile the installation based on the given install settings
 func install(c *operatorComponent, installArgs *mesh.InstallArgs, clusterName string) error {
-	var stdOut, stdErr bytes.Buffer
-	if err := mesh.ManifestGenerate(&mesh.RootArgs{}, &mesh.ManifestGenerateArgs{
-		InFilenames:   installArgs.InFilenames,
-		Set:           installArgs.Set,
-		Force:         installArgs.Force,
-		ManifestsPath: installArgs.ManifestsPath,
-		Revision:      installArgs.Revision,
-	}, cmdLogOptions(), cmdLogger(&stdOut, &stdErr)); err != nil {
+	if err := generateManifestForCleanup(c, installArgs, clusterName); err != nil {
 		return err
 	}
-	c.saveManifestForCleanup(clusterName, stdOut.String())
 
 	// Actually run the install command
 	installArgs.SkipConfirmation = true
 
 	scopes.Framework.Infof("Installing Istio components on cluster %s %s", clusterName, installArgs)
-	stdOut.Reset()
-	stdErr.Reset()
+	var stdOut, stdErr bytes.Buffer
 	if err := mesh.Install(&mesh.RootArgs{}, installArgs, cmdLogOptions(), &stdOut,
 		cmdLogger(&stdOut, &stdErr),
 		mesh.NewPrinterForWriter(&stdOut)); err != nil {
@@ -785,6 +857,23 @@ func install(c *operatorComponent, installArgs *mesh.InstallArgs, clusterName st
 	return nil
 }
 
+// generateManifestForCleanup generates the manifest of the install args, so that the resources are deleted on cleanup
+// whichever installer creates them.
+func generateManifestForCleanup(c *operatorComponent, installArgs *mesh.InstallArgs, clusterName string) error {
+	var stdOut, stdErr bytes.Buffer
+	if err := mesh.ManifestGenerate(&mesh.RootArgs{}, &mesh.ManifestGenerateArgs{
+		InFilenames:   installArgs.InFilenames,
+		Set:           installArgs.Set,
+		Force:         installArgs.Force,
+		ManifestsPath: installArgs.ManifestsPath,
+		Revision:      installArgs.Revision,
+	}, cmdLogOptions(), cmdLogger(&stdOut, &stdErr)); err != nil {
+		return err
+	}
+	c.saveManifestForCleanup(clusterName, stdOut.String())
+	return nil
+}
+
 func cmdLogOptions() *log.Options {
 	o := log.DefaultOptions()
 
@@ -816,6 +905,21 @@ func waitForIstioReady(ctx resource.Context, c cluster.Cluster, cfg Config) erro
 	return nil
 }
 
+// waitForExistingControlPlane checks that the control plane installed out of band, as used by
+// --istio.test.useExistingInstall, is ready in every primary cluster.
+func waitForExistingControlPlane(ctx resource.Context, cfg Config) error {
+	for _, c := range ctx.AllClusters().Primaries().Kube() {
+		fetch := kube2.NewPodFetch(c, cfg.SystemNamespace, "app=istiod")
+		if _, err := kube2.WaitUntilPodsAreReady(fetch); err != nil {
+			return fmt.Errorf("existing control plane in cluster %s is not ready: %v", c.Name(), err)
+		}
+		if err := waitForIstioReady(ctx, c, cfg); err != nil {
+			return fmt.Errorf("existing control plane in cluster %s is not ready: %v", c.Name(), err)
+		}
+	}
+	return nil
+}
+
 func (i *operatorComponent) configureDirectAPIServerAccess(ctx resource.Context, cfg Config) error {
 	// Configure direct access for each control plane to each APIServer. This allows each control plane to
 	// automatically discover endpoints in remote clusters.
@@ -0,0 +1,135 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestWriteIOPFileMeshConfigOverlay(t *testing.T) {
+	cfg := Config{
+		MeshConfigOverlay: `
+outboundTrafficPolicy:
+  mode: REGISTRY_ONLY
+`,
+	}
+	// The operator config is given explicitly, as rendering it from cfg requires the parsed image settings.
+	operatorYaml := `
+apiVersion: install.istio.io/v1alpha1
+kind: IstioOperator
+spec:
+  meshConfig:
+    accessLogFile: /dev/stdout
+    outboundTrafficPolicy:
+      mode: ALLOW_ANY
+`
+	iopFile := filepath.Join(t.TempDir(), "iop.yaml")
+	spec, err := writeIOPFile(cfg, iopFile, operatorYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"accessLogFile": "/dev/stdout",
+		"outboundTrafficPolicy": map[string]interface{}{
+			"mode": "REGISTRY_ONLY",
+		},
+	}
+	if diff := cmp.Diff(want, spec.MeshConfig); diff != "" {
+		t.Errorf("unexpected mesh config in spec (-want +got):\n%s", diff)
+	}
+
+	// The file passed to istioctl must carry the overlay as well.
+	b, err := os.ReadFile(iopFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := struct {
+		Spec struct {
+			MeshConfig map[string]interface{} `json:"meshConfig"`
+		} `json:"spec"`
+	}{}
+	if err := yaml.Unmarshal(b, &written); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, written.Spec.MeshConfig); diff != "" {
+		t.Errorf("unexpected mesh config in %s (-want +got):\n%s", iopFile, diff)
+	}
+}
+
+func TestOverlayMeshConfigInvalid(t *testing.T) {
+	if _, err := overlayMeshConfig(nil, "outboundTrafficPolicy: ["); err == nil {
+		t.Fatal("expected an error for an overlay that is not YAML")
+	}
+}
+
+func TestCNIEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		mode      resource.CNIMode
+		enableCNI bool
+		expected  bool
+	}{
+		{mode: resource.CNIModeEnabled, enableCNI: false, expected: true},
+		{mode: resource.CNIModeDisabled, enableCNI: true, expected: false},
+		{mode: resource.CNIModeAuto, enableCNI: true, expected: true},
+		{mode: resource.CNIModeAuto, enableCNI: false, expected: false},
+		{mode: "", enableCNI: true, expected: true},
+	} {
+		t.Run(fmt.Sprintf("%s/%v", tc.mode, tc.enableCNI), func(t *testing.T) {
+			if got := cniEnabled(tc.mode, tc.enableCNI); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDeployIstio(t *testing.T) {
+	if !deployIstio(&resource.Settings{}, true) {
+		t.Errorf("expected Istio to be deployed")
+	}
+	if deployIstio(&resource.Settings{}, false) {
+		t.Errorf("expected --istio.test.kube.deploy=false to skip the install")
+	}
+	if deployIstio(&resource.Settings{UseExistingInstall: true}, true) {
+		t.Errorf("expected --istio.test.useExistingInstall to skip the install")
+	}
+}
+
+func TestCNIInstallOptions(t *testing.T) {
+	if got := cniInstallOptions(false); len(got) != 0 {
+		t.Errorf("expected no options with CNI disabled, got %v", got)
+	}
+	want := []string{"components.cni.namespace=kube-system", "components.cni.enabled=true"}
+	if diff := cmp.Diff(want, cniInstallOptions(true)); diff != "" {
+		t.Errorf("unexpected options (-want +got):\n%s", diff)
+	}
+}
+
+func TestProfileInstallOptions(t *testing.T) {
+	if got := profileInstallOptions(""); len(got) != 0 {
+		t.Errorf("expected no options without a profile, got %v", got)
+	}
+	want := []string{"profile=minimal"}
+	if diff := cmp.Diff(want, profileInstallOptions(string(resource.InstallProfileMinimal))); diff != "" {
+		t.Errorf("unexpected options (-want +got):\n%s", diff)
+	}
+}
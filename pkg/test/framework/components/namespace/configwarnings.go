@@ -0,0 +1,52 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	ferrors "istio.io/istio/pkg/test/framework/errors"
+)
+
+// checkConfigWarnings returns a ConfigWarningError for every resource of the given types in the namespace whose
+// status carries warnings from Istiod's analysis. Types whose CRDs are not installed are skipped.
+func checkConfigWarnings(client dynamic.Interface, ns string, gvrs []schema.GroupVersionResource) error {
+	var errs error
+	for _, gvr := range gvrs {
+		list, err := client.Resource(gvr).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed listing %s: %v", gvr.Resource, err))
+			continue
+		}
+		for _, item := range list.Items {
+			status, _ := item.Object["status"].(map[string]interface{})
+			if err := ferrors.FindConfigWarningsInStatus(status, fmt.Sprintf("%s %s/%s", gvr.Resource, ns,
+				item.GetName())); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	ferrors "istio.io/istio/pkg/test/framework/errors"
+)
+
+func TestCheckConfigWarnings(t *testing.T) {
+	g := NewWithT(t)
+	warned := configObject("VirtualService", "reviews", map[string]interface{}{"gateways": []interface{}{"missing"}})
+	warned.Object["status"] = map[string]interface{}{"validationMessages": []interface{}{
+		map[string]interface{}{
+			"level": "WARNING",
+			"type":  map[string]interface{}{"code": "IST0101", "name": "ReferencedResourceNotFound"},
+		},
+	}}
+	informed := configObject("DestinationRule", "reviews", map[string]interface{}{"host": "reviews"})
+	informed.Object["status"] = map[string]interface{}{"validationMessages": []interface{}{
+		map[string]interface{}{
+			"level": "INFO",
+			"type":  map[string]interface{}{"code": "IST0102", "name": "NamespaceNotInjected"},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			virtualServices:  "VirtualServiceList",
+			destinationRules: "DestinationRuleList",
+		},
+		warned, informed, configObject("VirtualService", "ratings", map[string]interface{}{}))
+
+	err := checkConfigWarnings(client, "stable", []schema.GroupVersionResource{virtualServices, destinationRules})
+	g.Expect(ferrors.IsOrContainsConfigWarningError(err)).To(BeTrue())
+	g.Expect(err.Error()).To(ContainSubstring(
+		"config warnings for virtualservices stable/reviews: IST0101 ReferencedResourceNotFound (WARNING)"))
+	g.Expect(err.Error()).NotTo(ContainSubstring("destinationrules"))
+	g.Expect(err.Error()).NotTo(ContainSubstring("ratings"))
+
+	// Other namespaces are not checked.
+	g.Expect(checkConfigWarnings(client, "other", []schema.GroupVersionResource{virtualServices})).To(Succeed())
+}
@@ -26,17 +26,29 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/go-multierror"
 	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	"istio.io/api/label"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/framework/image"
 	"istio.io/istio/pkg/test/framework/resource"
 	kube2 "istio.io/istio/pkg/test/kube"
 	"istio.io/istio/pkg/test/scopes"
+	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/pkg/log"
 )
 
+const (
+	// caRootConfigMap is the configmap istiod writes the CA root to in every namespace.
+	caRootConfigMap = "istio-ca-root-cert"
+
+	suppressCARootTimeout = 10 * time.Second
+	suppressCARootDelay   = 100 * time.Millisecond
+)
+
 var (
 	idctr int64
 	rnd   = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -49,9 +61,20 @@ type kubeNamespace struct {
 	name   string
 	prefix string
 	ctx    resource.Context
+	// labels the namespace was created with, used to match --istio.test.namespaceSelector
+	labels map[string]string
+}
+
+// selected returns true if the namespace is matched by the namespace selector in the settings.
+func (n *kubeNamespace) selected() bool {
+	return n.ctx.Settings().NamespaceSelected(n.labels)
 }
 
 func (n *kubeNamespace) Dump(ctx resource.Context) {
+	if !n.selected() {
+		scopes.Framework.Debugf("skipping dump of namespace %s, not matched by namespace selector", n.name)
+		return
+	}
 	scopes.Framework.Errorf("=== Dumping Namespace %s State...", n.name)
 
 	d, err := ctx.CreateTmpDirectory(n.name + "-state")
@@ -126,29 +149,103 @@ func (n *kubeNamespace) Close() (err error) {
 		ns := n.name
 		n.name = ""
 
+		// Istiod's analysis is read before the config goes away with the namespace.
+		var warnings error
+		if n.ctx.Settings().FailOnConfigWarning {
+			for _, c := range n.ctx.Clusters().Kube() {
+				if werr := checkConfigWarnings(c.Dynamic(), ns, snapshotResources()); werr != nil {
+					warnings = multierror.Append(warnings, werr)
+				}
+			}
+		}
+
+		// Istiod cleans up first, so it is not caught mid-write by the deletion.
+		suppressCARoot(n.ctx, ns)
 		for _, c := range n.ctx.Clusters().Kube() {
 			err = c.CoreV1().Namespaces().Delete(context.TODO(), ns, kube2.DeleteOptionsForeground())
 		}
+		if warnings != nil {
+			err = multierror.Append(err, warnings)
+		}
 	}
 
 	scopes.Framework.Debugf("%s close complete (err:%v)", n.id, err)
 	return
 }
 
+// suppressCARoot coordinates with istiod before the namespace is deleted, in every cluster in parallel. Failures are
+// only logged, since the namespace is deleted regardless.
+func suppressCARoot(ctx resource.Context, ns string) {
+	wg := sync.WaitGroup{}
+	for _, c := range ctx.Clusters().Kube() {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			suppressCARootInCluster(c, ns)
+		}()
+	}
+	wg.Wait()
+}
+
+// suppressCARootInCluster labels the namespace for istiod to delete its CA root configmap and stop writing it. If
+// the configmap was written by an istiod that honors the label, it waits for the configmap to be deleted; a configmap
+// written by any other istiod, such as an older control plane, is left for the deletion of the namespace.
+func suppressCARootInCluster(c cluster.Cluster, ns string) {
+	cm, err := c.CoreV1().ConfigMaps(ns).Get(context.TODO(), caRootConfigMap, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		scopes.Framework.Warnf("failed to get the CA root of namespace %s in cluster %s: %v", ns, c.Name(), err)
+		return
+	}
+	exists := err == nil
+	if exists && cm.Labels[constants.CARootSuppressibleLabel] != "true" {
+		// Nothing to coordinate with.
+		return
+	}
+	// Label the namespace even without a configmap, so that istiod does not write one while the namespace is deleted.
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{%q:"true"}}}`, constants.CARootSuppressedLabel))
+	if _, err := c.CoreV1().Namespaces().Patch(context.TODO(), ns, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		scopes.Framework.Warnf("failed to label namespace %s in cluster %s for CA root suppression: %v", ns, c.Name(), err)
+		return
+	}
+	if !exists {
+		return
+	}
+	if err := retry.UntilSuccess(func() error {
+		_, err := c.CoreV1().ConfigMaps(ns).Get(context.TODO(), caRootConfigMap, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("configmap %s still exists", caRootConfigMap)
+	}, retry.Timeout(suppressCARootTimeout), retry.Delay(suppressCARootDelay)); err != nil {
+		scopes.Framework.Warnf("istiod did not delete the CA root of namespace %s in cluster %s: %v", ns, c.Name(), err)
+	}
+}
+
 func claimKube(ctx resource.Context, nsConfig *Config) (Instance, error) {
+	nsLabels := createNamespaceLabels(ctx, nsConfig)
 	for _, cluster := range ctx.Clusters().Kube() {
 		if !kube2.NamespaceExists(cluster, nsConfig.Prefix) {
 			if _, err := cluster.CoreV1().Namespaces().Create(context.TODO(), &kubeApiCore.Namespace{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:   nsConfig.Prefix,
-					Labels: createNamespaceLabels(ctx, nsConfig),
+					Labels: nsLabels,
 				},
 			}, metav1.CreateOptions{}); err != nil {
 				return nil, err
 			}
 		}
+		if ctx.Settings().SnapshotNamespaces {
+			if err := snapshotOrRestore(cluster, nsConfig.Prefix); err != nil {
+				return nil, fmt.Errorf("failed restoring snapshot of namespace %s in cluster %s: %v",
+					nsConfig.Prefix, cluster.Name(), err)
+			}
+		}
 	}
-	return &kubeNamespace{prefix: nsConfig.Prefix, name: nsConfig.Prefix, ctx: ctx}, nil
+	return &kubeNamespace{prefix: nsConfig.Prefix, name: nsConfig.Prefix, ctx: ctx, labels: nsLabels}, nil
 }
 
 // setNamespaceLabel labels a namespace with the given key, value pair
@@ -192,6 +289,7 @@ func newKube(ctx resource.Context, nsConfig *Config) (Instance, error) {
 		name:   ns,
 		prefix: nsConfig.Prefix,
 		ctx:    ctx,
+		labels: createNamespaceLabels(ctx, nsConfig),
 	}
 	id := ctx.TrackResource(n)
 	n.id = id
@@ -200,7 +298,7 @@ func newKube(ctx resource.Context, nsConfig *Config) (Instance, error) {
 		if _, err := cluster.CoreV1().Namespaces().Create(context.TODO(), &kubeApiCore.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:   ns,
-				Labels: createNamespaceLabels(ctx, nsConfig),
+				Labels: n.labels,
 			},
 		}, metav1.CreateOptions{}); err != nil {
 			return nil, err
@@ -221,24 +319,35 @@ func newKube(ctx resource.Context, nsConfig *Config) (Instance, error) {
 
 // createNamespaceLabels will take a namespace config and generate the proper k8s labels
 func createNamespaceLabels(ctx resource.Context, cfg *Config) map[string]string {
+	return namespaceLabels(ctx.Settings(), cfg)
+}
+
+// namespaceLabels returns the labels of a namespace created with the config. Whether it is labeled for injection
+// is decided by --istio.test.injectionMode, and for the per-test mode, by the config.
+func namespaceLabels(s *resource.Settings, cfg *Config) map[string]string {
 	l := make(map[string]string)
 	l["istio-testing"] = "istio-test"
-	if cfg.Inject {
+	inject := cfg.Inject
+	switch s.InjectionMode {
+	case resource.InjectionModeEnabled:
+		inject = true
+	case resource.InjectionModeDisabled:
+		inject = false
+	}
+	if inject {
 		// do not add namespace labels when running compatibility tests since
 		// this disables the necessary object selectors
-		if !ctx.Settings().Compatibility {
+		if !s.Compatibility {
 			if cfg.Revision != "" {
 				l[label.IoIstioRev.Name] = cfg.Revision
 			} else {
 				l["istio-injection"] = "enabled"
 			}
 		}
-	} else {
-		// if we're running compatibility tests, disable injection in the namespace
-		// explicitly so that object selectors are ignored
-		if ctx.Settings().Compatibility {
-			l["istio-injection"] = "disabled"
-		}
+	} else if s.Compatibility || s.InjectionMode == resource.InjectionModeDisabled {
+		// if we're running compatibility tests, or with injection disabled, disable injection in the
+		// namespace explicitly so that object selectors are ignored
+		l["istio-injection"] = "disabled"
 	}
 
 	// bring over supplied labels
@@ -0,0 +1,151 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+// clustersContext is a resource.Context that only provides settings and clusters.
+type clustersContext struct {
+	resource.Context
+	clusters cluster.Clusters
+	settings *resource.Settings
+}
+
+func (c clustersContext) Settings() *resource.Settings {
+	if c.settings != nil {
+		return c.settings
+	}
+	return resource.DefaultSettings()
+}
+
+func (c clustersContext) Clusters() cluster.Clusters {
+	return c.clusters
+}
+
+func TestCloseSuppressesCARootBeforeDeletion(t *testing.T) {
+	const ns = "echo-1-1234"
+	client := kube.NewFakeClient(
+		&kubeApiCore.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}},
+		&kubeApiCore.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      caRootConfigMap,
+			Namespace: ns,
+			Labels:    map[string]string{constants.CARootSuppressibleLabel: "true"},
+		}},
+	)
+	// The reactors use the tracker directly, since the clientset is locked while its reactors run.
+	clientset := client.Kube().(*fake.Clientset)
+	tracker := clientset.Tracker()
+	configMaps := kubeApiCore.SchemeGroupVersion.WithResource("configmaps")
+	namespaces := kubeApiCore.SchemeGroupVersion.WithResource("namespaces")
+	// Act as istiod does, deleting the configmap once the namespace is labeled; by the time it is next read.
+	clientset.PrependReactor("get", "configmaps", func(ktesting.Action) (bool, runtime.Object, error) {
+		obj, err := tracker.Get(namespaces, "", ns)
+		if err == nil && obj.(*kubeApiCore.Namespace).Labels[constants.CARootSuppressedLabel] == "true" {
+			_ = tracker.Delete(configMaps, ns, caRootConfigMap)
+		}
+		return false, nil, nil
+	})
+	var configMapAtDeletion error
+	clientset.PrependReactor("delete", "namespaces", func(ktesting.Action) (bool, runtime.Object, error) {
+		_, configMapAtDeletion = tracker.Get(configMaps, ns, caRootConfigMap)
+		return false, nil, nil
+	})
+	c := &cluster.FakeCluster{
+		ExtendedClient: client,
+		Topology:       cluster.Topology{ClusterName: "primary", ClusterKind: cluster.Kubernetes},
+	}
+
+	n := &kubeNamespace{name: ns, ctx: clustersContext{clusters: cluster.Clusters{c}}}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.IsNotFound(configMapAtDeletion) {
+		t.Fatalf("expected the configmap to be deleted before the namespace, got %v", configMapAtDeletion)
+	}
+	if _, err := client.CoreV1().Namespaces().Get(context.TODO(), ns, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the namespace to be deleted, got %v", err)
+	}
+}
+
+func TestCloseSkipsSuppressionWithoutSupport(t *testing.T) {
+	const ns = "echo-1-1234"
+	// The configmap was written by an istiod that does not honor the suppression label.
+	client := kube.NewFakeClient(
+		&kubeApiCore.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}},
+		&kubeApiCore.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: caRootConfigMap, Namespace: ns}},
+	)
+	clientset := client.Kube().(*fake.Clientset)
+	clientset.PrependReactor("patch", "namespaces", func(ktesting.Action) (bool, runtime.Object, error) {
+		t.Error("expected the namespace not to be labeled for suppression")
+		return false, nil, nil
+	})
+	c := &cluster.FakeCluster{
+		ExtendedClient: client,
+		Topology:       cluster.Topology{ClusterName: "primary", ClusterKind: cluster.Kubernetes},
+	}
+
+	start := time.Now()
+	n := &kubeNamespace{name: ns, ctx: clustersContext{clusters: cluster.Clusters{c}}}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= suppressCARootTimeout {
+		t.Fatalf("expected Close not to wait for the configmap, took %v", elapsed)
+	}
+	if _, err := client.CoreV1().Namespaces().Get(context.TODO(), ns, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the namespace to be deleted, got %v", err)
+	}
+}
+
+func TestCloseDeletesUnselectedNamespace(t *testing.T) {
+	const ns = "echo-1-1234"
+	client := kube.NewFakeClient(&kubeApiCore.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+	c := &cluster.FakeCluster{
+		ExtendedClient: client,
+		Topology:       cluster.Topology{ClusterName: "primary", ClusterKind: cluster.Kubernetes},
+	}
+	settings := resource.DefaultSettings()
+	selector, err := labels.Parse("team=foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.NamespaceLabelSelector = selector
+
+	// The selector only scopes dumps; a namespace the framework created is never leaked.
+	n := &kubeNamespace{name: ns, ctx: clustersContext{clusters: cluster.Clusters{c}, settings: settings}, labels: map[string]string{"team": "bar"}}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Namespaces().Get(context.TODO(), ns, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the namespace to be deleted, got %v", err)
+	}
+}
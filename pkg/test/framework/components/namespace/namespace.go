@@ -17,6 +17,7 @@ package namespace
 import (
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/framework/tracing"
 )
 
 // Config contains configuration information about the namespace instance
@@ -62,6 +63,8 @@ func ClaimOrFail(t test.Failer, ctx resource.Context, name string) Instance {
 
 // New creates a new Namespace in all clusters.
 func New(ctx resource.Context, nsConfig Config) (i Instance, err error) {
+	span := tracing.Start("namespace", "prefix", nsConfig.Prefix)
+	defer span.End()
 	if ctx.Settings().StableNamespaces {
 		return Claim(ctx, nsConfig)
 	}
@@ -18,6 +18,9 @@ import (
 	"testing"
 
 	. "github.com/onsi/gomega"
+
+	"istio.io/api/label"
+	"istio.io/istio/pkg/test/framework/resource"
 )
 
 func TestConfigRevisionOverwrite(t *testing.T) {
@@ -68,3 +71,62 @@ func TestConfigRevisionOverwrite(t *testing.T) {
 		})
 	}
 }
+
+func TestNamespaceLabelsInjectionMode(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		// test inputs.
+		mode resource.InjectionMode
+		cfg  Config
+
+		// expected results.
+		wantInjection string
+		wantRevision  string
+	}{
+		{
+			name:          "PerTestInject",
+			mode:          resource.InjectionModePerTest,
+			cfg:           Config{Inject: true},
+			wantInjection: "enabled",
+		},
+		{
+			name: "PerTestNoInject",
+			mode: resource.InjectionModePerTest,
+			cfg:  Config{Inject: false},
+		},
+		{
+			name:          "UnsetIsPerTest",
+			cfg:           Config{Inject: true},
+			wantInjection: "enabled",
+		},
+		{
+			name:          "EnabledOverridesConfig",
+			mode:          resource.InjectionModeEnabled,
+			cfg:           Config{Inject: false},
+			wantInjection: "enabled",
+		},
+		{
+			name:         "EnabledWithRevision",
+			mode:         resource.InjectionModeEnabled,
+			cfg:          Config{Inject: false, Revision: "canary"},
+			wantRevision: "canary",
+		},
+		{
+			name:          "DisabledOverridesConfig",
+			mode:          resource.InjectionModeDisabled,
+			cfg:           Config{Inject: true, Revision: "canary"},
+			wantInjection: "disabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := namespaceLabels(&resource.Settings{InjectionMode: tc.mode}, &tc.cfg)
+			g := NewWithT(t)
+			g.Expect(l["istio-injection"]).Should(Equal(tc.wantInjection))
+			g.Expect(l[label.IoIstioRev.Name]).Should(Equal(tc.wantRevision))
+			g.Expect(l["istio-testing"]).Should(Equal("istio-test"))
+		})
+	}
+}
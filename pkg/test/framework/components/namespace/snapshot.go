@@ -0,0 +1,235 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+const (
+	// snapshotConfigMap holds the snapshot of a stable namespace, so that it survives across runs.
+	snapshotConfigMap = "istio-test-namespace-snapshot"
+	snapshotDataKey   = "snapshot"
+)
+
+// snapshotEntry is a single resource captured in a snapshot.
+type snapshotEntry struct {
+	Group    string                 `json:"group"`
+	Version  string                 `json:"version"`
+	Resource string                 `json:"resource"`
+	Object   map[string]interface{} `json:"object"`
+}
+
+func (e snapshotEntry) gvr() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: e.Group, Version: e.Version, Resource: e.Resource}
+}
+
+// snapshot is the config of a namespace at a point in time.
+type snapshot []snapshotEntry
+
+// snapshotResources returns the config types captured by a snapshot.
+func snapshotResources() []schema.GroupVersionResource {
+	var out []schema.GroupVersionResource
+	for _, s := range collections.Pilot.All() {
+		out = append(out, s.Resource().GroupVersionResource())
+	}
+	return out
+}
+
+// normalizeObject returns a copy of the object with only the fields a snapshot compares and restores: everything
+// but the status and the metadata assigned by the API server.
+func normalizeObject(obj map[string]interface{}) map[string]interface{} {
+	out := copyObject(obj)
+	delete(out, "status")
+	meta, _ := out["metadata"].(map[string]interface{})
+	kept := map[string]interface{}{}
+	for _, k := range []string{"name", "namespace", "labels", "annotations"} {
+		if v, ok := meta[k]; ok {
+			kept[k] = v
+		}
+	}
+	out["metadata"] = kept
+	return out
+}
+
+// sameObject reports whether two normalized objects are equal. They are compared by their JSON encoding, since a
+// snapshot read back from its configmap has float64 numbers where the API server returns int64.
+func sameObject(a, b map[string]interface{}) bool {
+	ab, aerr := json.Marshal(a)
+	bb, berr := json.Marshal(b)
+	return aerr == nil && berr == nil && bytes.Equal(ab, bb)
+}
+
+func copyObject(obj map[string]interface{}) map[string]interface{} {
+	return (&unstructured.Unstructured{Object: obj}).DeepCopy().Object
+}
+
+// captureSnapshot captures the config of the given types in the namespace. Types whose CRDs are not installed are
+// skipped.
+func captureSnapshot(client dynamic.Interface, ns string, gvrs []schema.GroupVersionResource) (snapshot, error) {
+	var out snapshot
+	for _, gvr := range gvrs {
+		list, err := client.Resource(gvr).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed listing %s: %v", gvr.Resource, err)
+		}
+		for _, item := range list.Items {
+			out = append(out, snapshotEntry{
+				Group:    gvr.Group,
+				Version:  gvr.Version,
+				Resource: gvr.Resource,
+				Object:   normalizeObject(item.Object),
+			})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Resource != out[j].Resource {
+			return out[i].Resource < out[j].Resource
+		}
+		return (&unstructured.Unstructured{Object: out[i].Object}).GetName() <
+			(&unstructured.Unstructured{Object: out[j].Object}).GetName()
+	})
+	return out, nil
+}
+
+// restoreSnapshot reverts the config of the given types in the namespace to the snapshot: resources created since
+// are deleted, modified resources are updated back, and deleted resources are recreated. It returns the number of
+// resources it changed.
+func restoreSnapshot(client dynamic.Interface, ns string, snap snapshot, gvrs []schema.GroupVersionResource) (int, error) {
+	want := map[schema.GroupVersionResource]map[string]map[string]interface{}{}
+	for _, e := range snap {
+		if want[e.gvr()] == nil {
+			want[e.gvr()] = map[string]map[string]interface{}{}
+		}
+		want[e.gvr()][(&unstructured.Unstructured{Object: e.Object}).GetName()] = e.Object
+	}
+
+	changed := 0
+	var errs error
+	for _, gvr := range gvrs {
+		rc := client.Resource(gvr).Namespace(ns)
+		list, err := rc.List(context.TODO(), metav1.ListOptions{})
+		if errors.IsNotFound(err) && len(want[gvr]) == 0 {
+			continue
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed listing %s: %v", gvr.Resource, err))
+			continue
+		}
+		existing := map[string]bool{}
+		for _, item := range list.Items {
+			name := item.GetName()
+			existing[name] = true
+			obj, ok := want[gvr][name]
+			switch {
+			case !ok:
+				if err := rc.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+					errs = multierror.Append(errs, fmt.Errorf("failed deleting %s/%s: %v", gvr.Resource, name, err))
+					continue
+				}
+				changed++
+			case !sameObject(normalizeObject(item.Object), obj):
+				u := &unstructured.Unstructured{Object: copyObject(obj)}
+				u.SetResourceVersion(item.GetResourceVersion())
+				if _, err := rc.Update(context.TODO(), u, metav1.UpdateOptions{}); err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("failed reverting %s/%s: %v", gvr.Resource, name, err))
+					continue
+				}
+				changed++
+			}
+		}
+		for name, obj := range want[gvr] {
+			if existing[name] {
+				continue
+			}
+			if _, err := rc.Create(context.TODO(), &unstructured.Unstructured{Object: copyObject(obj)},
+				metav1.CreateOptions{}); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed recreating %s/%s: %v", gvr.Resource, name, err))
+				continue
+			}
+			changed++
+		}
+	}
+	return changed, errs
+}
+
+// loadSnapshot reads the snapshot saved in the namespace, returning false if there is none.
+func loadSnapshot(client kubernetes.Interface, ns string) (snapshot, bool, error) {
+	cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), snapshotConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal([]byte(cm.Data[snapshotDataKey]), &snap); err != nil {
+		return nil, false, fmt.Errorf("invalid snapshot in configmap %s/%s: %v", ns, snapshotConfigMap, err)
+	}
+	return snap, true, nil
+}
+
+// saveSnapshot saves the snapshot in the namespace.
+func saveSnapshot(client kubernetes.Interface, ns string, snap snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().ConfigMaps(ns).Create(context.TODO(), &kubeApiCore.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: snapshotConfigMap, Namespace: ns},
+		Data:       map[string]string{snapshotDataKey: string(b)},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// snapshotOrRestore captures the config of the namespace the first time it is claimed, and restores it on every
+// later claim.
+func snapshotOrRestore(c cluster.Cluster, ns string) error {
+	gvrs := snapshotResources()
+	snap, found, err := loadSnapshot(c, ns)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if snap, err = captureSnapshot(c.Dynamic(), ns, gvrs); err != nil {
+			return err
+		}
+		scopes.Framework.Infof("captured snapshot of %d resources in namespace %s of cluster %s", len(snap), ns, c.Name())
+		return saveSnapshot(c, ns, snap)
+	}
+	changed, err := restoreSnapshot(c.Dynamic(), ns, snap, gvrs)
+	scopes.Framework.Infof("restored snapshot of namespace %s in cluster %s, reverting %d resources", ns, c.Name(), changed)
+	return err
+}
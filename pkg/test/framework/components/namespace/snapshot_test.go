@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var (
+	virtualServices  = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1alpha3", Resource: "virtualservices"}
+	destinationRules = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1alpha3", Resource: "destinationrules"}
+)
+
+func configObject(kind, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.istio.io/v1alpha3",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "stable",
+			"resourceVersion": "1",
+			"uid":             name + "-uid",
+		},
+		"spec": spec,
+	}}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	g := NewWithT(t)
+	gvrs := []schema.GroupVersionResource{virtualServices, destinationRules}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			virtualServices:  "VirtualServiceList",
+			destinationRules: "DestinationRuleList",
+		},
+		configObject("VirtualService", "reviews", map[string]interface{}{"hosts": []interface{}{"reviews"}, "timeout": int64(5)}),
+		configObject("DestinationRule", "reviews", map[string]interface{}{"host": "reviews"}))
+
+	snap, err := captureSnapshot(client, "stable", gvrs)
+	g.Expect(err).To(BeNil())
+	g.Expect(snap).To(HaveLen(2))
+	for _, e := range snap {
+		meta := e.Object["metadata"].(map[string]interface{})
+		g.Expect(meta).NotTo(HaveKey("uid"))
+		g.Expect(meta).NotTo(HaveKey("resourceVersion"))
+	}
+
+	// The snapshot is read back from its configmap on later runs.
+	kube := fake.NewSimpleClientset()
+	g.Expect(saveSnapshot(kube, "stable", snap)).To(Succeed())
+	loaded, found, err := loadSnapshot(kube, "stable")
+	g.Expect(err).To(BeNil())
+	g.Expect(found).To(BeTrue())
+
+	// An unchanged namespace is left alone.
+	changed, err := restoreSnapshot(client, "stable", loaded, gvrs)
+	g.Expect(err).To(BeNil())
+	g.Expect(changed).To(Equal(0))
+
+	// A run modifies one resource, adds another and deletes a third.
+	vs := client.Resource(virtualServices).Namespace("stable")
+	modified := configObject("VirtualService", "reviews", map[string]interface{}{"hosts": []interface{}{"reviews"}, "timeout": int64(10)})
+	_, err = vs.Update(context.TODO(), modified, metav1.UpdateOptions{})
+	g.Expect(err).To(BeNil())
+	_, err = vs.Create(context.TODO(), configObject("VirtualService", "ratings", map[string]interface{}{}), metav1.CreateOptions{})
+	g.Expect(err).To(BeNil())
+	g.Expect(client.Resource(destinationRules).Namespace("stable").Delete(context.TODO(), "reviews", metav1.DeleteOptions{})).
+		To(Succeed())
+
+	changed, err = restoreSnapshot(client, "stable", loaded, gvrs)
+	g.Expect(err).To(BeNil())
+	g.Expect(changed).To(Equal(3))
+
+	restored, err := captureSnapshot(client, "stable", gvrs)
+	g.Expect(err).To(BeNil())
+	g.Expect(restored).To(HaveLen(len(snap)))
+	for i := range snap {
+		g.Expect(restored[i].gvr()).To(Equal(snap[i].gvr()))
+		g.Expect(sameObject(restored[i].Object, snap[i].Object)).To(BeTrue(), "resource %d differs", i)
+	}
+
+	changed, err = restoreSnapshot(client, "stable", loaded, gvrs)
+	g.Expect(err).To(BeNil())
+	g.Expect(changed).To(Equal(0))
+}
+
+func TestLoadSnapshotMissing(t *testing.T) {
+	g := NewWithT(t)
+	_, found, err := loadSnapshot(fake.NewSimpleClientset(), "stable")
+	g.Expect(err).To(BeNil())
+	g.Expect(found).To(BeFalse())
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -132,17 +133,72 @@ func newKube(ctx resource.Context, cfgIn Config) (Instance, error) {
 		scopes.Framework.Debugf("initialized Prometheus port forwarder: %v", forwarder.Address())
 
 		address := fmt.Sprintf("http://%s", forwarder.Address())
-		var client prometheusApi.Client
-		client, err = prometheusApi.NewClient(prometheusApi.Config{Address: address})
+		api, err := newAPI(address, &resource.Settings{})
 		if err != nil {
 			return nil, err
 		}
+		c.api[cls.Name()] = api
+	}
+	return c, nil
+}
 
-		c.api[cls.Name()] = prometheusApiV1.NewAPI(client)
+// newExternal returns an instance that queries the Prometheus-compatible API at --istio.test.prometheusURL
+// for all clusters.
+func newExternal(ctx resource.Context) (Instance, error) {
+	c := &kubeComponent{
+		clusters: ctx.Clusters(),
+	}
+	c.id = ctx.TrackResource(c)
+	c.api = make(map[string]prometheusApiV1.API)
+	c.forwarder = make(map[string]istioKube.PortForwarder)
+
+	scopes.Framework.Infof("using external Prometheus at %s", ctx.Settings().PrometheusURL)
+	api, err := newAPI(ctx.Settings().PrometheusURL, ctx.Settings())
+	if err != nil {
+		return nil, err
+	}
+	for _, cls := range ctx.Clusters() {
+		c.api[cls.Name()] = api
 	}
 	return c, nil
 }
 
+// newAPI creates a Prometheus API client for the given address, using the credentials from the settings, if any.
+func newAPI(address string, s *resource.Settings) (prometheusApiV1.API, error) {
+	cfg := prometheusApi.Config{Address: address}
+	if s.PrometheusBearerToken != "" || s.PrometheusUsername != "" || s.PrometheusPassword != "" {
+		cfg.RoundTripper = &authRoundTripper{
+			username:    s.PrometheusUsername,
+			password:    s.PrometheusPassword,
+			bearerToken: s.PrometheusBearerToken,
+			next:        prometheusApi.DefaultRoundTripper,
+		}
+	}
+	client, err := prometheusApi.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return prometheusApiV1.NewAPI(client), nil
+}
+
+// authRoundTripper adds basic or bearer token auth to each request.
+type authRoundTripper struct {
+	username    string
+	password    string
+	bearerToken string
+	next        http.RoundTripper
+}
+
+func (a *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if a.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.bearerToken)
+	} else {
+		req.SetBasicAuth(a.username, a.password)
+	}
+	return a.next.RoundTrip(req)
+}
+
 func (c *kubeComponent) ID() resource.ID {
 	return c.id
 }
@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestNewAPI(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings *resource.Settings
+		wantAuth string
+	}{
+		{
+			name:     "no auth",
+			settings: &resource.Settings{},
+		},
+		{
+			name: "basic auth",
+			settings: &resource.Settings{
+				PrometheusUsername: "user",
+				PrometheusPassword: "pass",
+			},
+			// base64("user:pass")
+			wantAuth: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name: "bearer token",
+			settings: &resource.Settings{
+				PrometheusBearerToken: "token",
+			},
+			wantAuth: "Bearer token",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotPath, gotAuth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotAuth = r.Header.Get("Authorization")
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+			}))
+			defer server.Close()
+
+			// The override may carry a path prefix, such as when Thanos is behind a proxy.
+			api, err := newAPI(server.URL+"/thanos", tc.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := api.Query(context.Background(), "up", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if gotPath != "/thanos/api/v1/query" {
+				t.Errorf("expected query against the override, got path %q", gotPath)
+			}
+			if gotAuth != tc.wantAuth {
+				t.Errorf("expected Authorization %q, got %q", tc.wantAuth, gotAuth)
+			}
+		})
+	}
+}
@@ -44,8 +44,12 @@ type Config struct {
 	SkipDeploy bool
 }
 
-// New returns a new instance of prometheus.
+// New returns a new instance of prometheus. If --istio.test.prometheusURL is set, the instance queries that
+// address rather than the in-cluster Prometheus.
 func New(ctx resource.Context, c Config) (i Instance, err error) {
+	if ctx.Settings().PrometheusURL != "" {
+		return newExternal(ctx)
+	}
 	return newKube(ctx, c)
 }
 
@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+const (
+	configDumpDir     = "config-dump"
+	sidecarContainer  = "istio-proxy"
+	configDumpCommand = "pilot-agent request GET config_dump"
+)
+
+// configDumpFetcher returns the Envoy config dumps of the sidecars in the namespaces, keyed by file name.
+type configDumpFetcher func(namespaces []string) (map[string][]byte, error)
+
+// dumpConfigOnFailure writes the config dumps of the sidecars in the namespaces of a failed test to the config-dump
+// directory under its work dir, if --istio.test.configDumpOnFailure is set. The dumps that were fetched are written
+// even if others fail.
+func dumpConfigOnFailure(s *resource.Settings, failed bool, workDir string, namespaces []string,
+	fetch configDumpFetcher) error {
+	if !s.ConfigDumpOnFailure || !failed || len(namespaces) == 0 {
+		return nil
+	}
+	dumps, errs := fetch(namespaces)
+	if len(dumps) == 0 {
+		return errs
+	}
+	dir := filepath.Join(workDir, configDumpDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for name, dump := range dumps {
+		if err := os.WriteFile(filepath.Join(dir, name), dump, 0o644); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
+
+// sidecarConfigDumps fetches the config dumps of the sidecars in every cluster of the context, naming each
+// <cluster>-<namespace>-<pod>.json.
+func sidecarConfigDumps(ctx resource.Context) configDumpFetcher {
+	return func(namespaces []string) (map[string][]byte, error) {
+		out := map[string][]byte{}
+		var errs error
+		for _, c := range ctx.Clusters().Kube() {
+			for _, ns := range namespaces {
+				pods, err := c.CoreV1().Pods(ns).List(context.TODO(), kubeApiMeta.ListOptions{})
+				if err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("cluster %s: %v", c.Name(), err))
+					continue
+				}
+				for _, p := range pods.Items {
+					if !hasSidecar(p) {
+						continue
+					}
+					stdout, _, err := c.PodExec(p.Name, ns, sidecarContainer, configDumpCommand)
+					if err != nil {
+						errs = multierror.Append(errs, fmt.Errorf("cluster %s: pod %s/%s: %v", c.Name(), ns, p.Name, err))
+						continue
+					}
+					out[fmt.Sprintf("%s-%s-%s.json", c.Name(), ns, p.Name)] = []byte(stdout)
+				}
+			}
+		}
+		return out, errs
+	}
+}
+
+func hasSidecar(pod kubeApiCore.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == sidecarContainer {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeNamespaces returns the sorted names of the namespaces tracked by the scope and its ancestors, which hold the
+// workloads a test sends its traffic through.
+func scopeNamespaces(s *scope) []string {
+	set := map[string]bool{}
+	for ; s != nil; s = s.parent {
+		s.mu.Lock()
+		for _, r := range s.resources {
+			if ns, ok := r.(namespace.Instance); ok {
+				set[ns.Name()] = true
+			}
+		}
+		s.mu.Unlock()
+	}
+	out := make([]string, 0, len(set))
+	for ns := range set {
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// captureConfigDumps is called as a test completes, to write the config dumps of its sidecars if it failed.
+func (c *testContext) captureConfigDumps() {
+	err := dumpConfigOnFailure(c.Settings(), c.Failed(), c.workDir, scopeNamespaces(c.scope), sidecarConfigDumps(c))
+	if err != nil {
+		scopes.Framework.Warnf("failed capturing config dumps of test %s: %v", c.id, err)
+	}
+}
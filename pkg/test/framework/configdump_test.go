@@ -0,0 +1,94 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pkg/test/framework/components/namespace"
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestDumpConfigOnFailure(t *testing.T) {
+	fetch := func(namespaces []string) (map[string][]byte, error) {
+		out := map[string][]byte{}
+		for _, ns := range namespaces {
+			out["primary-"+ns+"-client.json"] = []byte(`{"configs":[]}`)
+		}
+		return out, nil
+	}
+	for _, tc := range []struct {
+		name   string
+		flag   bool
+		failed bool
+		want   []string
+	}{
+		{name: "failed", flag: true, failed: true, want: []string{"primary-app-client.json"}},
+		{name: "passed", flag: true, failed: false},
+		{name: "flag unset", flag: false, failed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			workDir := filepath.Join(t.TempDir(), "TestOutbound")
+			s := &resource.Settings{ConfigDumpOnFailure: tc.flag}
+			if err := dumpConfigOnFailure(s, tc.failed, workDir, []string{"app"}, fetch); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			entries, err := os.ReadDir(filepath.Join(workDir, configDumpDir))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected config dumps %v, got %v", tc.want, got)
+			}
+			for _, name := range got {
+				b, err := os.ReadFile(filepath.Join(workDir, configDumpDir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != `{"configs":[]}` {
+					t.Errorf("unexpected config dump %s: %s", name, b)
+				}
+			}
+		})
+	}
+}
+
+type fakeNamespace struct {
+	namespace.Instance
+	name string
+}
+
+func (n fakeNamespace) Name() string { return n.name }
+
+func (n fakeNamespace) ID() resource.ID { return nil }
+
+func TestScopeNamespaces(t *testing.T) {
+	suite := newScope("suite", nil)
+	suite.add(fakeNamespace{name: "echo"}, &resourceID{id: "ns-1"})
+	test := newScope("test", suite)
+	test.add(fakeNamespace{name: "app"}, &resourceID{id: "ns-2"})
+	test.add(fakeNamespace{name: "echo"}, &resourceID{id: "ns-3"})
+
+	if got, want := scopeNamespaces(test), []string{"app", "echo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
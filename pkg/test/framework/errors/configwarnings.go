@@ -0,0 +1,82 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// configWarningLevels are the levels of the analysis messages reported as config warnings.
+var configWarningLevels = map[string]bool{
+	"ERROR":   true,
+	"WARNING": true,
+}
+
+type ConfigWarningError struct {
+	msg string
+}
+
+func NewConfigWarningError(format string, args ...interface{}) error {
+	return &ConfigWarningError{fmt.Sprintf(format, args...)}
+}
+
+func IsConfigWarningError(err error) bool {
+	_, ok := err.(*ConfigWarningError)
+	return ok
+}
+
+func IsOrContainsConfigWarningError(err error) bool {
+	if IsConfigWarningError(err) {
+		return true
+	}
+
+	if m, ok := err.(*multierror.Error); ok {
+		for _, e := range m.Errors {
+			if IsConfigWarningError(e) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (ce *ConfigWarningError) Error() string {
+	return ce.msg
+}
+
+// FindConfigWarningsInStatus looks for warnings in the validation messages that Istiod's analysis writes to the
+// `status` of an Istio resource. If found, it will return a ConfigWarningError. Use `resource` to name the resource,
+// like its kind, namespace and name.
+func FindConfigWarningsInStatus(status map[string]interface{}, resource string) error {
+	messages, _ := status["validationMessages"].([]interface{})
+	var warnings []string
+	for _, m := range messages {
+		msg, _ := m.(map[string]interface{})
+		level, _ := msg["level"].(string)
+		if !configWarningLevels[level] {
+			continue
+		}
+		typ, _ := msg["type"].(map[string]interface{})
+		warnings = append(warnings, fmt.Sprintf("%v %v (%s)", typ["code"], typ["name"], level))
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	return NewConfigWarningError("config warnings for %s: %s", resource, strings.Join(warnings, ", "))
+}
@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func validationMessage(level, code, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"level": level,
+		"type":  map[string]interface{}{"code": code, "name": name},
+	}
+}
+
+func TestFindConfigWarningsInStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status map[string]interface{}
+		want   string
+	}{
+		{name: "no status"},
+		{
+			name: "info only",
+			status: map[string]interface{}{"validationMessages": []interface{}{
+				validationMessage("INFO", "IST0102", "NamespaceNotInjected"),
+			}},
+		},
+		{
+			name: "warning and error",
+			status: map[string]interface{}{"validationMessages": []interface{}{
+				validationMessage("INFO", "IST0102", "NamespaceNotInjected"),
+				validationMessage("WARNING", "IST0104", "GatewayPortNotOnWorkload"),
+				validationMessage("ERROR", "IST0101", "ReferencedResourceNotFound"),
+			}},
+			want: "config warnings for VirtualService echo/reviews: IST0104 GatewayPortNotOnWorkload (WARNING), " +
+				"IST0101 ReferencedResourceNotFound (ERROR)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := FindConfigWarningsInStatus(tc.status, "VirtualService echo/reviews")
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("expected no config warnings, got %v", err)
+				}
+				return
+			}
+			if !IsConfigWarningError(err) || err.Error() != tc.want {
+				t.Fatalf("expected config warning error %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestIsOrContainsConfigWarningError(t *testing.T) {
+	warning := NewConfigWarningError("config warnings for VirtualService echo/reviews")
+	if !IsOrContainsConfigWarningError(warning) {
+		t.Error("expected a config warning error to be detected")
+	}
+	if !IsOrContainsConfigWarningError(multierror.Append(fmt.Errorf("delete failed"), warning)) {
+		t.Error("expected a config warning error to be detected in a multierror")
+	}
+	if IsOrContainsConfigWarningError(NewDeprecatedError("usage of deprecated stuff")) {
+		t.Error("expected a deprecation not to be detected as a config warning")
+	}
+}
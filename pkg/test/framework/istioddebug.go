@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-multierror"
+
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+const istiodDebugDir = "istiod-debug"
+
+// istiodDebugFetcher requests a debug path from every istiod, returning the responses keyed by <cluster>-<pod>.
+type istiodDebugFetcher func(path string) (map[string][]byte, error)
+
+// dumpIstiodDebugOnFailure writes the responses of the istiod debug endpoints to the istiod-debug directory under
+// the work dir of a failed test, as <cluster>-<pod>-<endpoint>.json, if --istio.test.istiodDebugOnFailure is set.
+// The endpoints that were fetched are written even if others fail.
+func dumpIstiodDebugOnFailure(s *resource.Settings, failed bool, workDir string, fetch istiodDebugFetcher) error {
+	if !s.IstiodDebugOnFailure || !failed || len(s.IstiodDebugEndpoints) == 0 {
+		return nil
+	}
+	dir := filepath.Join(workDir, istiodDebugDir)
+	var errs error
+	for _, endpoint := range s.IstiodDebugEndpoints {
+		results, err := fetch("debug/" + endpoint)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %v", endpoint, err))
+		}
+		if len(results) == 0 {
+			continue
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return multierror.Append(errs, err)
+		}
+		for istiod, body := range results {
+			out := filepath.Join(dir, fmt.Sprintf("%s-%s.json", istiod, endpoint))
+			if err := os.WriteFile(out, body, 0o644); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// istiodDebug fetches a debug path from every istiod in the primary clusters of the context.
+func istiodDebug(ctx resource.Context) istiodDebugFetcher {
+	ns := istiodNamespace(ctx)
+	return func(path string) (map[string][]byte, error) {
+		out := map[string][]byte{}
+		var errs error
+		for _, c := range ctx.Clusters().Kube().Primaries() {
+			results, err := c.AllDiscoveryDo(context.TODO(), ns, path)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("cluster %s: %v", c.Name(), err))
+				continue
+			}
+			for istiod, body := range results {
+				out[c.Name()+"-"+istiod] = body
+			}
+		}
+		return out, errs
+	}
+}
+
+// captureIstiodDebug is called as a test completes, to write the istiod debug endpoints if it failed.
+func (c *testContext) captureIstiodDebug() {
+	if err := dumpIstiodDebugOnFailure(c.Settings(), c.Failed(), c.workDir, istiodDebug(c)); err != nil {
+		scopes.Framework.Warnf("failed capturing istiod debug endpoints of test %s: %v", c.id, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestDumpIstiodDebugOnFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/debug/syncz", "/debug/endpointz":
+			fmt.Fprintf(w, `{"path":%q}`, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	// The fake endpoint stands in for a single istiod in the primary cluster.
+	fetch := func(path string) (map[string][]byte, error) {
+		resp, err := http.Get(srv.URL + "/" + path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: %s", path, resp.Status)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"primary-istiod-0": body}, nil
+	}
+	for _, tc := range []struct {
+		name      string
+		flag      bool
+		failed    bool
+		endpoints []string
+		want      []string
+		expectErr bool
+	}{
+		{
+			name:      "failed",
+			flag:      true,
+			failed:    true,
+			endpoints: []string{"syncz", "endpointz"},
+			want:      []string{"primary-istiod-0-endpointz.json", "primary-istiod-0-syncz.json"},
+		},
+		{
+			name:      "failed with a missing endpoint",
+			flag:      true,
+			failed:    true,
+			endpoints: []string{"syncz", "missingz"},
+			want:      []string{"primary-istiod-0-syncz.json"},
+			expectErr: true,
+		},
+		{name: "passed", flag: true, failed: false, endpoints: []string{"syncz"}},
+		{name: "flag unset", flag: false, failed: true, endpoints: []string{"syncz"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			workDir := filepath.Join(t.TempDir(), "TestOutbound")
+			s := &resource.Settings{IstiodDebugOnFailure: tc.flag, IstiodDebugEndpoints: tc.endpoints}
+			err := dumpIstiodDebugOnFailure(s, tc.failed, workDir, fetch)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", tc.expectErr, err)
+			}
+			var got []string
+			entries, err := os.ReadDir(filepath.Join(workDir, istiodDebugDir))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected istiod debug artifacts %v, got %v", tc.want, got)
+			}
+			b, err := os.ReadFile(filepath.Join(workDir, istiodDebugDir, "primary-istiod-0-syncz.json"))
+			if err == nil && string(b) != `{"path":"/debug/syncz"}` {
+				t.Errorf("unexpected syncz artifact: %s", b)
+			}
+		})
+	}
+}
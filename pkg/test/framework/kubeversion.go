@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/version"
+
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+// resolvedSettingsFile records the settings of a run, along with the server version of each cluster.
+const resolvedSettingsFile = "resolved-settings.txt"
+
+// serverVersion returns the Kubernetes version of a server, such as v1.22.3-gke.100.
+func serverVersion(v *version.Info) string {
+	if v.GitVersion != "" {
+		return v.GitVersion
+	}
+	// Some providers report minor versions such as 22+.
+	return fmt.Sprintf("v%s.%s", v.Major, strings.TrimSuffix(v.Minor, "+"))
+}
+
+// kubeVersions returns the server version of every Kubernetes cluster of the context, keyed by cluster name.
+func kubeVersions(ctx resource.Context) (map[string]string, error) {
+	out := map[string]string{}
+	for _, c := range ctx.Clusters().Kube() {
+		v, err := c.GetKubernetesVersion()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the Kubernetes version of cluster %s: %v", c.Name(), err)
+		}
+		out[c.Name()] = serverVersion(v)
+	}
+	return out, nil
+}
+
+// checkMinKubeVersion returns an error naming every cluster whose server version is below minVersion. An unset
+// minimum allows every version.
+func checkMinKubeVersion(minVersion string, versions map[string]string) error {
+	if minVersion == "" {
+		return nil
+	}
+	want, err := utilversion.ParseGeneric(minVersion)
+	if err != nil {
+		return fmt.Errorf("invalid --istio.test.minKubeVersion %q: %v", minVersion, err)
+	}
+	var errs error
+	for _, name := range sortedClusterNames(versions) {
+		got, err := utilversion.ParseGeneric(versions[name])
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("cluster %s: unknown Kubernetes version %q: %v", name,
+				versions[name], err))
+			continue
+		}
+		if got.LessThan(want) {
+			errs = multierror.Append(errs, fmt.Errorf("cluster %s runs Kubernetes %s, below the "+
+				"--istio.test.minKubeVersion of %s", name, versions[name], minVersion))
+		}
+	}
+	return errs
+}
+
+// writeResolvedSettings writes the settings of the run, along with the server version of each cluster, to the run
+// dir.
+func writeResolvedSettings(s *resource.Settings, versions map[string]string) error {
+	var b strings.Builder
+	b.WriteString(s.String())
+	for _, name := range sortedClusterNames(versions) {
+		fmt.Fprintf(&b, "KubeVersion[%s]: %s\n", name, versions[name])
+	}
+	return os.WriteFile(filepath.Join(s.RunDir(), resolvedSettingsFile), []byte(b.String()), 0o644)
+}
+
+func sortedClusterNames(versions map[string]string) []string {
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkKubeVersions records the server version of each cluster in the resolved settings, and fails if any is below
+// --istio.test.minKubeVersion. Without a minimum, a cluster whose version cannot be read is only logged. Suites
+// without an environment or Kubernetes clusters have nothing to check or record.
+func checkKubeVersions(ctx resource.Context) error {
+	if ctx.Environment() == nil || len(ctx.Clusters().Kube()) == 0 {
+		return nil
+	}
+	minVersion := ctx.Settings().MinKubeVersion
+	versions, err := kubeVersions(ctx)
+	if err != nil {
+		if minVersion != "" {
+			return err
+		}
+		scopes.Framework.Warnf("%v", err)
+	}
+	if err := writeResolvedSettings(ctx.Settings(), versions); err != nil {
+		scopes.Framework.Warnf("failed writing resolved settings: %v", err)
+	}
+	return checkMinKubeVersion(minVersion, versions)
+}
@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+
+	"istio.io/istio/pkg/test/framework/components/environment/kube"
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestServerVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   version.Info
+		want string
+	}{
+		{
+			name: "git version",
+			in:   version.Info{GitVersion: "v1.22.3-gke.100", Major: "1", Minor: "22+"},
+			want: "v1.22.3-gke.100",
+		},
+		{name: "major and minor", in: version.Info{Major: "1", Minor: "21+"}, want: "v1.21"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := serverVersion(&tc.in); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckMinKubeVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		min       string
+		versions  map[string]string
+		expectErr string
+	}{
+		{name: "unset", versions: map[string]string{"primary": "v1.16.0"}},
+		{name: "equal", min: "1.22", versions: map[string]string{"primary": "v1.22.0"}},
+		{name: "newer", min: "1.22", versions: map[string]string{"primary": "v1.23.1-gke.100"}},
+		{
+			name:      "older",
+			min:       "1.22",
+			versions:  map[string]string{"primary": "v1.23.0", "remote": "v1.21.5"},
+			expectErr: "cluster remote runs Kubernetes v1.21.5, below the --istio.test.minKubeVersion of 1.22",
+		},
+		{
+			name:      "older patch",
+			min:       "v1.22.4",
+			versions:  map[string]string{"primary": "v1.22.3"},
+			expectErr: "cluster primary runs Kubernetes v1.22.3",
+		},
+		{
+			name:      "unparseable server version",
+			min:       "1.22",
+			versions:  map[string]string{"primary": "unknown"},
+			expectErr: `unknown Kubernetes version "unknown"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkMinKubeVersion(tc.min, tc.versions)
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestWriteResolvedSettings(t *testing.T) {
+	s := resource.DefaultSettings()
+	s.BaseDir = t.TempDir()
+	s.MinKubeVersion = "1.22"
+	if err := os.MkdirAll(s.RunDir(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResolvedSettings(s, map[string]string{"remote": "v1.23.0", "primary": "v1.22.3"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(s.RunDir(), resolvedSettingsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"MinKubeVersion:    1.22\n",
+		"KubeVersion[primary]: v1.22.3\nKubeVersion[remote]: v1.23.0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected resolved settings to contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestSuite_KubeVersionsWithoutKubeClusters(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		envFactory resource.EnvironmentFactory
+	}{
+		{name: "no environment", envFactory: resource.NilEnvironmentFactory},
+		{name: "fake clusters", envFactory: func(resource.Context) (resource.Environment, error) {
+			return kube.FakeEnvironment{NumClusters: 2}, nil
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer cleanupRT()
+			var runDir string
+			runFn := func(ctx *suiteContext) int {
+				runDir = ctx.Settings().RunDir()
+				return 0
+			}
+			exitCode := -1
+			settings := resource.DefaultSettings()
+			settings.MinKubeVersion = "1.22"
+			s := newTestSuite("tid", runFn, func(code int) { exitCode = code }, settingsFn(settings))
+			s.envFactory = tc.envFactory
+			s.Run()
+
+			if exitCode != 0 {
+				t.Fatalf("expected the suite to pass, got exit code %d", exitCode)
+			}
+			if _, err := os.Stat(filepath.Join(runDir, resolvedSettingsFile)); !os.IsNotExist(err) {
+				t.Fatalf("expected no %s without Kubernetes clusters, got %v", resolvedSettingsFile, err)
+			}
+		})
+	}
+}
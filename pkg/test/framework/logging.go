@@ -35,10 +35,18 @@ func init() {
 		flag.BoolVar)
 }
 
-func configureLogging() error {
+// configureLogging configures the istio log scopes. With perTestLogs, their output is also copied to the log of
+// every running test.
+func configureLogging(levels map[string]log.Level, perTestLogs bool) error {
 	o := *logOptionsFromCommandline
 
 	o.LogGrpc = false
+	if perTestLogs {
+		o.OutputPaths = append(append([]string{}, o.OutputPaths...), testLogScheme+"://")
+	}
+	for scope, level := range levels {
+		o.SetOutputLevel(scope, level)
+	}
 	grpclog.SetLoggerV2(grpclog.NewLoggerV2(io.Discard, io.Discard, io.Discard))
 
 	return log.Configure(&o)
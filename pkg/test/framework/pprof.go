@@ -0,0 +1,127 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+// defaultIstiodNamespace is where istiod runs when neither the istio component nor --istio.test.systemNamespace
+// says otherwise.
+const defaultIstiodNamespace = "istio-system"
+
+// istiodComponent is implemented by the istio component, which imports this package and so cannot be imported here.
+type istiodComponent interface {
+	resource.Resource
+	SystemNamespace() string
+}
+
+// istiodNamespace returns the namespace of istiod: the one the istio component installed it in, or, without an istio
+// component, the one set by --istio.test.systemNamespace.
+func istiodNamespace(ctx resource.Context) string {
+	var i istiodComponent
+	if err := ctx.GetResource(&i); err == nil {
+		return i.SystemNamespace()
+	}
+	if ns := ctx.Settings().SystemNamespace; ns != "" {
+		return ns
+	}
+	return defaultIstiodNamespace
+}
+
+// profilePaths are the istiod debug endpoints captured by --istio.test.pprof, keyed by profile name.
+var profilePaths = map[string]string{
+	"heap": "debug/pprof/heap",
+	"cpu":  "debug/pprof/profile?seconds=5",
+}
+
+// profileFetcher requests a debug path from every istiod instance in a cluster, returning the responses keyed by
+// pod name.
+type profileFetcher func(path string) (map[string][]byte, error)
+
+// startProfiling periodically captures control plane profiles into the run directory until stop is closed.
+func startProfiling(ctx resource.Context, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				dumpProfiles(ctx, strconv.FormatInt(time.Now().Unix(), 10))
+			}
+		}
+	}()
+}
+
+// dumpProfiles captures profiles from every istiod in every primary cluster; remote clusters have no istiod. The
+// label distinguishes captures taken at different times.
+func dumpProfiles(ctx resource.Context, label string) {
+	ns := istiodNamespace(ctx)
+	for _, c := range ctx.Clusters().Kube().Primaries() {
+		c := c
+		fetch := func(path string) (map[string][]byte, error) {
+			return c.AllDiscoveryDo(context.TODO(), ns, path)
+		}
+		if err := writeProfiles(fetch, filepath.Join(profileDir(ctx.Settings()), c.Name()), label); err != nil {
+			scopes.Framework.Warnf("failed capturing profiles from cluster %s: %v", c.Name(), err)
+		}
+	}
+}
+
+// profileDir is the directory, within the run's artifacts, that profiles are written to.
+func profileDir(s *resource.Settings) string {
+	return filepath.Join(s.RunDir(), "pprof")
+}
+
+// writeProfiles fetches each profile and writes it to dir as <istiod>-<profile>-<label>.pprof.
+func writeProfiles(fetch profileFetcher, dir string, label string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(profilePaths))
+	for name := range profilePaths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs error
+	for _, name := range names {
+		results, err := fetch(profilePaths[name])
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		for istiod, profile := range results {
+			out := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.pprof", istiod, name, label))
+			if err := os.WriteFile(out, profile, 0o644); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	}
+	return errs
+}
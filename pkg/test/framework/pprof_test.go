@@ -0,0 +1,129 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestWriteProfiles(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		_, _ = w.Write([]byte("profile " + r.URL.Path))
+	}))
+	defer server.Close()
+	fetch := func(path string) (map[string][]byte, error) {
+		resp, err := http.Get(server.URL + "/" + path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"istiod-abc": body}, nil
+	}
+
+	settings := &resource.Settings{BaseDir: t.TempDir(), TestID: "pprof"}
+	dir := filepath.Join(profileDir(settings), "primary")
+	if !strings.HasPrefix(dir, settings.BaseDir) {
+		t.Fatalf("expected profiles to be written under the work dir %s, got %s", settings.BaseDir, dir)
+	}
+	if err := writeProfiles(fetch, dir, "failure"); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != len(profilePaths) {
+		t.Errorf("expected %d profiles to be fetched, got %v", len(profilePaths), requested)
+	}
+	for name, want := range map[string]string{
+		"istiod-abc-heap-failure.pprof": "profile /debug/pprof/heap",
+		"istiod-abc-cpu-failure.pprof":  "profile /debug/pprof/profile",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("expected profile %s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("profile %s: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+// istiodResourceContext is a resource.Context holding a single resource.
+type istiodResourceContext struct {
+	resource.Context
+	settings *resource.Settings
+	res      resource.Resource
+}
+
+func (c istiodResourceContext) Settings() *resource.Settings {
+	return c.settings
+}
+
+func (c istiodResourceContext) GetResource(ref interface{}) error {
+	s := newScope("test", nil)
+	if c.res != nil {
+		s.add(c.res, &resourceID{id: "istio"})
+	}
+	return s.get(ref)
+}
+
+type fakeIstiod struct {
+	ns string
+}
+
+func (f fakeIstiod) ID() resource.ID {
+	return &resourceID{id: "istio"}
+}
+
+func (f fakeIstiod) SystemNamespace() string {
+	return f.ns
+}
+
+func TestIstiodNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings *resource.Settings
+		res      resource.Resource
+		want     string
+	}{
+		{name: "default", settings: &resource.Settings{}, want: defaultIstiodNamespace},
+		{name: "flag", settings: &resource.Settings{SystemNamespace: "flag-ns"}, want: "flag-ns"},
+		{
+			name:     "istio component",
+			settings: &resource.Settings{SystemNamespace: "flag-ns"},
+			res:      fakeIstiod{ns: "custom-istio"},
+			want:     "custom-istio",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := istiodResourceContext{settings: tc.settings, res: tc.res}
+			if got := istiodNamespace(ctx); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
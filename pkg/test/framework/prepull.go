@@ -0,0 +1,203 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/image"
+	"istio.io/istio/pkg/test/framework/resource"
+	kube2 "istio.io/istio/pkg/test/kube"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+const (
+	prePullNamespace = "istio-test-prepull"
+	prePullName      = "istio-test-prepull"
+	prePullTimeout   = 5 * time.Minute
+)
+
+// imagePullFailureReasons are the container waiting reasons that indicate an image will not be pulled.
+var imagePullFailureReasons = map[string]bool{
+	"ImagePullBackOff":  true,
+	"ErrImageNeverPull": true,
+	"InvalidImageName":  true,
+}
+
+// prePullImageNames returns the images the framework deploys, built from the image settings.
+func prePullImageNames(s *image.Settings) []string {
+	var out []string
+	for _, name := range []string{"pilot", "proxyv2", "app"} {
+		out = append(out, fmt.Sprintf("%s/%s:%s", s.Hub, name, s.Tag))
+	}
+	return out
+}
+
+// prePullImages pulls the images the framework deploys onto every node of every cluster before any tests run,
+// so that registry problems fail the suite immediately rather than timing out deployments mid-suite.
+func prePullImages(ctx resource.Context) error {
+	s, err := image.SettingsFromCommandLine()
+	if err != nil {
+		return err
+	}
+	images := prePullImageNames(s)
+	scopes.Framework.Infof("=== BEGIN: Pre-pulling images %v ===", images)
+	start := time.Now()
+	for _, c := range ctx.Clusters().Kube() {
+		if err := prePullImagesInCluster(c, images, s.PullPolicy); err != nil {
+			return fmt.Errorf("cluster %s: %v", c.Name(), err)
+		}
+	}
+	scopes.Framework.Infof("=== DONE: Pre-pulling images (%v) ===", time.Since(start))
+	return nil
+}
+
+func prePullImagesInCluster(c cluster.Cluster, images []string, pullPolicy string) error {
+	if !kube2.NamespaceExists(c, prePullNamespace) {
+		if _, err := c.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: kubeApiMeta.ObjectMeta{
+				Name:   prePullNamespace,
+				Labels: map[string]string{"istio-injection": "disabled"},
+			},
+		}, kubeApiMeta.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if err := c.CoreV1().Namespaces().Delete(context.TODO(), prePullNamespace, kube2.DeleteOptionsForeground()); err != nil {
+			scopes.Framework.Warnf("failed to delete namespace %s: %v", prePullNamespace, err)
+		}
+	}()
+
+	if _, err := c.AppsV1().DaemonSets(prePullNamespace).Create(context.TODO(),
+		prePullDaemonSet(images, pullPolicy), kubeApiMeta.CreateOptions{}); err != nil {
+		return err
+	}
+
+	timeout := time.After(prePullTimeout)
+	var lastErr error
+	for {
+		pods, err := c.CoreV1().Pods(prePullNamespace).List(context.TODO(), kubeApiMeta.ListOptions{
+			LabelSelector: "app=" + prePullName,
+		})
+		switch {
+		case err != nil:
+			lastErr = err
+		case len(pods.Items) == 0:
+			lastErr = fmt.Errorf("no pre-pull pods scheduled yet")
+		default:
+			pulled, failures := imagePullStatus(pods.Items)
+			if len(failures) > 0 {
+				// Don't wait out the timeout; these images are not coming.
+				return imagePullError(failures)
+			}
+			if pulled {
+				return nil
+			}
+			lastErr = fmt.Errorf("images not yet pulled")
+		}
+		select {
+		case <-timeout:
+			return fmt.Errorf("timed out pre-pulling images: %v", lastErr)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// prePullDaemonSet runs each image as a container on every node. The containers are never expected to run
+// successfully; all that matters is that the kubelet pulls the image.
+func prePullDaemonSet(images []string, pullPolicy string) *appsv1.DaemonSet {
+	labels := map[string]string{"app": prePullName}
+	var containers []corev1.Container
+	for i, img := range images {
+		containers = append(containers, corev1.Container{
+			Name:            fmt.Sprintf("image-%d", i),
+			Image:           img,
+			ImagePullPolicy: corev1.PullPolicy(pullPolicy),
+			Command:         []string{"/istio-test-prepull-noop"},
+		})
+	}
+	return &appsv1.DaemonSet{
+		ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:      prePullName,
+			Namespace: prePullNamespace,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &kubeApiMeta.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: kubeApiMeta.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: containers,
+					Tolerations: []corev1.Toleration{{
+						Operator: corev1.TolerationOpExists,
+					}},
+				},
+			},
+		},
+	}
+}
+
+// imagePullStatus returns whether every image has been pulled on every pod, along with the images that
+// cannot be pulled, mapped to the pods and reasons they failed with.
+func imagePullStatus(pods []corev1.Pod) (bool, map[string][]string) {
+	pulled := true
+	failures := map[string][]string{}
+	for _, pod := range pods {
+		if len(pod.Status.ContainerStatuses) == 0 {
+			pulled = false
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting != nil && imagePullFailureReasons[cs.State.Waiting.Reason] {
+				failures[cs.Image] = append(failures[cs.Image],
+					fmt.Sprintf("%s on %s: %s", cs.State.Waiting.Reason, pod.Spec.NodeName, cs.State.Waiting.Message))
+				continue
+			}
+			if cs.ImageID == "" && cs.State.Running == nil && cs.State.Terminated == nil {
+				pulled = false
+			}
+		}
+	}
+	return pulled, failures
+}
+
+// imagePullError aggregates the pull failures into a single error listing every unpullable image.
+func imagePullError(failures map[string][]string) error {
+	images := make([]string, 0, len(failures))
+	for img := range failures {
+		images = append(images, img)
+	}
+	sort.Strings(images)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("unable to pull %d image(s):", len(images)))
+	for _, img := range images {
+		reasons := failures[img]
+		sort.Strings(reasons)
+		sb.WriteString(fmt.Sprintf("\n  %s:", img))
+		for _, r := range reasons {
+			sb.WriteString("\n    " + r)
+		}
+	}
+	return fmt.Errorf("%s", sb.String())
+}
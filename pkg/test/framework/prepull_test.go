@@ -0,0 +1,111 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPrePullDaemonSet(t *testing.T) {
+	ds := prePullDaemonSet([]string{"hub/pilot:tag", "hub/app:tag"}, "Never")
+	containers := ds.Spec.Template.Spec.Containers
+	if len(containers) != 2 {
+		t.Fatalf("expected a container per image, got %d", len(containers))
+	}
+	for _, c := range containers {
+		// With pull policy Never, the DaemonSet verifies the images are already on the nodes.
+		if c.ImagePullPolicy != corev1.PullNever {
+			t.Errorf("container %s: expected pull policy Never, got %s", c.Name, c.ImagePullPolicy)
+		}
+	}
+}
+
+func TestImagePullStatus(t *testing.T) {
+	waiting := func(img, reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Image: img,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "msg"}},
+		}
+	}
+	pulled := func(img string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Image:   img,
+			ImageID: "sha256:abc",
+			State:   corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}
+	}
+	pod := func(node string, statuses ...corev1.ContainerStatus) corev1.Pod {
+		return corev1.Pod{
+			Spec:   corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{ContainerStatuses: statuses},
+		}
+	}
+
+	cases := []struct {
+		name         string
+		pods         []corev1.Pod
+		expectPulled bool
+		expectErr    string
+	}{
+		{
+			name:         "all pulled",
+			pods:         []corev1.Pod{pod("node-a", pulled("pilot"), pulled("app")), pod("node-b", pulled("pilot"), pulled("app"))},
+			expectPulled: true,
+		},
+		{
+			name: "still pulling",
+			pods: []corev1.Pod{pod("node-a", pulled("pilot"), waiting("app", "ContainerCreating"))},
+		},
+		{
+			name: "not yet scheduled",
+			pods: []corev1.Pod{pod("node-a")},
+		},
+		{
+			name: "failures aggregated by image",
+			pods: []corev1.Pod{
+				pod("node-b", waiting("pilot", "ImagePullBackOff"), waiting("app", "ErrImageNeverPull")),
+				pod("node-a", waiting("pilot", "ImagePullBackOff"), pulled("app")),
+			},
+			expectErr: "unable to pull 2 image(s):\n" +
+				"  app:\n" +
+				"    ErrImageNeverPull on node-b: msg\n" +
+				"  pilot:\n" +
+				"    ImagePullBackOff on node-a: msg\n" +
+				"    ImagePullBackOff on node-b: msg",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotPulled, failures := imagePullStatus(tc.pods)
+			if tc.expectErr != "" {
+				if len(failures) == 0 {
+					t.Fatalf("expected failures, got none")
+				}
+				if got := imagePullError(failures).Error(); got != tc.expectErr {
+					t.Fatalf("unexpected error:\n%s\nwant:\n%s", got, tc.expectErr)
+				}
+				return
+			}
+			if len(failures) != 0 {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+			if gotPulled != tc.expectPulled {
+				t.Fatalf("expected pulled=%v, got %v", tc.expectPulled, gotPulled)
+			}
+		})
+	}
+}
@@ -17,12 +17,27 @@ package resource
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	kubeResource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/env"
 	"istio.io/istio/pkg/test/framework/components/echo/echotypes"
 	"istio.io/istio/pkg/test/framework/config"
 	"istio.io/istio/pkg/test/framework/label"
+	"istio.io/istio/pkg/util/gogoprotomarshal"
+	"istio.io/pkg/log"
 )
 
 var settingsFromCommandLine = DefaultSettings()
@@ -43,15 +58,92 @@ func SettingsFromCommandLine(testID string) (*Settings, error) {
 	}
 	s.Selector = f
 
+	s.OnlyLabels, err = parseOnlyLabels(s.OnlyLabelsString)
+	if err != nil {
+		return nil, err
+	}
+
+	s.NamespaceLabelSelector, err = parseNamespaceSelector(s.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SidecarResources, err = ParseSidecarResources(s.SidecarResourcesString)
+	if err != nil {
+		return nil, err
+	}
+
+	s.IstiodDebugEndpoints, err = parseIstiodDebugEndpoints(s.IstiodDebugEndpointsString)
+	if err != nil {
+		return nil, err
+	}
+
+	s.EchoProtocols, err = parseEchoProtocols(s.EchoProtocolsString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validateSystemNamespace(s.SystemNamespace); err != nil {
+		return nil, err
+	}
+
+	if err = validateKubeRateLimits(s.KubeQPS, s.KubeBurst); err != nil {
+		return nil, err
+	}
+
+	if err = validateEchoReplicas(s.EchoReplicas); err != nil {
+		return nil, err
+	}
+
+	if err = validateChartPath(s.ChartPath); err != nil {
+		return nil, err
+	}
+
+	if err = validateMeshConfigOverlay(s.MeshConfigOverlay); err != nil {
+		return nil, err
+	}
+
+	if err = readPrometheusCredentials(s); err != nil {
+		return nil, err
+	}
+
+	if s.ChangedSince != "" {
+		s.ChangedFiles, err = changedFilesSince(env.IstioSrc, s.ChangedSince)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --istio.test.changedSince: %v", err)
+		}
+	}
+
 	s.SkipMatcher, err = NewMatcher(s.SkipString)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.QuarantineFile != "" {
+		if s.QuarantineList, err = loadQuarantineList(s.QuarantineFile); err != nil {
+			return nil, fmt.Errorf("invalid --istio.test.quarantineFile: %v", err)
+		}
+	}
+	s.QuarantineMatcher, err = NewMatcher(s.QuarantineList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --istio.test.quarantineFile: %v", err)
+	}
+
 	for _, wl := range s.skipWorkloadClasses {
 		s.SkipWorkloadClasses.Insert(strings.Split(wl, ",")...)
 	}
-	if s.skipVM {
+	for _, f := range s.enabledFeatures {
+		if err = enableFeatures(s.EnabledFeatures, f); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range s.protocolFilter {
+		addProtocolFilter(s.ProtocolFilter, p)
+	}
+	if s.VMMode, err = resolveVMMode(s.VMMode, s.skipVM); err != nil {
+		return nil, err
+	}
+	if s.VMMode == VMModeSkip {
 		s.SkipWorkloadClasses.Insert(echotypes.VM)
 	}
 	if s.skipTProxy {
@@ -66,9 +158,21 @@ func SettingsFromCommandLine(testID string) (*Settings, error) {
 		return nil, err
 	}
 
+	for _, v := range s.ExtraValidators {
+		if err = v(s); err != nil {
+			return nil, err
+		}
+	}
+
 	return s, nil
 }
 
+// AddExtraValidator registers a validator to be run by SettingsFromCommandLine. It must be called before the
+// suite is run, typically from TestMain.
+func AddExtraValidator(fn func(*Settings) error) {
+	settingsFromCommandLine.ExtraValidators = append(settingsFromCommandLine.ExtraValidators, fn)
+}
+
 // validate checks that user has not passed invalid flag combinations to test framework.
 func validate(s *Settings) error {
 	if s.FailOnDeprecation && s.NoCleanup {
@@ -76,6 +180,15 @@ func validate(s *Settings) error {
 			" -istio.test.deprecation_failure must not be used at the same time")
 	}
 
+	if s.FailOnConfigWarning && s.NoCleanup {
+		return fmt.Errorf("checking for config warnings occurs at cleanup level, thus flags -istio.test.nocleanup and" +
+			" -istio.test.failOnConfigWarning must not be used at the same time")
+	}
+
+	if s.SnapshotNamespaces && !s.StableNamespaces {
+		return fmt.Errorf("--istio.test.snapshotNamespaces requires --istio.test.stableNamespaces")
+	}
+
 	if s.Revision != "" {
 		if s.Revisions != nil {
 			return fmt.Errorf("cannot use --istio.test.revision and --istio.test.revisions at the same time," +
@@ -94,6 +207,397 @@ func validate(s *Settings) error {
 		return fmt.Errorf("cannot use --istio.test.compatibility without setting --istio.test.revisions")
 	}
 
+	if s.InjectionMode != "" && !knownInjectionModes[s.InjectionMode] {
+		return fmt.Errorf("unknown --istio.test.injectionMode %q, must be one of %q, %q or %q",
+			s.InjectionMode, InjectionModeEnabled, InjectionModeDisabled, InjectionModePerTest)
+	}
+
+	if s.InjectionMode == InjectionModeDisabled && s.Revisions != nil {
+		// The revisions are only reachable through injection.
+		return fmt.Errorf("--istio.test.injectionMode=%s cannot be used with --istio.test.revision or "+
+			"--istio.test.revisions", s.InjectionMode)
+	}
+
+	if s.PeerAuthMode != "" && !knownPeerAuthModes[s.PeerAuthMode] {
+		return fmt.Errorf("unknown --istio.test.peerAuth %q, must be one of %q, %q or %q",
+			s.PeerAuthMode, PeerAuthModePermissive, PeerAuthModeStrict, PeerAuthModeDisable)
+	}
+
+	if err := validatePrometheusSettings(s); err != nil {
+		return err
+	}
+
+	if err := validateOTELEndpoint(s.OTELEndpoint); err != nil {
+		return err
+	}
+
+	if s.EchoReadyTimeout < 0 {
+		return fmt.Errorf("--istio.test.echoReadyTimeout must be positive, got %v", s.EchoReadyTimeout)
+	}
+
+	if s.MaxDuration < 0 {
+		return fmt.Errorf("--istio.test.maxDuration must be positive, got %v", s.MaxDuration)
+	}
+
+	if s.GatewayClass != "" && !knownGatewayClasses[s.GatewayClass] {
+		return fmt.Errorf("unknown --istio.test.gatewayClass %q, must be one of %q or %q",
+			s.GatewayClass, GatewayClassIstio, GatewayClassGatewayAPI)
+	}
+
+	if s.InstallMethod != "" && !knownInstallMethods[s.InstallMethod] {
+		return fmt.Errorf("unknown --istio.test.installMethod %q, must be one of %q, %q or %q",
+			s.InstallMethod, InstallMethodIstioctl, InstallMethodHelm, InstallMethodOperator)
+	}
+
+	if s.ChartPath != "" && s.InstallMethod == InstallMethodOperator {
+		// The operator renders the charts built into its image, so a local chart would be silently ignored.
+		return fmt.Errorf("--istio.test.chartPath cannot be used with --istio.test.installMethod=%s", s.InstallMethod)
+	}
+
+	if s.InstallProfile != "" && !knownInstallProfiles[s.InstallProfile] {
+		known := make([]string, 0, len(knownInstallProfiles))
+		for p := range knownInstallProfiles {
+			known = append(known, string(p))
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown --istio.test.profile %q, must be one of %v", s.InstallProfile, known)
+	}
+
+	if s.UseExistingInstall {
+		if s.ChartPath != "" {
+			return fmt.Errorf("--istio.test.chartPath cannot be used with --istio.test.useExistingInstall")
+		}
+		if s.InstallMethod != "" && s.InstallMethod != InstallMethodIstioctl {
+			return fmt.Errorf("--istio.test.installMethod=%s cannot be used with --istio.test.useExistingInstall",
+				s.InstallMethod)
+		}
+		if s.InstallProfile != "" {
+			return fmt.Errorf("--istio.test.profile cannot be used with --istio.test.useExistingInstall")
+		}
+	}
+
+	if s.StateDumpMode != "" && !knownStateDumpModes[s.StateDumpMode] {
+		return fmt.Errorf("unknown --istio.test.stateDump %q, must be one of %q, %q or %q",
+			s.StateDumpMode, StateDumpAlways, StateDumpOnFailure, StateDumpNever)
+	}
+
+	if s.StateDumpMode == StateDumpNever && s.RetainArtifactsOnSuccess {
+		return fmt.Errorf("--istio.test.stateDump=%s cannot be used with --istio.test.retainArtifactsOnSuccess",
+			s.StateDumpMode)
+	}
+
+	if s.MinKubeVersion != "" {
+		if _, err := version.ParseGeneric(s.MinKubeVersion); err != nil {
+			return fmt.Errorf("invalid --istio.test.minKubeVersion %q: %v", s.MinKubeVersion, err)
+		}
+	}
+
+	if s.CNIMode != "" && !knownCNIModes[s.CNIMode] {
+		return fmt.Errorf("unknown --istio.test.cni %q, must be one of %q, %q or %q",
+			s.CNIMode, CNIModeEnabled, CNIModeDisabled, CNIModeAuto)
+	}
+
+	levels, err := ParseLogLevels(s.LogLevelString)
+	if err != nil {
+		return fmt.Errorf("invalid --istio.test.logLevel: %v", err)
+	}
+	s.LogLevels = levels
+
+	return nil
+}
+
+// validateKubeRateLimits checks that the Kubernetes client rate limits are positive. The burst may be lower than
+// the QPS, in which case client-go limits requests to the burst.
+func validateKubeRateLimits(qps float32, burst int) error {
+	if qps <= 0 {
+		return fmt.Errorf("--istio.test.kubeQPS must be positive, got %v", qps)
+	}
+	if burst <= 0 {
+		return fmt.Errorf("--istio.test.kubeBurst must be positive, got %v", burst)
+	}
+	return nil
+}
+
+// parseOnlyLabels parses the labels of --istio.test.onlyLabels into a selector requiring all of them. Unlike
+// --istio.test.select, labels cannot be excluded.
+func parseOnlyLabels(s string) (label.Selector, error) {
+	for _, l := range strings.Split(s, ",") {
+		if strings.HasPrefix(l, "-") {
+			return label.Selector{}, fmt.Errorf("invalid --istio.test.onlyLabels %q: %q excludes a label, "+
+				"use --istio.test.select instead", s, l)
+		}
+	}
+	sel, err := label.ParseSelector(s)
+	if err != nil {
+		return label.Selector{}, fmt.Errorf("invalid --istio.test.onlyLabels: %v", err)
+	}
+	return sel, nil
+}
+
+func validateEchoReplicas(replicas int) error {
+	if replicas < 1 {
+		return fmt.Errorf("--istio.test.echoReplicas must be at least 1, got %v", replicas)
+	}
+	return nil
+}
+
+// resolveVMMode returns the VM mode selected by --istio.test.vmMode, or by the older --istio.test.skipVM, which
+// is equivalent to --istio.test.vmMode=skip.
+func resolveVMMode(mode VMMode, skipVM bool) (VMMode, error) {
+	if mode != "" && !knownVMModes[mode] {
+		return "", fmt.Errorf("unknown --istio.test.vmMode %q, must be one of %q or %q",
+			mode, VMModeSimulated, VMModeSkip)
+	}
+	if skipVM {
+		if mode != "" && mode != VMModeSkip {
+			return "", fmt.Errorf("--istio.test.skipVM conflicts with --istio.test.vmMode=%s", mode)
+		}
+		return VMModeSkip, nil
+	}
+	if mode == "" {
+		return VMModeSimulated, nil
+	}
+	return mode, nil
+}
+
+// enableFeatures adds the comma separated alpha features to the set, failing on any that are not in the registry.
+func enableFeatures(enabled sets.Set, features string) error {
+	for _, f := range strings.Split(features, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !knownAlphaFeatures[AlphaFeature(f)] {
+			known := make([]string, 0, len(knownAlphaFeatures))
+			for k := range knownAlphaFeatures {
+				known = append(known, string(k))
+			}
+			sort.Strings(known)
+			return fmt.Errorf("invalid --istio.test.features: unknown feature %q, expected one of %v", f, known)
+		}
+		enabled.Insert(f)
+	}
+	return nil
+}
+
+// parseIstiodDebugEndpoints parses a comma separated list of istiod debug endpoints, given either by name or by
+// their /debug/ path, into their names.
+func parseIstiodDebugEndpoints(endpoints string) ([]string, error) {
+	var out []string
+	for _, e := range strings.Split(endpoints, ",") {
+		e = strings.TrimPrefix(strings.TrimSpace(e), "/")
+		e = strings.TrimPrefix(e, "debug/")
+		if e == "" {
+			continue
+		}
+		if strings.ContainsAny(e, "/?") {
+			return nil, fmt.Errorf("invalid --istio.test.istiodDebugEndpoints %q: %q is not the name of an istiod "+
+				"debug endpoint", endpoints, e)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// parseEchoProtocols parses a comma separated list of protocols, such as 'http,grpc', rejecting unknown ones.
+func parseEchoProtocols(protocols string) ([]protocol.Instance, error) {
+	var out []protocol.Instance
+	for _, p := range strings.Split(protocols, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		instance := protocol.Parse(p)
+		if instance == protocol.Unsupported {
+			return nil, fmt.Errorf("invalid --istio.test.echoProtocols %q: unknown protocol %q", protocols, p)
+		}
+		out = append(out, instance)
+	}
+	return out, nil
+}
+
+// addProtocolFilter adds the comma separated protocols to the filter, in lower case.
+func addProtocolFilter(filter sets.Set, protocols string) {
+	for _, p := range strings.Split(protocols, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			filter.Insert(p)
+		}
+	}
+}
+
+// validateChartPath checks that the chart path, if set, is a directory containing a Helm chart.
+func validateChartPath(chartPath string) error {
+	if chartPath == "" {
+		return nil
+	}
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return fmt.Errorf("invalid --istio.test.chartPath: %v", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("invalid --istio.test.chartPath: %s is not a directory", chartPath)
+	}
+	if _, err := os.Stat(filepath.Join(chartPath, "Chart.yaml")); err != nil {
+		return fmt.Errorf("invalid --istio.test.chartPath: %s does not contain a Chart.yaml: %v", chartPath, err)
+	}
+	return nil
+}
+
+// validateMeshConfigOverlay checks that the mesh config overlay, if set, is a file that parses as mesh config.
+func validateMeshConfigOverlay(overlay string) error {
+	if overlay == "" {
+		return nil
+	}
+	b, err := os.ReadFile(overlay)
+	if err != nil {
+		return fmt.Errorf("invalid --istio.test.meshConfigOverlay: %v", err)
+	}
+	if err := gogoprotomarshal.ApplyYAMLStrict(string(b), &meshconfig.MeshConfig{}); err != nil {
+		return fmt.Errorf("invalid --istio.test.meshConfigOverlay: %s is not valid mesh config: %v", overlay, err)
+	}
+	return nil
+}
+
+var stringToLogLevel = map[string]log.Level{
+	"debug": log.DebugLevel,
+	"info":  log.InfoLevel,
+	"warn":  log.WarnLevel,
+	"error": log.ErrorLevel,
+	"fatal": log.FatalLevel,
+	"none":  log.NoneLevel,
+}
+
+// ParseLogLevels parses a comma-separated list of scope:level pairs (e.g. "tf:debug,default:info")
+// into a map of scope to log level.
+func ParseLogLevels(levels string) (map[string]log.Level, error) {
+	out := make(map[string]log.Level)
+	if levels == "" {
+		return out, nil
+	}
+	for _, sl := range strings.Split(levels, ",") {
+		parts := strings.Split(sl, ":")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%q is not of the form scope:level", sl)
+		}
+		level, ok := stringToLogLevel[strings.ToLower(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf("%q has an invalid level %q", sl, parts[1])
+		}
+		out[parts[0]] = level
+	}
+	return out, nil
+}
+
+// parseNamespaceSelector parses the Kubernetes label selector used to scope the namespaces managed by the framework.
+// An empty selector matches all namespaces.
+func parseNamespaceSelector(selector string) (labels.Selector, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --istio.test.namespaceSelector %q: %v", selector, err)
+	}
+	return sel, nil
+}
+
+// ParseSidecarResources parses a comma separated list of requests.cpu, requests.memory, limits.cpu and
+// limits.memory assignments, such as "requests.cpu=100m,requests.memory=128Mi". Each value must be a valid quantity.
+func ParseSidecarResources(spec string) (SidecarResources, error) {
+	out := SidecarResources{}
+	if spec == "" {
+		return out, nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return SidecarResources{}, fmt.Errorf("invalid --istio.test.sidecarResources %q: expected key=quantity, got %q", spec, kv)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if _, err := kubeResource.ParseQuantity(value); err != nil {
+			return SidecarResources{}, fmt.Errorf("invalid --istio.test.sidecarResources: %s=%q: %v", key, value, err)
+		}
+		switch key {
+		case "requests.cpu":
+			out.CPURequest = value
+		case "requests.memory":
+			out.MemoryRequest = value
+		case "limits.cpu":
+			out.CPULimit = value
+		case "limits.memory":
+			out.MemoryLimit = value
+		default:
+			return SidecarResources{}, fmt.Errorf("invalid --istio.test.sidecarResources: unknown resource %q, "+
+				"expected one of requests.cpu, requests.memory, limits.cpu or limits.memory", key)
+		}
+	}
+	return out, nil
+}
+
+// readPrometheusCredentials sets the Prometheus password and bearer token from the files they are passed in.
+func readPrometheusCredentials(s *Settings) error {
+	for _, c := range []struct {
+		flag string
+		file string
+		out  *string
+	}{
+		{flag: "prometheusPasswordFile", file: s.prometheusPasswordFile, out: &s.PrometheusPassword},
+		{flag: "prometheusBearerTokenFile", file: s.prometheusBearerTokenFile, out: &s.PrometheusBearerToken},
+	} {
+		if c.file == "" {
+			continue
+		}
+		b, err := os.ReadFile(c.file)
+		if err != nil {
+			return fmt.Errorf("invalid --istio.test.%s: %v", c.flag, err)
+		}
+		*c.out = strings.TrimSpace(string(b))
+	}
+	return nil
+}
+
+// validatePrometheusSettings checks that the external Prometheus URL is well formed, and that the auth flags
+// are only used with it and not combined.
+func validatePrometheusSettings(s *Settings) error {
+	hasBasicAuth := s.PrometheusUsername != "" || s.PrometheusPassword != ""
+	if s.PrometheusURL == "" {
+		if hasBasicAuth || s.PrometheusBearerToken != "" {
+			return fmt.Errorf("prometheus credentials require --istio.test.prometheusURL to be set")
+		}
+		return nil
+	}
+	u, err := url.Parse(s.PrometheusURL)
+	if err != nil {
+		return fmt.Errorf("invalid --istio.test.prometheusURL %q: %v", s.PrometheusURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --istio.test.prometheusURL %q: must be an absolute http or https URL", s.PrometheusURL)
+	}
+	if hasBasicAuth && s.PrometheusBearerToken != "" {
+		return fmt.Errorf("cannot use --istio.test.prometheusUsername/PasswordFile and --istio.test.prometheusBearerTokenFile at the same time")
+	}
+	return nil
+}
+
+// validateOTELEndpoint checks that the OpenTelemetry collector endpoint, if set, is an absolute http or https URL.
+func validateOTELEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid --istio.test.otelEndpoint %q: %v", endpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --istio.test.otelEndpoint %q: must be an absolute http or https URL", endpoint)
+	}
+	return nil
+}
+
+// validateSystemNamespace checks that the system namespace override, if set, is a valid namespace name.
+func validateSystemNamespace(ns string) error {
+	if ns == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+		return fmt.Errorf("invalid --istio.test.systemNamespace %q: %s", ns, strings.Join(errs, ", "))
+	}
 	return nil
 }
 
@@ -109,26 +613,49 @@ func init() {
 		"Do not cleanup resources after test completion")
 
 	flag.BoolVar(&settingsFromCommandLine.CIMode, "istio.test.ci", settingsFromCommandLine.CIMode,
-		"Enable CI Mode. Additional logging and state dumping will be enabled.")
+		"Enable CI Mode. Additional logging and state dumping will be enabled. State dumping can be limited with "+
+			"--istio.test.stateDump.")
 
 	flag.StringVar(&settingsFromCommandLine.SelectorString, "istio.test.select", settingsFromCommandLine.SelectorString,
 		"Comma separated list of labels for selecting tests to run (e.g. 'foo,+bar-baz').")
 
+	flag.StringVar(&settingsFromCommandLine.OnlyLabelsString, "istio.test.onlyLabels", settingsFromCommandLine.OnlyLabelsString,
+		"Comma separated list of labels that tests must all have to run (e.g. 'postsubmit,ipv4'), in addition to "+
+			"matching --istio.test.select.")
+
 	flag.Var(&settingsFromCommandLine.SkipString, "istio.test.skip",
 		"Skip tests matching the regular expression. This follows the semantics of -test.run.")
 
 	flag.Var(&settingsFromCommandLine.skipWorkloadClasses, "istio.test.skipWorkloads",
 		"Skips deploying and using workloads of the given comma-separated classes (e.g. vm, proxyless, etc.)")
 
+	flag.Var(&settingsFromCommandLine.enabledFeatures, "istio.test.features",
+		"Comma-separated alpha features enabled in the environment (e.g. gateway-api,wasm-plugin). "+
+			"Tests requiring other alpha features are skipped.")
+
+	flag.Var(&settingsFromCommandLine.protocolFilter, "istio.test.protocolFilter",
+		"Comma-separated protocols (e.g. http,https) whose cases are run by suites that support filtering by "+
+			"protocol. Other cases are skipped.")
+
 	flag.IntVar(&settingsFromCommandLine.Retries, "istio.test.retries", settingsFromCommandLine.Retries,
 		"Number of times to retry tests")
 
 	flag.BoolVar(&settingsFromCommandLine.StableNamespaces, "istio.test.stableNamespaces", settingsFromCommandLine.StableNamespaces,
 		"If set, will use consistent namespace rather than randomly generated. Useful with nocleanup to develop tests.")
 
+	flag.BoolVar(&settingsFromCommandLine.SnapshotNamespaces, "istio.test.snapshotNamespaces",
+		settingsFromCommandLine.SnapshotNamespaces, "If set, the Istio config of each stable namespace is captured when it "+
+			"is first claimed and restored each time it is claimed again, reverting config left behind by earlier runs. "+
+			"Requires --istio.test.stableNamespaces.")
+
 	flag.BoolVar(&settingsFromCommandLine.FailOnDeprecation, "istio.test.deprecation_failure", settingsFromCommandLine.FailOnDeprecation,
 		"Make tests fail if any usage of deprecated stuff (e.g. Envoy flags) is detected.")
 
+	flag.BoolVar(&settingsFromCommandLine.FailOnConfigWarning, "istio.test.failOnConfigWarning",
+		settingsFromCommandLine.FailOnConfigWarning, "Make tests fail if Istiod's analysis reports config warnings for "+
+			"resources in their namespaces. The check runs when the namespaces are cleaned up, and enables analysis "+
+			"in Istiod.")
+
 	flag.StringVar(&settingsFromCommandLine.Revision, "istio.test.revision", settingsFromCommandLine.Revision,
 		"If set to XXX, overwrite the default namespace label (istio-injection=enabled) with istio.io/rev=XXX.")
 
@@ -145,6 +672,176 @@ func init() {
 		"Transparently deploy echo instances pointing to each revision set in `Revisions`")
 
 	flag.Var(&settingsFromCommandLine.Revisions, "istio.test.revisions", "Istio CP revisions available to the test framework and their corresponding versions.")
+
+	flag.StringVar(&settingsFromCommandLine.LogLevelString, "istio.test.logLevel", settingsFromCommandLine.LogLevelString,
+		"Comma separated list of scope:level pairs (e.g. 'tf:debug,default:info') applied to the framework logger and "+
+			"to the deployed control plane.")
+
+	flag.StringVar(&settingsFromCommandLine.NamespaceSelector, "istio.test.namespaceSelector", settingsFromCommandLine.NamespaceSelector,
+		"Kubernetes label selector (e.g. 'istio-testing=istio-test,team=foo') restricting the namespaces that the framework "+
+			"dumps state for. Only dumps are scoped: namespaces are still set up for every test, and those the framework "+
+			"creates are always cleaned up, so that a scoped run does not leak namespaces into the cluster.")
+
+	flag.StringVar(&settingsFromCommandLine.SystemNamespace, "istio.test.systemNamespace", settingsFromCommandLine.SystemNamespace,
+		"Namespace the Istio control plane is installed into. Overrides --istio.test.kube.systemNamespace.")
+
+	flag.StringVar(&settingsFromCommandLine.PrometheusURL, "istio.test.prometheusURL", settingsFromCommandLine.PrometheusURL,
+		"Address of an existing Prometheus-compatible API to query, instead of the in-cluster Prometheus.")
+
+	flag.StringVar(&settingsFromCommandLine.PrometheusUsername, "istio.test.prometheusUsername", settingsFromCommandLine.PrometheusUsername,
+		"Username for basic auth against --istio.test.prometheusURL.")
+
+	flag.StringVar(&settingsFromCommandLine.prometheusPasswordFile, "istio.test.prometheusPasswordFile",
+		settingsFromCommandLine.prometheusPasswordFile,
+		"File containing the password for basic auth against --istio.test.prometheusURL.")
+
+	flag.StringVar(&settingsFromCommandLine.prometheusBearerTokenFile, "istio.test.prometheusBearerTokenFile",
+		settingsFromCommandLine.prometheusBearerTokenFile,
+		"File containing the bearer token for auth against --istio.test.prometheusURL.")
+
+	flag.BoolVar(&settingsFromCommandLine.PrePullImages, "istio.test.prePullImages", settingsFromCommandLine.PrePullImages,
+		"Pull the images used by the framework onto every node before running tests, and fail fast if any cannot be pulled. "+
+			"With --istio.test.pullpolicy=Never, this verifies the images are already present on the nodes.")
+
+	flag.DurationVar(&settingsFromCommandLine.PprofDump, "istio.test.pprof", settingsFromCommandLine.PprofDump,
+		"If non-zero, capture CPU and heap profiles from the control plane into the work dir at this interval, "+
+			"and before dumping state for a failed suite in CI mode.")
+
+	flag.BoolVar(&settingsFromCommandLine.ConfigDumpOnFailure, "istio.test.configDumpOnFailure",
+		settingsFromCommandLine.ConfigDumpOnFailure,
+		"If set, write the Envoy config dump of every sidecar in the namespaces of a failed test to its artifacts.")
+
+	flag.BoolVar(&settingsFromCommandLine.IstiodDebugOnFailure, "istio.test.istiodDebugOnFailure",
+		settingsFromCommandLine.IstiodDebugOnFailure, "If set, the istiod debug endpoints of "+
+			"--istio.test.istiodDebugEndpoints are captured into the artifacts of failed tests.")
+
+	flag.StringVar(&settingsFromCommandLine.IstiodDebugEndpointsString, "istio.test.istiodDebugEndpoints",
+		settingsFromCommandLine.IstiodDebugEndpointsString, "Comma separated istiod debug endpoints (e.g. "+
+			"'syncz,endpointz') captured on failure with --istio.test.istiodDebugOnFailure.")
+
+	flag.StringVar(&settingsFromCommandLine.MinKubeVersion, "istio.test.minKubeVersion",
+		settingsFromCommandLine.MinKubeVersion, "The lowest Kubernetes server version, such as 1.22, the clusters may "+
+			"run. If any cluster is older, the suite fails before setup.")
+
+	flag.StringVar(&settingsFromCommandLine.ChangedSince, "istio.test.changedSince", settingsFromCommandLine.ChangedSince,
+		"A git ref. If set, only suites impacted by the files changed since this ref are run; the rest are skipped. "+
+			"This is applied in addition to --istio.test.select.")
+
+	flag.BoolVar(&settingsFromCommandLine.CallGraphDump, "istio.test.callGraphDump", settingsFromCommandLine.CallGraphDump,
+		"Record the source, destination, protocol and outcome of every echo call to echo-call-graph.jsonl in the work dir.")
+
+	flag.Var((*float32Value)(&settingsFromCommandLine.KubeQPS), "istio.test.kubeQPS",
+		"The maximum queries per second of the framework's Kubernetes clients.")
+
+	flag.IntVar(&settingsFromCommandLine.KubeBurst, "istio.test.kubeBurst", settingsFromCommandLine.KubeBurst,
+		"The maximum burst of the framework's Kubernetes clients.")
+
+	flag.DurationVar(&settingsFromCommandLine.EchoReadyTimeout, "istio.test.echoReadyTimeout",
+		settingsFromCommandLine.EchoReadyTimeout,
+		"How long to wait for echo workloads to become ready. If set, overrides --istio.test.echo.readinessTimeout.")
+
+	flag.IntVar(&settingsFromCommandLine.EchoReplicas, "istio.test.echoReplicas", settingsFromCommandLine.EchoReplicas,
+		"The number of replicas of each echo deployment. Simulated VMs always run a single replica.")
+
+	flag.StringVar(&settingsFromCommandLine.OTELEndpoint, "istio.test.otelEndpoint", settingsFromCommandLine.OTELEndpoint,
+		"The OTLP/HTTP traces endpoint of an OpenTelemetry collector (e.g. http://localhost:4318/v1/traces). If set, "+
+			"spans of the install, namespace setup, echo deployments and each test are sent to it.")
+
+	flag.StringVar(&settingsFromCommandLine.EchoProtocolsString, "istio.test.echoProtocols",
+		settingsFromCommandLine.EchoProtocolsString, "Comma separated protocols (e.g. 'http,grpc') the echo workloads "+
+			"expose ports for. If unset, every configured port is deployed. A gRPC port is always kept.")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.GatewayClass), "istio.test.gatewayClass",
+		string(settingsFromCommandLine.GatewayClass),
+		"The gateway implementation tests deploy and route through. One of 'istio' (the gateways installed with Istio) "+
+			"or 'gateway-api' (gateways deployed from Kubernetes Gateway API resources).")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.VMMode), "istio.test.vmMode", string(settingsFromCommandLine.VMMode),
+		"How VM workloads are deployed. One of 'simulated' (in pods built from VM images, the default) or 'skip'. "+
+			"--istio.test.skipVM is equivalent to 'skip'.")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.CNIMode), "istio.test.cni", string(settingsFromCommandLine.CNIMode),
+		"Whether Istio is installed with the CNI plugin in place of the istio-init container injected into pods. "+
+			"One of 'enabled', 'disabled' or 'auto' (follow --istio.test.istio.enableCNI, the default).")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.InjectionMode), "istio.test.injectionMode",
+		string(settingsFromCommandLine.InjectionMode),
+		"How test namespaces are labeled for sidecar injection. One of 'enabled', which injects every namespace, "+
+			"'disabled', which injects none, or 'per-test' (the default), which injects the namespaces of tests that "+
+			"opt in. 'disabled' cannot be used with --istio.test.revision or --istio.test.revisions.")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.PeerAuthMode), "istio.test.peerAuth",
+		string(settingsFromCommandLine.PeerAuthMode),
+		"The mTLS mode of a mesh-wide PeerAuthentication applied before tests. One of 'permissive', 'strict' or "+
+			"'disable'. If unset, no PeerAuthentication is applied.")
+
+	flag.DurationVar(&settingsFromCommandLine.MaxDuration, "istio.test.maxDuration", settingsFromCommandLine.MaxDuration,
+		"The time budget of the whole suite. Once exceeded, no new tests are started, the state of in-flight tests is "+
+			"dumped, and the suite exits with an error. Unset by default.")
+
+	flag.StringVar(&settingsFromCommandLine.QuarantineFile, "istio.test.quarantineFile", settingsFromCommandLine.QuarantineFile,
+		"A file listing quarantined tests, one test name or --istio.test.skip style regex per line. Quarantined tests are "+
+			"run, but their failures are reported as warnings and do not fail the suite or trigger --istio.test.retries.")
+
+	flag.StringVar(&settingsFromCommandLine.ChartPath, "istio.test.chartPath", settingsFromCommandLine.ChartPath,
+		"A local Helm chart to install Istio from, in place of the chart of the same name in the built-in manifests.")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.InstallMethod), "istio.test.installMethod",
+		string(settingsFromCommandLine.InstallMethod),
+		"How Istio is installed. One of 'istioctl' (the default), 'helm' or 'operator'. --istio.test.chartPath "+
+			"cannot be used with 'operator'.")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.InstallProfile), "istio.test.profile",
+		string(settingsFromCommandLine.InstallProfile),
+		"The IstioOperator profile Istio is installed with, such as 'minimal' or 'demo'. If unset, the profile of "+
+			"the IstioOperator files of the install is used.")
+
+	flag.BoolVar(&settingsFromCommandLine.UseExistingInstall, "istio.test.useExistingInstall",
+		settingsFromCommandLine.UseExistingInstall, "If set, the tests run against the Istio already installed in "+
+			"the clusters, which is not installed or uninstalled by the framework. Cannot be used with "+
+			"--istio.test.chartPath, --istio.test.installMethod or --istio.test.profile.")
+
+	flag.BoolVar(&settingsFromCommandLine.RetainArtifactsOnSuccess, "istio.test.retainArtifactsOnSuccess",
+		settingsFromCommandLine.RetainArtifactsOnSuccess, "If set, state dumps and logs are kept for passing tests, "+
+			"and for the failed attempts of a suite that passes on one of --istio.test.retries.")
+
+	flag.StringVar((*string)(&settingsFromCommandLine.StateDumpMode), "istio.test.stateDump",
+		string(settingsFromCommandLine.StateDumpMode),
+		"When the state of the clusters is dumped. One of 'always', 'onfailure' or 'never'. If unset, failures are "+
+			"dumped with --istio.test.ci, and nothing is dumped otherwise.")
+
+	flag.StringVar(&settingsFromCommandLine.MeshConfigOverlay, "istio.test.meshConfigOverlay",
+		settingsFromCommandLine.MeshConfigOverlay, "A YAML file of mesh config, such as outboundTrafficPolicy, "+
+			"to merge over the mesh config of the installed control plane.")
+
+	flag.StringVar(&settingsFromCommandLine.SidecarResourcesString, "istio.test.sidecarResources",
+		settingsFromCommandLine.SidecarResourcesString, "Resource requests and limits of the sidecars of echo workloads, "+
+			"as a comma separated list of requests.cpu, requests.memory, limits.cpu and limits.memory assignments, "+
+			"e.g. requests.cpu=100m,requests.memory=128Mi.")
+
+	flag.BoolVar(&settingsFromCommandLine.ResourceReport, "istio.test.resourceReport", settingsFromCommandLine.ResourceReport,
+		"If set, write the pods created and the peak CPU and memory increase of each test to resource-report.tsv in the "+
+			"work dir. CPU and memory are only reported for clusters running metrics-server.")
+
+	flag.BoolVar(&settingsFromCommandLine.PerTestLogs, "istio.test.perTestLogs", settingsFromCommandLine.PerTestLogs,
+		"In addition to the main output, write each test's logs, and the istio log scopes output while it runs, "+
+			"to <testname>.log in the work dir.")
+}
+
+// float32Value is a flag.Value for a float32.
+type float32Value float32
+
+func (f *float32Value) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 32)
+}
+
+func (f *float32Value) Set(value string) error {
+	v, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return err
+	}
+	*f = float32Value(v)
+	return nil
 }
 
 type arrayFlags []string
@@ -14,9 +14,21 @@
 package resource
 
 import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/test/framework/config"
+	"istio.io/istio/pkg/test/framework/label"
+	"istio.io/pkg/log"
 )
 
 func TestValidate(t *testing.T) {
@@ -34,6 +46,20 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "fail on config warning and nocleanup",
+			settings: &Settings{
+				FailOnConfigWarning: true,
+				NoCleanup:           true,
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on config warning",
+			settings: &Settings{
+				FailOnConfigWarning: true,
+			},
+		},
 		{
 			name: "fail on both revision and revisions flag",
 			settings: &Settings{
@@ -52,6 +78,298 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "fail on malformed log level",
+			settings: &Settings{
+				LogLevelString: "tf:debug,default",
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on relative prometheus url",
+			settings: &Settings{
+				PrometheusURL: "thanos:9090",
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on relative otel endpoint",
+			settings: &Settings{
+				OTELEndpoint: "otel-collector:4318",
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on non-http otel endpoint",
+			settings: &Settings{
+				OTELEndpoint: "grpc://otel-collector:4317",
+			},
+			expectErr: true,
+		},
+		{
+			name: "otel endpoint",
+			settings: &Settings{
+				OTELEndpoint: "http://otel-collector.observability:4318/v1/traces",
+			},
+		},
+		{
+			name: "fail on prometheus credentials without url",
+			settings: &Settings{
+				PrometheusBearerToken: "token",
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on prometheus basic auth and bearer token",
+			settings: &Settings{
+				PrometheusURL:         "https://thanos.example.com",
+				PrometheusUsername:    "user",
+				PrometheusBearerToken: "token",
+			},
+			expectErr: true,
+		},
+		{
+			name: "prometheus url with basic auth",
+			settings: &Settings{
+				PrometheusURL:      "https://thanos.example.com:9090/prefix",
+				PrometheusUsername: "user",
+				PrometheusPassword: "pass",
+			},
+		},
+		{
+			name: "fail on negative echo ready timeout",
+			settings: &Settings{
+				EchoReadyTimeout: -time.Minute,
+			},
+			expectErr: true,
+		},
+		{
+			name: "echo ready timeout",
+			settings: &Settings{
+				EchoReadyTimeout: 15 * time.Minute,
+			},
+		},
+		{
+			name: "fail on negative max duration",
+			settings: &Settings{
+				MaxDuration: -time.Hour,
+			},
+			expectErr: true,
+		},
+		{
+			name: "max duration",
+			settings: &Settings{
+				MaxDuration: 2 * time.Hour,
+			},
+		},
+		{
+			name: "fail on unknown gateway class",
+			settings: &Settings{
+				GatewayClass: "nginx",
+			},
+			expectErr: true,
+		},
+		{
+			name: "gateway api gateway class",
+			settings: &Settings{
+				GatewayClass: GatewayClassGatewayAPI,
+			},
+		},
+		{
+			name: "fail on unknown install method",
+			settings: &Settings{
+				InstallMethod: "kustomize",
+			},
+			expectErr: true,
+		},
+		{
+			name: "helm install method",
+			settings: &Settings{
+				InstallMethod: InstallMethodHelm,
+			},
+		},
+		{
+			name: "chart path with helm",
+			settings: &Settings{
+				InstallMethod: InstallMethodHelm,
+				ChartPath:     "charts/istiod",
+			},
+		},
+		{
+			name: "chart path with istioctl",
+			settings: &Settings{
+				InstallMethod: InstallMethodIstioctl,
+				ChartPath:     "charts/istiod",
+			},
+		},
+		{
+			name: "fail on chart path with operator",
+			settings: &Settings{
+				InstallMethod: InstallMethodOperator,
+				ChartPath:     "charts/istiod",
+			},
+			expectErr: true,
+		},
+		{
+			name: "existing install",
+			settings: &Settings{
+				UseExistingInstall: true,
+				InstallMethod:      InstallMethodIstioctl,
+			},
+		},
+		{
+			name: "fail on chart path with existing install",
+			settings: &Settings{
+				UseExistingInstall: true,
+				ChartPath:          "charts/istiod",
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on install method with existing install",
+			settings: &Settings{
+				UseExistingInstall: true,
+				InstallMethod:      InstallMethodHelm,
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on unknown profile",
+			settings: &Settings{
+				InstallProfile: "ambient",
+			},
+			expectErr: true,
+		},
+		{
+			name: "minimal profile",
+			settings: &Settings{
+				InstallProfile: InstallProfileMinimal,
+			},
+		},
+		{
+			name: "fail on profile with existing install",
+			settings: &Settings{
+				UseExistingInstall: true,
+				InstallProfile:     InstallProfileDemo,
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on unknown injection mode",
+			settings: &Settings{
+				InjectionMode: "auto",
+			},
+			expectErr: true,
+		},
+		{
+			name: "injection disabled",
+			settings: &Settings{
+				InjectionMode: InjectionModeDisabled,
+			},
+		},
+		{
+			name: "injection enabled with revision",
+			settings: &Settings{
+				InjectionMode: InjectionModeEnabled,
+				Revision:      "canary",
+			},
+		},
+		{
+			name: "fail on injection disabled with revision",
+			settings: &Settings{
+				InjectionMode: InjectionModeDisabled,
+				Revision:      "canary",
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on injection disabled with revisions",
+			settings: &Settings{
+				InjectionMode: InjectionModeDisabled,
+				Revisions:     RevVerMap{"canary": ""},
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on unknown peer auth mode",
+			settings: &Settings{
+				PeerAuthMode: "STRICT",
+			},
+			expectErr: true,
+		},
+		{
+			name: "peer auth strict",
+			settings: &Settings{
+				PeerAuthMode: PeerAuthModeStrict,
+			},
+		},
+		{
+			name: "fail on unparseable min kube version",
+			settings: &Settings{
+				MinKubeVersion: "latest",
+			},
+			expectErr: true,
+		},
+		{
+			name: "min kube version",
+			settings: &Settings{
+				MinKubeVersion: "1.22",
+			},
+		},
+		{
+			name: "fail on unknown state dump mode",
+			settings: &Settings{
+				StateDumpMode: "on-failure",
+			},
+			expectErr: true,
+		},
+		{
+			name: "state dump on failure",
+			settings: &Settings{
+				StateDumpMode: StateDumpOnFailure,
+			},
+		},
+		{
+			name: "fail on never dumping state with retained artifacts",
+			settings: &Settings{
+				StateDumpMode:            StateDumpNever,
+				RetainArtifactsOnSuccess: true,
+			},
+			expectErr: true,
+		},
+		{
+			name: "fail on unknown cni mode",
+			settings: &Settings{
+				CNIMode: "on",
+			},
+			expectErr: true,
+		},
+		{
+			name: "cni enabled",
+			settings: &Settings{
+				CNIMode: CNIModeEnabled,
+			},
+		},
+		{
+			name: "cni disabled",
+			settings: &Settings{
+				CNIMode: CNIModeDisabled,
+			},
+		},
+		{
+			name: "fail on snapshot namespaces without stable namespaces",
+			settings: &Settings{
+				SnapshotNamespaces: true,
+			},
+			expectErr: true,
+		},
+		{
+			name: "snapshot stable namespaces",
+			settings: &Settings{
+				StableNamespaces:   true,
+				SnapshotNamespaces: true,
+			},
+		},
 		{
 			name: "revision flag converted to revvermap",
 			settings: &Settings{
@@ -73,6 +391,9 @@ func TestValidate(t *testing.T) {
 				}
 				return
 			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if tc.expectedRevs != nil {
 				if diff := cmp.Diff(tc.expectedRevs, tc.settings.Revisions); diff != "" {
 					t.Errorf("unexpected revisions, got: %v, want: %v, diff: %v",
@@ -82,3 +403,1167 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLogLevels(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		expected  map[string]log.Level
+		expectErr bool
+	}{
+		{
+			name:     "empty",
+			in:       "",
+			expected: map[string]log.Level{},
+		},
+		{
+			name: "single scope",
+			in:   "tf:debug",
+			expected: map[string]log.Level{
+				"tf": log.DebugLevel,
+			},
+		},
+		{
+			name: "multiple scopes",
+			in:   "pilot:debug,tf:info,default:NONE",
+			expected: map[string]log.Level{
+				"pilot":   log.DebugLevel,
+				"tf":      log.InfoLevel,
+				"default": log.NoneLevel,
+			},
+		},
+		{
+			name:      "missing level",
+			in:        "pilot:debug,tf",
+			expectErr: true,
+		},
+		{
+			name:      "missing scope",
+			in:        ":debug",
+			expectErr: true,
+		},
+		{
+			name:      "unknown level",
+			in:        "pilot:verbose",
+			expectErr: true,
+		},
+		{
+			name:      "too many separators",
+			in:        "pilot:debug:info",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseLogLevels(tc.in)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("unexpected log levels (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseOnlyLabels(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		labels    label.Set
+		selects   bool
+		expectErr bool
+	}{
+		{
+			name:    "unset",
+			selects: true,
+		},
+		{
+			name:    "all present",
+			in:      "postsubmit,ipv4",
+			labels:  label.NewSet(label.Postsubmit, label.IPv4, label.CustomSetup),
+			selects: true,
+		},
+		{
+			name:   "one missing",
+			in:     "postsubmit,ipv4",
+			labels: label.NewSet(label.Postsubmit),
+		},
+		{
+			name:    "explicit plus",
+			in:      "+postsubmit",
+			labels:  label.NewSet(label.Postsubmit),
+			selects: true,
+		},
+		{
+			name:      "exclusion",
+			in:        "postsubmit,-ipv4",
+			expectErr: true,
+		},
+		{
+			name:      "invalid label",
+			in:        "$postsubmit",
+			expectErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			sel, err := parseOnlyLabels(tc.in)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sel.Selects(tc.labels); got != tc.selects {
+				t.Errorf("expected Selects(%v) to be %v, got %v", tc.labels, tc.selects, got)
+			}
+		})
+	}
+}
+
+func TestParseNamespaceSelector(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		matches   map[string]string
+		rejects   map[string]string
+		expectErr bool
+	}{
+		{
+			name:    "empty matches everything",
+			in:      "",
+			matches: map[string]string{"foo": "bar"},
+		},
+		{
+			name:    "equality",
+			in:      "istio-testing=istio-test",
+			matches: map[string]string{"istio-testing": "istio-test"},
+			rejects: map[string]string{"istio-testing": "other"},
+		},
+		{
+			name:    "set based",
+			in:      "team in (a,b),!skip",
+			matches: map[string]string{"team": "a"},
+			rejects: map[string]string{"team": "b", "skip": "true"},
+		},
+		{
+			name:      "malformed",
+			in:        "team in (a,b",
+			expectErr: true,
+		},
+		{
+			name:      "set without parentheses",
+			in:        "team in a",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			sel, err := parseNamespaceSelector(tc.in)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if !strings.Contains(err.Error(), "istio.test.namespaceSelector") {
+					t.Errorf("expected error to reference the flag, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s := Settings{NamespaceLabelSelector: sel}
+			if tc.matches != nil && !s.NamespaceSelected(tc.matches) {
+				t.Errorf("expected %v to be selected by %q", tc.matches, tc.in)
+			}
+			if tc.rejects != nil && s.NamespaceSelected(tc.rejects) {
+				t.Errorf("expected %v not to be selected by %q", tc.rejects, tc.in)
+			}
+		})
+	}
+}
+
+func TestPrePullImagesFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.prePullImages")
+	if f == nil {
+		t.Fatal("flag istio.test.prePullImages is not registered")
+	}
+	if f.DefValue != "false" {
+		t.Errorf("expected pre-pulling to be disabled by default, got %s", f.DefValue)
+	}
+}
+
+func TestResourceReportFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.resourceReport")
+	if f == nil {
+		t.Fatal("flag istio.test.resourceReport is not registered")
+	}
+	if f.DefValue != "false" {
+		t.Errorf("expected resource reports to be disabled by default, got %s", f.DefValue)
+	}
+}
+
+func TestConfigDumpOnFailureFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.configDumpOnFailure")
+	if f == nil {
+		t.Fatal("flag istio.test.configDumpOnFailure is not registered")
+	}
+	if f.DefValue != "false" {
+		t.Errorf("expected config dumps to be disabled by default, got %s", f.DefValue)
+	}
+}
+
+func TestIstiodDebugFlags(t *testing.T) {
+	f := flag.Lookup("istio.test.istiodDebugOnFailure")
+	if f == nil {
+		t.Fatal("flag istio.test.istiodDebugOnFailure is not registered")
+	}
+	if f.DefValue != "false" {
+		t.Errorf("expected istiod debug captures to be disabled by default, got %s", f.DefValue)
+	}
+	f = flag.Lookup("istio.test.istiodDebugEndpoints")
+	if f == nil {
+		t.Fatal("flag istio.test.istiodDebugEndpoints is not registered")
+	}
+	if f.DefValue != "syncz,endpointz" {
+		t.Errorf("expected syncz and endpointz to be captured by default, got %q", f.DefValue)
+	}
+}
+
+func TestInjectionModeFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.injectionMode")
+	if f == nil {
+		t.Fatal("injectionMode flag is not registered")
+	}
+	if f.DefValue != string(InjectionModePerTest) {
+		t.Errorf("expected default of %q, got %q", InjectionModePerTest, f.DefValue)
+	}
+	orig := settingsFromCommandLine.InjectionMode
+	t.Cleanup(func() {
+		settingsFromCommandLine.InjectionMode = orig
+	})
+	if err := f.Value.Set("disabled"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.InjectionMode != InjectionModeDisabled {
+		t.Errorf("expected %q, got %q", InjectionModeDisabled, settingsFromCommandLine.InjectionMode)
+	}
+}
+
+func TestPeerAuthModeFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.peerAuth")
+	if f == nil {
+		t.Fatal("peerAuth flag is not registered")
+	}
+	if f.DefValue != "" {
+		t.Errorf("expected no PeerAuthentication by default, got %q", f.DefValue)
+	}
+	orig := settingsFromCommandLine.PeerAuthMode
+	t.Cleanup(func() {
+		settingsFromCommandLine.PeerAuthMode = orig
+	})
+	if err := f.Value.Set("strict"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.PeerAuthMode != PeerAuthModeStrict {
+		t.Errorf("expected %q, got %q", PeerAuthModeStrict, settingsFromCommandLine.PeerAuthMode)
+	}
+}
+
+func TestInstallProfileFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.profile")
+	if f == nil {
+		t.Fatal("profile flag is not registered")
+	}
+	if f.DefValue != "" {
+		t.Errorf("expected the profile of the IstioOperator files by default, got %q", f.DefValue)
+	}
+	orig := settingsFromCommandLine.InstallProfile
+	t.Cleanup(func() {
+		settingsFromCommandLine.InstallProfile = orig
+	})
+	if err := f.Value.Set("minimal"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.InstallProfile != InstallProfileMinimal {
+		t.Errorf("expected %q, got %q", InstallProfileMinimal, settingsFromCommandLine.InstallProfile)
+	}
+}
+
+func TestStateDumpFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.stateDump")
+	if f == nil {
+		t.Fatal("stateDump flag is not registered")
+	}
+	if f.DefValue != "" {
+		t.Errorf("expected the state dump to follow CI mode by default, got %q", f.DefValue)
+	}
+	orig := settingsFromCommandLine.StateDumpMode
+	t.Cleanup(func() {
+		settingsFromCommandLine.StateDumpMode = orig
+	})
+	if err := f.Value.Set("never"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.StateDumpMode != StateDumpNever {
+		t.Errorf("expected %q, got %q", StateDumpNever, settingsFromCommandLine.StateDumpMode)
+	}
+}
+
+func TestMinKubeVersionFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.minKubeVersion")
+	if f == nil {
+		t.Fatal("minKubeVersion flag is not registered")
+	}
+	if f.DefValue != "" {
+		t.Errorf("expected no minimum Kubernetes version by default, got %q", f.DefValue)
+	}
+}
+
+func TestFailOnConfigWarningFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.failOnConfigWarning")
+	if f == nil {
+		t.Fatal("failOnConfigWarning flag is not registered")
+	}
+	if f.DefValue != "false" {
+		t.Errorf("expected config warnings not to fail tests by default, got %q", f.DefValue)
+	}
+}
+
+func TestStateDump(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings Settings
+		want     StateDumpMode
+	}{
+		{name: "default", want: StateDumpNever},
+		{name: "ci", settings: Settings{CIMode: true}, want: StateDumpOnFailure},
+		{name: "always", settings: Settings{StateDumpMode: StateDumpAlways}, want: StateDumpAlways},
+		{name: "ci never", settings: Settings{CIMode: true, StateDumpMode: StateDumpNever}, want: StateDumpNever},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.settings.StateDump(); got != c.want {
+				t.Errorf("expected %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestUseExistingInstallFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.useExistingInstall")
+	if f == nil {
+		t.Fatal("flag istio.test.useExistingInstall is not registered")
+	}
+	if f.DefValue != "false" {
+		t.Errorf("expected Istio to be installed by default, got %s", f.DefValue)
+	}
+}
+
+func TestExtraValidators(t *testing.T) {
+	config.Parse()
+	orig := settingsFromCommandLine.ExtraValidators
+	t.Cleanup(func() {
+		settingsFromCommandLine.ExtraValidators = orig
+	})
+
+	wantErr := errors.New("prometheus URL is required")
+	var called []string
+	AddExtraValidator(func(s *Settings) error {
+		called = append(called, s.TestID)
+		return nil
+	})
+	AddExtraValidator(func(s *Settings) error {
+		return wantErr
+	})
+
+	if _, err := SettingsFromCommandLine("extra-validators"); err != wantErr {
+		t.Fatalf("expected error %v, got %v", wantErr, err)
+	}
+	if len(called) != 1 || called[0] != "extra-validators" {
+		t.Errorf("expected validators to be called with the parsed settings, got %v", called)
+	}
+}
+
+func TestPprofFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.pprof")
+	if f == nil {
+		t.Fatal("flag istio.test.pprof is not registered")
+	}
+	if f.DefValue != "0s" {
+		t.Errorf("expected profiling to be disabled by default, got %s", f.DefValue)
+	}
+	orig := settingsFromCommandLine.PprofDump
+	t.Cleanup(func() {
+		settingsFromCommandLine.PprofDump = orig
+	})
+	if err := f.Value.Set("30s"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.PprofDump != 30*time.Second {
+		t.Errorf("expected 30s, got %v", settingsFromCommandLine.PprofDump)
+	}
+}
+
+func TestKubeRateLimitFlags(t *testing.T) {
+	qps := flag.Lookup("istio.test.kubeQPS")
+	burst := flag.Lookup("istio.test.kubeBurst")
+	if qps == nil || burst == nil {
+		t.Fatal("kube rate limit flags are not registered")
+	}
+	if qps.DefValue != "200" || burst.DefValue != "400" {
+		t.Errorf("expected defaults of 200/400, got %s/%s", qps.DefValue, burst.DefValue)
+	}
+	origQPS, origBurst := settingsFromCommandLine.KubeQPS, settingsFromCommandLine.KubeBurst
+	t.Cleanup(func() {
+		settingsFromCommandLine.KubeQPS, settingsFromCommandLine.KubeBurst = origQPS, origBurst
+	})
+	if err := qps.Value.Set("1000.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := burst.Value.Set("50"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.KubeQPS != 1000.5 || settingsFromCommandLine.KubeBurst != 50 {
+		t.Errorf("expected 1000.5/50, got %v/%v", settingsFromCommandLine.KubeQPS, settingsFromCommandLine.KubeBurst)
+	}
+	if err := qps.Value.Set("fast"); err == nil {
+		t.Error("expected a non-numeric QPS to be rejected")
+	}
+}
+
+func TestEchoReadyTimeoutFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.echoReadyTimeout")
+	if f == nil {
+		t.Fatal("echo ready timeout flag is not registered")
+	}
+	orig := settingsFromCommandLine.EchoReadyTimeout
+	t.Cleanup(func() {
+		settingsFromCommandLine.EchoReadyTimeout = orig
+	})
+	if err := f.Value.Set("15m"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.EchoReadyTimeout != 15*time.Minute {
+		t.Errorf("expected 15m, got %v", settingsFromCommandLine.EchoReadyTimeout)
+	}
+	if err := f.Value.Set("soon"); err == nil {
+		t.Error("expected a malformed duration to be rejected")
+	}
+}
+
+func TestEchoReplicasFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.echoReplicas")
+	if f == nil {
+		t.Fatal("echo replicas flag is not registered")
+	}
+	if f.DefValue != "1" {
+		t.Errorf("expected default of 1, got %s", f.DefValue)
+	}
+	orig := settingsFromCommandLine.EchoReplicas
+	t.Cleanup(func() {
+		settingsFromCommandLine.EchoReplicas = orig
+	})
+	if err := f.Value.Set("5"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.EchoReplicas != 5 {
+		t.Errorf("expected 5, got %v", settingsFromCommandLine.EchoReplicas)
+	}
+	if err := f.Value.Set("many"); err == nil {
+		t.Error("expected a non-numeric replica count to be rejected")
+	}
+}
+
+func TestGatewayClassFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.gatewayClass")
+	if f == nil {
+		t.Fatal("gateway class flag is not registered")
+	}
+	if f.DefValue != string(GatewayClassIstio) {
+		t.Errorf("expected default of %q, got %q", GatewayClassIstio, f.DefValue)
+	}
+	orig := settingsFromCommandLine.GatewayClass
+	t.Cleanup(func() {
+		settingsFromCommandLine.GatewayClass = orig
+	})
+	if err := f.Value.Set("gateway-api"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.GatewayClass != GatewayClassGatewayAPI {
+		t.Errorf("expected %q, got %q", GatewayClassGatewayAPI, settingsFromCommandLine.GatewayClass)
+	}
+}
+
+func TestInstallMethodFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.installMethod")
+	if f == nil {
+		t.Fatal("install method flag is not registered")
+	}
+	if f.DefValue != string(InstallMethodIstioctl) {
+		t.Errorf("expected default of %q, got %q", InstallMethodIstioctl, f.DefValue)
+	}
+	orig := settingsFromCommandLine.InstallMethod
+	t.Cleanup(func() {
+		settingsFromCommandLine.InstallMethod = orig
+	})
+	if err := f.Value.Set("helm"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.InstallMethod != InstallMethodHelm {
+		t.Errorf("expected %q, got %q", InstallMethodHelm, settingsFromCommandLine.InstallMethod)
+	}
+}
+
+func TestCNIModeFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.cni")
+	if f == nil {
+		t.Fatal("cni flag is not registered")
+	}
+	if f.DefValue != string(CNIModeAuto) {
+		t.Errorf("expected default of %q, got %q", CNIModeAuto, f.DefValue)
+	}
+	orig := settingsFromCommandLine.CNIMode
+	t.Cleanup(func() {
+		settingsFromCommandLine.CNIMode = orig
+	})
+	if err := f.Value.Set("enabled"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.CNIMode != CNIModeEnabled {
+		t.Errorf("expected %q, got %q", CNIModeEnabled, settingsFromCommandLine.CNIMode)
+	}
+}
+
+func TestChartPathFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.chartPath")
+	if f == nil {
+		t.Fatal("chart path flag is not registered")
+	}
+	orig := settingsFromCommandLine.ChartPath
+	t.Cleanup(func() {
+		settingsFromCommandLine.ChartPath = orig
+	})
+	if err := f.Value.Set("/tmp/istio-discovery"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.ChartPath != "/tmp/istio-discovery" {
+		t.Errorf("expected /tmp/istio-discovery, got %v", settingsFromCommandLine.ChartPath)
+	}
+}
+
+func TestValidateChartPath(t *testing.T) {
+	chart := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: istiod\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notChart := t.TempDir()
+	file := filepath.Join(notChart, "values.yaml")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name      string
+		in        string
+		expectErr string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "chart",
+			in:   chart,
+		},
+		{
+			name:      "missing",
+			in:        filepath.Join(chart, "missing"),
+			expectErr: "no such file or directory",
+		},
+		{
+			name:      "file",
+			in:        file,
+			expectErr: "is not a directory",
+		},
+		{
+			name:      "no Chart.yaml",
+			in:        notChart,
+			expectErr: "does not contain a Chart.yaml",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateChartPath(tc.in)
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestVMModeFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.vmMode")
+	if f == nil {
+		t.Fatal("vm mode flag is not registered")
+	}
+	orig := settingsFromCommandLine.VMMode
+	t.Cleanup(func() {
+		settingsFromCommandLine.VMMode = orig
+	})
+	if err := f.Value.Set("skip"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.VMMode != VMModeSkip {
+		t.Errorf("expected %q, got %q", VMModeSkip, settingsFromCommandLine.VMMode)
+	}
+}
+
+func TestResolveVMMode(t *testing.T) {
+	tcs := []struct {
+		name      string
+		mode      VMMode
+		skipVM    bool
+		expected  VMMode
+		expectErr string
+	}{
+		{
+			name:     "default",
+			expected: VMModeSimulated,
+		},
+		{
+			name:      "real",
+			mode:      "real",
+			expectErr: "unknown --istio.test.vmMode",
+		},
+		{
+			name:     "simulated",
+			mode:     VMModeSimulated,
+			expected: VMModeSimulated,
+		},
+		{
+			name:     "skip",
+			mode:     VMModeSkip,
+			expected: VMModeSkip,
+		},
+		{
+			name:     "skipVM",
+			skipVM:   true,
+			expected: VMModeSkip,
+		},
+		{
+			name:     "skipVM and skip",
+			mode:     VMModeSkip,
+			skipVM:   true,
+			expected: VMModeSkip,
+		},
+		{
+			name:      "unknown",
+			mode:      "container",
+			expectErr: "unknown --istio.test.vmMode",
+		},
+		{
+			name:      "skipVM conflict",
+			mode:      VMModeSimulated,
+			skipVM:    true,
+			expectErr: "conflicts with --istio.test.vmMode=simulated",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveVMMode(tc.mode, tc.skipVM)
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateKubeRateLimits(t *testing.T) {
+	tcs := []struct {
+		name      string
+		qps       float32
+		burst     int
+		expectErr bool
+	}{
+		{
+			name:  "defaults",
+			qps:   200,
+			burst: 400,
+		},
+		{
+			name:  "burst lower than qps",
+			qps:   100,
+			burst: 10,
+		},
+		{
+			name:      "zero qps",
+			burst:     10,
+			expectErr: true,
+		},
+		{
+			name:      "negative burst",
+			qps:       10,
+			burst:     -1,
+			expectErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateKubeRateLimits(tc.qps, tc.burst)
+			if tc.expectErr && err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateEchoReplicas(t *testing.T) {
+	tcs := []struct {
+		name      string
+		replicas  int
+		expectErr bool
+	}{
+		{
+			name:     "default",
+			replicas: 1,
+		},
+		{
+			name:     "scaled",
+			replicas: 20,
+		},
+		{
+			name:      "zero",
+			expectErr: true,
+		},
+		{
+			name:      "negative",
+			replicas:  -2,
+			expectErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateEchoReplicas(tc.replicas)
+			if tc.expectErr && err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSystemNamespace(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		expectErr bool
+	}{
+		{
+			name: "unset",
+			in:   "",
+		},
+		{
+			name: "default",
+			in:   "istio-system",
+		},
+		{
+			name: "relocated",
+			in:   "mesh-control-plane-1",
+		},
+		{
+			name:      "uppercase",
+			in:        "Istio-System",
+			expectErr: true,
+		},
+		{
+			name:      "dots",
+			in:        "istio.system",
+			expectErr: true,
+		},
+		{
+			name:      "too long",
+			in:        strings.Repeat("a", 64),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSystemNamespace(tc.in)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if !strings.Contains(err.Error(), "istio.test.systemNamespace") {
+					t.Errorf("expected error to reference the flag, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMeshConfigOverlayFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.meshConfigOverlay")
+	if f == nil {
+		t.Fatal("mesh config overlay flag is not registered")
+	}
+	orig := settingsFromCommandLine.MeshConfigOverlay
+	t.Cleanup(func() {
+		settingsFromCommandLine.MeshConfigOverlay = orig
+	})
+	if err := f.Value.Set("/tmp/registry-only.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.MeshConfigOverlay != "/tmp/registry-only.yaml" {
+		t.Errorf("expected /tmp/registry-only.yaml, got %v", settingsFromCommandLine.MeshConfigOverlay)
+	}
+}
+
+func TestPrometheusCredentialFlags(t *testing.T) {
+	for _, name := range []string{"istio.test.prometheusPassword", "istio.test.prometheusBearerToken"} {
+		if flag.Lookup(name) != nil {
+			t.Errorf("credentials must not be passed on the command line, but %s is registered", name)
+		}
+	}
+	for _, name := range []string{"istio.test.prometheusPasswordFile", "istio.test.prometheusBearerTokenFile"} {
+		if flag.Lookup(name) == nil {
+			t.Errorf("%s is not registered", name)
+		}
+	}
+}
+
+func TestReadPrometheusCredentials(t *testing.T) {
+	dir := t.TempDir()
+	password := filepath.Join(dir, "password")
+	if err := os.WriteFile(password, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := &Settings{PrometheusUsername: "user", prometheusPasswordFile: password}
+	if err := readPrometheusCredentials(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.PrometheusPassword != "s3cret" {
+		t.Errorf("expected password %q, got %q", "s3cret", s.PrometheusPassword)
+	}
+	if out := s.String(); strings.Contains(out, "s3cret") {
+		t.Errorf("settings must not contain the password:\n%s", out)
+	}
+
+	s = &Settings{prometheusBearerTokenFile: filepath.Join(dir, "missing")}
+	if err := readPrometheusCredentials(s); err == nil || !strings.Contains(err.Error(), "prometheusBearerTokenFile") {
+		t.Errorf("expected an error for the missing token file, got %v", err)
+	}
+}
+
+func TestValidateMeshConfigOverlay(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tcs := []struct {
+		name      string
+		in        string
+		expectErr string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "registry only",
+			in:   write("registry-only.yaml", "outboundTrafficPolicy:\n  mode: REGISTRY_ONLY\n"),
+		},
+		{
+			name:      "missing",
+			in:        filepath.Join(dir, "missing.yaml"),
+			expectErr: "no such file or directory",
+		},
+		{
+			name:      "not yaml",
+			in:        write("not-yaml.yaml", "outboundTrafficPolicy: [\n"),
+			expectErr: "is not valid mesh config",
+		},
+		{
+			name:      "unknown field",
+			in:        write("unknown.yaml", "outboundTrafficPolicyMode: REGISTRY_ONLY\n"),
+			expectErr: "is not valid mesh config",
+		},
+		{
+			name:      "unknown mode",
+			in:        write("bad-mode.yaml", "outboundTrafficPolicy:\n  mode: BLOCK_ALL\n"),
+			expectErr: "is not valid mesh config",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMeshConfigOverlay(tc.in)
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSidecarResourcesFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.sidecarResources")
+	if f == nil {
+		t.Fatal("sidecar resources flag is not registered")
+	}
+	orig := settingsFromCommandLine.SidecarResourcesString
+	t.Cleanup(func() {
+		settingsFromCommandLine.SidecarResourcesString = orig
+	})
+	if err := f.Value.Set("requests.cpu=100m"); err != nil {
+		t.Fatal(err)
+	}
+	if settingsFromCommandLine.SidecarResourcesString != "requests.cpu=100m" {
+		t.Errorf("expected requests.cpu=100m, got %v", settingsFromCommandLine.SidecarResourcesString)
+	}
+}
+
+func TestParseSidecarResources(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		expect    SidecarResources
+		expectErr string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "requests and limits",
+			in:   "requests.cpu=100m, requests.memory=128Mi,limits.cpu=2,limits.memory=1Gi",
+			expect: SidecarResources{
+				CPURequest:    "100m",
+				MemoryRequest: "128Mi",
+				CPULimit:      "2",
+				MemoryLimit:   "1Gi",
+			},
+		},
+		{
+			name:   "requests only",
+			in:     "requests.cpu=500m",
+			expect: SidecarResources{CPURequest: "500m"},
+		},
+		{
+			name:      "bad quantity",
+			in:        "requests.cpu=100m,limits.memory=lots",
+			expectErr: `limits.memory="lots"`,
+		},
+		{
+			name:      "unknown resource",
+			in:        "requests.storage=1Gi",
+			expectErr: `unknown resource "requests.storage"`,
+		},
+		{
+			name:      "missing quantity",
+			in:        "requests.cpu",
+			expectErr: "expected key=quantity",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseSidecarResources(tc.in)
+			if tc.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+			}
+			if got != tc.expect {
+				t.Errorf("expected %+v, got %+v", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestParseIstiodDebugEndpoints(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		expect    []string
+		expectErr bool
+	}{
+		{name: "unset"},
+		{name: "names", in: "syncz, endpointz", expect: []string{"syncz", "endpointz"}},
+		{name: "paths", in: "/debug/syncz,debug/configz", expect: []string{"syncz", "configz"}},
+		{name: "query", in: "syncz?proxyID=a", expectErr: true},
+		{name: "not a debug path", in: "/ready/now", expectErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseIstiodDebugEndpoints(tc.in)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", tc.expectErr, err)
+			}
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Errorf("unexpected endpoints (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseEchoProtocols(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        string
+		expect    []protocol.Instance
+		expectErr bool
+	}{
+		{name: "unset"},
+		{name: "protocols", in: "http, GRPC,tcp", expect: []protocol.Instance{protocol.HTTP, protocol.GRPC, protocol.TCP}},
+		{name: "trailing comma", in: "https,", expect: []protocol.Instance{protocol.HTTPS}},
+		{name: "unknown", in: "http,quic", expectErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseEchoProtocols(tc.in)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", tc.expectErr, err)
+			}
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Errorf("unexpected protocols (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOTELEndpointFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.otelEndpoint")
+	if f == nil {
+		t.Fatal("otelEndpoint flag is not registered")
+	}
+	if f.DefValue != "" {
+		t.Errorf("expected tracing to be off by default, got %q", f.DefValue)
+	}
+}
+
+func TestEchoProtocolsFlag(t *testing.T) {
+	f := flag.Lookup("istio.test.echoProtocols")
+	if f == nil {
+		t.Fatal("echoProtocols flag is not registered")
+	}
+	if f.DefValue != "" {
+		t.Errorf("expected every echo protocol to be deployed by default, got %q", f.DefValue)
+	}
+}
+
+func TestEnableFeatures(t *testing.T) {
+	tcs := []struct {
+		name      string
+		in        []string
+		expect    []string
+		expectErr string
+	}{
+		{
+			name:   "unset",
+			expect: []string{},
+		},
+		{
+			name:   "comma separated",
+			in:     []string{"gateway-api, wasm-plugin"},
+			expect: []string{"gateway-api", "wasm-plugin"},
+		},
+		{
+			name:   "repeated",
+			in:     []string{"dns-capture", "proxyless-grpc,dns-capture"},
+			expect: []string{"dns-capture", "proxyless-grpc"},
+		},
+		{
+			name:      "unknown",
+			in:        []string{"gateway-api,time-travel"},
+			expectErr: `unknown feature "time-travel"`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			enabled := sets.NewSet()
+			var err error
+			for _, f := range tc.in {
+				if err = enableFeatures(enabled, f); err != nil {
+					break
+				}
+			}
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expect, enabled.SortedList()); diff != "" {
+				t.Errorf("unexpected features (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddProtocolFilter(t *testing.T) {
+	filter := sets.NewSet()
+	for _, p := range []string{"HTTPS, tcp", "", "http,https"} {
+		addProtocolFilter(filter, p)
+	}
+	if diff := cmp.Diff([]string{"http", "https", "tcp"}, filter.SortedList()); diff != "" {
+		t.Errorf("unexpected protocols (-want +got):\n%s", diff)
+	}
+}
+
+func TestMissingFeatures(t *testing.T) {
+	s := DefaultSettings()
+	s.EnabledFeatures.Insert(string(AlphaFeatureGatewayAPI))
+	if got := s.MissingFeatures(); len(got) != 0 {
+		t.Errorf("expected a test requiring nothing to run, got missing %v", got)
+	}
+	if got := s.MissingFeatures(AlphaFeatureGatewayAPI); len(got) != 0 {
+		t.Errorf("expected a test requiring an enabled feature to run, got missing %v", got)
+	}
+	got := s.MissingFeatures(AlphaFeatureWasmPlugin, AlphaFeatureGatewayAPI, AlphaFeatureDNSCapture)
+	if diff := cmp.Diff([]AlphaFeature{AlphaFeatureWasmPlugin, AlphaFeatureDNSCapture}, got); diff != "" {
+		t.Errorf("unexpected missing features (-want +got):\n%s", diff)
+	}
+	// Settings built without the command line have nothing enabled.
+	if got := (Settings{}).MissingFeatures(AlphaFeatureGatewayAPI); len(got) != 1 {
+		t.Errorf("expected the feature to be missing, got %v", got)
+	}
+}
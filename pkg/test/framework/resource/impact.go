@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"istio.io/istio/pkg/test/framework/label"
+)
+
+// alwaysImpactingPaths are repo-relative paths whose changes impact every suite.
+var alwaysImpactingPaths = []string{
+	"go.mod",
+	"pkg/test/framework/",
+}
+
+// resolveGitRef checks that ref resolves to a commit in the git repository at repo.
+func resolveGitRef(repo, ref string) error {
+	out, err := exec.Command("git", "-C", repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git ref %q does not resolve to a commit in %s: %v %s", ref, repo, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// changedFilesSince returns the repo-relative paths of files changed in the git repository at repo since ref,
+// including uncommitted changes.
+func changedFilesSince(repo, ref string) ([]string, error) {
+	if err := resolveGitRef(repo, ref); err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("git", "-C", repo, "diff", "--name-only", ref).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing files changed since %q: %v", ref, err)
+	}
+	var files []string
+	for _, f := range strings.Split(string(out), "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Impacted returns true if a suite in the package at pkgDir (relative to the repo root) and with the given labels is
+// impacted by the changed files. A suite is impacted by changes within its package, by changes to paths with a
+// directory named after one of its labels, and by changes to the framework itself.
+func Impacted(changed []string, pkgDir string, labels label.Set) bool {
+	pkgDir = filepath.ToSlash(filepath.Clean(pkgDir)) + "/"
+	for _, f := range changed {
+		f = filepath.ToSlash(f)
+		if strings.HasPrefix(f, pkgDir) {
+			return true
+		}
+		for _, p := range alwaysImpactingPaths {
+			if f == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(f, p)) {
+				return true
+			}
+		}
+		dirs := strings.Split(f, "/")
+		for _, d := range dirs[:len(dirs)-1] {
+			if _, ok := labels[label.Instance(strings.ToLower(d))]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
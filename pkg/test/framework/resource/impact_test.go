@@ -0,0 +1,128 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pkg/test/framework/label"
+)
+
+func TestImpacted(t *testing.T) {
+	const pkg = "tests/integration/telemetry/outboundtrafficpolicy"
+	cases := []struct {
+		name    string
+		changed []string
+		labels  label.Set
+		want    bool
+	}{
+		{
+			name: "no changes",
+		},
+		{
+			name:    "change in package",
+			changed: []string{"README.md", pkg + "/helper.go"},
+			want:    true,
+		},
+		{
+			name:    "change in sibling package with shared prefix",
+			changed: []string{pkg + "2/helper.go"},
+		},
+		{
+			name:    "unrelated change",
+			changed: []string{"pilot/pkg/xds/debug.go"},
+			labels:  label.NewSet(label.CustomSetup),
+		},
+		{
+			name:    "change under label directory",
+			changed: []string{"tests/integration/customsetup/values.yaml"},
+			labels:  label.NewSet(label.CustomSetup),
+			want:    true,
+		},
+		{
+			name:    "file named after label",
+			changed: []string{"docs/customsetup"},
+			labels:  label.NewSet(label.CustomSetup),
+		},
+		{
+			name:    "framework change",
+			changed: []string{"pkg/test/framework/suite.go"},
+			want:    true,
+		},
+		{
+			name:    "go.mod change",
+			changed: []string{"go.mod"},
+			want:    true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Impacted(tc.changed, pkg, tc.labels); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestChangedFilesSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	write := func(name string) {
+		t.Helper()
+		p := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("a.go")
+	git("add", "-A")
+	git("commit", "-q", "-m", "base")
+	git("tag", "base")
+	write("pkg/b.go")
+	git("add", "-A")
+	git("commit", "-q", "-m", "change")
+
+	if err := resolveGitRef(repo, "does-not-exist"); err == nil {
+		t.Error("expected an unknown ref to be rejected")
+	}
+	if _, err := changedFilesSince(repo, "does-not-exist"); err == nil {
+		t.Error("expected an unknown ref to be rejected")
+	}
+
+	got, err := changedFilesSince(repo, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"pkg/b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadQuarantineList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.txt")
+	content := `# Flaky on slow clusters
+TestTraffic/ServiceEntry
+
+  TestMultiCluster.*
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadQuarantineList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"TestTraffic/ServiceEntry", "TestMultiCluster.*"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	m, err := NewMatcher(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Settings{QuarantineMatcher: m}
+	for name, quarantined := range map[string]bool{
+		"TestTraffic/ServiceEntry":       true,
+		"TestTraffic/ServiceEntry/child": true,
+		"TestTraffic/Gateway":            false,
+		"TestMultiClusterLocality":       true,
+		"TestSingleCluster":              false,
+	} {
+		if got := s.Quarantined(name); got != quarantined {
+			t.Errorf("%s: expected quarantined=%v, got %v", name, quarantined, got)
+		}
+	}
+	if (Settings{}).Quarantined("TestTraffic/ServiceEntry") {
+		t.Error("expected nothing to be quarantined without a quarantine list")
+	}
+
+	if _, err := loadQuarantineList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected a missing quarantine file to be an error")
+	}
+}
@@ -18,12 +18,16 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/test/framework/components/echo/echotypes"
 	"istio.io/istio/pkg/test/framework/label"
+	"istio.io/pkg/log"
 )
 
 const (
@@ -31,6 +35,187 @@ const (
 	maxTestIDLength = 30
 )
 
+// GatewayClass is the gateway implementation that tests deploy and route through.
+type GatewayClass string
+
+const (
+	// GatewayClassIstio uses the istio-ingressgateway and istio-egressgateway deployments installed with Istio.
+	GatewayClassIstio GatewayClass = "istio"
+	// GatewayClassGatewayAPI uses gateways deployed by istiod from Kubernetes Gateway API resources.
+	GatewayClassGatewayAPI GatewayClass = "gateway-api"
+)
+
+var knownGatewayClasses = map[GatewayClass]bool{
+	GatewayClassIstio:      true,
+	GatewayClassGatewayAPI: true,
+}
+
+// SidecarResources are the resource requests and limits of the sidecar proxy of echo workloads. Empty fields leave
+// the injection defaults in place.
+type SidecarResources struct {
+	CPURequest    string
+	MemoryRequest string
+	CPULimit      string
+	MemoryLimit   string
+}
+
+// IsZero returns true if no requests or limits are set.
+func (r SidecarResources) IsZero() bool {
+	return r == SidecarResources{}
+}
+
+// AlphaFeature is an alpha feature that is not enabled in every environment. Tests that exercise one declare it,
+// and are skipped unless it is enabled with --istio.test.features.
+type AlphaFeature string
+
+const (
+	// AlphaFeatureGatewayAPI is support for the Kubernetes Gateway API.
+	AlphaFeatureGatewayAPI AlphaFeature = "gateway-api"
+	// AlphaFeatureWasmPlugin is the WasmPlugin API.
+	AlphaFeatureWasmPlugin AlphaFeature = "wasm-plugin"
+	// AlphaFeatureDNSCapture is DNS capture by the sidecar.
+	AlphaFeatureDNSCapture AlphaFeature = "dns-capture"
+	// AlphaFeatureProxylessGRPC is proxyless gRPC workloads.
+	AlphaFeatureProxylessGRPC AlphaFeature = "proxyless-grpc"
+)
+
+// knownAlphaFeatures is the registry of alpha features that may be enabled.
+var knownAlphaFeatures = map[AlphaFeature]bool{
+	AlphaFeatureGatewayAPI:    true,
+	AlphaFeatureWasmPlugin:    true,
+	AlphaFeatureDNSCapture:    true,
+	AlphaFeatureProxylessGRPC: true,
+}
+
+// VMMode is how the framework deploys VM workloads.
+type VMMode string
+
+const (
+	// VMModeSimulated runs VM workloads in pods built from VM images, which is the default.
+	VMModeSimulated VMMode = "simulated"
+	// VMModeSkip skips the VM related parts of all tests.
+	VMModeSkip VMMode = "skip"
+)
+
+var knownVMModes = map[VMMode]bool{
+	VMModeSimulated: true,
+	VMModeSkip:      true,
+}
+
+// InstallMethod is how the framework installs Istio.
+type InstallMethod string
+
+const (
+	// InstallMethodIstioctl installs with istioctl install, which is the default.
+	InstallMethodIstioctl InstallMethod = "istioctl"
+	// InstallMethodHelm installs the base, istiod and gateway Helm charts.
+	InstallMethodHelm InstallMethod = "helm"
+	// InstallMethodOperator installs the in-cluster operator, which then installs Istio from an IstioOperator resource.
+	InstallMethodOperator InstallMethod = "operator"
+)
+
+var knownInstallMethods = map[InstallMethod]bool{
+	InstallMethodIstioctl: true,
+	InstallMethodHelm:     true,
+	InstallMethodOperator: true,
+}
+
+// InstallProfile is the IstioOperator profile Istio is installed with.
+type InstallProfile string
+
+// The profiles of manifests/profiles that install a primary cluster.
+const (
+	InstallProfileDefault   InstallProfile = "default"
+	InstallProfileDemo      InstallProfile = "demo"
+	InstallProfileMinimal   InstallProfile = "minimal"
+	InstallProfileEmpty     InstallProfile = "empty"
+	InstallProfilePreview   InstallProfile = "preview"
+	InstallProfileOpenShift InstallProfile = "openshift"
+)
+
+var knownInstallProfiles = map[InstallProfile]bool{
+	InstallProfileDefault:   true,
+	InstallProfileDemo:      true,
+	InstallProfileMinimal:   true,
+	InstallProfileEmpty:     true,
+	InstallProfilePreview:   true,
+	InstallProfileOpenShift: true,
+}
+
+// CNIMode is whether Istio is installed with the CNI plugin, which sets up traffic redirection in place of the
+// istio-init container injected into every pod.
+type CNIMode string
+
+const (
+	// CNIModeEnabled installs the CNI plugin, so injected pods have no istio-init container.
+	CNIModeEnabled CNIMode = "enabled"
+	// CNIModeDisabled installs without the CNI plugin, so injected pods redirect traffic from istio-init.
+	CNIModeDisabled CNIMode = "disabled"
+	// CNIModeAuto leaves it to --istio.test.istio.enableCNI, which is the default.
+	CNIModeAuto CNIMode = "auto"
+)
+
+var knownCNIModes = map[CNIMode]bool{
+	CNIModeEnabled:  true,
+	CNIModeDisabled: true,
+	CNIModeAuto:     true,
+}
+
+// InjectionMode is how sidecar injection is set up on the namespaces created by tests.
+type InjectionMode string
+
+const (
+	// InjectionModeEnabled labels every test namespace for injection.
+	InjectionModeEnabled InjectionMode = "enabled"
+	// InjectionModeDisabled labels every test namespace with injection disabled, to test non-mesh behavior.
+	InjectionModeDisabled InjectionMode = "disabled"
+	// InjectionModePerTest labels the namespaces of tests that opt in to injection with namespace.Config.Inject,
+	// which is the default.
+	InjectionModePerTest InjectionMode = "per-test"
+)
+
+var knownInjectionModes = map[InjectionMode]bool{
+	InjectionModeEnabled:  true,
+	InjectionModeDisabled: true,
+	InjectionModePerTest:  true,
+}
+
+// PeerAuthMode is the mTLS mode of the mesh-wide PeerAuthentication applied before tests.
+type PeerAuthMode string
+
+const (
+	// PeerAuthModePermissive accepts both mTLS and plaintext traffic.
+	PeerAuthModePermissive PeerAuthMode = "permissive"
+	// PeerAuthModeStrict only accepts mTLS traffic.
+	PeerAuthModeStrict PeerAuthMode = "strict"
+	// PeerAuthModeDisable only accepts plaintext traffic.
+	PeerAuthModeDisable PeerAuthMode = "disable"
+)
+
+var knownPeerAuthModes = map[PeerAuthMode]bool{
+	PeerAuthModePermissive: true,
+	PeerAuthModeStrict:     true,
+	PeerAuthModeDisable:    true,
+}
+
+// StateDumpMode is when the state of the clusters is dumped at the end of a test or suite.
+type StateDumpMode string
+
+const (
+	// StateDumpAlways dumps the state of every test and suite, whether it passed or not.
+	StateDumpAlways StateDumpMode = "always"
+	// StateDumpOnFailure only dumps the state of tests and suites that failed.
+	StateDumpOnFailure StateDumpMode = "onfailure"
+	// StateDumpNever never dumps the state.
+	StateDumpNever StateDumpMode = "never"
+)
+
+var knownStateDumpModes = map[StateDumpMode]bool{
+	StateDumpAlways:    true,
+	StateDumpOnFailure: true,
+	StateDumpNever:     true,
+}
+
 // Settings is the set of arguments to the test driver.
 type Settings struct {
 	// Name of the test
@@ -47,6 +232,9 @@ type Settings struct {
 	// Should the tests fail if usage of deprecated stuff (e.g. Envoy flags) is detected
 	FailOnDeprecation bool
 
+	// Should the tests fail if Istiod's analysis reports config warnings for resources in their namespaces
+	FailOnConfigWarning bool
+
 	// Local working directory root for creating temporary directories / files in. If left empty,
 	// os.TempDir() will be used.
 	BaseDir string
@@ -59,9 +247,18 @@ type Settings struct {
 	// This is useful when combined with NoCleanup, to allow quickly iterating on tests.
 	StableNamespaces bool
 
+	// SnapshotNamespaces, if set, captures the Istio config of each stable namespace when it is first claimed, and
+	// restores it whenever the namespace is claimed again, so that every iteration starts from the same config.
+	// Requires StableNamespaces.
+	SnapshotNamespaces bool
+
 	// The label selector that the user has specified.
 	SelectorString string
 
+	// OnlyLabelsString is a comma separated list of labels that a test must all have to run, in addition to
+	// matching the label selector.
+	OnlyLabelsString string
+
 	// The regex specifying which tests to skip. This follows inverted semantics of golang's
 	// -test.run flag, which only supports positive match. If an entire package is meant to be
 	// excluded, it can be filtered with `go list` and explicitly passing the list of desired
@@ -73,9 +270,21 @@ type Settings struct {
 	skipWorkloadClasses arrayFlags
 	SkipWorkloadClasses sets.Set
 
+	// EnabledFeatures are the alpha features enabled in the environment. Tests requiring any other are skipped.
+	enabledFeatures arrayFlags
+	EnabledFeatures sets.Set
+
+	// ProtocolFilter, if not empty, restricts suites that honor it to the cases of these protocols, such as http or
+	// https. Other cases are skipped. Protocols are lower case.
+	protocolFilter arrayFlags
+	ProtocolFilter sets.Set
+
 	// The label selector, in parsed form.
 	Selector label.Selector
 
+	// OnlyLabels is the parsed form of OnlyLabelsString. It selects every test if no labels are given.
+	OnlyLabels label.Selector
+
 	// EnvironmentFactory allows caller to override the environment creation. If nil, a default is used based
 	// on the known environment names.
 	EnvironmentFactory EnvironmentFactory
@@ -106,6 +315,201 @@ type Settings struct {
 	// To configure it so that an Istio revision is on the latest version simply list the revision name without the version (i.e. "rev-a,rev-b")
 	// If using this flag with --istio.test.revision, this flag will take precedence.
 	Revisions RevVerMap
+
+	// LogLevelString is the comma-separated list of scope:level pairs specified by the user
+	// (e.g. "tf:debug,default:info").
+	LogLevelString string
+
+	// LogLevels is the parsed form of LogLevelString, mapping each scope to its output level.
+	// These are applied to the framework logger, as well as the deployed control plane where supported.
+	LogLevels map[string]log.Level
+
+	// NamespaceSelector is the Kubernetes label selector specified by the user, restricting the namespaces
+	// that the framework dumps state for. Only dumps are scoped: namespaces are still set up for every test, and
+	// those created by the framework are always cleaned up, so that a scoped run does not leak namespaces.
+	NamespaceSelector string
+
+	// NamespaceLabelSelector is the parsed form of NamespaceSelector. It matches everything if no selector is given.
+	NamespaceLabelSelector labels.Selector
+
+	// SystemNamespace overrides the namespace that the Istio control plane is installed into. If empty, the
+	// istio component configuration is used, which defaults to istio-system.
+	SystemNamespace string
+
+	// PrometheusURL, if set, is the address of an existing Prometheus-compatible API (e.g. Thanos) that the
+	// prometheus component queries instead of discovering the in-cluster deployment.
+	PrometheusURL string
+
+	// PrometheusUsername and PrometheusPassword are used for basic auth against PrometheusURL. The password is read
+	// from --istio.test.prometheusPasswordFile so that it does not show up in the command line.
+	PrometheusUsername string
+	PrometheusPassword string
+
+	// PrometheusBearerToken is used for bearer token auth against PrometheusURL. It is read from
+	// --istio.test.prometheusBearerTokenFile.
+	PrometheusBearerToken string
+
+	// Files holding PrometheusPassword and PrometheusBearerToken.
+	prometheusPasswordFile    string
+	prometheusBearerTokenFile string
+
+	// PrePullImages, if set, pulls the images used by the framework onto every node before any test runs,
+	// failing the suite immediately if any of them cannot be pulled.
+	PrePullImages bool
+
+	// PprofDump, if non-zero, is the interval at which CPU and heap profiles are captured from the control plane
+	// into the run directory. Profiles are also captured before the state dump of a failed suite in CI mode.
+	PprofDump time.Duration
+
+	// ConfigDumpOnFailure, if set, writes the Envoy config dump of every sidecar in the namespaces of a failed test to
+	// the config-dump directory of its artifacts.
+	ConfigDumpOnFailure bool
+
+	// IstiodDebugOnFailure, if set, writes the responses of the IstiodDebugEndpoints of every istiod to the
+	// istiod-debug directory of the artifacts of a failed test.
+	IstiodDebugOnFailure bool
+
+	// IstiodDebugEndpointsString is the comma separated list of istiod debug endpoints captured on failure.
+	IstiodDebugEndpointsString string
+
+	// IstiodDebugEndpoints are the names of the istiod debug endpoints captured on failure, such as syncz, parsed
+	// from IstiodDebugEndpointsString.
+	IstiodDebugEndpoints []string
+
+	// MinKubeVersion, if set, is the lowest Kubernetes server version, such as 1.22, that the clusters may run. Suites
+	// fail before setup if any cluster is older.
+	MinKubeVersion string
+
+	// ChangedSince, if set, is a git ref. Suites not impacted by the files changed since that ref are skipped.
+	ChangedSince string
+
+	// ChangedFiles are the repo-relative paths of the files changed since ChangedSince.
+	ChangedFiles []string
+
+	// CallGraphDump, if set, records every echo call made by the suite to echo-call-graph.jsonl in the run directory.
+	CallGraphDump bool
+
+	// KubeQPS and KubeBurst are the rate limits of the framework's Kubernetes clients.
+	KubeQPS   float32
+	KubeBurst int
+
+	// EchoReadyTimeout, if set, is how long to wait for echo workloads to become ready. It takes precedence over
+	// --istio.test.echo.readinessTimeout.
+	EchoReadyTimeout time.Duration
+
+	// EchoReplicas is the number of replicas of each echo deployment. Scale tests raise it to exercise load
+	// balancing and endpoint churn.
+	EchoReplicas int
+
+	// OTELEndpoint, if set, is the OTLP/HTTP traces endpoint of an OpenTelemetry collector, such as
+	// http://localhost:4318/v1/traces, that the framework sends spans of its major phases to: installing Istio,
+	// setting up namespaces, deploying echo workloads and running each test.
+	OTELEndpoint string
+
+	// EchoProtocolsString is the comma separated list of protocols the echo workloads expose ports for.
+	EchoProtocolsString string
+
+	// EchoProtocols, if set, limits the ports of the echo workloads to these protocols, parsed from
+	// EchoProtocolsString. A gRPC port is always kept, since the framework drives the echo workloads through it.
+	EchoProtocols []protocol.Instance
+
+	// GatewayClass is the gateway implementation tests deploy and route through.
+	GatewayClass GatewayClass
+
+	// QuarantineFile is a file listing quarantined tests, one name or --istio.test.skip style regex per line.
+	QuarantineFile string
+
+	// QuarantineList are the entries loaded from the QuarantineFile. Quarantined tests are run, but their failures
+	// are reported as warnings that do not fail the suite.
+	QuarantineList []string
+
+	// QuarantineMatcher matches the tests in the QuarantineList.
+	QuarantineMatcher *Matcher
+
+	// RetainArtifactsOnSuccess, if set, dumps the state of tests and suites that pass, and of every failed attempt
+	// of a suite that is retried, rather than only of the final failure in CI mode.
+	RetainArtifactsOnSuccess bool
+
+	// StateDumpMode is when state is dumped. If unset, it follows CIMode: failures are dumped in CI mode, and nothing
+	// is dumped otherwise. Use StateDump for the mode in effect.
+	StateDumpMode StateDumpMode
+
+	// ChartPath, if set, is a local Helm chart that Istio is installed from, in place of the chart of the same name
+	// in the built-in manifests.
+	ChartPath string
+
+	// InstallMethod is how Istio is installed. If unset, it is installed with istioctl.
+	InstallMethod InstallMethod
+
+	// InstallProfile, if set, is the IstioOperator profile Istio is installed with, overriding the profile of the
+	// IstioOperator files of the install.
+	InstallProfile InstallProfile
+
+	// UseExistingInstall, if set, runs the tests against the Istio already installed in the clusters. Istio is
+	// neither installed nor uninstalled; the framework only checks that the existing control plane is ready.
+	UseExistingInstall bool
+
+	// VMMode is how VM workloads are deployed. If unset, they are simulated.
+	VMMode VMMode
+
+	// CNIMode is whether Istio is installed with the CNI plugin or injects the istio-init container.
+	CNIMode CNIMode
+
+	// InjectionMode is how test namespaces are labeled for sidecar injection. If unset, each test opts in.
+	InjectionMode InjectionMode
+
+	// PeerAuthMode, if set, is applied as a mesh-wide PeerAuthentication before the tests of suites that honor it,
+	// so that the same cases run under different security postures. If unset, the mesh default is left in place.
+	PeerAuthMode PeerAuthMode
+
+	// MaxDuration, if set, is the time budget of the whole suite. Once exceeded, no new tests are started, the state
+	// of the in-flight ones is dumped, and the suite exits with an error. Unlike the go test timeout, this leaves
+	// artifacts behind.
+	MaxDuration time.Duration
+
+	// MeshConfigOverlay, if set, is a YAML file of mesh config that is merged over the mesh config of the installed
+	// control plane.
+	MeshConfigOverlay string
+
+	// SidecarResourcesString is the resource spec of echo sidecars, as a comma separated list of requests.cpu,
+	// requests.memory, limits.cpu and limits.memory assignments, e.g. "requests.cpu=100m,limits.memory=1Gi".
+	SidecarResourcesString string
+
+	// SidecarResources is the parsed form of SidecarResourcesString.
+	SidecarResources SidecarResources
+
+	// PerTestLogs, if set, additionally writes each test's logs, and the output of the istio log scopes while the test
+	// runs, to <testname>.log in the run directory.
+	PerTestLogs bool
+
+	// ResourceReport, if set, samples the pods and resource usage of the clusters while each test runs, and writes
+	// the pods created and the peak CPU and memory increase of every test to resource-report.tsv in the run directory.
+	ResourceReport bool
+
+	// ExtraValidators are additional checks run against the settings after the framework's own validation,
+	// allowing a suite to enforce its own flag invariants before any resource is created.
+	ExtraValidators []func(*Settings) error
+}
+
+// NamespaceSelected returns true if the namespace with the given labels is matched by the NamespaceSelector.
+func (s Settings) NamespaceSelected(nsLabels map[string]string) bool {
+	return s.NamespaceLabelSelector == nil || s.NamespaceLabelSelector.Matches(labels.Set(nsLabels))
+}
+
+// Quarantined returns true if the test is quarantined by the QuarantineList.
+func (s Settings) Quarantined(testName string) bool {
+	return s.QuarantineMatcher != nil && s.QuarantineMatcher.MatchTest(testName)
+}
+
+// MissingFeatures returns the required alpha features that are not enabled, in the order given.
+func (s Settings) MissingFeatures(required ...AlphaFeature) []AlphaFeature {
+	var missing []AlphaFeature
+	for _, f := range required {
+		if !s.EnabledFeatures.Contains(string(f)) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
 }
 
 func (s Settings) Skip(class echotypes.Class) bool {
@@ -137,6 +541,17 @@ func DefaultSettings() *Settings {
 	return &Settings{
 		RunID:               uuid.New(),
 		SkipWorkloadClasses: sets.NewSet(),
+		EnabledFeatures:     sets.NewSet(),
+		ProtocolFilter:      sets.NewSet(),
+		KubeQPS:             200,
+		KubeBurst:           400,
+		EchoReplicas:        1,
+		GatewayClass:        GatewayClassIstio,
+		CNIMode:             CNIModeAuto,
+		InjectionMode:       InjectionModePerTest,
+		InstallMethod:       InstallMethodIstioctl,
+
+		IstiodDebugEndpointsString: "syncz,endpointz",
 	}
 }
 
@@ -149,13 +564,77 @@ func (s *Settings) String() string {
 	result += fmt.Sprintf("NoCleanup:         %v\n", s.NoCleanup)
 	result += fmt.Sprintf("BaseDir:           %s\n", s.BaseDir)
 	result += fmt.Sprintf("Selector:          %v\n", s.Selector)
+	result += fmt.Sprintf("OnlyLabels:        %v\n", s.OnlyLabels)
 	result += fmt.Sprintf("FailOnDeprecation: %v\n", s.FailOnDeprecation)
+	result += fmt.Sprintf("FailOnConfigWarn:  %v\n", s.FailOnConfigWarning)
 	result += fmt.Sprintf("CIMode:            %v\n", s.CIMode)
 	result += fmt.Sprintf("Retries:           %v\n", s.Retries)
 	result += fmt.Sprintf("StableNamespaces:  %v\n", s.StableNamespaces)
+	result += fmt.Sprintf("SnapshotNs:        %v\n", s.SnapshotNamespaces)
 	result += fmt.Sprintf("Revision:          %v\n", s.Revision)
 	result += fmt.Sprintf("SkipWorkloads      %v\n", s.SkipWorkloadClasses.SortedList())
 	result += fmt.Sprintf("Compatibility:     %v\n", s.Compatibility)
 	result += fmt.Sprintf("Revisions:         %v\n", s.Revisions.String())
+	result += fmt.Sprintf("LogLevels:         %v\n", s.LogLevelString)
+	result += fmt.Sprintf("NamespaceSelector: %v\n", s.NamespaceSelector)
+	result += fmt.Sprintf("SystemNamespace:   %v\n", s.SystemNamespace)
+	result += fmt.Sprintf("PrometheusURL:     %v\n", s.PrometheusURL)
+	result += fmt.Sprintf("PrometheusAuth:    %v\n", s.prometheusAuth())
+	result += fmt.Sprintf("PrePullImages:     %v\n", s.PrePullImages)
+	result += fmt.Sprintf("PprofDump:         %v\n", s.PprofDump)
+	result += fmt.Sprintf("ConfigDumpOnFail:  %v\n", s.ConfigDumpOnFailure)
+	result += fmt.Sprintf("IstiodDebugOnFail: %v\n", s.IstiodDebugOnFailure)
+	result += fmt.Sprintf("IstiodDebug:       %v\n", s.IstiodDebugEndpoints)
+	result += fmt.Sprintf("MinKubeVersion:    %v\n", s.MinKubeVersion)
+	result += fmt.Sprintf("ChangedSince:      %v\n", s.ChangedSince)
+	result += fmt.Sprintf("CallGraphDump:     %v\n", s.CallGraphDump)
+	result += fmt.Sprintf("KubeQPS:           %v\n", s.KubeQPS)
+	result += fmt.Sprintf("KubeBurst:         %v\n", s.KubeBurst)
+	result += fmt.Sprintf("EchoReadyTimeout:  %v\n", s.EchoReadyTimeout)
+	result += fmt.Sprintf("EchoReplicas:      %v\n", s.EchoReplicas)
+	result += fmt.Sprintf("EchoProtocols:     %v\n", s.EchoProtocols)
+	result += fmt.Sprintf("OTELEndpoint:      %v\n", s.OTELEndpoint)
+	result += fmt.Sprintf("GatewayClass:      %v\n", s.GatewayClass)
+	result += fmt.Sprintf("QuarantineList:    %v\n", s.QuarantineList)
+	result += fmt.Sprintf("ChartPath:         %v\n", s.ChartPath)
+	result += fmt.Sprintf("InstallMethod:     %v\n", s.InstallMethod)
+	result += fmt.Sprintf("InstallProfile:    %v\n", s.InstallProfile)
+	result += fmt.Sprintf("ExistingInstall:   %v\n", s.UseExistingInstall)
+	result += fmt.Sprintf("VMMode:            %v\n", s.VMMode)
+	result += fmt.Sprintf("CNIMode:           %v\n", s.CNIMode)
+	result += fmt.Sprintf("InjectionMode:     %v\n", s.InjectionMode)
+	result += fmt.Sprintf("PeerAuthMode:      %v\n", s.PeerAuthMode)
+	result += fmt.Sprintf("MaxDuration:       %v\n", s.MaxDuration)
+	result += fmt.Sprintf("MeshConfigOverlay: %v\n", s.MeshConfigOverlay)
+	result += fmt.Sprintf("SidecarResources:  %v\n", s.SidecarResourcesString)
+	result += fmt.Sprintf("EnabledFeatures:   %v\n", s.EnabledFeatures.SortedList())
+	result += fmt.Sprintf("ProtocolFilter:    %v\n", s.ProtocolFilter.SortedList())
+	result += fmt.Sprintf("ResourceReport:    %v\n", s.ResourceReport)
+	result += fmt.Sprintf("PerTestLogs:       %v\n", s.PerTestLogs)
+	result += fmt.Sprintf("RetainArtifacts:   %v\n", s.RetainArtifactsOnSuccess)
+	result += fmt.Sprintf("StateDump:         %v\n", s.StateDump())
 	return result
 }
+
+// prometheusAuth describes the auth used against PrometheusURL, without the credentials themselves.
+func (s *Settings) prometheusAuth() string {
+	switch {
+	case s.PrometheusBearerToken != "":
+		return "bearer token"
+	case s.PrometheusUsername != "" || s.PrometheusPassword != "":
+		return fmt.Sprintf("basic (user %q)", s.PrometheusUsername)
+	default:
+		return "none"
+	}
+}
+
+// StateDump returns the StateDumpMode in effect, defaulting to dumping failures in CI mode and nothing otherwise.
+func (s *Settings) StateDump() StateDumpMode {
+	if s.StateDumpMode != "" {
+		return s.StateDumpMode
+	}
+	if s.CIMode {
+		return StateDumpOnFailure
+	}
+	return StateDumpNever
+}
@@ -0,0 +1,222 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	kubeResource "k8s.io/apimachinery/pkg/api/resource"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+const (
+	resourceReportFile     = "resource-report.tsv"
+	resourceReportHeader   = "test\tduration\tpods_created\tpeak_cpu_millicores\tpeak_memory_bytes\n"
+	resourceReportInterval = 10 * time.Second
+	podMetricsPath         = "/apis/metrics.k8s.io/v1beta1/pods"
+)
+
+// resourceSample is the state of the clusters at a point in time.
+type resourceSample struct {
+	// pods are the pods in every cluster, keyed by <cluster>/<uid>.
+	pods map[string]bool
+	// cpuMilli and memoryBytes are the summed usage of every container, if the clusters serve pod metrics.
+	cpuMilli    int64
+	memoryBytes int64
+}
+
+// sampleResources samples the clusters of the context. It is replaced in tests.
+var sampleResources = sampleClusterResources
+
+func sampleClusterResources(ctx resource.Context) (resourceSample, error) {
+	out := resourceSample{pods: map[string]bool{}}
+	for _, c := range ctx.Clusters().Kube() {
+		pods, err := c.CoreV1().Pods("").List(context.TODO(), kubeApiMeta.ListOptions{})
+		if err != nil {
+			return out, fmt.Errorf("cluster %s: %v", c.Name(), err)
+		}
+		for _, p := range pods.Items {
+			out.pods[c.Name()+"/"+string(p.UID)] = true
+		}
+		// Usage is only available from clusters running metrics-server; the pod counts are still reported without it.
+		raw, err := c.CoreV1().RESTClient().Get().AbsPath(podMetricsPath).DoRaw(context.TODO())
+		if err != nil {
+			continue
+		}
+		cpu, mem, err := parsePodMetrics(raw)
+		if err != nil {
+			return out, fmt.Errorf("cluster %s: %v", c.Name(), err)
+		}
+		out.cpuMilli += cpu
+		out.memoryBytes += mem
+	}
+	return out, nil
+}
+
+// parsePodMetrics sums the CPU, in millicores, and memory, in bytes, of every container in a PodMetricsList.
+func parsePodMetrics(raw []byte) (int64, int64, error) {
+	var list struct {
+		Items []struct {
+			Containers []struct {
+				Usage map[string]string `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return 0, 0, fmt.Errorf("invalid pod metrics: %v", err)
+	}
+	var cpu, mem int64
+	for _, item := range list.Items {
+		for _, c := range item.Containers {
+			for name, value := range c.Usage {
+				q, err := kubeResource.ParseQuantity(value)
+				if err != nil {
+					return 0, 0, fmt.Errorf("invalid %s usage %q: %v", name, value, err)
+				}
+				switch name {
+				case "cpu":
+					cpu += q.MilliValue()
+				case "memory":
+					mem += q.Value()
+				}
+			}
+		}
+	}
+	return cpu, mem, nil
+}
+
+// resourceUsage is what a test consumed: the pods it created, and the peak increase in CPU and memory usage over
+// when it started. Tests running in parallel are sampled together, so each is attributed the usage of the others.
+type resourceUsage struct {
+	PodsCreated     int
+	PeakCPUMilli    int64
+	PeakMemoryBytes int64
+}
+
+// resourceRecorder samples the clusters while a test runs.
+type resourceRecorder struct {
+	sample func() (resourceSample, error)
+
+	mu       sync.Mutex
+	baseline resourceSample
+	created  map[string]bool
+	usage    resourceUsage
+
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// startResourceRecording takes the baseline sample, then samples again every interval until stopped.
+func startResourceRecording(sample func() (resourceSample, error), interval time.Duration) *resourceRecorder {
+	r := &resourceRecorder{
+		sample:  sample,
+		created: map[string]bool{},
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	baseline, err := sample()
+	if err != nil {
+		scopes.Framework.Warnf("failed sampling cluster resources: %v", err)
+	}
+	r.baseline = baseline
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				r.record()
+			}
+		}
+	}()
+	return r
+}
+
+func (r *resourceRecorder) record() {
+	s, err := r.sample()
+	if err != nil {
+		scopes.Framework.Warnf("failed sampling cluster resources: %v", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for pod := range s.pods {
+		if !r.baseline.pods[pod] {
+			r.created[pod] = true
+		}
+	}
+	r.usage.PodsCreated = len(r.created)
+	if d := s.cpuMilli - r.baseline.cpuMilli; d > r.usage.PeakCPUMilli {
+		r.usage.PeakCPUMilli = d
+	}
+	if d := s.memoryBytes - r.baseline.memoryBytes; d > r.usage.PeakMemoryBytes {
+		r.usage.PeakMemoryBytes = d
+	}
+}
+
+// stop takes a final sample and returns the usage over the whole test.
+func (r *resourceRecorder) stop() resourceUsage {
+	close(r.stopCh)
+	<-r.done
+	r.record()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.usage
+}
+
+// resourceReport appends a row per test to resource-report.tsv as each test completes, so that the report of an
+// interrupted suite still covers the tests that ran.
+type resourceReport struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newResourceReport(runDir string) (*resourceReport, error) {
+	p := filepath.Join(runDir, resourceReportFile)
+	if err := os.MkdirAll(runDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p, []byte(resourceReportHeader), 0o644); err != nil {
+		return nil, err
+	}
+	return &resourceReport{path: p}, nil
+}
+
+func (r *resourceReport) add(testName string, d time.Duration, u resourceUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s\t%s\t%d\t%d\t%d\n", testName, d.Round(time.Millisecond), u.PodsCreated,
+		u.PeakCPUMilli, u.PeakMemoryBytes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -31,12 +31,14 @@ import (
 
 	kubelib "istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/test/echo"
+	"istio.io/istio/pkg/test/env"
 	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/framework/components/environment/kube"
 	"istio.io/istio/pkg/test/framework/config"
 	ferrors "istio.io/istio/pkg/test/framework/errors"
 	"istio.io/istio/pkg/test/framework/label"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/framework/tracing"
 	"istio.io/istio/pkg/test/scopes"
 	"istio.io/istio/pkg/test/util/file"
 	"istio.io/pkg/log"
@@ -49,6 +51,9 @@ const (
 
 	// Indicates an error due to the setup function supplied by the user
 	exitCodeSetupError = -2
+
+	// Indicates the suite ran for longer than --istio.test.maxDuration
+	exitCodeBudgetExceeded = -3
 )
 
 var (
@@ -298,7 +303,7 @@ func (s *suiteImpl) Setup(fn resource.SetupFn) Suite {
 func (s *suiteImpl) runSetupFn(fn resource.SetupFn, ctx SuiteContext) (err error) {
 	defer func() {
 		// Dump if the setup function fails
-		if err != nil && ctx.Settings().CIMode {
+		if err != nil && retainArtifacts(ctx.Settings(), true, false) {
 			rt.Dump(ctx)
 		}
 	}()
@@ -349,10 +354,39 @@ func (s *suiteImpl) run() (errLevel int) {
 		return s.doSkip(ctx)
 	}
 
+	if reason, skip := s.notImpacted(ctx.Settings()); skip {
+		s.Skip(reason)
+		return s.doSkip(ctx)
+	}
+
+	if endpoint := ctx.Settings().OTELEndpoint; endpoint != "" {
+		tracing.Enable(endpoint, ctx.Settings().TestID)
+		defer func() {
+			if err := tracing.Flush(); err != nil {
+				scopes.Framework.Warnf("failed sending traces to %s: %v", endpoint, err)
+			}
+		}()
+	}
+
 	start := time.Now()
 
+	var wd *watchdog
+	if budget := ctx.Settings().MaxDuration; budget > 0 {
+		r := rt
+		wd = startWatchdog(budget, func() {
+			s.abortOverBudget(ctx, r, budget)
+		})
+	}
+
 	defer func() {
-		if errLevel != 0 && ctx.Settings().CIMode {
+		// Stop the watchdog before tearing down, so that an abort never dumps or exits in the middle of Close.
+		if wd != nil {
+			wd.Stop()
+		}
+		if retainArtifacts(ctx.Settings(), errLevel != 0, false) {
+			if errLevel != 0 && ctx.Settings().PprofDump > 0 {
+				dumpProfiles(ctx, "failure")
+			}
 			rt.Dump(ctx)
 		}
 
@@ -363,10 +397,31 @@ func (s *suiteImpl) run() (errLevel int) {
 					errLevel = 1
 				}
 			}
+			if rt.context.settings.FailOnConfigWarning {
+				if ferrors.IsOrContainsConfigWarningError(err) {
+					errLevel = 1
+				}
+			}
 		}
 		rt = nil
 	}()
 
+	if err := checkKubeVersions(ctx); err != nil {
+		scopes.Framework.Errorf("Exiting due to unsupported Kubernetes version: %v", err)
+		return exitCodeSetupError
+	}
+
+	if ctx.Settings().CallGraphDump {
+		echo.EnableCallGraph(filepath.Join(ctx.Settings().RunDir(), "echo-call-graph.jsonl"))
+	}
+
+	if ctx.Settings().PrePullImages {
+		if err := prePullImages(ctx); err != nil {
+			scopes.Framework.Errorf("Exiting due to image pre-pull failure: %v", err)
+			return exitCodeSetupError
+		}
+	}
+
 	if err := s.runSetupFns(ctx); err != nil {
 		scopes.Framework.Errorf("Exiting due to setup failure: %v", err)
 		return exitCodeSetupError
@@ -377,6 +432,12 @@ func (s *suiteImpl) run() (errLevel int) {
 		return s.doSkip(ctx)
 	}
 
+	if interval := ctx.Settings().PprofDump; interval > 0 {
+		stopProfiling := make(chan struct{})
+		defer close(stopProfiling)
+		startProfiling(ctx, interval, stopProfiling)
+	}
+
 	defer func() {
 		end := time.Now()
 		scopes.Framework.Infof("=== Suite %q run time: %v ===", ctx.Settings().TestID, end.Sub(start))
@@ -399,15 +460,76 @@ func (s *suiteImpl) run() (errLevel int) {
 			scopes.Framework.Infof("=== FAILED: Test Run: '%s' (exitCode: %v) ===",
 				ctx.Settings().TestID, errLevel)
 			if attempt <= ctx.settings.Retries {
+				if retainArtifacts(ctx.Settings(), true, true) {
+					// The dump at the end of the run only reflects the final attempt.
+					rt.Dump(ctx)
+				}
 				scopes.Framework.Warnf("=== RETRY: Test Run: '%s' ===", ctx.Settings().TestID)
 			}
 		}
 	}
+	// Quarantined failures never fail the run, so they never trigger a retry; but a quarantined test is run, and
+	// reported, again on every retry of the suite.
+	if failures := ctx.quarantinedFailures(); len(failures) > 0 {
+		scopes.Framework.Warnf("=== QUARANTINED: %d failure(s) not failing '%s': %v ===",
+			len(failures), ctx.Settings().TestID, failures)
+	}
 	s.writeOutput()
 
 	return
 }
 
+// abortOverBudget stops new tests from starting, dumps the state of the in-flight ones, and exits. It is called
+// by the watchdog once the suite has run for longer than its time budget, with the runtime of the suite; the run
+// stops the watchdog before closing that runtime.
+func (s *suiteImpl) abortOverBudget(ctx *suiteContext, r *runtime, budget time.Duration) {
+	ctx.budgetExceeded.Store(true)
+	scopes.Framework.Errorf("=== ABORTED: Test Run: '%s': suite time budget of %v exceeded ===",
+		ctx.Settings().TestID, budget)
+	r.Dump(ctx)
+	s.writeOutput()
+	s.osExit(exitCodeBudgetExceeded)
+}
+
+// retainArtifacts returns true if state should be dumped at the end of a run, or of a test. retrying is set for a
+// failed attempt of a suite that is about to be retried. By default, only final failures are dumped, and only in CI
+// mode; --istio.test.stateDump overrides when state is dumped, and --istio.test.retainArtifactsOnSuccess dumps
+// everything, so that a suite that only passed on a retry keeps the artifacts of its failed attempts.
+func retainArtifacts(s *resource.Settings, failed, retrying bool) bool {
+	if s.RetainArtifactsOnSuccess {
+		return true
+	}
+	switch s.StateDump() {
+	case resource.StateDumpAlways:
+		return true
+	case resource.StateDumpOnFailure:
+		return failed && !retrying
+	default:
+		return false
+	}
+}
+
+// notImpacted returns true, along with the reason, if --istio.test.changedSince is set and the suite is not impacted
+// by the changed files. The selection is advisory: if the suite's package cannot be determined, it is run.
+func (s *suiteImpl) notImpacted(settings *resource.Settings) (string, bool) {
+	if settings.ChangedSince == "" {
+		return "", false
+	}
+	// go test runs each package's tests from the package directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	pkgDir, err := filepath.Rel(env.IstioSrc, wd)
+	if err != nil || strings.HasPrefix(pkgDir, "..") {
+		return "", false
+	}
+	if resource.Impacted(settings.ChangedFiles, pkgDir, s.labels) {
+		return "", false
+	}
+	return fmt.Sprintf("Not impacted by changes since %s: package=%s, labels=%v", settings.ChangedSince, pkgDir, s.labels), true
+}
+
 type SuiteOutcome struct {
 	Name         string
 	Environment  string
@@ -471,6 +593,8 @@ func (s *suiteImpl) runSetupFns(ctx SuiteContext) (err error) {
 	setupFns := append(append([]resource.SetupFn{}, s.requireFns...), s.setupFns...)
 
 	start := time.Now()
+	span := tracing.Start("setup")
+	defer span.End()
 	for _, fn := range setupFns {
 		err := s.runSetupFn(fn, ctx)
 		if err != nil {
@@ -510,7 +634,7 @@ func initRuntime(s *suiteImpl) error {
 		environmentFactory = newEnvironment
 	}
 
-	if err := configureLogging(); err != nil {
+	if err := configureLogging(settings.LogLevels, settings.PerTestLogs); err != nil {
 		return err
 	}
 
@@ -16,15 +16,25 @@ package framework
 
 import (
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 
 	"istio.io/istio/pkg/test/framework/components/environment/kube"
+	"istio.io/istio/pkg/test/framework/components/namespace"
 	"istio.io/istio/pkg/test/framework/label"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/scopes"
 )
 
 func defaultExitFn(_ int) {}
@@ -374,6 +384,413 @@ func TestSuite_Cleanup(t *testing.T) {
 	})
 }
 
+func TestSuite_PerTestLogs(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	var runDir string
+	runFn := func(ctx *suiteContext) int {
+		runDir = ctx.Settings().RunDir()
+		t.Run("group", func(t *testing.T) {
+			for _, name := range []string{"one", "two"} {
+				name := name
+				t.Run(name, func(t *testing.T) {
+					NewTest(t).RunParallel(func(ctx TestContext) {
+						for i := 0; i < 50; i++ {
+							ctx.Logf("hello from %s %d", name, i)
+						}
+					})
+				})
+			}
+		})
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	settings.PerTestLogs = true
+
+	s := newTestSuite("tid", runFn, defaultExitFn, settingsFn(settings))
+	s.Run()
+
+	for _, name := range []string{"one", "two"} {
+		other := "one"
+		if name == "one" {
+			other = "two"
+		}
+		b, err := os.ReadFile(testLogPath(runDir, t.Name()+"/group/"+name))
+		g.Expect(err).To(BeNil())
+		// Scope output of the framework is copied into both logs, only check the test's own lines.
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			if strings.Contains(line, "\tINFO\thello from ") {
+				lines = append(lines, line)
+			}
+		}
+		g.Expect(lines).To(HaveLen(50))
+		for i, line := range lines {
+			g.Expect(line).To(HaveSuffix(fmt.Sprintf("\tINFO\thello from %s %d", name, i)))
+			g.Expect(line).NotTo(ContainSubstring(other))
+		}
+	}
+}
+
+func TestSuite_PerTestLogsScopes(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	var runDir string
+	runFn := func(ctx *suiteContext) int {
+		runDir = ctx.Settings().RunDir()
+		NewTest(t).Run(func(ctx TestContext) {
+			scopes.Framework.Infof("hello from the framework scope")
+		})
+		scopes.Framework.Infof("hello after the test")
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	settings.PerTestLogs = true
+
+	s := newTestSuite("tid", runFn, defaultExitFn, settingsFn(settings))
+	s.Run()
+
+	b, err := os.ReadFile(testLogPath(runDir, t.Name()))
+	g.Expect(err).To(BeNil())
+	g.Expect(string(b)).To(ContainSubstring("\ttf\thello from the framework scope"))
+	g.Expect(string(b)).NotTo(ContainSubstring("hello after the test"))
+}
+
+func TestSuite_OTELTraces(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	var mu sync.Mutex
+	var spans []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		data := &otlptrace.TracesData{}
+		if err := proto.Unmarshal(b, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range data.ResourceSpans {
+			for _, ils := range rs.InstrumentationLibrarySpans {
+				for _, span := range ils.Spans {
+					spans = append(spans, span.Name)
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	runFn := func(ctx *suiteContext) int {
+		NewTest(t).Run(func(ctx TestContext) {
+			namespace.NewOrFail(ctx, ctx, namespace.Config{Prefix: "echo"})
+		})
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	settings.OTELEndpoint = collector.URL + "/v1/traces"
+
+	s := newTestSuite("tid", runFn, defaultExitFn, settingsFn(settings))
+	s.Setup(func(resource.Context) error {
+		return nil
+	})
+	s.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	g.Expect(spans).To(ConsistOf("setup", "namespace", "test", "suite"))
+}
+
+func TestSuite_ResourceReport(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	var mu sync.Mutex
+	current := resourceSample{pods: map[string]bool{"cluster-0/existing": true}, cpuMilli: 100, memoryBytes: 1024}
+	origSample := sampleResources
+	sampleResources = func(resource.Context) (resourceSample, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		out := current
+		out.pods = map[string]bool{}
+		for p := range current.pods {
+			out.pods[p] = true
+		}
+		return out, nil
+	}
+	defer func() {
+		sampleResources = origSample
+	}()
+
+	var runDir string
+	runFn := func(ctx *suiteContext) int {
+		runDir = ctx.Settings().RunDir()
+		t.Run("heavy", func(t *testing.T) {
+			NewTest(t).Run(func(ctx TestContext) {
+				mu.Lock()
+				defer mu.Unlock()
+				current.pods["cluster-0/a"] = true
+				current.pods["cluster-0/b"] = true
+				current.cpuMilli += 500
+				current.memoryBytes += 2048
+			})
+		})
+		t.Run("light", func(t *testing.T) {
+			NewTest(t).Run(func(ctx TestContext) {})
+		})
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	settings.ResourceReport = true
+
+	s := newTestSuite("tid", runFn, defaultExitFn, settingsFn(settings))
+	s.Run()
+
+	b, err := os.ReadFile(filepath.Join(runDir, resourceReportFile))
+	g.Expect(err).To(BeNil())
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	g.Expect(lines).To(HaveLen(3))
+	g.Expect(lines[0] + "\n").To(Equal(resourceReportHeader))
+	// The pods and usage left behind by the heavy test are the light test's baseline, so are not attributed to it.
+	for i, want := range []string{t.Name() + "/heavy\t*\t2\t500\t2048", t.Name() + "/light\t*\t0\t0\t0"} {
+		fields := strings.Split(lines[i+1], "\t")
+		wantFields := strings.Split(want, "\t")
+		g.Expect(fields).To(HaveLen(len(wantFields)))
+		for j := range fields {
+			if wantFields[j] != "*" {
+				g.Expect(fields[j]).To(Equal(wantFields[j]))
+			}
+		}
+	}
+}
+
+func TestSuite_OnlyLabels(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	var ran []string
+	runFn := func(ctx *suiteContext) int {
+		for name, labels := range map[string][]label.Instance{
+			"both":        {label.Postsubmit, label.IPv4},
+			"postsubmit":  {label.Postsubmit},
+			"ipv4":        {label.IPv4},
+			"all":         {label.Postsubmit, label.IPv4, label.CustomSetup},
+			"unlabeled":   nil,
+			"customsetup": {label.CustomSetup},
+		} {
+			name, labels := name, labels
+			t.Run(name, func(t *testing.T) {
+				NewTest(t).Label(labels...).Run(func(ctx TestContext) {
+					ran = append(ran, name)
+				})
+			})
+		}
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	var err error
+	// Only tests with all the required labels run, and the selector still excludes those it would on its own.
+	settings.OnlyLabels, err = label.ParseSelector("postsubmit,ipv4")
+	g.Expect(err).To(BeNil())
+	settings.Selector, err = label.ParseSelector("-customsetup")
+	g.Expect(err).To(BeNil())
+
+	s := newTestSuite("tid", runFn, defaultExitFn, settingsFn(settings))
+	s.Run()
+
+	g.Expect(ran).To(ConsistOf("both"))
+}
+
+func TestSuite_Quarantine(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	outcomes := map[string]Outcome{}
+	var quarantined []string
+	runFn := func(ctx *suiteContext) int {
+		t.Run("flaky", func(t *testing.T) {
+			NewTest(t).Run(func(ctx TestContext) {
+				ctx.Error("flaked")
+			})
+		})
+		t.Run("fatal", func(t *testing.T) {
+			NewTest(t).Run(func(ctx TestContext) {
+				ctx.Fatal("flaked")
+			})
+		})
+		t.Run("passing", func(t *testing.T) {
+			NewTest(t).Run(func(ctx TestContext) {})
+		})
+		for _, o := range ctx.testOutcomes {
+			outcomes[o.Name] = o.Outcome
+		}
+		quarantined = ctx.quarantinedFailures()
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	matcher, err := resource.NewMatcher([]string{t.Name() + "/flaky", t.Name() + "/fatal"})
+	g.Expect(err).To(BeNil())
+	settings.QuarantineMatcher = matcher
+
+	var exitCode int
+	s := newTestSuite("tid", runFn, func(code int) { exitCode = code }, settingsFn(settings))
+	s.Run()
+
+	g.Expect(exitCode).To(Equal(0))
+	g.Expect(t.Failed()).To(BeFalse())
+	g.Expect(outcomes).To(HaveKeyWithValue(t.Name()+"/flaky", QuarantinedFailure))
+	g.Expect(outcomes).To(HaveKeyWithValue(t.Name()+"/fatal", QuarantinedFailure))
+	g.Expect(outcomes).To(HaveKeyWithValue(t.Name()+"/passing", Passed))
+	g.Expect(quarantined).To(ConsistOf(t.Name()+"/flaky", t.Name()+"/fatal"))
+}
+
+// dumpRecorder records whether it was dumped.
+type dumpRecorder struct {
+	resource.FakeResource
+	dumped chan struct{}
+}
+
+func (d *dumpRecorder) Dump(resource.Context) {
+	close(d.dumped)
+}
+
+func TestSuite_MaxDuration(t *testing.T) {
+	defer cleanupRT()
+	g := NewWithT(t)
+
+	exited := make(chan int, 2)
+	dumper := &dumpRecorder{dumped: make(chan struct{})}
+	lateRan := false
+	runFn := func(ctx *suiteContext) int {
+		ctx.TrackResource(dumper)
+		// Hang, like a test stuck on a dependency, until the watchdog gives up on the suite.
+		<-exited
+		t.Run("late", func(t *testing.T) {
+			NewTest(t).Run(func(ctx TestContext) {
+				lateRan = true
+			})
+		})
+		return 0
+	}
+	settings := resource.DefaultSettings()
+	settings.MaxDuration = 50 * time.Millisecond
+
+	var exitCodes []int
+	var exitMu sync.Mutex
+	s := newTestSuite("tid", runFn, func(code int) {
+		exitMu.Lock()
+		defer exitMu.Unlock()
+		exitCodes = append(exitCodes, code)
+		exited <- code
+	}, settingsFn(settings))
+	s.Run()
+
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	// The first exit is the watchdog's; os.Exit would not have returned to let the suite finish.
+	g.Expect(exitCodes).NotTo(BeEmpty())
+	g.Expect(exitCodes[0]).To(Equal(exitCodeBudgetExceeded))
+	g.Expect(dumper.dumped).To(BeClosed())
+	g.Expect(lateRan).To(BeFalse())
+}
+
+func TestRetainArtifacts(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings resource.Settings
+		// attempts are the outcomes of each attempt of a run, true for failed; a run is retried until it passes.
+		attempts []bool
+		// retained are the attempts whose artifacts are expected to be dumped.
+		retained []bool
+	}{
+		{
+			name:     "success",
+			settings: resource.Settings{CIMode: true, Retries: 1},
+			attempts: []bool{false},
+			retained: []bool{false},
+		},
+		{
+			name:     "success retained",
+			settings: resource.Settings{CIMode: true, Retries: 1, RetainArtifactsOnSuccess: true},
+			attempts: []bool{false},
+			retained: []bool{true},
+		},
+		{
+			name:     "retry then success",
+			settings: resource.Settings{CIMode: true, Retries: 1},
+			attempts: []bool{true, false},
+			retained: []bool{false, false},
+		},
+		{
+			name:     "retry then success retained",
+			settings: resource.Settings{CIMode: true, Retries: 1, RetainArtifactsOnSuccess: true},
+			attempts: []bool{true, false},
+			retained: []bool{true, true},
+		},
+		{
+			name:     "failure",
+			settings: resource.Settings{CIMode: true, Retries: 1},
+			attempts: []bool{true, true},
+			retained: []bool{false, true},
+		},
+		{
+			name:     "failure outside of CI",
+			settings: resource.Settings{Retries: 1},
+			attempts: []bool{true, true},
+			retained: []bool{false, false},
+		},
+		{
+			name:     "failure retained outside of CI",
+			settings: resource.Settings{Retries: 1, RetainArtifactsOnSuccess: true},
+			attempts: []bool{true, true},
+			retained: []bool{true, true},
+		},
+		{
+			name:     "success always dumped",
+			settings: resource.Settings{Retries: 1, StateDumpMode: resource.StateDumpAlways},
+			attempts: []bool{false},
+			retained: []bool{true},
+		},
+		{
+			name:     "retry then success always dumped",
+			settings: resource.Settings{Retries: 1, StateDumpMode: resource.StateDumpAlways},
+			attempts: []bool{true, false},
+			retained: []bool{true, true},
+		},
+		{
+			name:     "failure dumped outside of CI",
+			settings: resource.Settings{Retries: 1, StateDumpMode: resource.StateDumpOnFailure},
+			attempts: []bool{true, true},
+			retained: []bool{false, true},
+		},
+		{
+			name:     "success never dumped in CI",
+			settings: resource.Settings{CIMode: true, Retries: 1, StateDumpMode: resource.StateDumpNever},
+			attempts: []bool{false},
+			retained: []bool{false},
+		},
+		{
+			name:     "failure never dumped in CI",
+			settings: resource.Settings{CIMode: true, Retries: 1, StateDumpMode: resource.StateDumpNever},
+			attempts: []bool{true, true},
+			retained: []bool{false, false},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			var got []bool
+			for i, failed := range tc.attempts {
+				retrying := failed && i < tc.settings.Retries
+				got = append(got, retainArtifacts(&tc.settings, failed, retrying))
+			}
+			g.Expect(got).To(Equal(tc.retained))
+		})
+	}
+}
+
 func TestSuite_DoubleInit_Error(t *testing.T) {
 	defer cleanupRT()
 	g := NewWithT(t)
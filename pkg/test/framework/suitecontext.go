@@ -22,6 +22,7 @@ import (
 	"strings"
 	"sync"
 
+	"go.uber.org/atomic"
 	"sigs.k8s.io/yaml"
 
 	"istio.io/istio/pkg/test/framework/components/cluster"
@@ -60,7 +61,13 @@ type suiteContext struct {
 	outcomeMu    sync.RWMutex
 	testOutcomes []TestOutcome
 
+	// budgetExceeded is set once the suite has run for longer than --istio.test.maxDuration.
+	budgetExceeded atomic.Bool
+
 	traces sync.Map
+
+	// resourceReport, if non-nil, receives the resource usage of each test, with --istio.test.resourceReport.
+	resourceReport *resourceReport
 }
 
 func newSuiteContext(s *resource.Settings, envFn resource.EnvironmentFactory, labels label.Set) (*suiteContext, error) {
@@ -78,6 +85,13 @@ func newSuiteContext(s *resource.Settings, envFn resource.EnvironmentFactory, la
 		suiteLabels:  labels,
 		contextNames: make(map[string]struct{}),
 	}
+	if s.ResourceReport {
+		report, err := newResourceReport(s.RunDir())
+		if err != nil {
+			scopes.Framework.Warnf("failed creating resource report: %v", err)
+		}
+		c.resourceReport = report
+	}
 
 	env, err := envFn(c)
 	if err != nil {
@@ -213,6 +227,8 @@ const (
 	Failed         Outcome = "Failed"
 	Skipped        Outcome = "Skipped"
 	NotImplemented Outcome = "NotImplemented"
+	// QuarantinedFailure is the outcome of a quarantined test that failed. It does not fail the suite.
+	QuarantinedFailure Outcome = "QuarantinedFailure"
 )
 
 type TestOutcome struct {
@@ -230,6 +246,9 @@ func (s *suiteContext) registerOutcome(test *testImpl) {
 		o = NotImplemented
 	} else if test.goTest.Failed() {
 		o = Failed
+	} else if test.ctx != nil && test.ctx.quarantinedFailed.Load() {
+		// Checked before skipped, since a fatal quarantined failure stops the test by skipping it.
+		o = QuarantinedFailure
 	} else if test.goTest.Skipped() {
 		o = Skipped
 	}
@@ -244,6 +263,19 @@ func (s *suiteContext) registerOutcome(test *testImpl) {
 	s.testOutcomes = append(s.testOutcomes, newOutcome)
 }
 
+// quarantinedFailures returns the names of the quarantined tests that failed.
+func (s *suiteContext) quarantinedFailures() []string {
+	s.outcomeMu.RLock()
+	defer s.outcomeMu.RUnlock()
+	var out []string
+	for _, o := range s.testOutcomes {
+		if o.Outcome == QuarantinedFailure {
+			out = append(out, o.Name)
+		}
+	}
+	return out
+}
+
 func (s *suiteContext) RecordTraceEvent(key string, value interface{}) {
 	s.traces.Store(key, value)
 }
@@ -23,6 +23,7 @@ import (
 	"istio.io/istio/pkg/test/framework/features"
 	"istio.io/istio/pkg/test/framework/label"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/framework/tracing"
 	"istio.io/istio/pkg/test/scopes"
 	"istio.io/pkg/log"
 )
@@ -48,6 +49,8 @@ type Test interface {
 	RequiresLocalControlPlane() Test
 	// RequiresSingleNetwork ensures that clusters are in the same network
 	RequiresSingleNetwork() Test
+	// RequiresAlphaFeatures skips the test unless all of the alpha features are enabled with --istio.test.features.
+	RequiresAlphaFeatures(feats ...resource.AlphaFeature) Test
 	// Run the test, supplied as a lambda.
 	Run(fn func(t TestContext))
 	// RunParallel runs this test in parallel with other children of the same parent test/suite. Under the hood,
@@ -115,6 +118,8 @@ type testImpl struct {
 	requireLocalIstiod   bool
 	requireSingleNetwork bool
 	minIstioVersion      string
+	// requiredFeatures are the alpha features that must be enabled for the test to run.
+	requiredFeatures []resource.AlphaFeature
 
 	ctx *testContext
 
@@ -194,6 +199,11 @@ func (t *testImpl) RequiresSingleNetwork() Test {
 	return t
 }
 
+func (t *testImpl) RequiresAlphaFeatures(feats ...resource.AlphaFeature) Test {
+	t.requiredFeatures = append(t.requiredFeatures, feats...)
+	return t
+}
+
 func (t *testImpl) RequireIstioVersion(version string) Test {
 	t.minIstioVersion = version
 	return t
@@ -222,6 +232,11 @@ func (t *testImpl) runInternal(fn func(ctx TestContext), parallel bool) {
 		return
 	}
 
+	if t.s.budgetExceeded.Load() {
+		t.goTest.Skip("Skipped because the suite time budget (--istio.test.maxDuration) was exceeded.")
+		return
+	}
+
 	if t.parent != nil {
 		// Create a new subtest under the parent's test.
 		parentGoTest := t.parent.goTest
@@ -286,6 +301,13 @@ func (t *testImpl) doRun(ctx *testContext, fn func(ctx TestContext), parallel bo
 		}
 	}
 
+	if missing := t.s.Settings().MissingFeatures(t.requiredFeatures...); len(missing) > 0 {
+		ctx.Done()
+		t.goTest.Skipf("Skipping %q: requires alpha features %v, which are not enabled with --istio.test.features",
+			t.goTest.Name(), missing)
+		return
+	}
+
 	start := time.Now()
 
 	scopes.Framework.Infof("=== BEGIN: Test: '%s[%s]' ===", rt.suiteContext().Settings().TestID, t.goTest.Name())
@@ -302,6 +324,16 @@ func (t *testImpl) doRun(ctx *testContext, fn func(ctx TestContext), parallel bo
 		t.goTest.Parallel()
 	}
 
+	// Sample once the test is actually running, as parallel tests are paused until their parent exits.
+	var usage *resourceRecorder
+	if t.s.resourceReport != nil {
+		usage = startResourceRecording(func() (resourceSample, error) {
+			return sampleResources(ctx)
+		}, resourceReportInterval)
+	}
+
+	span := tracing.Start("test", "test", t.goTest.Name())
+
 	defer func() {
 		doneFn := func() {
 			message := "passed"
@@ -309,6 +341,11 @@ func (t *testImpl) doRun(ctx *testContext, fn func(ctx TestContext), parallel bo
 				message = "failed"
 			}
 			end := time.Now()
+			if usage != nil {
+				if err := t.s.resourceReport.add(t.goTest.Name(), end.Sub(start), usage.stop()); err != nil {
+					scopes.Framework.Warnf("failed writing resource report for %s: %v", t.goTest.Name(), err)
+				}
+			}
 			scopes.Framework.Infof("=== DONE (%s):  Test: '%s[%s] (%v)' ===",
 				message,
 				rt.suiteContext().Settings().TestID,
@@ -316,6 +353,8 @@ func (t *testImpl) doRun(ctx *testContext, fn func(ctx TestContext), parallel bo
 				end.Sub(start))
 			rt.suiteContext().registerOutcome(t)
 			ctx.Done()
+			span.SetAttribute("outcome", message)
+			span.End()
 			if t.hasParallelChildren {
 				globalParentLock.Delete(t)
 			}
@@ -22,6 +22,8 @@ import (
 	"testing"
 	"time"
 
+	"go.uber.org/atomic"
+
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/framework/errors"
@@ -97,6 +99,13 @@ type testContext struct {
 
 	// The workDir for this particular context
 	workDir string
+
+	// log, if non-nil, receives a copy of everything logged through this context.
+	log *testLog
+
+	// quarantined tests report their failures as warnings, which don't fail the suite.
+	quarantined       bool
+	quarantinedFailed atomic.Bool
 }
 
 // Before executing a new context, we should wait for existing contexts to terminate if they are NOT parents of this context.
@@ -147,8 +156,11 @@ func newTestContext(test *testImpl, goTest *testing.T, s *suiteContext, parentSc
 	if !s.settings.Selector.Selects(allLabels) {
 		goTest.Skipf("Skipping: label mismatch: labels=%v, filter=%v", allLabels, s.settings.Selector)
 	}
+	if !s.settings.OnlyLabels.Selects(allLabels) {
+		goTest.Skipf("Skipping: missing required labels: labels=%v, required=%v", allLabels, s.settings.OnlyLabels)
+	}
 
-	if s.settings.SkipMatcher.MatchTest(goTest.Name()) {
+	if s.settings.SkipMatcher != nil && s.settings.SkipMatcher.MatchTest(goTest.Name()) {
 		goTest.Skipf("Skipping: test %v matched -istio.test.skip regex", goTest.Name())
 	}
 
@@ -173,6 +185,14 @@ func newTestContext(test *testImpl, goTest *testing.T, s *suiteContext, parentSc
 		parentScope = s.globalScope
 	}
 
+	var log *testLog
+	if s.settings.PerTestLogs {
+		var err error
+		if log, err = newTestLog(s.settings.RunDir(), goTest.Name()); err != nil {
+			scopes.Framework.Warnf("failed creating per-test log for %s: %v", goTest.Name(), err)
+		}
+	}
+
 	scopeID := fmt.Sprintf("[%s]", id)
 	return &testContext{
 		id:         id,
@@ -181,7 +201,10 @@ func newTestContext(test *testImpl, goTest *testing.T, s *suiteContext, parentSc
 		suite:      s,
 		scope:      newScope(scopeID, parentScope),
 		workDir:    workDir,
+		log:        log,
 		FileWriter: yml.NewFileWriter(workDir),
+
+		quarantined: s.settings.Quarantined(goTest.Name()),
 	}
 }
 
@@ -313,7 +336,10 @@ func (c *testContext) Cleanup(fn func()) {
 }
 
 func (c *testContext) Done() {
-	if c.Failed() && c.Settings().CIMode {
+	c.captureConfigDumps()
+	c.captureIstiodDebug()
+
+	if retainArtifacts(c.Settings(), c.Failed(), false) {
 		scopes.Framework.Debugf("Begin dumping testContext: %q", c.id)
 		// make sure we dump suite-level resources, but don't dump sibling tests or their children
 		rt.DumpShallow(c)
@@ -329,52 +355,97 @@ func (c *testContext) Done() {
 				c.Error("Using deprecated Envoy features. Failing due to -istio.test.deprecation_failure flag.")
 			}
 		}
+		if c.Settings().FailOnConfigWarning {
+			if errors.IsOrContainsConfigWarningError(err) {
+				c.Error("Istiod reported config warnings. Failing due to -istio.test.failOnConfigWarning flag.")
+			}
+		}
 	}
 	scopes.Framework.Debugf("Completed cleaning up testContext: %q", c.id)
+	_ = c.log.Close()
+}
+
+// quarantineFailure records a failure of a quarantined test, logging it as a warning instead of failing the test.
+func (c *testContext) quarantineFailure(msg string) {
+	c.Helper()
+	c.quarantinedFailed.Store(true)
+	scopes.Framework.Warnf("Quarantined test %s failed: %s", c.T.Name(), msg)
+	c.T.Logf("QUARANTINED FAILURE: %s", msg)
 }
 
 func (c *testContext) Error(args ...interface{}) {
 	c.Helper()
+	c.log.write("ERROR", fmt.Sprintln(args...))
+	if c.quarantined {
+		c.quarantineFailure(fmt.Sprintln(args...))
+		return
+	}
 	c.T.Error(args...)
 }
 
 func (c *testContext) Errorf(format string, args ...interface{}) {
 	c.Helper()
+	c.log.write("ERROR", fmt.Sprintf(format, args...))
+	if c.quarantined {
+		c.quarantineFailure(fmt.Sprintf(format, args...))
+		return
+	}
 	c.T.Errorf(format, args...)
 }
 
 func (c *testContext) Fail() {
 	c.Helper()
+	if c.quarantined {
+		c.quarantineFailure("test marked failed")
+		return
+	}
 	c.T.Fail()
 }
 
 func (c *testContext) FailNow() {
 	c.Helper()
+	if c.quarantined {
+		c.quarantineFailure("test marked failed")
+		// Stopping the test with anything other than FailNow or SkipNow fails it.
+		c.T.SkipNow()
+	}
 	c.T.FailNow()
 }
 
 func (c *testContext) Failed() bool {
 	c.Helper()
-	return c.T.Failed()
+	return c.T.Failed() || c.quarantinedFailed.Load()
 }
 
 func (c *testContext) Fatal(args ...interface{}) {
 	c.Helper()
+	c.log.write("FATAL", fmt.Sprintln(args...))
+	if c.quarantined {
+		c.quarantineFailure(fmt.Sprintln(args...))
+		c.T.SkipNow()
+	}
 	c.T.Fatal(args...)
 }
 
 func (c *testContext) Fatalf(format string, args ...interface{}) {
 	c.Helper()
+	c.log.write("FATAL", fmt.Sprintf(format, args...))
+	if c.quarantined {
+		c.quarantineFailure(fmt.Sprintf(format, args...))
+		c.T.SkipNow()
+	}
 	c.T.Fatalf(format, args...)
 }
 
 func (c *testContext) Log(args ...interface{}) {
 	c.Helper()
+	c.log.write("INFO", fmt.Sprintln(args...))
 	c.T.Log(args...)
 }
 
 func (c *testContext) Logf(format string, args ...interface{}) {
 	c.Helper()
+	c.log.write("INFO", fmt.Sprintf(format, args...))
 	c.T.Logf(format, args...)
 }
 
@@ -385,6 +456,7 @@ func (c *testContext) Name() string {
 
 func (c *testContext) Skip(args ...interface{}) {
 	c.Helper()
+	c.log.write("SKIP", fmt.Sprintln(args...))
 	c.T.Skip(args...)
 }
 
@@ -395,6 +467,7 @@ func (c *testContext) SkipNow() {
 
 func (c *testContext) Skipf(format string, args ...interface{}) {
 	c.Helper()
+	c.log.write("SKIP", fmt.Sprintf(format, args...))
 	c.T.Skipf(format, args...)
 }
 
@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testLogScheme is the zap sink that copies the output of the istio log scopes, such as scopes.Framework, to the
+// logs of the running tests.
+const testLogScheme = "istio-test-log"
+
+func init() {
+	if err := zap.RegisterSink(testLogScheme, func(*url.URL) (zap.Sink, error) {
+		return testLogSink{}, nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+var (
+	activeTestLogsMu sync.Mutex
+	activeTestLogs   = map[*testLog]struct{}{}
+)
+
+// testLogSink writes each log entry to every test log that is open. The scopes are global, so an entry is copied to
+// the logs of all tests running at the time, including tests running in parallel.
+type testLogSink struct{}
+
+func (testLogSink) Write(p []byte) (int, error) {
+	activeTestLogsMu.Lock()
+	defer activeTestLogsMu.Unlock()
+	for l := range activeTestLogs {
+		l.writeRaw(p)
+	}
+	return len(p), nil
+}
+
+func (testLogSink) Sync() error {
+	return nil
+}
+
+func (testLogSink) Close() error {
+	return nil
+}
+
+// testLog tees a test's log output to <testname>.log in the run directory, together with the output of the istio
+// log scopes while the test runs. Subtests get their own file, nested under their parent's directory in the same
+// way as their work dirs.
+type testLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func testLogPath(runDir, testName string) string {
+	return filepath.Join(runDir, testName+".log")
+}
+
+func newTestLog(runDir, testName string) (*testLog, error) {
+	p := testLogPath(runDir, testName)
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return nil, err
+	}
+	// Append, so that a test run again by --istio.test.retries keeps the logs of every attempt.
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &testLog{f: f}
+	activeTestLogsMu.Lock()
+	activeTestLogs[l] = struct{}{}
+	activeTestLogsMu.Unlock()
+	return l, nil
+}
+
+// write appends a single line to the log. Each line is written with one call under the lock, so parallel
+// subtests logging through the same context never interleave within a line.
+func (l *testLog) write(level, msg string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\n", time.Now().Format(time.RFC3339Nano), level, strings.TrimSuffix(msg, "\n"))
+	_, _ = l.f.WriteString(line)
+}
+
+// writeRaw appends a log entry already formatted by the scopes' encoder.
+func (l *testLog) writeRaw(entry []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	_, _ = l.f.Write(entry)
+}
+
+func (l *testLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	activeTestLogsMu.Lock()
+	delete(activeTestLogs, l)
+	activeTestLogsMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
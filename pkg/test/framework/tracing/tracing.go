@@ -0,0 +1,202 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records spans of the major phases of a test suite, such as installing Istio or running a test,
+// and sends them to an OpenTelemetry collector, to show where the time of the suite goes.
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// serviceName is the service the spans are reported for.
+	serviceName = "istio-test-framework"
+
+	// SuiteSpan is the name of the span of the whole suite, the parent of every other span.
+	SuiteSpan = "suite"
+
+	exportTimeout = 10 * time.Second
+)
+
+var tracer struct {
+	mu       sync.Mutex
+	endpoint string
+	traceID  []byte
+	suite    *Span
+	spans    []*otlptrace.Span
+}
+
+// Span is a phase of the suite. A nil Span, as returned while tracing is disabled, does nothing.
+type Span struct {
+	name       string
+	id         []byte
+	parentID   []byte
+	start      time.Time
+	mu         sync.Mutex
+	attributes map[string]string
+}
+
+// Enable starts tracing the suite, starting its span. The spans are sent to the OTLP/HTTP traces endpoint by Flush.
+func Enable(endpoint, suite string) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	tracer.endpoint = endpoint
+	tracer.traceID = randomID(16)
+	tracer.spans = nil
+	tracer.suite = newSpan(SuiteSpan, nil, []string{"suite", suite})
+}
+
+// Start starts a span of the suite, named after its phase, such as install. The attributes are key value pairs. It
+// returns nil if tracing is disabled.
+func Start(name string, attributes ...string) *Span {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if tracer.suite == nil {
+		return nil
+	}
+	return newSpan(name, tracer.suite.id, attributes)
+}
+
+func newSpan(name string, parentID []byte, attributes []string) *Span {
+	s := &Span{
+		name:       name,
+		id:         randomID(8),
+		parentID:   parentID,
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		s.attributes[attributes[i]] = attributes[i+1]
+	}
+	return s
+}
+
+// SetAttribute sets an attribute of the span, such as the outcome of a test.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends the span. Spans ended after tracing is disabled are dropped.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if tracer.suite == nil {
+		return
+	}
+	tracer.spans = append(tracer.spans, s.proto(tracer.traceID, time.Now()))
+}
+
+func (s *Span) proto(traceID []byte, end time.Time) *otlptrace.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.attributes))
+	for k := range s.attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attributes := make([]*otlpcommon.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, stringAttribute(k, s.attributes[k]))
+	}
+	return &otlptrace.Span{
+		TraceId:           traceID,
+		SpanId:            s.id,
+		ParentSpanId:      s.parentID,
+		Name:              s.name,
+		Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(s.start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        attributes,
+	}
+}
+
+// Flush ends the span of the suite, sends every span to the collector, and disables tracing. It does nothing if
+// tracing is disabled.
+func Flush() error {
+	tracer.mu.Lock()
+	if tracer.suite == nil {
+		tracer.mu.Unlock()
+		return nil
+	}
+	spans := append(tracer.spans, tracer.suite.proto(tracer.traceID, time.Now()))
+	endpoint := tracer.endpoint
+	tracer.suite, tracer.spans = nil, nil
+	tracer.mu.Unlock()
+
+	return export(endpoint, spans)
+}
+
+// export sends the spans to the OTLP/HTTP traces endpoint. TracesData has the same encoding as the
+// ExportTraceServiceRequest the endpoint expects.
+func export(endpoint string, spans []*otlptrace.Span) error {
+	b, err := proto.Marshal(&otlptrace.TracesData{
+		ResourceSpans: []*otlptrace.ResourceSpans{{
+			Resource: &otlpresource.Resource{
+				Attributes: []*otlpcommon.KeyValue{stringAttribute("service.name", serviceName)},
+			},
+			InstrumentationLibrarySpans: []*otlptrace.InstrumentationLibrarySpans{{
+				InstrumentationLibrary: &otlpcommon.InstrumentationLibrary{Name: serviceName},
+				Spans:                  spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: exportTimeout}
+	resp, err := client.Post(endpoint, "application/x-protobuf", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("collector returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+func stringAttribute(key, value string) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{
+		Key:   key,
+		Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func randomID(n int) []byte {
+	id := make([]byte, n)
+	_, _ = rand.Read(id)
+	return id
+}
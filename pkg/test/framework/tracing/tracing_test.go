@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector is an OTLP/HTTP traces endpoint that keeps the spans it receives.
+type fakeCollector struct {
+	mu    sync.Mutex
+	spans []*otlptrace.Span
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	data := &otlptrace.TracesData{}
+	if err := proto.Unmarshal(b, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range data.ResourceSpans {
+		for _, ils := range rs.InstrumentationLibrarySpans {
+			c.spans = append(c.spans, ils.Spans...)
+		}
+	}
+}
+
+func attribute(s *otlptrace.Span, key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestFlush(t *testing.T) {
+	collector := &fakeCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	Enable(srv.URL+"/v1/traces", "telemetry")
+	install := Start("install", "revision", "canary")
+	install.End()
+	test := Start("test", "test", "TestTraffic")
+	test.SetAttribute("outcome", "passed")
+	test.End()
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(collector.spans) != 3 {
+		t.Fatalf("expected 3 spans, got %v", collector.spans)
+	}
+	byName := map[string]*otlptrace.Span{}
+	for _, s := range collector.spans {
+		byName[s.Name] = s
+	}
+	suite := byName[SuiteSpan]
+	if suite == nil || attribute(suite, "suite") != "telemetry" || len(suite.ParentSpanId) != 0 {
+		t.Fatalf("expected a root suite span, got %v", suite)
+	}
+	for name, want := range map[string][2]string{
+		"install": {"revision", "canary"},
+		"test":    {"outcome", "passed"},
+	} {
+		s := byName[name]
+		if s == nil {
+			t.Fatalf("expected a %s span, got %v", name, collector.spans)
+		}
+		if !bytes.Equal(s.TraceId, suite.TraceId) || !bytes.Equal(s.ParentSpanId, suite.SpanId) {
+			t.Errorf("expected the %s span to be a child of the suite span, got %v", name, s)
+		}
+		if got := attribute(s, want[0]); got != want[1] {
+			t.Errorf("expected the %s span to have %s=%s, got %q", name, want[0], want[1], got)
+		}
+		if s.EndTimeUnixNano < s.StartTimeUnixNano {
+			t.Errorf("expected the %s span to end after it started, got %v", name, s)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	s := Start("install")
+	if s != nil {
+		t.Fatalf("expected no span while tracing is disabled, got %v", s)
+	}
+	s.SetAttribute("outcome", "passed")
+	s.End()
+	if err := Flush(); err != nil {
+		t.Fatalf("expected flushing disabled tracing to do nothing, got %v", err)
+	}
+}
+
+func TestFlushCollectorError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	Enable(srv.URL, "telemetry")
+	if err := Flush(); err == nil {
+		t.Fatal("expected the collector error to be returned")
+	}
+	// Tracing is disabled once flushed.
+	if s := Start("install"); s != nil {
+		t.Fatalf("expected no span after flushing, got %v", s)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"sync"
+	"time"
+)
+
+// watchdog calls a function once a time budget is exceeded, unless it is stopped first.
+type watchdog struct {
+	timer *time.Timer
+
+	// mu is held while onExpiry runs, so that Stop waits for it to return.
+	mu      sync.Mutex
+	stopped bool
+}
+
+// startWatchdog calls onExpiry, on its own goroutine, if the watchdog is not stopped within the budget.
+func startWatchdog(budget time.Duration, onExpiry func()) *watchdog {
+	w := &watchdog{}
+	w.timer = time.AfterFunc(budget, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.stopped {
+			return
+		}
+		onExpiry()
+	})
+	return w
+}
+
+// Stop stops the watchdog. It returns false if the budget was already exceeded. Once Stop returns, onExpiry is
+// neither running nor going to run.
+func (w *watchdog) Stop() bool {
+	stopped := w.timer.Stop()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	return stopped
+}
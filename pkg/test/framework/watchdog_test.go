@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package framework
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	t.Run("stopped within budget", func(t *testing.T) {
+		w := startWatchdog(time.Hour, func() {
+			t.Error("expected the watchdog not to expire")
+		})
+		if !w.Stop() {
+			t.Fatal("expected the watchdog to be stopped within its budget")
+		}
+	})
+	t.Run("budget exceeded", func(t *testing.T) {
+		expired := make(chan struct{})
+		w := startWatchdog(10*time.Millisecond, func() {
+			close(expired)
+		})
+		select {
+		case <-expired:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the watchdog to expire")
+		}
+		if w.Stop() {
+			t.Fatal("expected Stop to report that the budget was exceeded")
+		}
+	})
+	t.Run("stop waits for expiry", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		done := false
+		w := startWatchdog(time.Millisecond, func() {
+			close(started)
+			<-release
+			done = true
+		})
+		<-started
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+		}()
+		w.Stop()
+		if !done {
+			t.Fatal("expected Stop to wait for the expiry to return")
+		}
+	})
+}
@@ -16,10 +16,11 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	listerv1 "k8s.io/client-go/listers/core/v1"
@@ -27,6 +28,30 @@ import (
 	"istio.io/istio/pkg/config/constants"
 )
 
+// ImmutableConfigMapError is returned when the CA bundle cannot be written to a configmap marked immutable, because
+// the configmap could not be deleted to recreate it with the new bundle. Retrying fails the same way until the
+// immutable flag is cleared.
+type ImmutableConfigMapError struct {
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *ImmutableConfigMapError) Error() string {
+	return fmt.Sprintf("configmap %s/%s is immutable and could not be recreated with the new data; "+
+		"clear its immutable flag or allow deleting it: %v", e.Namespace, e.Name, e.Err)
+}
+
+func (e *ImmutableConfigMapError) Unwrap() error {
+	return e.Err
+}
+
+// IsImmutableConfigMapError returns true if the error, or any error it wraps, is an ImmutableConfigMapError.
+func IsImmutableConfigMapError(err error) bool {
+	var immutableErr *ImmutableConfigMapError
+	return errors.As(err, &immutableErr)
+}
+
 // InsertDataToConfigMap inserts a data to a configmap in a namespace.
 // client: the k8s client interface.
 // namespace: the namespace of the configmap.
@@ -34,29 +59,44 @@ import (
 // configName: the name of the configmap.
 // dataName: the name of the data in the configmap.
 func InsertDataToConfigMap(client corev1.ConfigMapsGetter, lister listerv1.ConfigMapLister, meta metav1.ObjectMeta, caBundle []byte) error {
+	return InsertDataToConfigMapWithKey(client, lister, meta, constants.CACertNamespaceConfigMapDataName, caBundle)
+}
+
+// InsertDataToConfigMapWithKey is like InsertDataToConfigMap, but stores the CA bundle under the given data key.
+//
+// Every write is atomic: the configmap is either created, or updated with a single full-object Update that carries
+// the complete bundle together with the labels and owner references. The Update is guarded by the resourceVersion it
+// was built from, so a concurrent writer causes a conflict rather than an interleaved write, and readers never
+// observe the configmap with an empty or partial bundle. The exception is an immutable configmap, which is deleted
+// and created again with the new bundle, so readers may find it missing in between.
+func InsertDataToConfigMapWithKey(client corev1.ConfigMapsGetter, lister listerv1.ConfigMapLister, meta metav1.ObjectMeta,
+	dataKey string, caBundle []byte) error {
 	configmap, err := lister.ConfigMaps(meta.Namespace).Get(meta.Name)
-	if err != nil && !errors.IsNotFound(err) {
+	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("error when getting configmap %v: %v", meta.Name, err)
 	}
-	if errors.IsNotFound(err) {
+	if apierrors.IsNotFound(err) {
 		// Create a new ConfigMap.
-		configmap = &v1.ConfigMap{
-			ObjectMeta: meta,
-			Data: map[string]string{
-				constants.CACertNamespaceConfigMapDataName: string(caBundle),
-			},
-		}
+		configmap = desiredConfigMap(meta, dataKey, caBundle)
 		if _, err = client.ConfigMaps(meta.Namespace).Create(context.TODO(), configmap, metav1.CreateOptions{}); err != nil {
 			// Namespace may be deleted between now... and our previous check. Just skip this, we cannot create into deleted ns
 			// And don't retry a create if the namespace is terminating
-			if errors.IsNotFound(err) || errors.HasStatusCause(err, v1.NamespaceTerminatingCause) {
+			if apierrors.IsNotFound(err) || apierrors.HasStatusCause(err, v1.NamespaceTerminatingCause) {
 				return nil
 			}
-			return fmt.Errorf("error when creating configmap %v: %v", meta.Name, err)
+			if apierrors.IsAlreadyExists(err) {
+				// The lister is lagging behind the API server, such as after a failover. Update the live object instead.
+				return updateLiveConfigMap(client, meta, dataKey, caBundle)
+			}
+			return fmt.Errorf("error when creating configmap %v: %w", meta.Name, err)
 		}
 	} else {
 		// Otherwise, update the config map if changes are required
-		err := UpdateDataInConfigMap(client, configmap, caBundle)
+		err := updateConfigMap(client, configmap, dataKey, meta.Labels, meta.OwnerReferences, caBundle)
+		if apierrors.IsConflict(err) {
+			// The lister returned an outdated version of the configmap. Retry once against the live object.
+			return updateLiveConfigMap(client, meta, dataKey, caBundle)
+		}
 		if err != nil {
 			return err
 		}
@@ -64,6 +104,26 @@ func InsertDataToConfigMap(client corev1.ConfigMapsGetter, lister listerv1.Confi
 	return nil
 }
 
+// desiredConfigMap returns the complete configmap to create. The metadata is copied, so the object never shares
+// maps with the caller.
+func desiredConfigMap(meta metav1.ObjectMeta, dataKey string, caBundle []byte) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: *meta.DeepCopy(),
+		Data: map[string]string{
+			dataKey: string(caBundle),
+		},
+	}
+}
+
+// updateLiveConfigMap updates the configmap as read from the API server, bypassing the lister.
+func updateLiveConfigMap(client corev1.ConfigMapsGetter, meta metav1.ObjectMeta, dataKey string, caBundle []byte) error {
+	configmap, err := client.ConfigMaps(meta.Namespace).Get(context.TODO(), meta.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error when getting configmap %v: %v", meta.Name, err)
+	}
+	return updateConfigMap(client, configmap, dataKey, meta.Labels, meta.OwnerReferences, caBundle)
+}
+
 // insertData merges a configmap with a map, and returns true if any changes were made
 func insertData(cm *v1.ConfigMap, data map[string]string) bool {
 	if cm.Data == nil {
@@ -80,19 +140,96 @@ func insertData(cm *v1.ConfigMap, data map[string]string) bool {
 	return needsUpdate
 }
 
+// insertLabels merges labels into a configmap's existing labels, preserving any labels set by others,
+// and returns true if any changes were made
+func insertLabels(cm *v1.ConfigMap, labels map[string]string) bool {
+	needsUpdate := false
+	for k, v := range labels {
+		if existing, ok := cm.Labels[k]; ok && existing == v {
+			continue
+		}
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[k] = v
+		needsUpdate = true
+	}
+	return needsUpdate
+}
+
+// insertOwnerReferences adds any owner references missing from a configmap, and returns true if any changes were made
+func insertOwnerReferences(cm *v1.ConfigMap, refs []metav1.OwnerReference) bool {
+	needsUpdate := false
+	for _, ref := range refs {
+		found := false
+		for _, existing := range cm.OwnerReferences {
+			if existing.UID == ref.UID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cm.OwnerReferences = append(cm.OwnerReferences, ref)
+			needsUpdate = true
+		}
+	}
+	return needsUpdate
+}
+
 func UpdateDataInConfigMap(client corev1.ConfigMapsGetter, cm *v1.ConfigMap, caBundle []byte) error {
+	return updateConfigMap(client, cm, constants.CACertNamespaceConfigMapDataName, nil, nil, caBundle)
+}
+
+// updateConfigMap applies the bundle, labels and owner references to a copy of the configmap and writes it back with a
+// single Update, so the data and labels always change together. The cached object is never modified. The data of an
+// immutable configmap cannot be updated, so it is recreated instead.
+func updateConfigMap(client corev1.ConfigMapsGetter, cm *v1.ConfigMap, dataKey string, labels map[string]string,
+	ownerRefs []metav1.OwnerReference, caBundle []byte) error {
 	if cm == nil {
 		return fmt.Errorf("cannot update nil configmap")
 	}
 	newCm := cm.DeepCopy()
 	data := map[string]string{
-		constants.CACertNamespaceConfigMapDataName: string(caBundle),
+		dataKey: string(caBundle),
 	}
-	if needsUpdate := insertData(newCm, data); !needsUpdate {
+	dataChanged := insertData(newCm, data)
+	labelsChanged := insertLabels(newCm, labels)
+	ownersChanged := insertOwnerReferences(newCm, ownerRefs)
+	if !dataChanged && !labelsChanged && !ownersChanged {
 		return nil
 	}
+	if dataChanged && newCm.Immutable != nil && *newCm.Immutable {
+		return recreateConfigMap(client, newCm)
+	}
 	if _, err := client.ConfigMaps(newCm.Namespace).Update(context.TODO(), newCm, metav1.UpdateOptions{}); err != nil {
-		return fmt.Errorf("error when updating configmap %v: %v", cm.Name, err)
+		return fmt.Errorf("error when updating configmap %v: %w", cm.Name, err)
+	}
+	return nil
+}
+
+// recreateConfigMap replaces an immutable configmap by deleting it and creating it again with the new data, keeping it
+// immutable. The delete is guarded by the UID and resourceVersion the configmap was read with, so that a configmap
+// changed in the meantime causes a conflict rather than being replaced. If the delete is rejected for any other
+// reason, such as missing permissions, an ImmutableConfigMapError is returned.
+func recreateConfigMap(client corev1.ConfigMapsGetter, cm *v1.ConfigMap) error {
+	uid, resourceVersion := cm.UID, cm.ResourceVersion
+	err := client.ConfigMaps(cm.Namespace).Delete(context.TODO(), cm.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion},
+	})
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("error when deleting immutable configmap %v: %w", cm.Name, err)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return &ImmutableConfigMapError{Namespace: cm.Namespace, Name: cm.Name, Err: err}
+	}
+	newCm := cm.DeepCopy()
+	newCm.UID = ""
+	newCm.ResourceVersion = ""
+	newCm.CreationTimestamp = metav1.Time{}
+	newCm.Generation = 0
+	newCm.ManagedFields = nil
+	if _, err := client.ConfigMaps(newCm.Namespace).Create(context.TODO(), newCm, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("error when recreating immutable configmap %v: %w", cm.Name, err)
 	}
 	return nil
 }
@@ -17,6 +17,9 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -126,6 +129,8 @@ func TestInsertDataToConfigMap(t *testing.T) {
 		expectedActions   []ktesting.Action
 		expectedErr       string
 		client            *fake.Clientset
+		// staleLister leaves the existing ConfigMap out of the lister, as if the cache had not caught up yet.
+		staleLister bool
 	}{
 		{
 			name:              "non-existing ConfigMap",
@@ -163,6 +168,19 @@ func TestInsertDataToConfigMap(t *testing.T) {
 				configMapName),
 			client: createConfigMapDisabledClient(),
 		},
+		{
+			name:              "existing ConfigMap missing from stale lister",
+			meta:              metav1.ObjectMeta{Namespace: namespaceName, Name: configMapName},
+			existingConfigMap: createConfigMap(namespaceName, configMapName, map[string]string{}),
+			caBundle:          caBundle,
+			staleLister:       true,
+			expectedActions: []ktesting.Action{
+				ktesting.NewCreateAction(gvr, namespaceName, createConfigMap(namespaceName, configMapName, testData)),
+				ktesting.NewGetAction(gvr, namespaceName, configMapName),
+				ktesting.NewUpdateAction(gvr, namespaceName, createConfigMap(namespaceName, configMapName, testData)),
+			},
+			expectedErr: "",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -178,8 +196,10 @@ func TestInsertDataToConfigMap(t *testing.T) {
 				if _, err := client.CoreV1().ConfigMaps(tc.meta.Namespace).Create(context.TODO(), tc.existingConfigMap, metav1.CreateOptions{}); err != nil {
 					t.Errorf("failed to create configmap %v", err)
 				}
-				if err := lister.Informer().GetIndexer().Add(tc.existingConfigMap); err != nil {
-					t.Errorf("failed to add configmap to informer %v", err)
+				if !tc.staleLister {
+					if err := lister.Informer().GetIndexer().Add(tc.existingConfigMap); err != nil {
+						t.Errorf("failed to add configmap to informer %v", err)
+					}
 				}
 			}
 			client.ClearActions()
@@ -194,7 +214,214 @@ func TestInsertDataToConfigMap(t *testing.T) {
 					t.Error(err)
 				}
 			}
+			if tc.staleLister {
+				cm, err := client.CoreV1().ConfigMaps(tc.meta.Namespace).Get(context.TODO(), tc.meta.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != string(tc.caBundle) {
+					t.Errorf("expected the live configmap to be updated to %q, got %q", tc.caBundle, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertDataToImmutableConfigMap(t *testing.T) {
+	meta := metav1.ObjectMeta{Namespace: namespaceName, Name: configMapName}
+	immutable := true
+	existing := createConfigMap(namespaceName, configMapName, map[string]string{
+		constants.CACertNamespaceConfigMapDataName: "old-data",
+	})
+	existing.Immutable = &immutable
+	existing.Generation = 3
+	existing.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "pilot-discovery", Operation: metav1.ManagedFieldsOperationUpdate}}
+
+	t.Run("recreated", func(t *testing.T) {
+		client := fake.NewSimpleClientset(existing.DeepCopy())
+		lister := createFakeLister(client)
+		if err := lister.Informer().GetIndexer().Add(existing.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+		client.ClearActions()
+		if err := InsertDataToConfigMap(client.CoreV1(), lister.Lister(), meta, []byte("new-data")); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkActions(client.Actions(), []ktesting.Action{
+			ktesting.NewDeleteAction(v1.SchemeGroupVersion.WithResource("configmaps"), namespaceName, configMapName),
+			ktesting.NewCreateAction(v1.SchemeGroupVersion.WithResource("configmaps"), namespaceName, existing),
+		}); err != nil {
+			t.Error(err)
+		}
+		cm, err := client.CoreV1().ConfigMaps(namespaceName).Get(context.TODO(), configMapName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != "new-data" {
+			t.Errorf("expected the recreated configmap to hold the new data, got %q", got)
+		}
+		if cm.Immutable == nil || !*cm.Immutable {
+			t.Error("expected the recreated configmap to stay immutable")
+		}
+		created := client.Actions()[1].(ktesting.CreateAction).GetObject().(*v1.ConfigMap)
+		if created.Generation != 0 || created.ManagedFields != nil {
+			t.Errorf("expected server-set metadata to be cleared on create, got generation %d and managed fields %v",
+				created.Generation, created.ManagedFields)
+		}
+	})
+
+	t.Run("delete forbidden", func(t *testing.T) {
+		client := fake.NewSimpleClientset(existing.DeepCopy())
+		client.PrependReactor("delete", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(v1.Resource("configmaps"), configMapName, fmt.Errorf("no permission"))
 		})
+		lister := createFakeLister(client)
+		if err := lister.Informer().GetIndexer().Add(existing.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+		err := InsertDataToConfigMap(client.CoreV1(), lister.Lister(), meta, []byte("new-data"))
+		if !IsImmutableConfigMapError(err) {
+			t.Fatalf("expected an ImmutableConfigMapError, got %v", err)
+		}
+		cm, err := client.CoreV1().ConfigMaps(namespaceName).Get(context.TODO(), configMapName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; got != "old-data" {
+			t.Errorf("expected the configmap to be left alone, got %q", got)
+		}
+	})
+}
+
+func TestInsertDataToConfigMapConcurrent(t *testing.T) {
+	bundles := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		bundles[fmt.Sprintf("-----BEGIN CERTIFICATE-----\nroot-%d\n-----END CERTIFICATE-----\n", i)] = true
+	}
+	meta := metav1.ObjectMeta{Namespace: namespaceName, Name: configMapName, Labels: map[string]string{"istio.io/config": "true"}}
+	checkComplete := func(cm *v1.ConfigMap) error {
+		if got := cm.Data[constants.CACertNamespaceConfigMapDataName]; !bundles[got] {
+			return fmt.Errorf("configmap has incomplete bundle %q", got)
+		}
+		if cm.Labels["istio.io/config"] != "true" {
+			return fmt.Errorf("configmap is missing its labels: %v", cm.Labels)
+		}
+		return nil
+	}
+
+	var first string
+	for bundle := range bundles {
+		first = bundle
+		break
+	}
+	existing := createConfigMap(namespaceName, configMapName, map[string]string{constants.CACertNamespaceConfigMapDataName: first})
+	existing.Labels = meta.Labels
+	existing.ResourceVersion = "1"
+	client := fake.NewSimpleClientset(existing.DeepCopy())
+	errCh := make(chan error, 100)
+	// The tracker does not enforce resourceVersions; do it as the apiserver does, so that stale writes conflict.
+	// Reactors run under the lock of the clientset, so the check and the write are atomic.
+	configMaps := v1.SchemeGroupVersion.WithResource("configmaps")
+	// Writes built from the lister carry resourceVersion 1, which only the first write to change the data can match;
+	// any other resourceVersion comes from a retry against the live configmap.
+	var conflicts, retries int32
+	client.PrependReactor("update", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		cm := action.(ktesting.UpdateAction).GetObject().(*v1.ConfigMap)
+		obj, err := client.Tracker().Get(configMaps, cm.Namespace, cm.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		if cm.ResourceVersion != existing.ResourceVersion {
+			atomic.AddInt32(&retries, 1)
+		}
+		current, _ := strconv.Atoi(obj.(*v1.ConfigMap).ResourceVersion)
+		if cm.ResourceVersion != strconv.Itoa(current) {
+			atomic.AddInt32(&conflicts, 1)
+			return true, nil, errors.NewConflict(v1.Resource("configmaps"), cm.Name, fmt.Errorf("stale resourceVersion"))
+		}
+		cm.ResourceVersion = strconv.Itoa(current + 1)
+		return false, nil, nil
+	})
+	for _, verb := range []string{"create", "update"} {
+		client.PrependReactor(verb, "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+			cm := action.(ktesting.CreateAction).GetObject().(*v1.ConfigMap)
+			if err := checkComplete(cm); err != nil {
+				select {
+				case errCh <- fmt.Errorf("%s: %v", action.GetVerb(), err):
+				default:
+				}
+			}
+			return false, nil, nil
+		})
+	}
+	// The lister never observes a write, so every writer starts from the stale configmap and conflicts, unless it is
+	// the first to change it; it then retries against the live object.
+	informer := createFakeLister(client)
+	if err := informer.Informer().GetIndexer().Add(existing.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	lister := informer.Lister()
+
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			cm, err := client.CoreV1().ConfigMaps(namespaceName).Get(context.TODO(), configMapName, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err == nil {
+				err = checkComplete(cm)
+			}
+			if err != nil {
+				select {
+				case errCh <- fmt.Errorf("read: %v", err):
+				default:
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for bundle := range bundles {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(bundle string) {
+				defer wg.Done()
+				err := InsertDataToConfigMap(client.CoreV1(), lister, meta, []byte(bundle))
+				// A conflicting write is rejected as a whole, which is fine; anything else is not.
+				if err != nil && !errors.IsConflict(err) {
+					errCh <- err
+				}
+			}(bundle)
+		}
+	}
+	wg.Wait()
+	close(stop)
+	<-readerDone
+	close(errCh)
+	for err := range errCh {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&conflicts) == 0 {
+		t.Error("expected stale writes to conflict")
+	}
+	if atomic.LoadInt32(&retries) == 0 {
+		t.Error("expected conflicting writes to be retried against the live configmap")
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(namespaceName).Get(context.TODO(), configMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkComplete(cm); err != nil {
+		t.Error(err)
 	}
 }
 
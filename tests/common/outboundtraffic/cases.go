@@ -0,0 +1,1064 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outboundtraffic defines the cases of the outbound traffic policy integration tests, along with the
+// validation of the cases and the checks of their results that need no cluster, so that they are unit tested.
+package outboundtraffic
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/common/model"
+	"google.golang.org/grpc/codes"
+
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/gvk"
+	echoClient "istio.io/istio/pkg/test/echo"
+	"istio.io/istio/pkg/test/framework"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/resource"
+	tmpl "istio.io/istio/pkg/test/util/tmpl"
+)
+
+// MeshPeerAuthentication is applied to the root namespace to set the mTLS mode of the whole mesh.
+const MeshPeerAuthentication = `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+spec:
+  mtls:
+    mode: {{.Mode}}
+`
+
+// TestCase represents what is being tested
+type TestCase struct {
+	Name     string
+	PortName string
+	HTTP2    bool
+	Host     string
+	// Hosts, if set, runs the case once per host in place of Host, as subtests named after the host. The templates
+	// of the case may refer to the host of each run as {{.Host}}, so that its metrics are asserted per host.
+	Hosts []string
+	// Port, if set, selects the destination port by its service port number, for ports that cases don't refer
+	// to by name. PortName takes precedence if both are set.
+	Port int
+	// Path, if set, is the path of the request URL.
+	Path string
+	// Headers, if set, are sent with every request of the case, in addition to the Host header.
+	Headers map[string]string
+	// IPFamily selects the IP family used to reach the destination. If unset, the destination
+	// is reached through its cluster-local FQDN.
+	IPFamily IPFamily
+	// DestinationRuleYAML, if set, is applied to the service namespace before the requests are sent
+	// and removed once the case completes. It is validated before any traffic is sent. It is a template that
+	// may refer to {{.EgressGatewayHost}}, the host of the egress gateway service, along with the parameters of
+	// DestinationServiceNamespace.
+	DestinationRuleYAML string
+	// VirtualServiceYAML, if set, is applied and validated in the same way as DestinationRuleYAML, and may only
+	// contain VirtualServices.
+	VirtualServiceYAML string
+	// ExpectDelta, if set, sends exactly this many requests without retries and expects the case's metric to
+	// increase by exactly this much, rather than checking the cumulative value. This keeps traffic from earlier
+	// cases from satisfying the assertion.
+	ExpectDelta int
+	// KeepAliveRequests, if set, sends this many requests one after another without retries, and expects the
+	// connections opened for them, as counted by Expected.ConnectionsPromQueryFormat, to have been reused; at most
+	// Expected.MaxNewConnections may be opened.
+	KeepAliveRequests int
+	// RequiresEgressGateway, if set, skips the case rather than failing it when the install has no egress gateway
+	// to route it through, as with minimal profiles.
+	RequiresEgressGateway bool
+	// RequiresZonalEgressGateway, if set, skips the case unless the egress gateway has replicas in both
+	// ClientLocality and FailoverLocality, as set by the istio-locality label of its pods.
+	RequiresZonalEgressGateway bool
+	// Setup, if set, is called before the requests of the case are sent, to apply config that is specific to the
+	// case, such as to the given service namespace. The teardown it returns, if any, is called once the case
+	// completes, even if it fails. Setup reports its own failures through t, and cleans up after them itself.
+	Setup    func(t *testing.T, ctx framework.TestContext, serviceNamespace string) func()
+	Expected Expected
+}
+
+const (
+	// PassthroughCluster is the cluster requests to unknown destinations are forwarded through with ALLOW_ANY.
+	PassthroughCluster = "PassthroughCluster"
+	// BlackHoleCluster is the cluster requests to unknown destinations are dropped by with REGISTRY_ONLY.
+	BlackHoleCluster = "BlackHoleCluster"
+)
+
+// IPFamily is the IP family used when sending requests to the "external" destination
+type IPFamily string
+
+const (
+	IPv4 IPFamily = "ipv4"
+	IPv6 IPFamily = "ipv6"
+	// DualStack sends requests over both IPv4 and IPv6
+	DualStack IPFamily = "dual"
+)
+
+// Expected contains the metric and query to run against
+// prometheus to validate that expected telemetry information was gathered;
+// as well as the http response code
+type Expected struct {
+	Metric          string
+	PromQueryFormat string
+	StatusCode      int
+	// Protocol is the protocol the client sends the request over, such as HTTP/1.1, HTTP/2.0 or TCP.
+	Protocol       string
+	RequestHeaders map[string]string
+	// UpstreamProtocol, if set, is the protocol the destination must have received the request over, as reported
+	// by it, such as HTTP/1.1 for a request the egress gateway downgrades from HTTP/2.0. The case's query is then
+	// also scoped to the request_protocol of Protocol, which Istio reports as http for both HTTP versions.
+	UpstreamProtocol string
+	// Revision, if set, sends the request directly to the destination workload injected with this
+	// control plane revision and verifies that the response was served by it.
+	Revision string
+	// ExpectedSNI, if set, is the SNI that the destination must observe on the TLS connection.
+	// Only applies to HTTPS cases.
+	ExpectedSNI string
+	// DestinationServiceNamespace, if set, scopes PromQueryFormat to the given destination_service_namespace,
+	// so that services of the same name in other namespaces are not counted. It is a template that may refer
+	// to {{.AppNamespace}} and {{.ServiceNamespace}}.
+	DestinationServiceNamespace string
+	// SourceWorkload and SourceApp, if set, scope PromQueryFormat to traffic from the given source_workload
+	// and source_app, so that traffic from other clients is not counted.
+	SourceWorkload string
+	SourceApp      string
+	// Cluster, if set, scopes PromQueryFormat to requests routed to the given cluster, such as PassthroughCluster,
+	// BlackHoleCluster or the host of a ServiceEntry, as reported in destination_service_name. If prefixed with "!",
+	// it scopes the query to requests that were not routed to the cluster instead.
+	Cluster string
+	// DestinationApp, if set, scopes PromQueryFormat to requests reported with the given destination_app. It is a
+	// template that may refer to {{.EgressGatewayApp}}, the app label of the egress gateway, along with the
+	// parameters of DestinationServiceNamespace.
+	DestinationApp string
+	// SourceLocality and DestinationLocality, if set, scope PromQueryFormat to requests reported with the given
+	// source_locality and destination_locality, in the region.zone.subzone format of the istio-locality label. Istio
+	// does not report localities by default, so the runner applies LocalityTelemetry while the case runs, which only
+	// adds them to istio_requests_total as reported by the client. If prefixed with "!", they scope the query to
+	// other localities instead. They are templates that may refer to {{.ClientLocality}} and {{.FailoverLocality}},
+	// along with the parameters of DestinationServiceNamespace.
+	SourceLocality      string
+	DestinationLocality string
+	// BlockMode, if set, expects the request to be blocked in the given way. The StatusCode is not checked.
+	BlockMode BlockMode
+	// GRPCStatus, if set, is the gRPC status code a gRPC case must end with, such as OK or UNAVAILABLE. A gRPC
+	// failure is reported in the status, often with an HTTP 200, so it is checked independently of StatusCode;
+	// the StatusCode and the other response checks only apply if the expected status is OK.
+	GRPCStatus string
+	// GatewayPromQueryFormat, if set, is a second query, against the metrics reported by the egress gateway for its
+	// hop to the external destination. Source metrics attribute the request to the gateway service as soon as the
+	// sidecar routes it there; this proves the gateway forwarded it. It is a template that may refer to
+	// {{.EgressGatewayWorkload}}, the deployment of the egress gateway, along with the parameters of
+	// DestinationServiceNamespace.
+	GatewayPromQueryFormat string
+	// ResponseBodyContains and ResponseBodyRegex, if set, must match the body of every response, proving that the
+	// payload passed through unmodified. Only the first maxResponseBodyCheckSize bytes of the body are checked.
+	ResponseBodyContains string
+	ResponseBodyRegex    string
+	// ConnectionsPromQueryFormat is the query counting the connections opened for a KeepAliveRequests case, such
+	// as istio_tcp_connections_opened_total. It is a template with the parameters of DestinationServiceNamespace.
+	ConnectionsPromQueryFormat string
+	// MaxNewConnections is the most connections a KeepAliveRequests case may open.
+	MaxNewConnections int
+	// NoServerErrors, if set, expects the source proxy to have reported no 5xx responses for the case's traffic,
+	// including requests that were retried until they succeeded. The responses are counted by
+	// istio_requests_total, scoped in the same way as PromQueryFormat.
+	NoServerErrors bool
+	// ConnectionSecurityPolicy, if set, expects the hop selected by ConnectionSecurityPromQueryFormat to have been
+	// reported with this connection_security_policy.
+	ConnectionSecurityPolicy ConnectionSecurityPolicy
+	// ConnectionSecurityPromQueryFormat selects the hop whose connection security is checked. Only the receiving end
+	// of a hop knows its connection security, so the query must select destination reported metrics. It is a
+	// template with the parameters of GatewayPromQueryFormat.
+	ConnectionSecurityPromQueryFormat string
+	// MaxRetries, if positive, is the most times the source proxy may have retried a request before it was
+	// served, as counted by the x-envoy-attempt-count header received by the destination. This catches retries
+	// being multiplied, such as by retry policies applied at several hops.
+	MaxRetries int
+	// EnvoyHeaders, if set, asserts which x-envoy-* and x-forwarded-* headers the destination received, as echoed
+	// back by it: headers mapped to true must be present, and headers mapped to false must have been stripped on
+	// the way.
+	EnvoyHeaders map[string]bool
+	// MinDistinctUpstreams, if set, sends RequestsPerUpstream requests per expected upstream and expects them to
+	// have been spread over at least this many replicas of the destination, as identified by the hostname echoed
+	// back in each response. This catches load balancing regressions that pin all traffic to a single endpoint.
+	MinDistinctUpstreams int
+	// LatencyQuantile, if set, expects a quantile of the durations of the case's requests, as reported by the source
+	// proxy in istio_request_duration_milliseconds, to stay under a threshold. The durations are scoped in the same
+	// way as NoServerErrors.
+	LatencyQuantile *LatencyQuantile
+}
+
+// LatencyQuantile is a latency SLO: the Quantile of the request durations over the last latencyWindow must not
+// exceed the Threshold.
+type LatencyQuantile struct {
+	// Quantile is between 0 and 1, such as 0.99 for the p99 latency.
+	Quantile  float64
+	Threshold time.Duration
+}
+
+// ConnectionSecurityPolicy is the connection_security_policy a hop is reported with.
+type ConnectionSecurityPolicy string
+
+const (
+	// MutualTLS is a hop secured by Istio mTLS.
+	MutualTLS ConnectionSecurityPolicy = "mutual_tls"
+	// NoConnectionSecurity is a plaintext hop, or one whose TLS was not terminated by the proxy.
+	NoConnectionSecurity ConnectionSecurityPolicy = "none"
+)
+
+var validConnectionSecurityPolicies = map[ConnectionSecurityPolicy]bool{
+	MutualTLS:            true,
+	NoConnectionSecurity: true,
+}
+
+// maxResponseBodyCheckSize bounds how much of a response body is checked against the expected content.
+const maxResponseBodyCheckSize = 64 * 1024
+
+// CheckResponseBody verifies that the response body has the expected content.
+func CheckResponseBody(expected Expected, r echoClient.Response) error {
+	body := r.RawContent
+	if len(body) > maxResponseBodyCheckSize {
+		body = body[:maxResponseBodyCheckSize]
+	}
+	if expected.ResponseBodyContains != "" && !strings.Contains(body, expected.ResponseBodyContains) {
+		return fmt.Errorf("response body does not contain %q: %s", expected.ResponseBodyContains, body)
+	}
+	if expected.ResponseBodyRegex != "" {
+		// The pattern was validated before the case ran.
+		if !regexp.MustCompile(expected.ResponseBodyRegex).MatchString(body) {
+			return fmt.Errorf("response body does not match %q: %s", expected.ResponseBodyRegex, body)
+		}
+	}
+	return nil
+}
+
+// BlockMode is how a blocked request is observed by the client.
+type BlockMode string
+
+const (
+	// BlockReset is a connection reset or closed by the proxy without a response.
+	BlockReset BlockMode = "reset"
+	// BlockTLSError is a failed TLS handshake.
+	BlockTLSError BlockMode = "tls_error"
+	// BlockHTTP502 is a 502 response from the proxy.
+	BlockHTTP502 BlockMode = "http_502"
+	// BlockAny is any of the above.
+	BlockAny BlockMode = "any_block"
+)
+
+var validBlockModes = map[BlockMode]bool{
+	BlockReset:    true,
+	BlockTLSError: true,
+	BlockHTTP502:  true,
+	BlockAny:      true,
+}
+
+// classifyBlock returns how a call was blocked, or an empty string if it was not.
+func classifyBlock(rs echoClient.Responses, err error) BlockMode {
+	if err == nil {
+		for _, r := range rs {
+			if r.Code == strconv.Itoa(http.StatusBadGateway) {
+				return BlockHTTP502
+			}
+		}
+		return ""
+	}
+	msg := strings.ToLower(err.Error())
+	// Check for resets first: a connection reset during the handshake is a reset, not a TLS error.
+	for _, s := range []string{"connection reset", "reset by peer", "broken pipe", "eof"} {
+		if strings.Contains(msg, s) {
+			return BlockReset
+		}
+	}
+	for _, s := range []string{"tls:", "handshake", "x509", "certificate"} {
+		if strings.Contains(msg, s) {
+			return BlockTLSError
+		}
+	}
+	return ""
+}
+
+// CheckBlockMode verifies that a call was blocked in the expected way.
+func CheckBlockMode(want BlockMode, rs echoClient.Responses, err error) error {
+	got := classifyBlock(rs, err)
+	switch {
+	case got == "":
+		return fmt.Errorf("expected request to be blocked (%s), but it was not: responses=%v, err=%v", want, rs, err)
+	case want != BlockAny && got != want:
+		return fmt.Errorf("expected request to be blocked by %s, got %s: %v", want, got, err)
+	}
+	return nil
+}
+
+// grpcStatusPattern matches the status code in the error of a failed gRPC call, as forwarded by the echo client.
+var grpcStatusPattern = regexp.MustCompile(`code = (\w+)`)
+
+// parseGRPCStatus parses the canonical name of a gRPC status code, such as UNAVAILABLE.
+func parseGRPCStatus(name string) (codes.Code, error) {
+	var c codes.Code
+	if err := c.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+		return 0, fmt.Errorf("unknown gRPC status %q", name)
+	}
+	return c, nil
+}
+
+// GRPCStatus returns the gRPC status code a call ended with. Calls that failed without a gRPC status, such as
+// those whose connection could not be established, are reported as Unknown.
+func GRPCStatus(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	m := grpcStatusPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return codes.Unknown
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == m[1] {
+			return c
+		}
+	}
+	return codes.Unknown
+}
+
+// CheckGRPCStatus verifies that a gRPC call ended with the expected status.
+func CheckGRPCStatus(want string, err error) error {
+	code, perr := parseGRPCStatus(want)
+	if perr != nil {
+		return perr
+	}
+	if got := GRPCStatus(err); got != code {
+		return fmt.Errorf("expected gRPC status %s, got %s: %v", code, got, err)
+	}
+	return nil
+}
+
+// validateGRPCStatus checks that GRPCStatus is a known status code, only expected of gRPC cases that are not
+// expected to be blocked at the transport.
+func validateGRPCStatus(tc *TestCase) error {
+	if tc.Expected.GRPCStatus == "" {
+		return nil
+	}
+	if _, err := parseGRPCStatus(tc.Expected.GRPCStatus); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(tc.PortName, "grpc") {
+		return fmt.Errorf("GRPCStatus only applies to gRPC cases, got port %q", tc.PortName)
+	}
+	if tc.Expected.BlockMode != "" {
+		return fmt.Errorf("GRPCStatus and BlockMode are mutually exclusive")
+	}
+	return nil
+}
+
+// EgressGatewayService returns the name of the egress gateway service for the gateway class, as reported in the
+// destination_service_name of requests routed through it.
+func EgressGatewayService(class resource.GatewayClass) string {
+	if class == resource.GatewayClassGatewayAPI {
+		return "egress-gateway"
+	}
+	return "istio-egressgateway"
+}
+
+// EgressGatewayWorkload returns the name of the egress gateway deployment for the gateway class, as reported in the
+// source_workload of the requests it forwards. istiod names the deployment of a gateway-api Gateway after the Gateway.
+func EgressGatewayWorkload(class resource.GatewayClass) string {
+	if class == resource.GatewayClassGatewayAPI {
+		return "egress-gateway"
+	}
+	return "istio-egressgateway"
+}
+
+// EgressGatewayApp returns the app label of the egress gateway pods for the gateway class, as reported in the
+// destination_app of requests routed through it. The pods istiod deploys for a gateway-api Gateway have no app label,
+// which Istio reports as unknown.
+func EgressGatewayApp(class resource.GatewayClass) string {
+	if class == resource.GatewayClassGatewayAPI {
+		return "unknown"
+	}
+	return "istio-egressgateway"
+}
+
+// ApplyPeerAuthentication applies a mesh-wide PeerAuthentication with the mode to the root namespace.
+func ApplyPeerAuthentication(cfg resource.ConfigManager, rootNamespace string, mode resource.PeerAuthMode) error {
+	b, err := tmpl.Evaluate(MeshPeerAuthentication, map[string]string{"Mode": strings.ToUpper(string(mode))})
+	if err != nil {
+		return err
+	}
+	if err := cfg.ApplyYAML(rootNamespace, b); err != nil {
+		return fmt.Errorf("failed to apply %s PeerAuthentication: %v", mode, err)
+	}
+	return nil
+}
+
+// ZonalEgressGatewaySkipReason returns why a case requiring a zonal egress gateway must be skipped, or "" if it can
+// run with the egress gateway deployed in the localities.
+func ZonalEgressGatewaySkipReason(tc *TestCase, localities sets.Set) string {
+	if !tc.RequiresZonalEgressGateway || (localities.Contains(ClientLocality) && localities.Contains(FailoverLocality)) {
+		return ""
+	}
+	return fmt.Sprintf("case %q requires an egress gateway with replicas in %s and %s, got %v", tc.Name,
+		ClientLocality, FailoverLocality, localities.SortedList())
+}
+
+// EgressGatewaySkipReason returns why the case must be skipped, or "" if it can run with the egress gateway
+// deployed or not.
+func EgressGatewaySkipReason(tc *TestCase, deployed bool) string {
+	if !tc.RequiresEgressGateway || deployed {
+		return ""
+	}
+	return fmt.Sprintf("case %q requires an egress gateway, but %s is not deployed", tc.Name,
+		EgressGatewayService(resource.GatewayClassIstio))
+}
+
+// ProtocolSkipReason returns why the case must be skipped under --istio.test.protocolFilter, or "" if it runs. A
+// case matches the filter by the protocol prefix of its port name, such as https for https-conflict, or by its
+// expected protocol, with every HTTP version matching http.
+func ProtocolSkipReason(tc *TestCase, filter sets.Set) string {
+	if filter.Empty() {
+		return ""
+	}
+	if tc.PortName != "" && filter.Contains(strings.ToLower(strings.SplitN(tc.PortName, "-", 2)[0])) {
+		return ""
+	}
+	if tc.Expected.Protocol != "" && filter.Contains(requestProtocol(tc.Expected.Protocol)) {
+		return ""
+	}
+	return fmt.Sprintf("case %q is not one of the protocols %v selected by --istio.test.protocolFilter", tc.Name,
+		filter.SortedList())
+}
+
+// CaseSetup calls the Setup hook of the case, if any, and returns the teardown to defer, which is never nil.
+func CaseSetup(t *testing.T, ctx framework.TestContext, serviceNamespace string, tc *TestCase) func() {
+	if tc.Setup == nil {
+		return func() {}
+	}
+	teardown := tc.Setup(t, ctx, serviceNamespace)
+	if teardown == nil {
+		return func() {}
+	}
+	return teardown
+}
+
+// ExpandHosts returns the cases with every case that sets Hosts replaced by a copy per host.
+func ExpandHosts(cases []*TestCase) []*TestCase {
+	out := make([]*TestCase, 0, len(cases))
+	for _, tc := range cases {
+		if len(tc.Hosts) == 0 {
+			out = append(out, tc)
+			continue
+		}
+		for _, host := range tc.Hosts {
+			c := *tc
+			c.Name = tc.Name + "/" + host
+			c.Host = host
+			c.Hosts = nil
+			out = append(out, &c)
+		}
+	}
+	return out
+}
+
+// Phase is a step of a lifecycle case: the config of the phase is changed, then the case's request is sent and
+// checked against the phase's expectations.
+type Phase struct {
+	Name string
+	// ApplyYAML, if set, is applied to the service namespace before the phase's request is sent. It is left in
+	// place for the following phases.
+	ApplyYAML string
+	// DeleteYAML, if set, is deleted from the service namespace before the phase's request is sent, such as config
+	// applied by an earlier phase.
+	DeleteYAML string
+	Expected   Expected
+}
+
+// PhaseCases returns the case of each phase: the given case, with the phase's expectations.
+func PhaseCases(tc *TestCase, phases []Phase) []*TestCase {
+	cases := make([]*TestCase, 0, len(phases))
+	for _, p := range phases {
+		c := *tc
+		c.Name = tc.Name + " " + p.Name
+		c.Expected = p.Expected
+		cases = append(cases, &c)
+	}
+	return cases
+}
+
+// ValidatePhases checks that the phases of a case can be run.
+func ValidatePhases(tc *TestCase, phases []Phase) error {
+	if len(phases) == 0 {
+		return fmt.Errorf("no phases")
+	}
+	if tc.ExpectDelta > 0 || tc.KeepAliveRequests > 0 {
+		return fmt.Errorf("ExpectDelta and KeepAliveRequests are not supported by phases")
+	}
+	if len(tc.Hosts) > 0 {
+		return fmt.Errorf("Hosts is not supported by phases")
+	}
+	names := map[string]bool{}
+	for _, p := range phases {
+		if p.Name == "" {
+			return fmt.Errorf("phases must be named")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate phase %q", p.Name)
+		}
+		names[p.Name] = true
+		for field, yaml := range map[string]string{"ApplyYAML": p.ApplyYAML, "DeleteYAML": p.DeleteYAML} {
+			if yaml == "" {
+				continue
+			}
+			if _, _, err := crd.ParseInputs(yaml); err != nil {
+				return fmt.Errorf("phase %q: invalid %s: %v", p.Name, field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// revisionSpecificLabels are the labels that are expected to differ between revisions serving the same traffic, and
+// are ignored when comparing their metrics.
+var revisionSpecificLabels = map[model.LabelName]bool{
+	"source_canonical_revision":      true,
+	"destination_canonical_revision": true,
+	"source_version":                 true,
+	"destination_version":            true,
+	"instance":                       true,
+	"pod":                            true,
+	"pod_name":                       true,
+	"kubernetes_pod_name":            true,
+}
+
+// SeriesQuery returns the selector summed by a case's metric query, which lists the series behind the sum.
+func SeriesQuery(query string) (string, error) {
+	q := strings.TrimSpace(query)
+	if !strings.HasPrefix(q, "sum(") || !strings.HasSuffix(q, ")") {
+		return "", fmt.Errorf("query %q is not a sum of a selector", query)
+	}
+	return q[len("sum(") : len(q)-1], nil
+}
+
+// IncreasedSeries returns the sorted label sets of the series whose value increased between the two samples,
+// without their revision specific labels.
+func IncreasedSeries(before, after model.Vector) []string {
+	prev := map[model.Fingerprint]model.SampleValue{}
+	for _, s := range before {
+		prev[s.Metric.Fingerprint()] = s.Value
+	}
+	set := map[string]bool{}
+	for _, s := range after {
+		// The placeholder for an empty result has no labels.
+		if len(s.Metric) == 0 || s.Value <= prev[s.Metric.Fingerprint()] {
+			continue
+		}
+		m := model.Metric{}
+		for k, v := range s.Metric {
+			if !revisionSpecificLabels[k] {
+				m[k] = v
+			}
+		}
+		set[m.String()] = true
+	}
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CheckRevisionParity compares the series of each revision with those of the first, in order of revision name.
+func CheckRevisionParity(series map[string][]string) error {
+	revisions := make([]string, 0, len(series))
+	for rev := range series {
+		revisions = append(revisions, rev)
+	}
+	sort.Strings(revisions)
+	for i := 1; i < len(revisions); i++ {
+		rev := revisions[i]
+		if diff := cmp.Diff(series[revisions[0]], series[rev]); diff != "" {
+			return fmt.Errorf("metrics of revision %q differ from revision %q (-%s +%s):\n%s",
+				rev, revisions[0], revisions[0], rev, diff)
+		}
+	}
+	return nil
+}
+
+// latencyWindow is the range the request durations of a LatencyQuantile case are taken over.
+const latencyWindow = "5m"
+
+// LatencyQuantileQuery returns the PromQL for the quantile of the request durations reported by the source proxy,
+// in milliseconds, scoped by the matchers.
+func LatencyQuantileQuery(lq LatencyQuantile, matchers []string) string {
+	buckets := WithLabelMatchers(fmt.Sprintf(
+		`sum by (le) (rate(istio_request_duration_milliseconds_bucket{reporter="source"}[%s]))`, latencyWindow),
+		matchers...)
+	return fmt.Sprintf("histogram_quantile(%v, %s)", lq.Quantile, buckets)
+}
+
+// validateLatencyQuantile checks that the latency SLO of a case, if any, can be asserted.
+func validateLatencyQuantile(tc *TestCase) error {
+	lq := tc.Expected.LatencyQuantile
+	if lq == nil {
+		return nil
+	}
+	if lq.Quantile <= 0 || lq.Quantile > 1 {
+		return fmt.Errorf("LatencyQuantile quantile must be in (0, 1], got %v", lq.Quantile)
+	}
+	if lq.Threshold <= 0 {
+		return fmt.Errorf("LatencyQuantile threshold must be positive, got %v", lq.Threshold)
+	}
+	if tc.Expected.Metric == "" {
+		return fmt.Errorf("LatencyQuantile requires a Metric")
+	}
+	return nil
+}
+
+// CheckLatencyQuantile verifies that the observed request duration quantile stays under the threshold.
+func CheckLatencyQuantile(got time.Duration, lq LatencyQuantile) error {
+	if got > lq.Threshold {
+		return fmt.Errorf("p%v latency of %v exceeds the threshold of %v", lq.Quantile*100, got, lq.Threshold)
+	}
+	return nil
+}
+
+// PromQuery returns the PromQL used to validate the case's metric. The query is evaluated as a template against
+// the params, and the case's label matchers are added to its selector.
+func PromQuery(t *testing.T, tc *TestCase, params map[string]string) string {
+	return WithLabelMatchers(tmpl.EvaluateOrFail(t, tc.Expected.PromQueryFormat, params), CaseMatchers(t, tc, params)...)
+}
+
+// CaseMatchers returns the label matchers for the destination service namespace, source identity, cluster,
+// destination app, protocol and localities the case expects.
+func CaseMatchers(t *testing.T, tc *TestCase, params map[string]string) []string {
+	var matchers []string
+	if tc.Expected.DestinationServiceNamespace != "" {
+		ns := tmpl.EvaluateOrFail(t, tc.Expected.DestinationServiceNamespace, params)
+		matchers = append(matchers, fmt.Sprintf("destination_service_namespace=%q", ns))
+	}
+	if tc.Expected.SourceWorkload != "" {
+		matchers = append(matchers, fmt.Sprintf("source_workload=%q", tc.Expected.SourceWorkload))
+	}
+	if tc.Expected.SourceApp != "" {
+		matchers = append(matchers, fmt.Sprintf("source_app=%q", tc.Expected.SourceApp))
+	}
+	if tc.Expected.Cluster != "" {
+		matchers = append(matchers, negatableMatcher("destination_service_name", tc.Expected.Cluster))
+	}
+	if tc.Expected.DestinationApp != "" {
+		app := tmpl.EvaluateOrFail(t, tc.Expected.DestinationApp, params)
+		matchers = append(matchers, fmt.Sprintf("destination_app=%q", app))
+	}
+	if tc.Expected.UpstreamProtocol != "" && tc.Expected.Protocol != "" {
+		matchers = append(matchers, fmt.Sprintf("request_protocol=%q", requestProtocol(tc.Expected.Protocol)))
+	}
+	if tc.Expected.SourceLocality != "" {
+		locality := tmpl.EvaluateOrFail(t, tc.Expected.SourceLocality, params)
+		matchers = append(matchers, negatableMatcher("source_locality", locality))
+	}
+	if tc.Expected.DestinationLocality != "" {
+		locality := tmpl.EvaluateOrFail(t, tc.Expected.DestinationLocality, params)
+		matchers = append(matchers, negatableMatcher("destination_locality", locality))
+	}
+	return matchers
+}
+
+// negatableMatcher returns the matcher of the label for the value, or of any other value if it is prefixed with "!".
+func negatableMatcher(label, value string) string {
+	if v := strings.TrimPrefix(value, "!"); v != value {
+		return fmt.Sprintf("%s!=%q", label, v)
+	}
+	return fmt.Sprintf("%s=%q", label, value)
+}
+
+// requestProtocol returns the request_protocol label Istio reports for requests sent over the protocol.
+func requestProtocol(protocol string) string {
+	if strings.HasPrefix(protocol, "HTTP/") {
+		return "http"
+	}
+	return strings.ToLower(protocol)
+}
+
+// WithLabelMatchers adds the matchers to the first label selector in the query.
+func WithLabelMatchers(query string, matchers ...string) string {
+	i := strings.Index(query, "{")
+	if i < 0 || len(matchers) == 0 {
+		return query
+	}
+	m := strings.Join(matchers, ",")
+	if strings.HasPrefix(query[i+1:], "}") {
+		return query[:i+1] + m + query[i+1:]
+	}
+	return query[:i+1] + m + "," + query[i+1:]
+}
+
+// ValidateCase checks that the config carried by the test case is valid before any of it is applied.
+func ValidateCase(tc *TestCase) error {
+	if err := validatePort(tc); err != nil {
+		return err
+	}
+	if tc.Expected.BlockMode != "" && !validBlockModes[tc.Expected.BlockMode] {
+		return fmt.Errorf("unknown BlockMode %q", tc.Expected.BlockMode)
+	}
+	if tc.Expected.BlockMode != "" && tc.Expected.StatusCode != 0 {
+		return fmt.Errorf("BlockMode and StatusCode are mutually exclusive")
+	}
+	if tc.Expected.ResponseBodyRegex != "" {
+		if _, err := regexp.Compile(tc.Expected.ResponseBodyRegex); err != nil {
+			return fmt.Errorf("invalid ResponseBodyRegex: %v", err)
+		}
+	}
+	if tc.ExpectDelta < 0 {
+		return fmt.Errorf("ExpectDelta must not be negative, got %d", tc.ExpectDelta)
+	}
+	if tc.ExpectDelta > 0 && tc.Expected.Metric == "" {
+		return fmt.Errorf("ExpectDelta requires a Metric")
+	}
+	if err := validateKeepAlive(tc); err != nil {
+		return err
+	}
+	if tc.Expected.ExpectedSNI != "" && !strings.HasPrefix(tc.PortName, "https") {
+		return fmt.Errorf("ExpectedSNI only applies to HTTPS cases, got port %s", tc.PortName)
+	}
+	if err := validateConnectionSecurity(tc.Expected); err != nil {
+		return err
+	}
+	if tc.Expected.MaxRetries < 0 {
+		return fmt.Errorf("MaxRetries must not be negative, got %d", tc.Expected.MaxRetries)
+	}
+	if tc.Expected.MaxRetries > 0 && tc.Expected.BlockMode != "" {
+		return fmt.Errorf("MaxRetries does not apply to blocked requests")
+	}
+	if tc.Expected.NoServerErrors && tc.Expected.Metric == "" {
+		return fmt.Errorf("NoServerErrors requires a Metric")
+	}
+	if err := validateEnvoyHeaders(tc.Expected.EnvoyHeaders); err != nil {
+		return err
+	}
+	if err := validateMinDistinctUpstreams(tc); err != nil {
+		return err
+	}
+	if err := validateHosts(tc); err != nil {
+		return err
+	}
+	if err := validateUpstreamProtocol(tc); err != nil {
+		return err
+	}
+	if err := validateLocality(tc); err != nil {
+		return err
+	}
+	if err := validateGRPCStatus(tc); err != nil {
+		return err
+	}
+	if err := validateLatencyQuantile(tc); err != nil {
+		return err
+	}
+	if err := validateCaseConfig("DestinationRuleYAML", tc.DestinationRuleYAML, gvk.DestinationRule); err != nil {
+		return err
+	}
+	if err := validateCaseConfig("VirtualServiceYAML", tc.VirtualServiceYAML, gvk.VirtualService); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateLocality checks that localities are only expected of the istio_requests_total reported by the client,
+// the only metric LocalityTelemetry adds them to.
+func validateLocality(tc *TestCase) error {
+	if tc.Expected.SourceLocality == "" && tc.Expected.DestinationLocality == "" {
+		return nil
+	}
+	if tc.Expected.Metric != "istio_requests_total" {
+		return fmt.Errorf("SourceLocality and DestinationLocality require the istio_requests_total Metric, got %q",
+			tc.Expected.Metric)
+	}
+	if !strings.Contains(tc.Expected.PromQueryFormat, `reporter="source"`) {
+		return fmt.Errorf("SourceLocality and DestinationLocality require a PromQueryFormat of reporter=\"source\"")
+	}
+	return nil
+}
+
+// UsesLocality returns true if any of the cases expects a locality.
+func UsesLocality(cases []*TestCase) bool {
+	for _, tc := range cases {
+		if tc.Expected.SourceLocality != "" || tc.Expected.DestinationLocality != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateUpstreamProtocol checks that UpstreamProtocol is only expected of HTTP cases, whose client protocol is set.
+func validateUpstreamProtocol(tc *TestCase) error {
+	if tc.Expected.UpstreamProtocol == "" {
+		return nil
+	}
+	if !strings.HasPrefix(tc.Expected.UpstreamProtocol, "HTTP/") {
+		return fmt.Errorf("UpstreamProtocol must be an HTTP protocol, got %q", tc.Expected.UpstreamProtocol)
+	}
+	client := "HTTP/1.1"
+	if tc.HTTP2 {
+		client = "HTTP/2.0"
+	}
+	if tc.Expected.Protocol != client {
+		return fmt.Errorf("Protocol must be the %s the client sends, got %q", client, tc.Expected.Protocol)
+	}
+	return nil
+}
+
+// validateHosts checks that the hosts of a case fanned out over Hosts are set and distinct.
+func validateHosts(tc *TestCase) error {
+	if len(tc.Hosts) > 0 && tc.Host != "" {
+		return fmt.Errorf("Host and Hosts are mutually exclusive")
+	}
+	seen := map[string]bool{}
+	for _, host := range tc.Hosts {
+		if host == "" {
+			return fmt.Errorf("Hosts must not contain empty hosts")
+		}
+		if seen[host] {
+			return fmt.Errorf("duplicate host %q", host)
+		}
+		seen[host] = true
+	}
+	return nil
+}
+
+// validateMinDistinctUpstreams checks that a MinDistinctUpstreams case controls how many requests it sends.
+func validateMinDistinctUpstreams(tc *TestCase) error {
+	switch {
+	case tc.Expected.MinDistinctUpstreams < 0:
+		return fmt.Errorf("MinDistinctUpstreams must not be negative, got %d", tc.Expected.MinDistinctUpstreams)
+	case tc.Expected.MinDistinctUpstreams == 0:
+		return nil
+	case tc.ExpectDelta > 0 || tc.KeepAliveRequests > 0:
+		return fmt.Errorf("MinDistinctUpstreams cannot be used with ExpectDelta or KeepAliveRequests")
+	case tc.Expected.BlockMode != "":
+		return fmt.Errorf("MinDistinctUpstreams does not apply to blocked requests")
+	}
+	return nil
+}
+
+// validateCaseConfig checks that the config of the named TestCase field parses and only contains the given kind.
+func validateCaseConfig(field, yaml string, kind config.GroupVersionKind) error {
+	if yaml == "" {
+		return nil
+	}
+	configs, unknown, err := crd.ParseInputs(yaml)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", field, err)
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%s contains unknown kinds %v", field, unknown)
+	}
+	for _, c := range configs {
+		if c.GroupVersionKind != kind {
+			return fmt.Errorf("%s contains a %s, only %ss are allowed", field, c.GroupVersionKind.Kind, kind.Kind)
+		}
+	}
+	return nil
+}
+
+// validateConnectionSecurity checks that a case expecting a connection security policy names a known one, and has a
+// hop to check it against.
+func validateConnectionSecurity(expected Expected) error {
+	if expected.ConnectionSecurityPolicy == "" {
+		if expected.ConnectionSecurityPromQueryFormat != "" {
+			return fmt.Errorf("ConnectionSecurityPromQueryFormat requires a ConnectionSecurityPolicy")
+		}
+		return nil
+	}
+	if !validConnectionSecurityPolicies[expected.ConnectionSecurityPolicy] {
+		return fmt.Errorf("unknown ConnectionSecurityPolicy %q", expected.ConnectionSecurityPolicy)
+	}
+	if expected.ConnectionSecurityPromQueryFormat == "" {
+		return fmt.Errorf("ConnectionSecurityPolicy requires a ConnectionSecurityPromQueryFormat")
+	}
+	if expected.Metric == "" {
+		return fmt.Errorf("ConnectionSecurityPolicy requires a Metric")
+	}
+	return nil
+}
+
+// validateKeepAlive checks that a KeepAliveRequests case has a connection count to check, and a ceiling that
+// proves reuse.
+func validateKeepAlive(tc *TestCase) error {
+	if tc.KeepAliveRequests < 0 {
+		return fmt.Errorf("KeepAliveRequests must not be negative, got %d", tc.KeepAliveRequests)
+	}
+	if tc.KeepAliveRequests == 0 {
+		return nil
+	}
+	if tc.ExpectDelta > 0 {
+		return fmt.Errorf("KeepAliveRequests and ExpectDelta are mutually exclusive")
+	}
+	if tc.Expected.ConnectionsPromQueryFormat == "" {
+		return fmt.Errorf("KeepAliveRequests requires a ConnectionsPromQueryFormat")
+	}
+	if tc.Expected.MaxNewConnections <= 0 || tc.Expected.MaxNewConnections >= tc.KeepAliveRequests {
+		return fmt.Errorf("MaxNewConnections must be between 1 and KeepAliveRequests-1, got %d", tc.Expected.MaxNewConnections)
+	}
+	return nil
+}
+
+// validatePort checks that the case selects a destination port.
+func validatePort(tc *TestCase) error {
+	if tc.PortName == "" && tc.Port == 0 {
+		return fmt.Errorf("one of PortName or Port is required")
+	}
+	if tc.Port < 0 || tc.Port > 65535 {
+		return fmt.Errorf("invalid Port %d", tc.Port)
+	}
+	return nil
+}
+
+// CasePort returns the destination port the case selects, by PortName if set, and otherwise by Port.
+func CasePort(ports []echo.Port, tc *TestCase) (echo.Port, error) {
+	for _, port := range ports {
+		if tc.PortName != "" && port.Name == tc.PortName {
+			return port, nil
+		}
+		if tc.PortName == "" && port.ServicePort == tc.Port {
+			return port, nil
+		}
+	}
+	if tc.PortName != "" {
+		return echo.Port{}, fmt.Errorf("no port named %s", tc.PortName)
+	}
+	return echo.Port{}, fmt.Errorf("no port numbered %d", tc.Port)
+}
+
+// CheckConnectionReuse verifies that the requests opened no more than max connections.
+func CheckConnectionReuse(opened float64, requests, max int) error {
+	if opened > float64(max) {
+		return fmt.Errorf("%v connections opened for %d requests, expected at most %d: connections are not being reused",
+			opened, requests, max)
+	}
+	return nil
+}
+
+// CheckDelta verifies that the metric increased by exactly want from the baseline.
+func CheckDelta(baseline, got float64, want int) error {
+	if delta := got - baseline; delta != float64(want) {
+		return fmt.Errorf("bad metric delta: got %v (from %v to %v), want %d", delta, baseline, got, want)
+	}
+	return nil
+}
+
+// attemptCountHeader is set by the source proxy on every attempt of a request, starting at 1.
+const attemptCountHeader = "X-Envoy-Attempt-Count"
+
+const (
+	// ClientLocality is the locality the client is deployed in, in the format of the istio-locality label. Cases
+	// refer to it as {{.ClientLocality}}.
+	ClientLocality = "region.zone.subzone"
+	// FailoverLocality is another zone of the client's region, which zonal egress gateways also have replicas in.
+	// Cases refer to it as {{.FailoverLocality}}.
+	FailoverLocality = "region.failover.subzone"
+)
+
+// InternalHeader is a header the egress gateway strips before forwarding requests to some-external-site.com, so
+// that internal details don't leak out of the mesh.
+const InternalHeader = "x-forwarded-user"
+
+// envoyHeaderPrefixes are the prefixes of the headers Expected.EnvoyHeaders may assert.
+var envoyHeaderPrefixes = []string{"x-envoy-", "x-forwarded-"}
+
+// CheckEnvoyHeaders verifies that the destination received the expected headers, and none of the stripped ones.
+func CheckEnvoyHeaders(r echoClient.Response, expected map[string]bool) error {
+	names := make([]string, 0, len(expected))
+	for k := range expected {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		got := r.RequestHeaders.Get(k)
+		if expected[k] && got == "" {
+			return fmt.Errorf("destination did not receive the %s header", k)
+		}
+		if !expected[k] && got != "" {
+			return fmt.Errorf("destination received the %s header %q, expected it to be stripped", k, got)
+		}
+	}
+	return nil
+}
+
+// validateEnvoyHeaders checks that Expected.EnvoyHeaders only asserts headers added or stripped by the proxies.
+func validateEnvoyHeaders(headers map[string]bool) error {
+	for k := range headers {
+		valid := false
+		for _, prefix := range envoyHeaderPrefixes {
+			if strings.HasPrefix(strings.ToLower(k), prefix) {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("EnvoyHeaders may only contain x-envoy-* and x-forwarded-* headers, got %q", k)
+		}
+	}
+	return nil
+}
+
+// CheckRetries verifies that the response was served within maxRetries retries.
+func CheckRetries(r echoClient.Response, maxRetries int) error {
+	v := r.RequestHeaders.Get(attemptCountHeader)
+	if v == "" {
+		return fmt.Errorf("destination did not receive the %s header", attemptCountHeader)
+	}
+	attempts, err := strconv.Atoi(v)
+	if err != nil || attempts < 1 {
+		return fmt.Errorf("invalid %s header %q", attemptCountHeader, v)
+	}
+	if retries := attempts - 1; retries > maxRetries {
+		return fmt.Errorf("served after %d retries, expected at most %d", retries, maxRetries)
+	}
+	return nil
+}
+
+// RequestsPerUpstream is how many requests a MinDistinctUpstreams case sends per upstream it expects to reach.
+const RequestsPerUpstream = 10
+
+// CheckDistinctUpstreams verifies that the responses were served by at least min distinct upstreams.
+func CheckDistinctUpstreams(rs echoClient.Responses, min int) error {
+	hosts := map[string]bool{}
+	for _, r := range rs {
+		if r.Hostname != "" {
+			hosts[r.Hostname] = true
+		}
+	}
+	if len(hosts) < min {
+		return fmt.Errorf("%d requests were served by %d distinct upstreams, expected at least %d",
+			len(rs), len(hosts), min)
+	}
+	return nil
+}
+
+// CheckNoServerErrors verifies that no 5xx responses were counted since the baseline.
+func CheckNoServerErrors(baseline, got float64) error {
+	if delta := got - baseline; delta != 0 {
+		return fmt.Errorf("observed %v 5xx responses (from %v to %v), want none", delta, baseline, got)
+	}
+	return nil
+}
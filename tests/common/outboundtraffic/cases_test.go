@@ -0,0 +1,1145 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outboundtraffic
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	securityBeta "istio.io/api/security/v1beta1"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config/schema/gvk"
+	echoClient "istio.io/istio/pkg/test/echo"
+	"istio.io/istio/pkg/test/framework"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/resource"
+)
+
+func TestPromQuery(t *testing.T) {
+	const base = `sum(istio_requests_total{destination_service_name="*.example.com",response_code="200"})`
+	params := map[string]string{
+		"AppNamespace":     "app-1",
+		"ServiceNamespace": "service-1",
+		"EgressGatewayApp": "istio-egressgateway",
+		"ClientLocality":   ClientLocality,
+		"FailoverLocality": FailoverLocality,
+	}
+	cases := []struct {
+		name           string
+		query          string
+		namespace      string
+		sourceWorkload string
+		sourceApp      string
+		cluster        string
+		destinationApp string
+		protocol       string
+		upstream       string
+		sourceLoc      string
+		destLoc        string
+		want           string
+	}{
+		{
+			name:  "no namespace",
+			query: base,
+			want:  base,
+		},
+		{
+			name:      "service namespace",
+			query:     base,
+			namespace: "{{.ServiceNamespace}}",
+			want: `sum(istio_requests_total{destination_service_namespace="service-1",` +
+				`destination_service_name="*.example.com",response_code="200"})`,
+		},
+		{
+			name:      "app namespace",
+			query:     base,
+			namespace: "{{.AppNamespace}}",
+			want: `sum(istio_requests_total{destination_service_namespace="app-1",` +
+				`destination_service_name="*.example.com",response_code="200"})`,
+		},
+		{
+			name:      "empty selector",
+			query:     `sum(istio_requests_total{})`,
+			namespace: "{{.ServiceNamespace}}",
+			want:      `sum(istio_requests_total{destination_service_namespace="service-1"})`,
+		},
+		{
+			name:           "source identity",
+			query:          base,
+			sourceWorkload: "client-v1",
+			sourceApp:      "client",
+			want: `sum(istio_requests_total{source_workload="client-v1",source_app="client",` +
+				`destination_service_name="*.example.com",response_code="200"})`,
+		},
+		{
+			name:    "cluster",
+			query:   `sum(istio_requests_total{response_code="200"})`,
+			cluster: PassthroughCluster,
+			want:    `sum(istio_requests_total{destination_service_name="PassthroughCluster",response_code="200"})`,
+		},
+		{
+			name:    "not cluster",
+			query:   `sum(istio_requests_total{response_code="200"})`,
+			cluster: "!" + PassthroughCluster,
+			want:    `sum(istio_requests_total{destination_service_name!="PassthroughCluster",response_code="200"})`,
+		},
+		{
+			name:           "destination app",
+			query:          `sum(istio_requests_total{destination_service_name="istio-egressgateway"})`,
+			destinationApp: "{{.EgressGatewayApp}}",
+			want: `sum(istio_requests_total{destination_app="istio-egressgateway",` +
+				`destination_service_name="istio-egressgateway"})`,
+		},
+		{
+			name:     "client protocol of a downgrade",
+			query:    `sum(istio_requests_total{response_code="200"})`,
+			protocol: "HTTP/2.0",
+			upstream: "HTTP/1.1",
+			want:     `sum(istio_requests_total{request_protocol="http",response_code="200"})`,
+		},
+		{
+			name:     "client protocol without upstream protocol",
+			query:    `sum(istio_requests_total{response_code="200"})`,
+			protocol: "HTTP/2.0",
+			want:     `sum(istio_requests_total{response_code="200"})`,
+		},
+		{
+			name:      "same zone",
+			query:     `sum(istio_requests_total{reporter="source"})`,
+			sourceLoc: "{{.ClientLocality}}",
+			destLoc:   "{{.ClientLocality}}",
+			want: `sum(istio_requests_total{source_locality="region.zone.subzone",` +
+				`destination_locality="region.zone.subzone",reporter="source"})`,
+		},
+		{
+			name:    "failover zone",
+			query:   `sum(istio_requests_total{reporter="source"})`,
+			destLoc: "{{.FailoverLocality}}",
+			want:    `sum(istio_requests_total{destination_locality="region.failover.subzone",reporter="source"})`,
+		},
+		{
+			name:    "not the client zone",
+			query:   `sum(istio_requests_total{reporter="source"})`,
+			destLoc: "!{{.ClientLocality}}",
+			want:    `sum(istio_requests_total{destination_locality!="region.zone.subzone",reporter="source"})`,
+		},
+		{
+			name:           "all matchers",
+			query:          `sum(istio_requests_total{})`,
+			namespace:      "{{.AppNamespace}}",
+			sourceWorkload: "client-v1",
+			sourceApp:      "client",
+			want:           `sum(istio_requests_total{destination_service_namespace="app-1",source_workload="client-v1",source_app="client"})`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := PromQuery(t, &TestCase{Expected: Expected{
+				PromQueryFormat:             tc.query,
+				DestinationServiceNamespace: tc.namespace,
+				SourceWorkload:              tc.sourceWorkload,
+				SourceApp:                   tc.sourceApp,
+				Cluster:                     tc.cluster,
+				DestinationApp:              tc.destinationApp,
+				Protocol:                    tc.protocol,
+				UpstreamProtocol:            tc.upstream,
+				SourceLocality:              tc.sourceLoc,
+				DestinationLocality:         tc.destLoc,
+			}}, params)
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClassifyBlock(t *testing.T) {
+	cases := []struct {
+		name string
+		rs   echoClient.Responses
+		err  error
+		want BlockMode
+	}{
+		{
+			name: "success",
+			rs:   echoClient.Responses{{Code: "200"}},
+		},
+		{
+			name: "502",
+			rs:   echoClient.Responses{{Code: "502"}},
+			want: BlockHTTP502,
+		},
+		{
+			name: "reset",
+			err:  errors.New("read tcp 10.0.0.1:5000->10.0.0.2:9090: read: connection reset by peer"),
+			want: BlockReset,
+		},
+		{
+			name: "closed",
+			err:  errors.New(`Get "http://destination:80": EOF`),
+			want: BlockReset,
+		},
+		{
+			name: "reset during handshake",
+			err:  errors.New("tls handshake: read: connection reset by peer"),
+			want: BlockReset,
+		},
+		{
+			name: "tls error",
+			err:  errors.New("tls: first record does not look like a TLS handshake"),
+			want: BlockTLSError,
+		},
+		{
+			name: "unclassified error",
+			err:  errors.New("context deadline exceeded"),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := classifyBlock(tc.rs, tc.err); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	if err := CheckBlockMode(BlockAny, nil, errors.New("connection reset by peer")); err != nil {
+		t.Errorf("expected any block to match a reset: %v", err)
+	}
+	if err := CheckBlockMode(BlockTLSError, nil, errors.New("connection reset by peer")); err == nil {
+		t.Error("expected a reset not to match a TLS error")
+	}
+	if err := CheckBlockMode(BlockAny, echoClient.Responses{{Code: "200"}}, nil); err == nil {
+		t.Error("expected an unblocked request not to match")
+	}
+}
+
+func TestCheckDelta(t *testing.T) {
+	// Two consecutive cases against the same cumulative counter: the first sends 5 requests, the second 3.
+	// Asserting the absolute value would let the second case pass on the first case's traffic alone.
+	if err := CheckDelta(0, 5, 5); err != nil {
+		t.Errorf("first case: %v", err)
+	}
+	if err := CheckDelta(5, 8, 3); err != nil {
+		t.Errorf("second case: %v", err)
+	}
+	if err := CheckDelta(5, 5, 3); err == nil {
+		t.Error("expected the second case to fail when none of its requests were counted")
+	}
+	if err := CheckDelta(5, 9, 3); err == nil {
+		t.Error("expected the second case to fail when more requests than it sent were counted")
+	}
+}
+
+func TestCheckNoServerErrors(t *testing.T) {
+	if err := CheckNoServerErrors(4, 4); err != nil {
+		t.Errorf("expected no new 5xx to pass: %v", err)
+	}
+	// A request that failed with a 503 and then succeeded on retry still counts.
+	if err := CheckNoServerErrors(4, 5); err == nil {
+		t.Error("expected a 5xx during the case to fail it")
+	}
+}
+
+func TestEgressGatewaySkipReason(t *testing.T) {
+	egress := &TestCase{Name: "HTTP Traffic Egress", RequiresEgressGateway: true}
+	passthrough := &TestCase{Name: "HTTP Traffic"}
+	if reason := EgressGatewaySkipReason(egress, true); reason != "" {
+		t.Errorf("expected an egress case to run with the gateway deployed, got skip %q", reason)
+	}
+	if reason := EgressGatewaySkipReason(egress, false); !strings.Contains(reason, "istio-egressgateway") {
+		t.Errorf("expected an egress case to be skipped naming the missing gateway, got %q", reason)
+	}
+	for _, deployed := range []bool{true, false} {
+		if reason := EgressGatewaySkipReason(passthrough, deployed); reason != "" {
+			t.Errorf("expected a case not requiring the gateway to run (deployed=%v), got skip %q", deployed, reason)
+		}
+	}
+}
+
+func TestEgressGatewayNames(t *testing.T) {
+	for _, tc := range []struct {
+		class                  resource.GatewayClass
+		service, workload, app string
+	}{
+		{class: resource.GatewayClassIstio, service: "istio-egressgateway", workload: "istio-egressgateway", app: "istio-egressgateway"},
+		{class: resource.GatewayClassGatewayAPI, service: "egress-gateway", workload: "egress-gateway", app: "unknown"},
+	} {
+		if got := EgressGatewayService(tc.class); got != tc.service {
+			t.Errorf("%s: expected service %q, got %q", tc.class, tc.service, got)
+		}
+		if got := EgressGatewayWorkload(tc.class); got != tc.workload {
+			t.Errorf("%s: expected workload %q, got %q", tc.class, tc.workload, got)
+		}
+		if got := EgressGatewayApp(tc.class); got != tc.app {
+			t.Errorf("%s: expected app %q, got %q", tc.class, tc.app, got)
+		}
+	}
+}
+
+func TestSeriesQuery(t *testing.T) {
+	got, err := SeriesQuery(`sum(istio_requests_total{reporter="source"})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `istio_requests_total{reporter="source"}`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if _, err := SeriesQuery(`rate(istio_requests_total[1m])`); err == nil {
+		t.Error("expected a query that is not a sum to be rejected")
+	}
+}
+
+func TestRevisionParity(t *testing.T) {
+	sample := func(value float64, labels ...string) *model.Sample {
+		m := model.Metric{}
+		for i := 0; i < len(labels); i += 2 {
+			m[model.LabelName(labels[i])] = model.LabelValue(labels[i+1])
+		}
+		return &model.Sample{Metric: m, Value: model.SampleValue(value)}
+	}
+	// Both revisions' traffic is counted by the same source series; only the revision labels differ.
+	before := model.Vector{
+		sample(4, "response_code", "200", "source_canonical_revision", "v1", "pod", "client-a"),
+		sample(2, "response_code", "503", "source_canonical_revision", "v1", "pod", "client-a"),
+	}
+	canary := IncreasedSeries(before, model.Vector{
+		sample(7, "response_code", "200", "source_canonical_revision", "v1", "pod", "client-a"),
+		sample(2, "response_code", "503", "source_canonical_revision", "v1", "pod", "client-a"),
+	})
+	stable := IncreasedSeries(model.Vector{sample(0)}, model.Vector{
+		sample(3, "response_code", "200", "source_canonical_revision", "v2", "pod", "client-b"),
+	})
+	if want := []string{`{response_code="200"}`}; !reflect.DeepEqual(canary, want) {
+		t.Errorf("expected only the increased series %v, got %v", want, canary)
+	}
+	if err := CheckRevisionParity(map[string][]string{"canary": canary, "stable": stable}); err != nil {
+		t.Errorf("expected revisions differing only in revision labels to match: %v", err)
+	}
+
+	// A regression in one revision reports its traffic with a different response flag.
+	regressed := IncreasedSeries(nil, model.Vector{
+		sample(3, "response_code", "200", "response_flags", "DC", "source_canonical_revision", "v2"),
+	})
+	err := CheckRevisionParity(map[string][]string{"canary": canary, "stable": regressed})
+	if err == nil || !strings.Contains(err.Error(), `response_flags="DC"`) {
+		t.Errorf("expected a diff naming the differing label, got %v", err)
+	}
+}
+
+func TestValidateConnectionSecurity(t *testing.T) {
+	const query = `sum(istio_requests_total{reporter="destination"})`
+	cases := []struct {
+		name      string
+		expected  Expected
+		expectErr bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "mutual tls",
+			expected: Expected{
+				Metric:                            "istio_requests_total",
+				ConnectionSecurityPolicy:          MutualTLS,
+				ConnectionSecurityPromQueryFormat: query,
+			},
+		},
+		{
+			name: "unknown policy",
+			expected: Expected{
+				Metric:                            "istio_requests_total",
+				ConnectionSecurityPolicy:          "tls",
+				ConnectionSecurityPromQueryFormat: query,
+			},
+			expectErr: true,
+		},
+		{
+			name: "no hop",
+			expected: Expected{
+				Metric:                   "istio_requests_total",
+				ConnectionSecurityPolicy: NoConnectionSecurity,
+			},
+			expectErr: true,
+		},
+		{
+			name: "hop without policy",
+			expected: Expected{
+				Metric:                            "istio_requests_total",
+				ConnectionSecurityPromQueryFormat: query,
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateConnectionSecurity(tc.expected)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckResponseBody(t *testing.T) {
+	r := echoClient.Response{RawContent: "ServiceVersion=v1\nURL=/outbound-payload-check?marker=passthrough\nMethod=GET\n"}
+	cases := []struct {
+		name      string
+		expected  Expected
+		expectErr bool
+	}{
+		{
+			name: "nothing expected",
+		},
+		{
+			name:     "contains",
+			expected: Expected{ResponseBodyContains: "URL=/outbound-payload-check?marker=passthrough"},
+		},
+		{
+			name:      "rewritten",
+			expected:  Expected{ResponseBodyContains: "URL=/outbound-payload-check?marker=rewritten"},
+			expectErr: true,
+		},
+		{
+			name:     "regex",
+			expected: Expected{ResponseBodyRegex: `(?m)^Method=GET$`},
+		},
+		{
+			name:      "regex mismatch",
+			expected:  Expected{ResponseBodyRegex: `(?m)^Method=POST$`},
+			expectErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckResponseBody(tc.expected, r)
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+
+	// Content beyond the size bound is not read.
+	large := echoClient.Response{RawContent: strings.Repeat("a", maxResponseBodyCheckSize) + "marker"}
+	if err := CheckResponseBody(Expected{ResponseBodyContains: "marker"}, large); err == nil {
+		t.Error("expected content beyond the size bound not to be checked")
+	}
+}
+
+func TestCheckRetries(t *testing.T) {
+	cases := []struct {
+		name      string
+		attempts  string
+		expectErr bool
+	}{
+		{name: "first attempt", attempts: "1"},
+		{name: "within budget", attempts: "3"},
+		{name: "over budget", attempts: "4", expectErr: true},
+		{name: "missing", expectErr: true},
+		{name: "invalid", attempts: "many", expectErr: true},
+		{name: "zero", attempts: "0", expectErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := echoClient.Response{RequestHeaders: http.Header{}}
+			if tc.attempts != "" {
+				r.RequestHeaders.Set(attemptCountHeader, tc.attempts)
+			}
+			err := CheckRetries(r, 2)
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckEnvoyHeaders(t *testing.T) {
+	expected := map[string]bool{"X-Forwarded-For": true, InternalHeader: false}
+	cases := []struct {
+		name      string
+		headers   map[string]string
+		expectErr bool
+	}{
+		{name: "forwarded and stripped", headers: map[string]string{"X-Forwarded-For": "10.0.0.1"}},
+		{name: "not forwarded", expectErr: true},
+		{
+			name:      "not stripped",
+			headers:   map[string]string{"X-Forwarded-For": "10.0.0.1", InternalHeader: "test-user"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := echoClient.Response{RequestHeaders: http.Header{}}
+			for k, v := range tc.headers {
+				r.RequestHeaders.Set(k, v)
+			}
+			err := CheckEnvoyHeaders(r, expected)
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateUpstreamProtocol(t *testing.T) {
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{name: "unset", tc: TestCase{Expected: Expected{Protocol: "TCP"}}},
+		{
+			name: "downgrade",
+			tc:   TestCase{HTTP2: true, Expected: Expected{Protocol: "HTTP/2.0", UpstreamProtocol: "HTTP/1.1"}},
+		},
+		{name: "upgrade", tc: TestCase{Expected: Expected{Protocol: "HTTP/1.1", UpstreamProtocol: "HTTP/2.0"}}},
+		{name: "tcp", tc: TestCase{Expected: Expected{Protocol: "TCP", UpstreamProtocol: "TCP"}}, invalid: true},
+		{name: "no client protocol", tc: TestCase{Expected: Expected{UpstreamProtocol: "HTTP/1.1"}}, invalid: true},
+		{
+			name:    "client protocol does not match the request",
+			tc:      TestCase{HTTP2: true, Expected: Expected{Protocol: "HTTP/1.1", UpstreamProtocol: "HTTP/1.1"}},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := c.tc
+			err := validateUpstreamProtocol(&tc)
+			if c.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestExpandHosts(t *testing.T) {
+	single := &TestCase{Name: "single", Host: "foo.example.com"}
+	fanned := &TestCase{
+		Name:  "fanned",
+		Hosts: []string{"foo.example.com", "bar.example.com"},
+		Expected: Expected{
+			PromQueryFormat: `sum(istio_requests_total{destination_service_name="{{.Host}}"})`,
+		},
+	}
+	got := ExpandHosts([]*TestCase{single, fanned})
+	if len(got) != 3 {
+		t.Fatalf("expected 3 cases, got %d", len(got))
+	}
+	if got[0] != single {
+		t.Errorf("expected the single host case to be kept as is")
+	}
+	for i, host := range fanned.Hosts {
+		tc := got[i+1]
+		if want := "fanned/" + host; tc.Name != want {
+			t.Errorf("expected case %q, got %q", want, tc.Name)
+		}
+		if tc.Host != host || len(tc.Hosts) != 0 {
+			t.Errorf("expected case for host %s, got Host %q and Hosts %v", host, tc.Host, tc.Hosts)
+		}
+		// Each host is asserted on its own metrics.
+		want := `sum(istio_requests_total{destination_service_name="` + host + `"})`
+		if q := PromQuery(t, tc, map[string]string{"Host": tc.Host}); q != want {
+			t.Errorf("expected query %s, got %s", want, q)
+		}
+	}
+	if len(fanned.Hosts) != 2 {
+		t.Errorf("expected the original case to be left unchanged")
+	}
+}
+
+func TestValidateHosts(t *testing.T) {
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{name: "single host", tc: TestCase{Host: "foo.example.com"}},
+		{name: "hosts", tc: TestCase{Hosts: []string{"foo.example.com", "bar.example.com"}}},
+		{name: "host and hosts", tc: TestCase{Host: "foo.example.com", Hosts: []string{"bar.example.com"}}, invalid: true},
+		{name: "empty host", tc: TestCase{Hosts: []string{""}}, invalid: true},
+		{name: "duplicate host", tc: TestCase{Hosts: []string{"foo.example.com", "foo.example.com"}}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := c.tc
+			err := validateHosts(&tc)
+			if c.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestCheckDistinctUpstreams(t *testing.T) {
+	rs := echoClient.Responses{
+		{Hostname: "destination-v1-0"},
+		{Hostname: "destination-v2-0"},
+		{Hostname: "destination-v1-0"},
+	}
+	if err := CheckDistinctUpstreams(rs, 2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckDistinctUpstreams(rs[:1], 2); err == nil {
+		t.Errorf("expected error for requests pinned to one upstream")
+	}
+	if err := CheckDistinctUpstreams(echoClient.Responses{{}, {}}, 1); err == nil {
+		t.Errorf("expected error for responses without a hostname")
+	}
+}
+
+func TestValidateMinDistinctUpstreams(t *testing.T) {
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{name: "unset"},
+		{name: "valid", tc: TestCase{Expected: Expected{MinDistinctUpstreams: 2}}},
+		{name: "negative", tc: TestCase{Expected: Expected{MinDistinctUpstreams: -1}}, invalid: true},
+		{name: "delta", tc: TestCase{ExpectDelta: 1, Expected: Expected{MinDistinctUpstreams: 2}}, invalid: true},
+		{name: "blocked", tc: TestCase{Expected: Expected{MinDistinctUpstreams: 2, BlockMode: BlockReset}}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := c.tc
+			err := validateMinDistinctUpstreams(&tc)
+			if c.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestValidateEnvoyHeaders(t *testing.T) {
+	if err := validateEnvoyHeaders(map[string]bool{"X-Forwarded-For": true, "x-envoy-attempt-count": true}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateEnvoyHeaders(map[string]bool{"Handled-By-Egress-Gateway": true}); err == nil {
+		t.Errorf("expected error for a header not added by the proxies")
+	}
+}
+
+const serviceEntry = `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: wildcard
+spec:
+  hosts:
+  - "*.example.com"
+  location: MESH_EXTERNAL
+  ports:
+  - name: http
+    number: 80
+    protocol: HTTP
+  resolution: NONE
+`
+
+func TestValidatePhases(t *testing.T) {
+	valid := []Phase{{Name: "before", ApplyYAML: serviceEntry}, {Name: "after", DeleteYAML: serviceEntry}}
+	cases := []struct {
+		name    string
+		tc      TestCase
+		phases  []Phase
+		invalid bool
+	}{
+		{name: "valid", phases: valid},
+		{name: "no phases", invalid: true},
+		{name: "delta", tc: TestCase{ExpectDelta: 1}, phases: valid, invalid: true},
+		{name: "hosts", tc: TestCase{Hosts: []string{"foo.example.com"}}, phases: valid, invalid: true},
+		{name: "unnamed", phases: []Phase{{ApplyYAML: serviceEntry}}, invalid: true},
+		{name: "duplicate", phases: []Phase{{Name: "a"}, {Name: "a"}}, invalid: true},
+		{name: "bad yaml", phases: []Phase{{Name: "a", DeleteYAML: "kind: [\n"}}, invalid: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidatePhases(&tc.tc, tc.phases)
+			if tc.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", tc.invalid, err)
+			}
+		})
+	}
+
+	got := PhaseCases(&TestCase{Name: "case", PortName: "http"}, []Phase{
+		{Name: "before", Expected: Expected{StatusCode: 200}},
+		{Name: "after", Expected: Expected{BlockMode: BlockHTTP502}},
+	})
+	if len(got) != 2 || got[0].Name != "case before" || got[1].Name != "case after" {
+		t.Fatalf("unexpected phase cases %+v", got)
+	}
+	if got[0].PortName != "http" || got[0].Expected.StatusCode != 200 || got[1].Expected.BlockMode != BlockHTTP502 {
+		t.Errorf("expected each phase case to have the case's request and the phase's expectations, got %+v and %+v",
+			got[0], got[1])
+	}
+}
+
+func TestCasePort(t *testing.T) {
+	ports := []echo.Port{
+		{Name: "http", ServicePort: 80},
+		{Name: "https", ServicePort: 443},
+	}
+	cases := []struct {
+		name     string
+		tc       TestCase
+		expected string
+		invalid  bool
+		missing  bool
+	}{
+		{name: "by name", tc: TestCase{PortName: "https"}, expected: "https"},
+		{name: "by number", tc: TestCase{Port: 80}, expected: "http"},
+		{name: "name takes precedence", tc: TestCase{PortName: "https", Port: 80}, expected: "https"},
+		{name: "neither set", tc: TestCase{}, invalid: true},
+		{name: "out of range", tc: TestCase{Port: 70000}, invalid: true},
+		{name: "unknown name", tc: TestCase{PortName: "grpc", Port: 80}, missing: true},
+		{name: "unknown number", tc: TestCase{Port: 8080}, missing: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := validatePort(&c.tc); (err != nil) != c.invalid {
+				t.Fatalf("expected invalid=%v, got %v", c.invalid, err)
+			}
+			if c.invalid {
+				return
+			}
+			port, err := CasePort(ports, &c.tc)
+			if (err != nil) != c.missing {
+				t.Fatalf("expected missing=%v, got %v", c.missing, err)
+			}
+			if port.Name != c.expected {
+				t.Fatalf("expected port %q, got %q", c.expected, port.Name)
+			}
+		})
+	}
+}
+
+func TestCheckConnectionReuse(t *testing.T) {
+	if err := CheckConnectionReuse(1, 10, 2); err != nil {
+		t.Errorf("expected a single connection for 10 requests to pass: %v", err)
+	}
+	if err := CheckConnectionReuse(2, 10, 2); err != nil {
+		t.Errorf("expected the ceiling itself to pass: %v", err)
+	}
+	if err := CheckConnectionReuse(10, 10, 2); err == nil {
+		t.Error("expected a connection per request to fail")
+	}
+}
+
+func TestValidateKeepAlive(t *testing.T) {
+	valid := Expected{ConnectionsPromQueryFormat: "sum(istio_tcp_connections_opened_total)", MaxNewConnections: 2}
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{name: "unset", tc: TestCase{}},
+		{name: "valid", tc: TestCase{KeepAliveRequests: 10, Expected: valid}},
+		{name: "negative", tc: TestCase{KeepAliveRequests: -1}, invalid: true},
+		{name: "with delta", tc: TestCase{KeepAliveRequests: 10, ExpectDelta: 10, Expected: valid}, invalid: true},
+		{name: "no query", tc: TestCase{KeepAliveRequests: 10, Expected: Expected{MaxNewConnections: 2}}, invalid: true},
+		{name: "no ceiling", tc: TestCase{KeepAliveRequests: 10, Expected: Expected{
+			ConnectionsPromQueryFormat: valid.ConnectionsPromQueryFormat,
+		}}, invalid: true},
+		{name: "ceiling proves nothing", tc: TestCase{KeepAliveRequests: 2, Expected: valid}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := validateKeepAlive(&c.tc); (err != nil) != c.invalid {
+				t.Fatalf("expected invalid=%v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestProtocolSkipReason(t *testing.T) {
+	cases := []*TestCase{
+		{Name: "HTTP Traffic", PortName: "http", Expected: Expected{Protocol: "HTTP/1.1"}},
+		{Name: "HTTPS Traffic", PortName: "https"},
+		{Name: "HTTPS Traffic Conflict", PortName: "https-conflict"},
+		{Name: "TCP Traffic", PortName: "tcp"},
+		{Name: "HTTP2 Traffic By Port", Port: 8081, Expected: Expected{Protocol: "HTTP/2.0"}},
+	}
+	tests := []struct {
+		name   string
+		filter []string
+		want   []string
+	}{
+		{
+			name: "no filter",
+			want: []string{"HTTP Traffic", "HTTPS Traffic", "HTTPS Traffic Conflict", "TCP Traffic", "HTTP2 Traffic By Port"},
+		},
+		{
+			name:   "https",
+			filter: []string{"https"},
+			want:   []string{"HTTPS Traffic", "HTTPS Traffic Conflict"},
+		},
+		{
+			name:   "http matches by port name and expected protocol",
+			filter: []string{"http"},
+			want:   []string{"HTTP Traffic", "HTTP2 Traffic By Port"},
+		},
+		{
+			name:   "several protocols",
+			filter: []string{"tcp", "https"},
+			want:   []string{"HTTPS Traffic", "HTTPS Traffic Conflict", "TCP Traffic"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := sets.NewSet(tt.filter...)
+			var ran []string
+			for _, tc := range cases {
+				reason := ProtocolSkipReason(tc, filter)
+				if reason == "" {
+					ran = append(ran, tc.Name)
+				} else if !strings.Contains(reason, tc.Name) {
+					t.Errorf("expected the skip reason to name the case, got %q", reason)
+				}
+			}
+			if !reflect.DeepEqual(ran, tt.want) {
+				t.Errorf("expected %v to run, got %v", tt.want, ran)
+			}
+		})
+	}
+}
+
+// recordingConfigManager records the YAML applied to each namespace.
+type recordingConfigManager struct {
+	resource.ConfigManager
+	applied map[string][]string
+}
+
+func (r *recordingConfigManager) ApplyYAML(ns string, yamlText ...string) error {
+	r.applied[ns] = append(r.applied[ns], yamlText...)
+	return nil
+}
+
+func TestApplyPeerAuthentication(t *testing.T) {
+	cases := []struct {
+		mode resource.PeerAuthMode
+		want securityBeta.PeerAuthentication_MutualTLS_Mode
+	}{
+		{resource.PeerAuthModePermissive, securityBeta.PeerAuthentication_MutualTLS_PERMISSIVE},
+		{resource.PeerAuthModeStrict, securityBeta.PeerAuthentication_MutualTLS_STRICT},
+		{resource.PeerAuthModeDisable, securityBeta.PeerAuthentication_MutualTLS_DISABLE},
+	}
+	for _, tt := range cases {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			cfg := &recordingConfigManager{applied: map[string][]string{}}
+			if err := ApplyPeerAuthentication(cfg, "istio-system", tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.applied) != 1 || len(cfg.applied["istio-system"]) != 1 {
+				t.Fatalf("expected a single resource applied to istio-system, got %v", cfg.applied)
+			}
+			configs, unknown, err := crd.ParseInputs(cfg.applied["istio-system"][0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unknown) > 0 || len(configs) != 1 || configs[0].GroupVersionKind != gvk.PeerAuthentication {
+				t.Fatalf("expected a single PeerAuthentication, got %v (unknown %v)", configs, unknown)
+			}
+			if configs[0].Name != "default" {
+				t.Errorf("expected the PeerAuthentication to be named default, got %q", configs[0].Name)
+			}
+			pa := configs[0].Spec.(*securityBeta.PeerAuthentication)
+			if pa.GetSelector() != nil {
+				t.Errorf("expected a mesh-wide PeerAuthentication, got selector %v", pa.GetSelector())
+			}
+			if got := pa.GetMtls().GetMode(); got != tt.want {
+				t.Errorf("expected mode %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateLocality(t *testing.T) {
+	const sourceQuery = `sum(istio_requests_total{reporter="source"})`
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{
+			name: "unset",
+			tc:   TestCase{Expected: Expected{Metric: "istio_tcp_connections_closed_total"}},
+		},
+		{
+			name: "client reported requests",
+			tc: TestCase{Expected: Expected{
+				Metric:              "istio_requests_total",
+				PromQueryFormat:     sourceQuery,
+				DestinationLocality: "{{.ClientLocality}}",
+			}},
+		},
+		{
+			name: "tcp metric",
+			tc: TestCase{Expected: Expected{
+				Metric:         "istio_tcp_connections_closed_total",
+				SourceLocality: "{{.ClientLocality}}",
+			}},
+			invalid: true,
+		},
+		{
+			name: "destination reported requests",
+			tc: TestCase{Expected: Expected{
+				Metric:              "istio_requests_total",
+				PromQueryFormat:     `sum(istio_requests_total{reporter="destination"})`,
+				DestinationLocality: "{{.ClientLocality}}",
+			}},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := c.tc
+			err := validateLocality(&tc)
+			if c.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestValidateGRPCStatus(t *testing.T) {
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{name: "unset", tc: TestCase{PortName: "http"}},
+		{name: "ok", tc: TestCase{PortName: "grpc", Expected: Expected{GRPCStatus: "OK"}}},
+		{name: "unavailable", tc: TestCase{PortName: "grpc", Expected: Expected{GRPCStatus: "UNAVAILABLE"}}},
+		{name: "unknown status", tc: TestCase{PortName: "grpc", Expected: Expected{GRPCStatus: "Unavailable"}}, invalid: true},
+		{name: "http port", tc: TestCase{PortName: "http", Expected: Expected{GRPCStatus: "OK"}}, invalid: true},
+		{
+			name:    "blocked",
+			tc:      TestCase{PortName: "grpc", Expected: Expected{GRPCStatus: "UNAVAILABLE", BlockMode: BlockReset}},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := c.tc
+			err := validateGRPCStatus(&tc)
+			if c.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestCheckGRPCStatus(t *testing.T) {
+	unavailable := errors.New("1/1 requests had errors; first error: " +
+		"rpc error: code = Unavailable desc = upstream connect error")
+	cases := []struct {
+		name string
+		want string
+		err  error
+		fail bool
+	}{
+		{name: "ok", want: "OK"},
+		{name: "unavailable", want: "UNAVAILABLE", err: unavailable},
+		{name: "unavailable expected ok", want: "OK", err: unavailable, fail: true},
+		{name: "ok expected unavailable", want: "UNAVAILABLE", fail: true},
+		{name: "no status", want: "UNAVAILABLE", err: errors.New("connection reset by peer"), fail: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := CheckGRPCStatus(c.want, c.err)
+			if c.fail != (err != nil) {
+				t.Errorf("expected failure: %v, got %v", c.fail, err)
+			}
+		})
+	}
+}
+
+func TestLatencyQuantileQuery(t *testing.T) {
+	got := LatencyQuantileQuery(LatencyQuantile{Quantile: 0.99, Threshold: time.Second},
+		[]string{`source_workload="client-v1"`, `destination_service_name="PassthroughCluster"`})
+	want := `histogram_quantile(0.99, sum by (le) (rate(istio_request_duration_milliseconds_bucket{` +
+		`source_workload="client-v1",destination_service_name="PassthroughCluster",reporter="source"}[5m])))`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestValidateLatencyQuantile(t *testing.T) {
+	p99 := &LatencyQuantile{Quantile: 0.99, Threshold: time.Second}
+	cases := []struct {
+		name    string
+		tc      TestCase
+		invalid bool
+	}{
+		{name: "unset", tc: TestCase{}},
+		{name: "p99", tc: TestCase{Expected: Expected{Metric: "istio_requests_total", LatencyQuantile: p99}}},
+		{
+			name: "max",
+			tc: TestCase{Expected: Expected{
+				Metric:          "istio_requests_total",
+				LatencyQuantile: &LatencyQuantile{Quantile: 1, Threshold: time.Second},
+			}},
+		},
+		{
+			name: "zero quantile",
+			tc: TestCase{Expected: Expected{
+				Metric:          "istio_requests_total",
+				LatencyQuantile: &LatencyQuantile{Threshold: time.Second},
+			}},
+			invalid: true,
+		},
+		{
+			name: "percentile",
+			tc: TestCase{Expected: Expected{
+				Metric:          "istio_requests_total",
+				LatencyQuantile: &LatencyQuantile{Quantile: 99, Threshold: time.Second},
+			}},
+			invalid: true,
+		},
+		{
+			name: "no threshold",
+			tc: TestCase{Expected: Expected{
+				Metric:          "istio_requests_total",
+				LatencyQuantile: &LatencyQuantile{Quantile: 0.99},
+			}},
+			invalid: true,
+		},
+		{name: "no metric", tc: TestCase{Expected: Expected{LatencyQuantile: p99}}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := c.tc
+			err := validateLatencyQuantile(&tc)
+			if c.invalid != (err != nil) {
+				t.Errorf("expected invalid: %v, got %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestCheckLatencyQuantile(t *testing.T) {
+	p99 := LatencyQuantile{Quantile: 0.99, Threshold: 100 * time.Millisecond}
+	if err := CheckLatencyQuantile(40*time.Millisecond, p99); err != nil {
+		t.Errorf("expected a latency under the threshold to pass: %v", err)
+	}
+	if err := CheckLatencyQuantile(100*time.Millisecond, p99); err != nil {
+		t.Errorf("expected a latency at the threshold to pass: %v", err)
+	}
+	if err := CheckLatencyQuantile(250*time.Millisecond, p99); err == nil {
+		t.Error("expected a latency over the threshold to fail")
+	}
+}
+
+func TestZonalEgressGatewaySkipReason(t *testing.T) {
+	zonal := &TestCase{Name: "zonal", RequiresZonalEgressGateway: true}
+	if reason := ZonalEgressGatewaySkipReason(&TestCase{Name: "any"}, sets.NewSet()); reason != "" {
+		t.Errorf("expected a case not requiring a zonal gateway to run, got %q", reason)
+	}
+	if reason := ZonalEgressGatewaySkipReason(zonal, sets.NewSet(ClientLocality)); reason == "" {
+		t.Error("expected the case to be skipped without a replica in the failover zone")
+	}
+	if reason := ZonalEgressGatewaySkipReason(zonal, sets.NewSet(ClientLocality, FailoverLocality)); reason != "" {
+		t.Errorf("expected the case to run with replicas in both zones, got %q", reason)
+	}
+}
+
+func TestCaseSetup(t *testing.T) {
+	var events []string
+	tc := &TestCase{
+		Setup: func(t *testing.T, ctx framework.TestContext, serviceNamespace string) func() {
+			events = append(events, "setup "+serviceNamespace)
+			return func() {
+				events = append(events, "teardown "+serviceNamespace)
+			}
+		},
+	}
+	// runCase runs the case as runCases does, failing it as t.FailNow would, if set.
+	runCase := func(tc *TestCase, fail bool) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer CaseSetup(t, nil, "service-2", tc)()
+			events = append(events, "requests")
+			if fail {
+				runtime.Goexit()
+			}
+			events = append(events, "checks")
+		}()
+		<-done
+	}
+
+	runCase(tc, false)
+	if want := []string{"setup service-2", "requests", "checks", "teardown service-2"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+
+	events = nil
+	runCase(tc, true)
+	if want := []string{"setup service-2", "requests", "teardown service-2"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("expected the teardown to run after a failure, got %v", events)
+	}
+
+	// Cases without a hook, or whose hook has nothing to tear down, run as usual.
+	events = nil
+	runCase(&TestCase{}, false)
+	runCase(&TestCase{Setup: func(*testing.T, framework.TestContext, string) func() { return nil }}, false)
+	if want := []string{"requests", "checks", "requests", "checks"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+}
+
+func TestValidateCase(t *testing.T) {
+	cases := []struct {
+		name      string
+		tc        TestCase
+		expectErr string
+	}{
+		{name: "valid", tc: TestCase{PortName: "http", Expected: Expected{StatusCode: http.StatusOK}}},
+		{name: "no port", tc: TestCase{}, expectErr: "one of PortName or Port is required"},
+		{
+			name:      "block mode with status code",
+			tc:        TestCase{PortName: "http", Expected: Expected{BlockMode: BlockReset, StatusCode: http.StatusOK}},
+			expectErr: "BlockMode and StatusCode are mutually exclusive",
+		},
+		{
+			name:      "invalid regex",
+			tc:        TestCase{PortName: "http", Expected: Expected{ResponseBodyRegex: "("}},
+			expectErr: "invalid ResponseBodyRegex",
+		},
+		{
+			name:      "invalid destination rule",
+			tc:        TestCase{PortName: "http", DestinationRuleYAML: serviceEntry},
+			expectErr: "only DestinationRules are allowed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateCase(&c.tc)
+			if c.expectErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.expectErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectErr)) {
+				t.Fatalf("expected error containing %q, got %v", c.expectErr, err)
+			}
+		})
+	}
+}
@@ -18,25 +18,39 @@
 package outboundtrafficpolicy
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"net"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/prometheus/common/model"
+	"google.golang.org/grpc/codes"
+	kubeErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pkg/config/protocol"
 	echoClient "istio.io/istio/pkg/test/echo"
 	"istio.io/istio/pkg/test/echo/common"
 	"istio.io/istio/pkg/test/env"
 	"istio.io/istio/pkg/test/framework"
+	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/framework/components/echo"
 	"istio.io/istio/pkg/test/framework/components/echo/echoboot"
 	"istio.io/istio/pkg/test/framework/components/environment/kube"
+	"istio.io/istio/pkg/test/framework/components/istio"
 	"istio.io/istio/pkg/test/framework/components/namespace"
 	"istio.io/istio/pkg/test/framework/components/prometheus"
 	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/util/retry"
 	tmpl "istio.io/istio/pkg/test/util/tmpl"
-	promtest "istio.io/istio/tests/integration/telemetry/stats/prometheus"
+	"istio.io/istio/tests/common/outboundtraffic"
 )
 
 const (
@@ -59,6 +73,24 @@ spec:
     number: 9091
     protocol: HTTP
   resolution: DNS
+`
+	// WildcardServiceEntry is used to verify that requests for any subdomain of the wildcard host
+	// are resolved to the ServiceEntry rather than the passthrough/blackhole cluster.
+	// Resolution NONE forwards the request to the original destination, which is the destination pod.
+	WildcardServiceEntry = `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: wildcard
+spec:
+  hosts:
+  - "*.example.com"
+  location: MESH_EXTERNAL
+  ports:
+  - name: http
+    number: 80
+    protocol: HTTP
+  resolution: NONE
 `
 	SidecarScope = `
 apiVersion: networking.istio.io/v1alpha3
@@ -81,7 +113,7 @@ metadata:
   name: istio-egressgateway
 spec:
   selector:
-    istio: egressgateway
+    {{.EgressGatewaySelector}}
   servers:
   - port:
       number: 80
@@ -89,6 +121,7 @@ spec:
       protocol: HTTP
     hosts:
     - "some-external-site.com"
+    - "some-external-site-tls.com"
 ---
 apiVersion: networking.istio.io/v1alpha3
 kind: VirtualService
@@ -107,7 +140,7 @@ spec:
         port: 80
       route:
       - destination:
-          host: istio-egressgateway.istio-system.svc.cluster.local
+          host: {{.EgressGatewayHost}}
           port:
             number: 80
         weight: 100
@@ -122,6 +155,8 @@ spec:
         request:
           add:
             handled-by-egress-gateway: "true"
+          remove:
+          - {{.InternalHeader}}
 ---
 apiVersion: networking.istio.io/v1alpha3
 kind: ServiceEntry
@@ -138,27 +173,227 @@ spec:
   - number: 80
     name: http
   resolution: DNS
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: route-tls-origination-via-egressgateway
+spec:
+  hosts:
+    - "some-external-site-tls.com"
+  gateways:
+  - istio-egressgateway
+  - mesh
+  http:
+    - match:
+      - gateways:
+        - mesh # from sidecars, route to egress gateway service
+        port: 80
+      route:
+      - destination:
+          host: {{.EgressGatewayHost}}
+          port:
+            number: 80
+        weight: 100
+    - match:
+      - gateways:
+        - istio-egressgateway
+        port: 80
+      route:
+      - destination:
+          host: some-external-site-tls.com
+          port:
+            number: 443
+      headers:
+        request:
+          add:
+            handled-by-egress-gateway: "true"
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: ext-service-entry-tls
+spec:
+  hosts:
+  - "some-external-site-tls.com"
+  location: MESH_EXTERNAL
+  endpoints:
+  - address: destination.{{.AppNamespace}}.svc.cluster.local
+    network: external
+  ports:
+  - number: 80
+    name: http
+    protocol: HTTP
+  - number: 443
+    name: https
+    protocol: HTTPS
+  resolution: DNS
+`
+
+	// GatewayAPIEgressGateway has istiod deploy an egress gateway for the gateway-api gateway class. The
+	// listener's hostname is never used; routing through the gateway is configured by the Gateway above,
+	// which selects the deployment by its istio.io/gateway-name label.
+	GatewayAPIEgressGateway = `
+apiVersion: gateway.networking.k8s.io/v1alpha2
+kind: Gateway
+metadata:
+  name: egress-gateway
+spec:
+  gatewayClassName: istio
+  listeners:
+  - name: http
+    hostname: "egress-gateway.invalid"
+    port: 80
+    protocol: HTTP
+`
+
+	// TLSOriginationDestinationRule makes the egress gateway originate TLS for requests to some-external-site-tls.com,
+	// which are routed to the TLS port of the destination.
+	TLSOriginationDestinationRule = `
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: originate-tls-for-some-external-site
+spec:
+  host: some-external-site-tls.com
+  trafficPolicy:
+    portLevelSettings:
+    - port:
+        number: 443
+      tls:
+        mode: SIMPLE
+        sni: some-external-site-tls.com
+`
+
+	// LocalEgressGatewayDestinationRule enables locality load balancing to the istio egress gateway, so that the
+	// client's sidecar prefers the gateway replica of its own zone. Outlier detection is required for it to apply.
+	LocalEgressGatewayDestinationRule = `
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: local-egress-gateway
+spec:
+  host: "{{.EgressGatewayHost}}"
+  trafficPolicy:
+    loadBalancer:
+      localityLbSetting:
+        enabled: true
+    outlierDetection:
+      consecutive5xxErrors: 10
+      interval: 1s
+      baseEjectionTime: 1m
+`
+
+	// FailoverEgressGatewayDestinationRule shifts the traffic of the client's zone to the egress gateway replica of
+	// FailoverLocality, as locality load balancing does when the replicas of the client's zone fail.
+	FailoverEgressGatewayDestinationRule = `
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: failover-egress-gateway
+spec:
+  host: "{{.EgressGatewayHost}}"
+  trafficPolicy:
+    loadBalancer:
+      localityLbSetting:
+        enabled: true
+        distribute:
+        - from: region/zone/*
+          to:
+            "region/failover/*": 100
+    outlierDetection:
+      consecutive5xxErrors: 10
+      interval: 1s
+      baseEjectionTime: 1m
 `
+
+	// LocalityTelemetry adds the istio-locality labels of the client and of the workload it sent the request to
+	// as the source_locality and destination_locality of istio_requests_total reported by the client. It is applied
+	// to the root namespace while cases expecting a locality run.
+	LocalityTelemetry = `
+apiVersion: telemetry.istio.io/v1alpha1
+kind: Telemetry
+metadata:
+  name: outbound-locality
+spec:
+  metrics:
+  - providers:
+    - name: prometheus
+    overrides:
+    - match:
+        metric: REQUEST_COUNT
+        mode: CLIENT
+      tagOverrides:
+        source_locality:
+          value: "node.labels['istio-locality']"
+        destination_locality:
+          value: "upstream_peer.labels['istio-locality']"
+`
+)
+
+// The cases and their expectations are defined by outboundtraffic, so that they can be unit tested.
+type (
+	TestCase                 = outboundtraffic.TestCase
+	IPFamily                 = outboundtraffic.IPFamily
+	Expected                 = outboundtraffic.Expected
+	LatencyQuantile          = outboundtraffic.LatencyQuantile
+	ConnectionSecurityPolicy = outboundtraffic.ConnectionSecurityPolicy
+	BlockMode                = outboundtraffic.BlockMode
+	Phase                    = outboundtraffic.Phase
+)
+
+const (
+	PassthroughCluster     = outboundtraffic.PassthroughCluster
+	BlackHoleCluster       = outboundtraffic.BlackHoleCluster
+	IPv4                   = outboundtraffic.IPv4
+	IPv6                   = outboundtraffic.IPv6
+	DualStack              = outboundtraffic.DualStack
+	MutualTLS              = outboundtraffic.MutualTLS
+	NoConnectionSecurity   = outboundtraffic.NoConnectionSecurity
+	BlockReset             = outboundtraffic.BlockReset
+	BlockTLSError          = outboundtraffic.BlockTLSError
+	BlockHTTP502           = outboundtraffic.BlockHTTP502
+	BlockAny               = outboundtraffic.BlockAny
+	ClientLocality         = outboundtraffic.ClientLocality
+	FailoverLocality       = outboundtraffic.FailoverLocality
+	InternalHeader         = outboundtraffic.InternalHeader
+	MeshPeerAuthentication = outboundtraffic.MeshPeerAuthentication
 )
 
-// TestCase represents what is being tested
-type TestCase struct {
-	Name     string
-	PortName string
-	HTTP2    bool
-	Host     string
-	Expected Expected
+// CaseResult is the outcome of a single request sent for a test case. A case sends one request per destination
+// address, so it may have several results.
+type CaseResult struct {
+	Name string
+	// StatusCode is the status code of the last response received, if any.
+	StatusCode string
+	// MetricValue is the observed value of the case's metric query, if it has one. For ExpectDelta cases, it is
+	// the observed increase.
+	MetricValue float64
+	// GatewayMetricValue is the observed value of the case's gateway query, if it has one.
+	GatewayMetricValue float64
+	// LatencyQuantile is the observed request duration quantile of a LatencyQuantile case.
+	LatencyQuantile time.Duration
+	// Latency is the time taken to get a successful response, including retries.
+	Latency time.Duration
+	Err     error
+	// Series, collected by RunRevisionParity, are the label sets of the metric series the case's traffic increased,
+	// without the labels that are expected to differ between revisions.
+	Series []string
 }
 
-// Expected contains the metric and query to run against
-// prometheus to validate that expected telemetry information was gathered;
-// as well as the http response code
-type Expected struct {
-	Metric          string
-	PromQueryFormat string
-	StatusCode      int
-	Protocol        string
-	RequestHeaders  map[string]string
+// Success returns true if the request and its telemetry were as expected.
+func (r CaseResult) Success() bool {
+	return r.Err == nil
+}
+
+// RunOptions controls how RunExternalRequestWithOptions reports failures.
+type RunOptions struct {
+	// CollectOnly records failures in the returned results instead of failing the test, so that callers
+	// can assert their own invariants across cases.
+	CollectOnly bool
+
+	// collectSeries, set by RunRevisionParity, records the series each revision case increased in CaseResult.Series.
+	collectSeries bool
 }
 
 // TrafficPolicy is the mode of the outbound traffic policy to use
@@ -195,16 +430,126 @@ func mustReadCert(t *testing.T, f string) string {
 // We want to test "external" traffic. To do this without actually hitting an external endpoint,
 // we can import only the service namespace, so the apps are not known
 func createGateway(t *testing.T, ctx resource.Context, appsNamespace namespace.Instance, serviceNamespace namespace.Instance) {
-	b := tmpl.EvaluateOrFail(t, Gateway, map[string]string{"AppNamespace": appsNamespace.Name()})
+	params := map[string]string{"AppNamespace": appsNamespace.Name(), "InternalHeader": InternalHeader}
+	switch ctx.Settings().GatewayClass {
+	case resource.GatewayClassGatewayAPI:
+		crd, err := os.ReadFile(path.Join(env.IstioSrc, "tests/integration/pilot/testdata/gateway-api-crd.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ctx.ConfigIstio().ApplyYAMLNoCleanup("", string(crd)); err != nil {
+			t.Fatalf("failed to apply gateway api crds: %v", err)
+		}
+		if err := ctx.ConfigIstio().ApplyYAML(serviceNamespace.Name(), GatewayAPIEgressGateway); err != nil {
+			t.Fatalf("failed to apply gateway api egress gateway: %v", err)
+		}
+		params["EgressGatewaySelector"] = "istio.io/gateway-name: egress-gateway"
+	default:
+		params["EgressGatewaySelector"] = "istio: egressgateway"
+	}
+	params["EgressGatewayHost"] = egressGatewayHost(ctx, serviceNamespace)
+	b := tmpl.EvaluateOrFail(t, Gateway, params)
 	if err := ctx.ConfigIstio().ApplyYAML(serviceNamespace.Name(), b); err != nil {
 		t.Fatalf("failed to apply gateway: %v. template: %v", err, b)
 	}
 }
 
+// egressGatewayHost returns the host of the egress gateway service that egress cases route through. The gateway-api
+// gateway is deployed to the service namespace by createGateway, the istio gateway to the system namespace of the
+// Istio component.
+func egressGatewayHost(ctx resource.Context, serviceNamespace namespace.Instance) string {
+	class := ctx.Settings().GatewayClass
+	ns := serviceNamespace.Name()
+	if class != resource.GatewayClassGatewayAPI {
+		ns = "istio-system"
+		// Without an Istio component no gateway was installed with it, and the egress cases are skipped.
+		if ist, err := istio.Get(ctx); err == nil {
+			ns = ist.Settings().SystemNamespace
+		}
+	}
+	return fmt.Sprintf("%s.%s.svc.cluster.local", outboundtraffic.EgressGatewayService(class), ns)
+}
+
+// egressGatewayDeployed reports whether the egress gateway that egress cases route through is deployed. The
+// gateway-api gateway is deployed by createGateway itself; the istio gateway is looked up in the system namespace of
+// the Istio component, and is absent if there is no Istio component.
+func egressGatewayDeployed(ctx resource.Context) (bool, error) {
+	class := ctx.Settings().GatewayClass
+	if class == resource.GatewayClassGatewayAPI {
+		return true, nil
+	}
+	ist, err := istio.Get(ctx)
+	if err != nil {
+		// There is no Istio component, so no gateway was installed with it.
+		return false, nil // nolint: nilerr
+	}
+	_, err = ctx.Clusters().Default().CoreV1().Services(ist.Settings().SystemNamespace).
+		Get(context.TODO(), outboundtraffic.EgressGatewayService(class), kubeApiMeta.GetOptions{})
+	if kubeErrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// setupPeerAuthentication applies the mesh-wide PeerAuthentication selected by --istio.test.peerAuth, if any, to the
+// root namespace of the Istio component. It is removed once the suite completes.
+func setupPeerAuthentication(ctx resource.Context) error {
+	mode := ctx.Settings().PeerAuthMode
+	if mode == "" {
+		return nil
+	}
+	ist, err := istio.Get(ctx)
+	if err != nil {
+		return err
+	}
+	return outboundtraffic.ApplyPeerAuthentication(ctx.ConfigIstio(), ist.Settings().SystemNamespace, mode)
+}
+
+// egressGatewayLocalities returns the istio-locality labels of the pods of the istio egress gateway. Replicas without
+// the label are not counted. The gateway-api gateway deployed by createGateway has no locality.
+func egressGatewayLocalities(ctx resource.Context) (sets.Set, error) {
+	out := sets.NewSet()
+	if ctx.Settings().GatewayClass == resource.GatewayClassGatewayAPI {
+		return out, nil
+	}
+	ist, err := istio.Get(ctx)
+	if err != nil {
+		// There is no Istio component, so no gateway was installed with it.
+		return out, nil // nolint: nilerr
+	}
+	pods, err := ctx.Clusters().Default().CoreV1().Pods(ist.Settings().SystemNamespace).
+		List(context.TODO(), kubeApiMeta.ListOptions{LabelSelector: "istio=egressgateway"})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pods.Items {
+		if l := p.Labels["istio-locality"]; l != "" {
+			out.Insert(l)
+		}
+	}
+	return out, nil
+}
+
+// applyLocalityTelemetry applies LocalityTelemetry to the root namespace until the test completes.
+func applyLocalityTelemetry(t *testing.T, ctx framework.TestContext) {
+	ist, err := istio.Get(ctx)
+	if err != nil {
+		t.Fatalf("cases expecting a locality require the Istio component: %v", err)
+	}
+	ctx.ConfigIstio().ApplyYAMLOrFail(t, ist.Settings().SystemNamespace, LocalityTelemetry)
+}
+
 // TODO support native environment for registry only/gateway. Blocked by #13177 because the listeners for native use static
 // routes and this test relies on the dynamic routes sent through pilot to allow external traffic.
 
-func RunExternalRequest(cases []*TestCase, prometheus prometheus.Instance, mode TrafficPolicy, t *testing.T) {
+// RunExternalRequest runs the cases, failing the test on any failure, and returns the per-case results.
+func RunExternalRequest(cases []*TestCase, prometheus prometheus.Instance, mode TrafficPolicy, t *testing.T) []CaseResult {
+	return RunExternalRequestWithOptions(cases, prometheus, mode, RunOptions{}, t)
+}
+
+// RunExternalRequestWithOptions is like RunExternalRequest, with control over how failures are reported.
+func RunExternalRequestWithOptions(cases []*TestCase, prometheus prometheus.Instance, mode TrafficPolicy,
+	opts RunOptions, t *testing.T) []CaseResult {
 	// Testing of Blackhole and Passthrough clusters:
 	// Setup of environment:
 	// 1. client and destination are deployed to app-1-XXXX namespace
@@ -244,50 +589,663 @@ func RunExternalRequest(cases []*TestCase, prometheus prometheus.Instance, mode
 	//    client ---TCP request at port 9091 ----> Hits listener 0.0.0.0_9091 ->  ALLOW_ANY/REGISTRY_ONLY
 	//    Metric is istio_tcp_connections_closed_total i.e. TCP
 	//
+	// 7. HTTP wildcard ServiceEntry
+	//    client ---HTTP request (Host: foo.example.com)----> Hits listener 0.0.0.0_80 -> *.example.com cluster
+	//    client ---HTTP request (Host: foo.example.org)----> Hits listener 0.0.0.0_80 -> ALLOW_ANY/REGISTRY_ONLY
+	//    Metric is istio_requests_total i.e. HTTP
+	//
+	// 8. HTTP egress with TLS origination
+	//    client ---HTTP request (Host: some-external-site-tls.com)----> Hits listener 0.0.0.0_80 ->
+	//      VS Routing (add Egress Header) --> Egress Gateway --TLS (case DestinationRule)--> destination
+	//    Metric is istio_requests_total i.e. HTTP with destination as istio-egressgateway
+	//
+	var results []CaseResult
 	framework.
 		NewTest(t).
 		Run(func(ctx framework.TestContext) {
-			client, dest := setupEcho(t, ctx, mode)
-
-			for _, tc := range cases {
-				t.Run(tc.Name, func(t *testing.T) {
-					client.CallWithRetryOrFail(t, echo.CallOptions{
-						Target:   dest,
-						PortName: tc.PortName,
-						Headers: map[string][]string{
-							"Host": {tc.Host},
-						},
-						HTTP2: tc.HTTP2,
-						Check: func(rs echoClient.Responses, err error) error {
-							// the expected response from a blackhole test case will have err
-							// set; use the length of the expected code to ignore this condition
-							if err != nil && tc.Expected.StatusCode > 0 {
-								return fmt.Errorf("request failed: %v", err)
-							}
-							codeStr := strconv.Itoa(tc.Expected.StatusCode)
-							for i, r := range rs {
-								if codeStr != r.Code {
-									return fmt.Errorf("response[%d] received status code %s, expected %d", i, r.Code, tc.Expected.StatusCode)
-								}
-								for k, v := range tc.Expected.RequestHeaders {
-									if got := r.RequestHeaders.Get(k); got != v {
-										return fmt.Errorf("expected metadata %v=%v, got %q", k, v, got)
-									}
-								}
-							}
-							return nil
-						},
-					})
-
-					if tc.Expected.Metric != "" {
-						promtest.ValidateMetric(t, ctx.Clusters().Default(), prometheus, tc.Expected.PromQueryFormat, tc.Expected.Metric, 1)
+			results = runExternalRequest(t, ctx, cases, prometheus, mode, opts)
+		})
+	return results
+}
+
+func runExternalRequest(t *testing.T, ctx framework.TestContext, cases []*TestCase, prometheus prometheus.Instance,
+	mode TrafficPolicy, runOpts RunOptions) []CaseResult {
+	validateCases(t, cases)
+	return runCases(t, ctx, newExternalSetup(t, ctx, mode), outboundtraffic.ExpandHosts(cases), prometheus, runOpts)
+}
+
+// validateCases checks that the config carried by the test cases is valid before any of it is applied.
+func validateCases(t *testing.T, cases []*TestCase) {
+	for _, tc := range cases {
+		if err := outboundtraffic.ValidateCase(tc); err != nil {
+			t.Fatalf("case %q: %v", tc.Name, err)
+		}
+	}
+}
+
+// externalSetup is the deployment the cases send their traffic through.
+type externalSetup struct {
+	client           echo.Instance
+	dest             echo.Instance
+	serviceNamespace namespace.Instance
+	egressDeployed   bool
+	// egressLocalities are the localities of the egress gateway replicas.
+	egressLocalities sets.Set
+}
+
+func newExternalSetup(t *testing.T, ctx framework.TestContext, mode TrafficPolicy) externalSetup {
+	client, dest, serviceNamespace := setupEcho(t, ctx, mode)
+	egressDeployed, err := egressGatewayDeployed(ctx)
+	if err != nil {
+		t.Fatalf("failed to check for the egress gateway: %v", err)
+	}
+	egressLocalities, err := egressGatewayLocalities(ctx)
+	if err != nil {
+		t.Fatalf("failed to look up the localities of the egress gateway: %v", err)
+	}
+	return externalSetup{
+		client:           client,
+		dest:             dest,
+		serviceNamespace: serviceNamespace,
+		egressDeployed:   egressDeployed,
+		egressLocalities: egressLocalities,
+	}
+}
+
+// runCases runs the validated cases against the setup.
+func runCases(t *testing.T, ctx framework.TestContext, setup externalSetup, cases []*TestCase,
+	prometheus prometheus.Instance, runOpts RunOptions) []CaseResult {
+	var results []CaseResult
+	client, dest, serviceNamespace, egressDeployed := setup.client, setup.dest, setup.serviceNamespace, setup.egressDeployed
+	if outboundtraffic.UsesLocality(cases) {
+		applyLocalityTelemetry(t, ctx)
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if reason := outboundtraffic.ProtocolSkipReason(tc, ctx.Settings().ProtocolFilter); reason != "" {
+				t.Skip(reason)
+			}
+			if reason := outboundtraffic.EgressGatewaySkipReason(tc, egressDeployed); reason != "" {
+				t.Skip(reason)
+			}
+			if reason := outboundtraffic.ZonalEgressGatewaySkipReason(tc, setup.egressLocalities); reason != "" {
+				t.Skip(reason)
+			}
+			defer outboundtraffic.CaseSetup(t, ctx, serviceNamespace.Name(), tc)()
+			params := map[string]string{
+				"AppNamespace":          dest.Config().Namespace.Name(),
+				"ServiceNamespace":      serviceNamespace.Name(),
+				"EgressGatewayService":  outboundtraffic.EgressGatewayService(ctx.Settings().GatewayClass),
+				"EgressGatewayWorkload": outboundtraffic.EgressGatewayWorkload(ctx.Settings().GatewayClass),
+				"EgressGatewayApp":      outboundtraffic.EgressGatewayApp(ctx.Settings().GatewayClass),
+				"EgressGatewayHost":     egressGatewayHost(ctx, serviceNamespace),
+				"Host":                  tc.Host,
+				"ClientLocality":        ClientLocality,
+				"FailoverLocality":      FailoverLocality,
+			}
+			q := queries{metric: outboundtraffic.PromQuery(t, tc, params)}
+			if tc.Expected.NoServerErrors {
+				q.serverErrors = outboundtraffic.WithLabelMatchers(serverErrorsQuery, outboundtraffic.CaseMatchers(t, tc, params)...)
+			}
+			if tc.Expected.GatewayPromQueryFormat != "" {
+				q.gateway = tmpl.EvaluateOrFail(t, tc.Expected.GatewayPromQueryFormat, params)
+			}
+			if tc.Expected.LatencyQuantile != nil {
+				q.latency = outboundtraffic.LatencyQuantileQuery(*tc.Expected.LatencyQuantile, outboundtraffic.CaseMatchers(t, tc, params))
+			}
+			if tc.Expected.ConnectionSecurityPolicy != "" {
+				q.connectionSecurity = outboundtraffic.WithLabelMatchers(
+					tmpl.EvaluateOrFail(t, tc.Expected.ConnectionSecurityPromQueryFormat, params),
+					fmt.Sprintf("connection_security_policy=%q", tc.Expected.ConnectionSecurityPolicy))
+			}
+			if tc.Expected.ConnectionsPromQueryFormat != "" {
+				q.connections = tmpl.EvaluateOrFail(t, tc.Expected.ConnectionsPromQueryFormat, params)
+			}
+			if tc.DestinationRuleYAML != "" {
+				dr := tmpl.EvaluateOrFail(t, tc.DestinationRuleYAML, params)
+				ctx.ConfigIstio().ApplyYAMLOrFail(t, serviceNamespace.Name(), dr)
+				defer ctx.ConfigIstio().DeleteYAMLOrFail(t, serviceNamespace.Name(), dr)
+			}
+			if tc.VirtualServiceYAML != "" {
+				vs := tmpl.EvaluateOrFail(t, tc.VirtualServiceYAML, params)
+				ctx.ConfigIstio().ApplyYAMLOrFail(t, serviceNamespace.Name(), vs)
+				defer ctx.ConfigIstio().DeleteYAMLOrFail(t, serviceNamespace.Name(), vs)
+			}
+			if tc.Expected.Revision != "" {
+				var series string
+				var before model.Vector
+				var err error
+				if runOpts.collectSeries {
+					if series, err = outboundtraffic.SeriesQuery(q.metric); err != nil {
+						t.Fatal(err)
+					}
+					if before, err = querySeries(ctx.Clusters().Default(), prometheus, series); err != nil {
+						t.Fatal(err)
 					}
-				})
+				}
+				result := sendExternalRequest(t, ctx, prometheus, client, revisionCallOptions(t, ctx, dest, tc), tc, q, runOpts)
+				if runOpts.collectSeries && result.Err == nil {
+					after, err := querySeries(ctx.Clusters().Default(), prometheus, series)
+					if err != nil {
+						t.Fatal(err)
+					}
+					result.Series = outboundtraffic.IncreasedSeries(before, after)
+				}
+				results = append(results, result)
+				return
+			}
+			port, err := outboundtraffic.CasePort(dest.Config().Ports, tc)
+			if err != nil {
+				t.Fatalf("%s: %v", dest.Config().Service, err)
+			}
+			for _, address := range destinationAddresses(t, ctx, dest, tc.IPFamily) {
+				results = append(results, sendExternalRequest(t, ctx, prometheus, client, echo.CallOptions{
+					Target:   dest,
+					PortName: port.Name,
+					Address:  address,
+				}, tc, q, runOpts))
 			}
 		})
+	}
+	return results
 }
 
-func setupEcho(t *testing.T, ctx resource.Context, mode TrafficPolicy) (echo.Instance, echo.Instance) {
+// RunPhases runs the case once per phase, in order, against the same deployment, changing the config of each phase
+// before sending its request. This checks that config changes, and removals in particular, propagate to the client.
+// Each phase's request is retried until its Expected is met, so the case's ExpectDelta and KeepAliveRequests, which
+// disable retries, are not supported. It returns the result of each phase.
+func RunPhases(tc *TestCase, phases []Phase, prometheus prometheus.Instance, mode TrafficPolicy, t *testing.T) []CaseResult {
+	var results []CaseResult
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			cases := outboundtraffic.PhaseCases(tc, phases)
+			validateCases(t, cases)
+			if err := outboundtraffic.ValidatePhases(tc, phases); err != nil {
+				t.Fatalf("case %q: %v", tc.Name, err)
+			}
+			setup := newExternalSetup(t, ctx, mode)
+			for i, p := range phases {
+				ns := setup.serviceNamespace.Name()
+				if p.DeleteYAML != "" {
+					ctx.ConfigIstio().DeleteYAMLOrFail(t, ns, p.DeleteYAML)
+				}
+				if p.ApplyYAML != "" {
+					ctx.ConfigIstio().ApplyYAMLOrFail(t, ns, p.ApplyYAML)
+				}
+				results = append(results, runCases(t, ctx, setup, cases[i:i+1], prometheus, RunOptions{})...)
+				if t.Failed() {
+					// Later phases build on this one.
+					return
+				}
+			}
+		})
+	return results
+}
+
+// RunRevisionParity runs the case against the destination workload of each revision under test in compatibility
+// mode, and fails unless the traffic to every revision produced the same metric series, ignoring the labels that are
+// expected to differ between revisions. The case's PromQueryFormat must be a sum of a selector, whose series are
+// compared. Each revision's traffic is sent with ExpectDelta, so that its series can be told apart from those of the
+// revisions before it; the case's ExpectDelta defaults to 1.
+func RunRevisionParity(tc *TestCase, prometheus prometheus.Instance, mode TrafficPolicy, t *testing.T) {
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			if !ctx.Settings().Compatibility || !ctx.Settings().Revisions.IsMultiVersion() {
+				ctx.Skip("revision parity requires --istio.test.compatibility with multiple revisions")
+			}
+			revisions := make([]string, 0, len(ctx.Settings().Revisions))
+			for rev := range ctx.Settings().Revisions {
+				revisions = append(revisions, rev)
+			}
+			sort.Strings(revisions)
+
+			cases := make([]*TestCase, 0, len(revisions))
+			caseRevisions := map[string]string{}
+			for _, rev := range revisions {
+				c := *tc
+				c.Name = tc.Name + " " + rev
+				caseRevisions[c.Name] = rev
+				c.Expected.Revision = rev
+				if c.ExpectDelta == 0 {
+					c.ExpectDelta = 1
+				}
+				cases = append(cases, &c)
+			}
+			series := map[string][]string{}
+			for _, r := range runExternalRequest(t, ctx, cases, prometheus, mode, RunOptions{collectSeries: true}) {
+				series[caseRevisions[r.Name]] = r.Series
+			}
+			if t.Failed() {
+				// A revision that failed has no series to compare.
+				return
+			}
+			if err := outboundtraffic.CheckRevisionParity(series); err != nil {
+				t.Fatal(err)
+			}
+		})
+}
+
+// querySeries returns the series matched by the selector, which may be none.
+func querySeries(cluster cluster.Cluster, prom prometheus.Instance, selector string) (model.Vector, error) {
+	val, err := prom.Query(cluster, fmt.Sprintf("(%s) or vector(0)", selector))
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := val.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("expected a vector for %q, got %v", selector, val.Type())
+	}
+	return vec, nil
+}
+
+// serverErrorsQuery counts the 5xx responses reported by the source proxy, for NoServerErrors cases.
+const serverErrorsQuery = `sum(istio_requests_total{reporter="source",response_code=~"5.."})`
+
+// revisionCallOptions returns call options targeting a destination pod injected with the expected revision.
+// The request bypasses the destination service, so it is sent to the pod IP on the workload port.
+func revisionCallOptions(t *testing.T, ctx framework.TestContext, dest echo.Instance, tc *TestCase) echo.CallOptions {
+	pods, err := ctx.Clusters().Default().CoreV1().Pods(dest.Config().Namespace.Name()).List(context.TODO(), kubeApiMeta.ListOptions{
+		LabelSelector: fmt.Sprintf("app=%s,istio.io/rev=%s", dest.Config().Service, tc.Expected.Revision),
+	})
+	if err != nil {
+		t.Fatalf("failed to list pods for revision %s: %v", tc.Expected.Revision, err)
+	}
+	podIP := ""
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP != "" {
+			podIP = pod.Status.PodIP
+			break
+		}
+	}
+	if podIP == "" {
+		t.Fatalf("no running %s pod found for revision %s", dest.Config().Service, tc.Expected.Revision)
+	}
+
+	port, err := outboundtraffic.CasePort(dest.Config().Ports, tc)
+	if err != nil {
+		t.Fatalf("%s: %v", dest.Config().Service, err)
+	}
+	return echo.CallOptions{
+		Port: &echo.Port{
+			Name:        port.Name,
+			Protocol:    port.Protocol,
+			ServicePort: port.InstancePort,
+			TLS:         port.TLS,
+		},
+		Address: podIP,
+	}
+}
+
+// destinationAddresses returns the addresses used to reach the destination for the given IP family.
+// An empty address means the destination's cluster-local FQDN is used. The test is skipped if
+// the destination does not have an address of the requested family.
+func destinationAddresses(t *testing.T, ctx framework.TestContext, dest echo.Instance, family IPFamily) []string {
+	if family == "" {
+		return []string{""}
+	}
+	svc, err := ctx.Clusters().Default().CoreV1().Services(dest.Config().Namespace.Name()).
+		Get(context.TODO(), dest.Config().Service, kubeApiMeta.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get service %s: %v", dest.Config().Service, err)
+	}
+	clusterIPs := svc.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && svc.Spec.ClusterIP != "" {
+		clusterIPs = []string{svc.Spec.ClusterIP}
+	}
+
+	var v4, v6 string
+	for _, ip := range clusterIPs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		if parsed.To4() != nil {
+			v4 = ip
+		} else {
+			v6 = ip
+		}
+	}
+
+	switch family {
+	case IPv4:
+		if v4 == "" {
+			t.Skipf("cluster does not support %s: service %s has cluster IPs %v", family, svc.Name, clusterIPs)
+		}
+		return []string{v4}
+	case IPv6:
+		if v6 == "" {
+			t.Skipf("cluster does not support %s: service %s has cluster IPs %v", family, svc.Name, clusterIPs)
+		}
+		return []string{v6}
+	case DualStack:
+		if v4 == "" || v6 == "" {
+			t.Skipf("cluster does not support %s: service %s has cluster IPs %v", family, svc.Name, clusterIPs)
+		}
+		return []string{v4, v6}
+	default:
+		t.Fatalf("unknown IP family %q", family)
+	}
+	return nil
+}
+
+// queries are the evaluated PromQL queries of a case.
+type queries struct {
+	metric string
+	// gateway is the query for the egress gateway's hop, if the case has one.
+	gateway string
+	// connections is the query counting opened connections, for KeepAliveRequests cases.
+	connections string
+	// serverErrors is the query counting 5xx responses, for NoServerErrors cases.
+	serverErrors string
+	// connectionSecurity is the query for the hop whose connection security is checked, scoped to the expected policy.
+	connectionSecurity string
+	// latency is the query for the request duration quantile, for LatencyQuantile cases.
+	latency string
+}
+
+func sendExternalRequest(t *testing.T, ctx framework.TestContext, prometheus prometheus.Instance,
+	client echo.Instance, opts echo.CallOptions, tc *TestCase, q queries, runOpts RunOptions) CaseResult {
+	opts.Headers = map[string][]string{
+		"Host": {tc.Host},
+	}
+	for k, v := range tc.Headers {
+		opts.Headers[k] = []string{v}
+	}
+	opts.HTTP2 = tc.HTTP2
+	opts.Path = tc.Path
+	opts.Check = func(rs echoClient.Responses, err error) error {
+		if tc.Expected.BlockMode != "" {
+			return outboundtraffic.CheckBlockMode(tc.Expected.BlockMode, rs, err)
+		}
+		if tc.Expected.GRPCStatus != "" {
+			if err := outboundtraffic.CheckGRPCStatus(tc.Expected.GRPCStatus, err); err != nil {
+				return err
+			}
+			if outboundtraffic.GRPCStatus(err) != codes.OK {
+				return nil
+			}
+		}
+		// the expected response from a blackhole test case will have err
+		// set; use the length of the expected code to ignore this condition
+		if err != nil && tc.Expected.StatusCode > 0 {
+			return fmt.Errorf("request failed: %v", err)
+		}
+		codeStr := strconv.Itoa(tc.Expected.StatusCode)
+		for i, r := range rs {
+			if codeStr != r.Code {
+				return fmt.Errorf("response[%d] received status code %s, expected %d", i, r.Code, tc.Expected.StatusCode)
+			}
+			for k, v := range tc.Expected.RequestHeaders {
+				if got := r.RequestHeaders.Get(k); got != v {
+					return fmt.Errorf("expected metadata %v=%v, got %q", k, v, got)
+				}
+			}
+			if tc.Expected.UpstreamProtocol != "" && r.Protocol != tc.Expected.UpstreamProtocol {
+				return fmt.Errorf("response[%d] received over %q upstream, expected %q", i, r.Protocol,
+					tc.Expected.UpstreamProtocol)
+			}
+			if tc.Expected.ExpectedSNI != "" && r.SNI != tc.Expected.ExpectedSNI {
+				return fmt.Errorf("response[%d] observed SNI %q, expected %q", i, r.SNI, tc.Expected.ExpectedSNI)
+			}
+			if tc.Expected.Revision != "" && r.IstioRevision != tc.Expected.Revision {
+				return fmt.Errorf("response[%d] served by revision %q, expected %q", i, r.IstioRevision, tc.Expected.Revision)
+			}
+			if err := outboundtraffic.CheckResponseBody(tc.Expected, r); err != nil {
+				return fmt.Errorf("response[%d]: %v", i, err)
+			}
+			if tc.Expected.MaxRetries > 0 {
+				if err := outboundtraffic.CheckRetries(r, tc.Expected.MaxRetries); err != nil {
+					return fmt.Errorf("response[%d]: %v", i, err)
+				}
+			}
+			if err := outboundtraffic.CheckEnvoyHeaders(r, tc.Expected.EnvoyHeaders); err != nil {
+				return fmt.Errorf("response[%d]: %v", i, err)
+			}
+		}
+		if tc.Expected.MinDistinctUpstreams > 0 {
+			return outboundtraffic.CheckDistinctUpstreams(rs, tc.Expected.MinDistinctUpstreams)
+		}
+		return nil
+	}
+	if tc.Expected.MinDistinctUpstreams > 0 {
+		opts.Count = tc.Expected.MinDistinctUpstreams * outboundtraffic.RequestsPerUpstream
+	}
+	if tc.KeepAliveRequests > 0 {
+		return sendKeepAliveRequests(t, ctx, prometheus, client, opts, tc, q, runOpts)
+	}
+	result := CaseResult{Name: tc.Name}
+	var baseline, serverErrorsBaseline float64
+	if q.serverErrors != "" {
+		serverErrorsBaseline, result.Err = settledMetric(ctx.Clusters().Default(), prometheus, q.serverErrors)
+		if result.Err != nil {
+			if !runOpts.CollectOnly {
+				t.Fatal(result.Err)
+			}
+			return result
+		}
+	}
+	if tc.ExpectDelta > 0 {
+		opts.Count = tc.ExpectDelta
+		baseline, result.Err = settledMetric(ctx.Clusters().Default(), prometheus, q.metric)
+		if result.Err != nil {
+			if !runOpts.CollectOnly {
+				t.Fatal(result.Err)
+			}
+			return result
+		}
+	}
+
+	start := time.Now()
+	var rs echoClient.Responses
+	switch {
+	case tc.ExpectDelta > 0:
+		// Retries would send more requests than expected, so the case gets a single attempt.
+		rs, result.Err = client.Call(opts)
+		if result.Err != nil && !runOpts.CollectOnly {
+			t.Fatal(result.Err)
+		}
+	case runOpts.CollectOnly:
+		rs, result.Err = client.CallWithRetry(opts)
+	default:
+		rs = client.CallWithRetryOrFail(t, opts)
+	}
+	result.Latency = time.Since(start)
+	if len(rs) > 0 {
+		result.StatusCode = rs[len(rs)-1].Code
+	}
+	if result.Err != nil || tc.Expected.Metric == "" {
+		return result
+	}
+
+	if tc.ExpectDelta > 0 {
+		result.MetricValue, result.Err = queryMetricDelta(t, ctx.Clusters().Default(), prometheus, q.metric,
+			tc.Expected.Metric, baseline, tc.ExpectDelta)
+	} else {
+		result.MetricValue, result.Err = queryMetric(t, ctx.Clusters().Default(), prometheus, q.metric, tc.Expected.Metric)
+	}
+	if result.Err == nil && q.serverErrors != "" {
+		var got float64
+		got, result.Err = settledMetric(ctx.Clusters().Default(), prometheus, q.serverErrors)
+		if result.Err == nil {
+			result.Err = outboundtraffic.CheckNoServerErrors(serverErrorsBaseline, got)
+		}
+	}
+	if result.Err == nil && q.latency != "" {
+		result.LatencyQuantile, result.Err = queryLatencyQuantile(t, ctx.Clusters().Default(), prometheus, q.latency,
+			*tc.Expected.LatencyQuantile)
+	}
+	if result.Err == nil && q.gateway != "" {
+		result.GatewayMetricValue, result.Err = queryMetric(t, ctx.Clusters().Default(), prometheus, q.gateway,
+			tc.Expected.Metric+" (gateway)")
+		if result.Err != nil {
+			result.Err = fmt.Errorf("egress gateway did not report forwarding the request: %v", result.Err)
+		}
+	}
+	if result.Err == nil && q.connectionSecurity != "" {
+		_, result.Err = queryMetric(t, ctx.Clusters().Default(), prometheus, q.connectionSecurity,
+			fmt.Sprintf("%s (%s)", tc.Expected.Metric, tc.Expected.ConnectionSecurityPolicy))
+		if result.Err != nil {
+			result.Err = fmt.Errorf("hop was not reported with connection_security_policy %q: %v",
+				tc.Expected.ConnectionSecurityPolicy, result.Err)
+		}
+	}
+	if result.Err != nil && !runOpts.CollectOnly {
+		t.Fatal(result.Err)
+	}
+	return result
+}
+
+// sendKeepAliveRequests sends the requests of a KeepAliveRequests case one after another, and checks that the
+// connections opened for them were reused. The MetricValue of the result is the number of connections opened.
+func sendKeepAliveRequests(t *testing.T, ctx framework.TestContext, prom prometheus.Instance,
+	client echo.Instance, opts echo.CallOptions, tc *TestCase, q queries, runOpts RunOptions) CaseResult {
+	result := CaseResult{Name: tc.Name}
+	fail := func(err error) CaseResult {
+		result.Err = err
+		if !runOpts.CollectOnly {
+			t.Fatal(err)
+		}
+		return result
+	}
+	cluster := ctx.Clusters().Default()
+	baseline, err := settledMetric(cluster, prom, q.connections)
+	if err != nil {
+		return fail(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < tc.KeepAliveRequests; i++ {
+		// Retries would open connections of their own, so each request gets a single attempt.
+		rs, err := client.Call(opts)
+		if err != nil {
+			return fail(fmt.Errorf("request %d: %v", i, err))
+		}
+		if len(rs) > 0 {
+			result.StatusCode = rs[len(rs)-1].Code
+		}
+	}
+	result.Latency = time.Since(start)
+
+	// Wait for the connections to be reported before waiting for the count to settle, so that a query that never
+	// matches anything cannot pass.
+	err = retry.UntilSuccess(func() error {
+		got, err := currentMetric(cluster, prom, q.connections)
+		if err != nil {
+			return err
+		}
+		if got <= baseline {
+			return fmt.Errorf("no connections reported yet: got %v, baseline %v", got, baseline)
+		}
+		return nil
+	}, retry.Delay(time.Second), retry.Timeout(2*time.Minute))
+	if err != nil {
+		return fail(err)
+	}
+	got, err := settledMetric(cluster, prom, q.connections)
+	if err != nil {
+		return fail(err)
+	}
+	result.MetricValue = got - baseline
+	t.Logf("%d requests opened %v connections", tc.KeepAliveRequests, result.MetricValue)
+	if err := outboundtraffic.CheckConnectionReuse(result.MetricValue, tc.KeepAliveRequests, tc.Expected.MaxNewConnections); err != nil {
+		return fail(err)
+	}
+	return result
+}
+
+// queryMetric waits until the query reports at least one request, returning the observed value.
+func queryMetric(t *testing.T, cluster cluster.Cluster, prometheus prometheus.Instance, query, metricName string) (float64, error) {
+	var got float64
+	err := retry.UntilSuccess(func() error {
+		var err error
+		got, err = prometheus.QuerySum(cluster, query)
+		t.Logf("%s: %f", metricName, got)
+		if err != nil {
+			return err
+		}
+		if got < 1 {
+			return fmt.Errorf("bad metric value: got %f, want at least 1", got)
+		}
+		return nil
+	}, retry.Delay(time.Second), retry.Timeout(2*time.Minute))
+	return got, err
+}
+
+// queryLatencyQuantile waits for the request duration quantile to be reported, and checks it against the threshold.
+func queryLatencyQuantile(t *testing.T, cluster cluster.Cluster, prom prometheus.Instance, query string,
+	lq LatencyQuantile) (time.Duration, error) {
+	var got float64
+	err := retry.UntilSuccess(func() error {
+		var err error
+		got, err = prom.QuerySum(cluster, query)
+		t.Logf("p%v latency: %fms", lq.Quantile*100, got)
+		if err != nil {
+			return err
+		}
+		// histogram_quantile is NaN while no bucket has increased within the window.
+		if math.IsNaN(got) || math.IsInf(got, 0) {
+			return fmt.Errorf("no request durations in the window yet: %v", got)
+		}
+		return nil
+	}, retry.Delay(time.Second), retry.Timeout(2*time.Minute))
+	if err != nil {
+		return 0, fmt.Errorf("request durations were not reported: %v", err)
+	}
+	latency := time.Duration(got * float64(time.Millisecond))
+	return latency, outboundtraffic.CheckLatencyQuantile(latency, lq)
+}
+
+// currentMetric returns the current value of the query, which is zero if it has no samples yet.
+func currentMetric(cluster cluster.Cluster, prom prometheus.Instance, query string) (float64, error) {
+	val, err := prom.Query(cluster, fmt.Sprintf("(%s) or vector(0)", query))
+	if err != nil {
+		return 0, err
+	}
+	// Sum fails on a zero value, which is the expected value before any traffic.
+	got, _ := prometheus.Sum(val)
+	return got, nil
+}
+
+// settledMetric waits until the query returns the same value on consecutive polls, so that traffic sent before
+// the snapshot, but not yet scraped, is not attributed to the requests that follow.
+func settledMetric(cluster cluster.Cluster, prom prometheus.Instance, query string) (float64, error) {
+	last := -1.0
+	var got float64
+	err := retry.UntilSuccess(func() error {
+		var err error
+		got, err = currentMetric(cluster, prom, query)
+		if err != nil {
+			return err
+		}
+		if got != last {
+			last = got
+			return fmt.Errorf("metric not settled: %v", got)
+		}
+		return nil
+	}, retry.Delay(5*time.Second), retry.Timeout(2*time.Minute))
+	return got, err
+}
+
+// queryMetricDelta waits until the query has increased by exactly want from the baseline, returning the observed
+// increase.
+func queryMetricDelta(t *testing.T, cluster cluster.Cluster, prom prometheus.Instance, query, metricName string,
+	baseline float64, want int) (float64, error) {
+	var got float64
+	err := retry.UntilSuccess(func() error {
+		var err error
+		got, err = currentMetric(cluster, prom, query)
+		t.Logf("%s: %f (baseline %f)", metricName, got, baseline)
+		if err != nil {
+			return err
+		}
+		return outboundtraffic.CheckDelta(baseline, got, want)
+	}, retry.Delay(time.Second), retry.Timeout(2*time.Minute))
+	return got - baseline, err
+}
+
+func setupEcho(t *testing.T, ctx resource.Context, mode TrafficPolicy) (echo.Instance, echo.Instance, namespace.Instance) {
 	appsNamespace := namespace.NewOrFail(t, ctx, namespace.Config{
 		Prefix: "app",
 		Inject: true,
@@ -306,11 +1264,18 @@ func setupEcho(t *testing.T, ctx resource.Context, mode TrafficPolicy) (echo.Ins
 			Service:   "client",
 			Namespace: appsNamespace,
 			Subsets:   []echo.SubsetConfig{{}},
+			Locality:  ClientLocality,
 		}).
 		With(&dest, echo.Config{
 			Service:   "destination",
 			Namespace: appsNamespace,
-			Subsets:   []echo.SubsetConfig{{Annotations: echo.NewAnnotations().SetBool(echo.SidecarInject, false)}},
+			// Two replicas, so that cases can check that requests are spread over them
+			Subsets: []echo.SubsetConfig{
+				{Annotations: echo.NewAnnotations().SetBool(echo.SidecarInject, false)},
+				{Version: "v2", Annotations: echo.NewAnnotations().SetBool(echo.SidecarInject, false)},
+			},
+			// Expose every IP family supported by the cluster, so cases can select one explicitly
+			IPFamilyPolicy: "PreferDualStack",
 			Ports: []echo.Port{
 				{
 					// Plain HTTP port, will match no listeners and fall through
@@ -346,6 +1311,13 @@ func setupEcho(t *testing.T, ctx resource.Context, mode TrafficPolicy) (echo.Ins
 					Protocol:    protocol.TCP,
 					ServicePort: 9091,
 				},
+				{
+					// gRPC port, will match no listeners and fall through
+					Name:         "grpc",
+					Protocol:     protocol.GRPC,
+					ServicePort:  7070,
+					InstancePort: 7070,
+				},
 			},
 			TLSSettings: &common.TLSSettings{
 				// Echo has these test certs baked into the docker image
@@ -354,12 +1326,12 @@ func setupEcho(t *testing.T, ctx resource.Context, mode TrafficPolicy) (echo.Ins
 			},
 		}).BuildOrFail(t)
 
-	if err := ctx.ConfigIstio().ApplyYAML(serviceNamespace.Name(), ServiceEntry); err != nil {
+	if err := ctx.ConfigIstio().ApplyYAML(serviceNamespace.Name(), ServiceEntry, WildcardServiceEntry); err != nil {
 		t.Errorf("failed to apply service entries: %v", err)
 	}
 
 	if _, isKube := ctx.Environment().(*kube.Environment); isKube {
 		createGateway(t, ctx, appsNamespace, serviceNamespace)
 	}
-	return client, dest
+	return client, dest, serviceNamespace
 }
@@ -19,7 +19,14 @@ package outboundtrafficpolicy
 
 import (
 	"net/http"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
+
+	"istio.io/istio/pkg/test/framework"
+	"istio.io/istio/pkg/test/framework/components/prometheus"
+	"istio.io/istio/tests/common/outboundtraffic"
 )
 
 func TestOutboundTrafficPolicy_AllowAny(t *testing.T) {
@@ -32,6 +39,55 @@ func TestOutboundTrafficPolicy_AllowAny(t *testing.T) {
 				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
 				StatusCode:      http.StatusOK,
 				Protocol:        "HTTP/1.1",
+				SourceWorkload:  "client-v1",
+				SourceApp:       "client",
+			},
+		},
+		{
+			// Passthrough adds no hop of its own, so requests to the echo server should stay well under a second
+			Name:     "HTTP Traffic Latency",
+			PortName: "http",
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+				SourceWorkload:  "client-v1",
+				Cluster:         "PassthroughCluster",
+				LatencyQuantile: &LatencyQuantile{Quantile: 0.99, Threshold: time.Second},
+			},
+		},
+		{
+			// Selects the plain HTTP port by number rather than by name
+			Name: "HTTP Traffic Numeric Port",
+			Port: 80,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+			},
+		},
+		{
+			Name:     "HTTP Traffic Load Balanced",
+			PortName: "http",
+			Expected: Expected{
+				StatusCode: http.StatusOK,
+				Protocol:   "HTTP/1.1",
+				// The destination has a v1 and a v2 replica
+				MinDistinctUpstreams: 2,
+			},
+		},
+		{
+			Name:     "HTTP Traffic Payload Passthrough",
+			PortName: "http",
+			Path:     "/outbound-payload-check?marker=passthrough",
+			Expected: Expected{
+				StatusCode: http.StatusOK,
+				Protocol:   "HTTP/1.1",
+				// The destination echoes the request URL; it must arrive as sent.
+				ResponseBodyContains: "URL=/outbound-payload-check?marker=passthrough",
+				ResponseBodyRegex:    `(?m)^Method=GET$`,
 			},
 		},
 		{
@@ -55,6 +111,19 @@ func TestOutboundTrafficPolicy_AllowAny(t *testing.T) {
 				Protocol:        "HTTP/1.1",
 			},
 		},
+		{
+			Name:     "HTTPS Traffic SNI Passthrough",
+			PortName: "https",
+			Host:     "some-external-site.com",
+			Expected: Expected{
+				Metric:          "istio_tcp_connections_opened_total",
+				PromQueryFormat: `sum(istio_tcp_connections_opened_total{reporter="source",destination_service_name="PassthroughCluster"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+				// The sidecar must forward the client's SNI untouched
+				ExpectedSNI: "some-external-site.com",
+			},
+		},
 		{
 			Name:     "HTTPS Traffic Conflict",
 			PortName: "https-conflict",
@@ -88,14 +157,57 @@ func TestOutboundTrafficPolicy_AllowAny(t *testing.T) {
 			},
 		},
 		{
-			Name:     "HTTP Traffic Egress",
-			PortName: "http",
-			Host:     "some-external-site.com",
+			Name:                  "HTTP Traffic Egress",
+			PortName:              "http",
+			Host:                  "some-external-site.com",
+			RequiresEgressGateway: true,
 			Expected: Expected{
 				Metric:          "istio_requests_total",
-				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="istio-egressgateway",response_code="200"})`, // nolint: lll
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				// The app label of the gateway pods is not the name of the gateway service for every gateway class
+				DestinationApp: "{{.EgressGatewayApp}}",
+				StatusCode:     http.StatusOK,
+				Protocol:       "HTTP/1.1",
+				RequestHeaders: map[string]string{
+					// We inject this header in the VirtualService
+					"Handled-By-Egress-Gateway": "true",
+				},
+			},
+		},
+		{
+			Name:                  "HTTP Traffic Egress Forwarded Headers",
+			PortName:              "http",
+			Host:                  "some-external-site.com",
+			RequiresEgressGateway: true,
+			Headers: map[string]string{
+				InternalHeader: "test-user",
+			},
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
 				StatusCode:      http.StatusOK,
 				Protocol:        "HTTP/1.1",
+				EnvoyHeaders: map[string]bool{
+					// The gateway records the client it received the request from
+					"X-Forwarded-For": true,
+					// We strip this header in the VirtualService
+					InternalHeader: false,
+				},
+			},
+		},
+		{
+			Name:                  "HTTP Traffic Egress Gateway Hop",
+			PortName:              "http",
+			Host:                  "some-external-site.com",
+			RequiresEgressGateway: true,
+			Expected: Expected{
+				Metric: "istio_requests_total",
+				// The client's hop, attributed to the gateway service by the client's sidecar
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				// The gateway's hop, reported by the gateway itself as it forwards to the external service
+				GatewayPromQueryFormat: `sum(istio_requests_total{reporter="source",source_workload="{{.EgressGatewayWorkload}}",destination_service_name="some-external-site.com",response_code="200"})`, // nolint: lll
+				StatusCode:             http.StatusOK,
+				Protocol:               "HTTP/1.1",
 				RequestHeaders: map[string]string{
 					// We inject this header in the VirtualService
 					"Handled-By-Egress-Gateway": "true",
@@ -103,22 +215,187 @@ func TestOutboundTrafficPolicy_AllowAny(t *testing.T) {
 			},
 		},
 		{
-			Name:     "HTTP H2 Traffic Egress",
-			PortName: "http",
-			HTTP2:    true,
-			Host:     "some-external-site.com",
+			// The same case for every external site routed through the gateway, each asserted on its own metrics
+			Name:                  "HTTP Traffic Egress Gateway Hop Per Host",
+			PortName:              "http",
+			Hosts:                 []string{"some-external-site.com", "some-external-site-tls.com"},
+			RequiresEgressGateway: true,
+			DestinationRuleYAML:   TLSOriginationDestinationRule,
+			Expected: Expected{
+				Metric: "istio_requests_total",
+				// The client's hop, attributed to the gateway service for every host
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				// The gateway's hop, attributed to the host the request was for
+				GatewayPromQueryFormat: `sum(istio_requests_total{reporter="source",source_workload="{{.EgressGatewayWorkload}}",destination_service_name="{{.Host}}",response_code="200"})`, // nolint: lll
+				StatusCode:             http.StatusOK,
+				Protocol:               "HTTP/1.1",
+				RequestHeaders: map[string]string{
+					// We inject this header in the VirtualService
+					"Handled-By-Egress-Gateway": "true",
+				},
+			},
+		},
+		{
+			Name:                       "HTTP Traffic Egress Gateway Same Zone",
+			PortName:                   "http",
+			Host:                       "some-external-site.com",
+			RequiresEgressGateway:      true,
+			RequiresZonalEgressGateway: true,
+			DestinationRuleYAML:        LocalEgressGatewayDestinationRule,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				// Locality load balancing picks the gateway replica of the client's zone
+				SourceLocality:      "{{.ClientLocality}}",
+				DestinationLocality: "{{.ClientLocality}}",
+				StatusCode:          http.StatusOK,
+				Protocol:            "HTTP/1.1",
+			},
+		},
+		{
+			Name:                       "HTTP Traffic Egress Gateway Zone Failover",
+			PortName:                   "http",
+			Host:                       "some-external-site.com",
+			RequiresEgressGateway:      true,
+			RequiresZonalEgressGateway: true,
+			DestinationRuleYAML:        FailoverEgressGatewayDestinationRule,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				// The traffic of the client's zone is served by the gateway replica of the failover zone
+				SourceLocality:      "{{.ClientLocality}}",
+				DestinationLocality: "{{.FailoverLocality}}",
+				StatusCode:          http.StatusOK,
+				Protocol:            "HTTP/1.1",
+			},
+		},
+		{
+			Name:                  "HTTP Traffic Egress mTLS to Gateway",
+			PortName:              "http",
+			Host:                  "some-external-site.com",
+			RequiresEgressGateway: true,
 			Expected: Expected{
 				Metric:          "istio_requests_total",
-				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="istio-egressgateway",response_code="200"})`, // nolint: lll
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				// The client's sidecar reaches the gateway over auto mTLS, as the gateway receiving the hop reports
+				ConnectionSecurityPolicy:          MutualTLS,
+				ConnectionSecurityPromQueryFormat: `sum(istio_requests_total{reporter="destination",destination_workload="{{.EgressGatewayWorkload}}",source_workload="client-v1"})`, // nolint: lll
+				StatusCode:                        http.StatusOK,
+				Protocol:                          "HTTP/1.1",
+			},
+		},
+		{
+			Name:                  "HTTP H2 Traffic Egress",
+			PortName:              "http",
+			HTTP2:                 true,
+			Host:                  "some-external-site.com",
+			RequiresEgressGateway: true,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
 				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/2.0",
 				// Even though we send h2 to the gateway, the gateway should send h1, as configured by the ServiceEntry
-				Protocol: "HTTP/1.1",
+				UpstreamProtocol: "HTTP/1.1",
 				RequestHeaders: map[string]string{
 					// We inject this header in the VirtualService
 					"Handled-By-Egress-Gateway": "true",
 				},
 			},
 		},
+		{
+			Name:                  "HTTP H2 Traffic Egress TLS Origination",
+			PortName:              "http",
+			HTTP2:                 true,
+			Host:                  "some-external-site-tls.com",
+			RequiresEgressGateway: true,
+			DestinationRuleYAML:   TLSOriginationDestinationRule,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="{{.EgressGatewayService}}",response_code="200"})`, // nolint: lll
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/2.0",
+				// The gateway originates TLS to the destination over HTTP/1.1
+				UpstreamProtocol: "HTTP/1.1",
+				RequestHeaders: map[string]string{
+					// We inject this header in the VirtualService
+					"Handled-By-Egress-Gateway": "true",
+				},
+			},
+		},
+		{
+			Name:     "HTTP Traffic Wildcard ServiceEntry",
+			PortName: "http",
+			Host:     "foo.example.com",
+			Expected: Expected{
+				Metric:                      "istio_requests_total",
+				PromQueryFormat:             `sum(istio_requests_total{reporter="source",destination_service_name="*.example.com",response_code="200"})`,
+				DestinationServiceNamespace: "{{.ServiceNamespace}}",
+				StatusCode:                  http.StatusOK,
+				Protocol:                    "HTTP/1.1",
+			},
+		},
+		{
+			// The host also resolves to the destination, so PassthroughCluster would serve it just as well; assert that
+			// the ServiceEntry's cluster was chosen instead.
+			Name:        "HTTP Traffic Wildcard ServiceEntry Not Passthrough",
+			PortName:    "http",
+			Host:        "bar.example.com",
+			ExpectDelta: 3,
+			Expected: Expected{
+				Metric:                      "istio_requests_total",
+				PromQueryFormat:             `sum(istio_requests_total{reporter="source",response_code="200"})`,
+				DestinationServiceNamespace: "{{.ServiceNamespace}}",
+				Cluster:                     "!" + PassthroughCluster,
+				SourceWorkload:              "client-v1",
+				StatusCode:                  http.StatusOK,
+				Protocol:                    "HTTP/1.1",
+			},
+		},
+		{
+			Name:     "HTTP Traffic Wildcard ServiceEntry Mismatch",
+			PortName: "http",
+			Host:     "foo.example.org",
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+			},
+		},
+		{
+			Name:     "HTTP IPv6 Traffic",
+			PortName: "http",
+			IPFamily: IPv6,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+			},
+		},
+		{
+			Name:     "HTTP Dual Stack Traffic",
+			PortName: "http",
+			IPFamily: DualStack,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+			},
+		},
+		{
+			Name:     "HTTPS IPv6 Traffic",
+			PortName: "https",
+			IPFamily: IPv6,
+			Expected: Expected{
+				Metric:          "istio_tcp_connections_opened_total",
+				PromQueryFormat: `sum(istio_tcp_connections_opened_total{reporter="source",destination_service_name="PassthroughCluster"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+			},
+		},
 		// TODO add HTTPS through gateway
 		{
 			Name:     "TCP",
@@ -142,7 +419,323 @@ func TestOutboundTrafficPolicy_AllowAny(t *testing.T) {
 				Protocol:   "TCP",
 			},
 		},
+		{
+			Name:     "gRPC Traffic",
+			PortName: "grpc",
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",request_protocol="grpc",grpc_response_status="0"})`,
+				StatusCode:      http.StatusOK,
+				Protocol:        "GRPC",
+				GRPCStatus:      "OK",
+			},
+		},
+		{
+			// The ServiceEntry is only needed by this case, so it is applied and removed around it.
+			Name:     "HTTP Traffic Case ServiceEntry",
+			PortName: "http",
+			Host:     "removable.example.net",
+			Setup: func(t *testing.T, ctx framework.TestContext, serviceNamespace string) func() {
+				ctx.ConfigIstio().ApplyYAMLOrFail(t, serviceNamespace, removableServiceEntry)
+				return func() {
+					ctx.ConfigIstio().DeleteYAMLOrFail(t, serviceNamespace, removableServiceEntry)
+				}
+			},
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",source_workload_namespace="{{.AppNamespace}}",response_code="200"})`,
+				Cluster:         "removable.example.net",
+				StatusCode:      http.StatusOK,
+				Protocol:        "HTTP/1.1",
+				RequestHeaders:  map[string]string{"Handled-By-Service-Entry": "true"},
+			},
+		},
 	}
 
 	RunExternalRequest(cases, prom, AllowAny, t)
 }
+
+// TestOutboundTrafficPolicy_AllowAny_Revisions verifies that, in compatibility mode, passthrough traffic
+// reaches the destination workload of each revision under test.
+func TestOutboundTrafficPolicy_AllowAny_Revisions(t *testing.T) {
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			if !ctx.Settings().Compatibility || !ctx.Settings().Revisions.IsMultiVersion() {
+				ctx.Skip("per-revision assertions require --istio.test.compatibility with multiple revisions")
+			}
+			revisions := make([]string, 0, len(ctx.Settings().Revisions))
+			for rev := range ctx.Settings().Revisions {
+				revisions = append(revisions, rev)
+			}
+			sort.Strings(revisions)
+
+			cases := make([]*TestCase, 0, len(revisions))
+			for _, rev := range revisions {
+				cases = append(cases, &TestCase{
+					Name:     "HTTP Traffic " + rev,
+					PortName: "http",
+					Expected: Expected{
+						StatusCode: http.StatusOK,
+						Protocol:   "HTTP/1.1",
+						Revision:   rev,
+					},
+				})
+			}
+			runExternalRequest(t, ctx, cases, prom, AllowAny, RunOptions{})
+		})
+}
+
+// TestOutboundTrafficPolicy_AllowAny_RevisionParity verifies that, in compatibility mode, passthrough traffic to
+// each revision under test is reported with the same metric attributes.
+func TestOutboundTrafficPolicy_AllowAny_RevisionParity(t *testing.T) {
+	RunRevisionParity(&TestCase{
+		Name:     "HTTP Traffic",
+		PortName: "http",
+		Expected: Expected{
+			Metric:          "istio_requests_total",
+			PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster"})`,
+			SourceWorkload:  "client-v1",
+			StatusCode:      http.StatusOK,
+			Protocol:        "HTTP/1.1",
+		},
+	}, prom, AllowAny, t)
+}
+
+// TestOutboundTrafficPolicy_AllowAny_Results verifies that cases can be run without failing inline, and their
+// outcomes inspected afterwards.
+func TestOutboundTrafficPolicy_AllowAny_Results(t *testing.T) {
+	cases := []*TestCase{
+		{
+			Name:     "HTTP Traffic",
+			PortName: "http",
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`,
+				StatusCode:      http.StatusOK,
+				SourceWorkload:  "client-v1",
+				SourceApp:       "client",
+			},
+		},
+		{
+			Name:     "HTTPS Traffic",
+			PortName: "https",
+			Expected: Expected{
+				StatusCode: http.StatusOK,
+			},
+		},
+	}
+
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			results := runExternalRequest(t, ctx, cases, prom, AllowAny, RunOptions{CollectOnly: true})
+			successes := 0
+			for _, r := range results {
+				if r.Success() {
+					successes++
+				} else {
+					t.Logf("case %q failed after %v: %v", r.Name, r.Latency, r.Err)
+				}
+			}
+			if successes != len(cases) {
+				t.Fatalf("expected all %d cases to succeed, got %d successes in %+v", len(cases), successes, results)
+			}
+			if results[0].MetricValue < 1 {
+				t.Errorf("expected the observed metric value to be recorded, got %v", results[0].MetricValue)
+			}
+
+			// The same query scoped to a different client must not count the client's traffic.
+			query := outboundtraffic.WithLabelMatchers(cases[0].Expected.PromQueryFormat, `source_workload="other-client-v1"`, `source_app="other-client"`)
+			val, err := prom.Query(ctx.Clusters().Default(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := prometheus.Sum(val); err == nil && got > 0 {
+				t.Errorf("expected no traffic from other clients, got %v for %s", got, query)
+			}
+		})
+}
+
+// TestOutboundTrafficPolicy_AllowAny_KeepAlive verifies that sequential requests to an external destination
+// reuse the sidecar's connections to it, rather than opening one per request.
+func TestOutboundTrafficPolicy_AllowAny_KeepAlive(t *testing.T) {
+	cases := []*TestCase{
+		{
+			Name:              "HTTP Traffic Keep Alive",
+			PortName:          "http",
+			KeepAliveRequests: 10,
+			Expected: Expected{
+				StatusCode: http.StatusOK,
+				ConnectionsPromQueryFormat: `sum(istio_tcp_connections_opened_total{reporter="source",` +
+					`destination_service_name="PassthroughCluster",source_workload="client-v1"})`,
+				MaxNewConnections: 2,
+			},
+		},
+	}
+
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			runExternalRequest(t, ctx, cases, prom, AllowAny, RunOptions{})
+		})
+}
+
+// TestOutboundTrafficPolicy_AllowAny_Delta verifies that consecutive cases against the same metric are each
+// credited with only the requests they sent.
+func TestOutboundTrafficPolicy_AllowAny_Delta(t *testing.T) {
+	query := `sum(istio_requests_total{reporter="source",destination_service_name="PassthroughCluster",response_code="200"})`
+	cases := []*TestCase{
+		{
+			Name:        "HTTP Traffic First",
+			PortName:    "http",
+			ExpectDelta: 5,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: query,
+				StatusCode:      http.StatusOK,
+				SourceWorkload:  "client-v1",
+				SourceApp:       "client",
+			},
+		},
+		{
+			Name:        "HTTP Traffic Second",
+			PortName:    "http",
+			ExpectDelta: 3,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: query,
+				StatusCode:      http.StatusOK,
+				SourceWorkload:  "client-v1",
+				SourceApp:       "client",
+			},
+		},
+	}
+
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			results := runExternalRequest(t, ctx, cases, prom, AllowAny, RunOptions{})
+			if len(results) != 2 {
+				t.Fatalf("expected 2 results, got %+v", results)
+			}
+			if results[0].MetricValue != 5 || results[1].MetricValue != 3 {
+				t.Errorf("expected deltas of 5 and 3, got %v and %v", results[0].MetricValue, results[1].MetricValue)
+			}
+		})
+}
+
+// TestOutboundTrafficPolicy_AllowAny_NoServerErrors verifies that NoServerErrors fails a case whose requests
+// intermittently fail, even though retrying them eventually succeeds.
+func TestOutboundTrafficPolicy_AllowAny_NoServerErrors(t *testing.T) {
+	cases := []*TestCase{
+		{
+			Name:     "HTTP Traffic Flaky Wildcard ServiceEntry",
+			PortName: "http",
+			Host:     "flaky.example.com",
+			VirtualServiceYAML: `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: flaky-example-com
+spec:
+  hosts:
+  - flaky.example.com
+  http:
+  - fault:
+      abort:
+        httpStatus: 503
+        percentage:
+          value: 50
+    route:
+    - destination:
+        host: "*.example.com"
+`,
+			Expected: Expected{
+				Metric:                      "istio_requests_total",
+				PromQueryFormat:             `sum(istio_requests_total{reporter="source",destination_service_name="*.example.com",response_code="200"})`,
+				DestinationServiceNamespace: "{{.ServiceNamespace}}",
+				SourceWorkload:              "client-v1",
+				StatusCode:                  http.StatusOK,
+				NoServerErrors:              true,
+			},
+		},
+	}
+
+	framework.
+		NewTest(t).
+		Run(func(ctx framework.TestContext) {
+			results := runExternalRequest(t, ctx, cases, prom, AllowAny, RunOptions{CollectOnly: true})
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %+v", results)
+			}
+			if results[0].StatusCode != strconv.Itoa(http.StatusOK) {
+				t.Fatalf("expected a retried request to succeed, got status %q: %v", results[0].StatusCode, results[0].Err)
+			}
+			if results[0].Err == nil {
+				t.Fatal("expected the injected 503s to fail the case")
+			}
+			t.Logf("case failed as expected: %v", results[0].Err)
+		})
+}
+
+// TestOutboundTrafficPolicy_AllowAny_RetryBudget verifies that a flaky external destination is recovered by the
+// retry policy within its budget of retries.
+func TestOutboundTrafficPolicy_AllowAny_RetryBudget(t *testing.T) {
+	cases := []*TestCase{
+		{
+			Name:     "HTTP Traffic Retried Wildcard ServiceEntry",
+			PortName: "http",
+			Host:     "retried.example.com",
+			// The destination fails half of the requests.
+			Path: "/?codes=503:1,200:1",
+			VirtualServiceYAML: `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: retried-example-com
+spec:
+  hosts:
+  - retried.example.com
+  http:
+  - retries:
+      attempts: 3
+      retryOn: 5xx
+    route:
+    - destination:
+        host: "*.example.com"
+`,
+			Expected: Expected{
+				Metric:                      "istio_requests_total",
+				PromQueryFormat:             `sum(istio_requests_total{reporter="source",destination_service_name="*.example.com",response_code="200"})`,
+				DestinationServiceNamespace: "{{.ServiceNamespace}}",
+				SourceWorkload:              "client-v1",
+				StatusCode:                  http.StatusOK,
+				MaxRetries:                  3,
+			},
+		},
+	}
+
+	RunExternalRequest(cases, prom, AllowAny, t)
+}
+
+// TestOutboundTrafficPolicy_AllowAny_ServiceEntryRemoved verifies that traffic to an external host falls through to
+// PassthroughCluster once its ServiceEntry is removed.
+func TestOutboundTrafficPolicy_AllowAny_ServiceEntryRemoved(t *testing.T) {
+	tc := &TestCase{
+		Name:     "HTTP Traffic",
+		PortName: "http",
+		Host:     "removable.example.net",
+	}
+	results := RunPhases(tc, removedServiceEntryPhases(Expected{
+		Metric:          "istio_requests_total",
+		PromQueryFormat: `sum(istio_requests_total{reporter="source",source_workload_namespace="{{.AppNamespace}}",response_code="200"})`,
+		Cluster:         PassthroughCluster,
+		StatusCode:      http.StatusOK,
+		// Retried until the VirtualService no longer marks the request.
+		RequestHeaders: map[string]string{"Handled-By-Service-Entry": ""},
+	}), prom, AllowAny, t)
+	if len(results) != 2 {
+		t.Fatalf("expected a result per phase, got %+v", results)
+	}
+}
@@ -30,7 +30,7 @@ func TestOutboundTrafficPolicy_RegistryOnly(t *testing.T) {
 			Expected: Expected{
 				Metric:          "istio_requests_total",
 				PromQueryFormat: `sum(istio_requests_total{destination_service_name="BlackHoleCluster",response_code="502"})`,
-				StatusCode:      http.StatusBadGateway,
+				BlockMode:       BlockHTTP502,
 			},
 		},
 		{
@@ -39,6 +39,8 @@ func TestOutboundTrafficPolicy_RegistryOnly(t *testing.T) {
 			Expected: Expected{
 				Metric:          "istio_tcp_connections_closed_total",
 				PromQueryFormat: `sum(istio_tcp_connections_closed_total{destination_service_name="BlackHoleCluster"})`,
+				// The connection is dropped mid-handshake; depending on timing this is seen as a reset or a TLS error.
+				BlockMode: BlockAny,
 			},
 		},
 		{
@@ -47,15 +49,18 @@ func TestOutboundTrafficPolicy_RegistryOnly(t *testing.T) {
 			Expected: Expected{
 				Metric:          "istio_tcp_connections_closed_total",
 				PromQueryFormat: `sum(istio_tcp_connections_closed_total{destination_service_name="BlackHoleCluster"})`,
+				// The HTTP listener on the conflicting port does not speak TLS.
+				BlockMode: BlockTLSError,
 			},
 		},
 		{
-			Name:     "HTTP Traffic Egress",
-			PortName: "http",
-			Host:     "some-external-site.com",
+			Name:                  "HTTP Traffic Egress",
+			PortName:              "http",
+			Host:                  "some-external-site.com",
+			RequiresEgressGateway: true,
 			Expected: Expected{
 				Metric:          "istio_requests_total",
-				PromQueryFormat: `sum(istio_requests_total{destination_service_name="istio-egressgateway",response_code="200"})`,
+				PromQueryFormat: `sum(istio_requests_total{destination_service_name="{{.EgressGatewayService}}",response_code="200"})`,
 				StatusCode:      http.StatusOK,
 				RequestHeaders: map[string]string{
 					// We inject this header in the VirtualService
@@ -63,6 +68,47 @@ func TestOutboundTrafficPolicy_RegistryOnly(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:     "HTTP Traffic Wildcard ServiceEntry",
+			PortName: "http",
+			Host:     "foo.example.com",
+			Expected: Expected{
+				Metric:                      "istio_requests_total",
+				PromQueryFormat:             `sum(istio_requests_total{destination_service_name="*.example.com",response_code="200"})`,
+				DestinationServiceNamespace: "{{.ServiceNamespace}}",
+				StatusCode:                  http.StatusOK,
+			},
+		},
+		{
+			Name:     "HTTP Traffic Wildcard ServiceEntry Mismatch",
+			PortName: "http",
+			Host:     "foo.example.org",
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{destination_service_name="BlackHoleCluster",response_code="502"})`,
+				StatusCode:      http.StatusBadGateway,
+			},
+		},
+		{
+			Name:     "HTTP IPv6 Traffic",
+			PortName: "http",
+			IPFamily: IPv6,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{destination_service_name="BlackHoleCluster",response_code="502"})`,
+				StatusCode:      http.StatusBadGateway,
+			},
+		},
+		{
+			Name:     "HTTP Dual Stack Traffic",
+			PortName: "http",
+			IPFamily: DualStack,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{destination_service_name="BlackHoleCluster",response_code="502"})`,
+				StatusCode:      http.StatusBadGateway,
+			},
+		},
 		// TODO add HTTPS through gateway
 		{
 			Name:     "TCP",
@@ -70,6 +116,7 @@ func TestOutboundTrafficPolicy_RegistryOnly(t *testing.T) {
 			Expected: Expected{
 				Metric:          "istio_tcp_connections_closed_total",
 				PromQueryFormat: `sum(istio_tcp_connections_closed_total{reporter="source",destination_service_name="BlackHoleCluster",source_workload="client-v1"})`,
+				BlockMode:       BlockReset,
 			},
 		},
 		{
@@ -80,8 +127,37 @@ func TestOutboundTrafficPolicy_RegistryOnly(t *testing.T) {
 				PromQueryFormat: `sum(istio_tcp_connections_closed_total{reporter="source",destination_service_name="BlackHoleCluster",source_workload="client-v1"})`,
 			},
 		},
+		{
+			Name:     "gRPC Traffic",
+			PortName: "grpc",
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{destination_service_name="BlackHoleCluster",request_protocol="grpc"})`,
+				// The BlackHoleCluster 502 reaches the client as a gRPC status, not as a transport failure.
+				GRPCStatus: "UNAVAILABLE",
+			},
+		},
 	}
 
 	// destination_service="BlackHoleCluster" does not get filled in when using sidecar scoping
 	RunExternalRequest(cases, prom, RegistryOnly, t)
 }
+
+// TestOutboundTrafficPolicy_RegistryOnly_ServiceEntryRemoved verifies that traffic to an external host is blocked
+// once its ServiceEntry is removed.
+func TestOutboundTrafficPolicy_RegistryOnly_ServiceEntryRemoved(t *testing.T) {
+	tc := &TestCase{
+		Name:     "HTTP Traffic",
+		PortName: "http",
+		Host:     "removable.example.net",
+	}
+	results := RunPhases(tc, removedServiceEntryPhases(Expected{
+		Metric:          "istio_requests_total",
+		PromQueryFormat: `sum(istio_requests_total{reporter="source",source_workload_namespace="{{.AppNamespace}}",response_code="502"})`,
+		Cluster:         BlackHoleCluster,
+		BlockMode:       BlockHTTP502,
+	}), prom, RegistryOnly, t)
+	if len(results) != 2 {
+		t.Fatalf("expected a result per phase, got %+v", results)
+	}
+}
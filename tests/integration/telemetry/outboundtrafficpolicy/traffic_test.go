@@ -18,6 +18,7 @@
 package outboundtrafficpolicy
 
 import (
+	"net/http"
 	"testing"
 
 	"istio.io/istio/pkg/test/framework"
@@ -29,6 +30,63 @@ import (
 
 var prom prometheus.Instance
 
+// removableServiceEntry routes removable.example.net through a ServiceEntry, for cases that remove it. The
+// VirtualService marks the requests it routes, so the client can tell when the removal has propagated.
+const removableServiceEntry = `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: removable
+spec:
+  hosts:
+  - removable.example.net
+  location: MESH_EXTERNAL
+  ports:
+  - name: http
+    number: 80
+    protocol: HTTP
+  resolution: NONE
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: removable
+spec:
+  hosts:
+  - removable.example.net
+  http:
+  - headers:
+      request:
+        add:
+          handled-by-service-entry: "true"
+    route:
+    - destination:
+        host: removable.example.net
+`
+
+// removedServiceEntryPhases are the phases of a case sending traffic to removable.example.net: first through its
+// ServiceEntry, then once it is removed, as the traffic policy handles unknown hosts.
+func removedServiceEntryPhases(removed Expected) []Phase {
+	return []Phase{
+		{
+			Name:      "ServiceEntry",
+			ApplyYAML: removableServiceEntry,
+			Expected: Expected{
+				Metric:          "istio_requests_total",
+				PromQueryFormat: `sum(istio_requests_total{reporter="source",source_workload_namespace="{{.AppNamespace}}",response_code="200"})`,
+				Cluster:         "removable.example.net",
+				StatusCode:      http.StatusOK,
+				RequestHeaders:  map[string]string{"Handled-By-Service-Entry": "true"},
+			},
+		},
+		{
+			Name:       "Removed",
+			DeleteYAML: removableServiceEntry,
+			Expected:   removed,
+		},
+	}
+}
+
 func TestMain(m *testing.M) {
 	var ist istio.Instance
 	// nolint: staticcheck
@@ -36,6 +94,7 @@ func TestMain(m *testing.M) {
 		RequireSingleCluster().
 		Label(label.CustomSetup).
 		Setup(istio.Setup(&ist, nil)).
+		Setup(setupPeerAuthentication).
 		Setup(setupPrometheus).
 		Run()
 }